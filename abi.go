@@ -0,0 +1,383 @@
+package elf_reader
+
+// This file contains code for recording the ABI of a shared library, and for
+// checking whether two versions of a shared library are compatible.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Holds a single symbol exported by a shared library.
+type ABISymbol struct {
+	Name string
+	// The symbol's version, or an empty string if it's unversioned.
+	Version string `json:",omitempty"`
+	// True if this isn't the default version of the symbol, i.e. it's only
+	// used when explicitly requested by version, like "name@VERSION" rather
+	// than "name@@VERSION".
+	HiddenVersion bool `json:",omitempty"`
+	// One of "function", "object", "TLS", "indirect function", etc.
+	Type string
+	// Either "global", "weak" or "unique".
+	Binding string
+	// Either "default" or "protected".
+	Visibility string
+	Size       uint64
+}
+
+// Returns the name and version of the symbol, in the same format used by
+// tools such as nm.
+func (s *ABISymbol) VersionedName() string {
+	if s.Version == "" {
+		return s.Name
+	}
+	if s.HiddenVersion {
+		return s.Name + "@" + s.Version
+	}
+	return s.Name + "@@" + s.Version
+}
+
+func (s *ABISymbol) String() string {
+	return fmt.Sprintf("%s (%s %s, %s visibility, %d bytes)",
+		s.VersionedName(), s.Binding, s.Type, s.Visibility, s.Size)
+}
+
+// Holds a summary of the parts of a shared library that other programs can
+// depend on. Snapshots can be encoded as JSON, so they can be stored and
+// compared against future builds of the library.
+type ABISnapshot struct {
+	SOName string `json:",omitempty"`
+	// The names of the versions defined by the library, not including the
+	// base version, which is named after the library itself.
+	Versions []string `json:",omitempty"`
+	// The exported symbols, sorted by name and version.
+	Symbols []ABISymbol
+}
+
+// Returns a name for a symbol type in a symbol's info field.
+func symbolTypeName(t uint8) string {
+	switch t {
+	case 0:
+		return "no type"
+	case 1:
+		return "object"
+	case 2:
+		return "function"
+	case 3:
+		return "section"
+	case 4:
+		return "file"
+	case 5:
+		return "common"
+	case 6:
+		return "TLS"
+	case 10:
+		return "indirect function"
+	}
+	return fmt.Sprintf("type %d", t)
+}
+
+// Returns a name for a symbol binding in a symbol's info field.
+func symbolBindingName(b uint8) string {
+	switch b {
+	case 0:
+		return "local"
+	case 1:
+		return "global"
+	case 2:
+		return "weak"
+	case 10:
+		return "unique"
+	}
+	return fmt.Sprintf("binding %d", b)
+}
+
+// Returns a name for the visibility in a symbol's "other" field.
+func symbolVisibilityName(other uint8) string {
+	switch other & 3 {
+	case 0:
+		return "default"
+	case 1:
+		return "internal"
+	case 2:
+		return "hidden"
+	}
+	return "protected"
+}
+
+// Returns the SONAME in the file's dynamic table, or an empty string if it
+// doesn't have one.
+func getSOName(f ELFFile) (string, error) {
+	table, e := GetDynamicTable(f)
+	if (e != nil) || (table == nil) {
+		return "", e
+	}
+	names, e := table.Strings(DynamicTagSOName)
+	if (e != nil) || (len(names) == 0) {
+		return "", e
+	}
+	return names[0], nil
+}
+
+// Returns an ABI snapshot of the given shared library, containing its
+// SONAME, version definitions and exported dynamic symbols. Only defined
+// symbols with global, weak or unique binding and default or protected
+// visibility are included.
+func NewABISnapshot(f ELFFile) (*ABISnapshot, error) {
+	toReturn := &ABISnapshot{}
+	var e error
+	toReturn.SOName, e = getSOName(f)
+	if e != nil {
+		return nil, e
+	}
+	definitions, e := GetVersionDefinitions(f)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading version definitions: %w", e)
+	}
+	for _, d := range definitions {
+		if (d.Flags & VersionFlagBase) != 0 {
+			continue
+		}
+		toReturn.Versions = append(toReturn.Versions, d.Name)
+	}
+	sort.Strings(toReturn.Versions)
+	versionNames, e := GetVersionNames(f)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading version names: %w", e)
+	}
+	versionIndices, e := GetSymbolVersionIndices(f)
+	if e != nil {
+		return nil, e
+	}
+
+	symbolTable := findSectionByType(f, DynamicLoaderSymbolSection)
+	if symbolTable == 0 {
+		return toReturn, nil
+	}
+	symbols, names, e := f.GetSymbols(symbolTable)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading dynamic symbols: %w", e)
+	}
+	for i, s := range symbols {
+		binding := s.GetInfo().Binding()
+		if (binding != 1) && (binding != 2) && (binding != 10) {
+			continue
+		}
+		visibility := s.GetOther() & 3
+		if (visibility == 1) || (visibility == 2) {
+			continue
+		}
+		if (s.GetSectionIndex() == 0) || (names[i] == "") {
+			continue
+		}
+		symbol := ABISymbol{
+			Name:       names[i],
+			Type:       symbolTypeName(s.GetInfo().SymbolType()),
+			Binding:    symbolBindingName(binding),
+			Visibility: symbolVisibilityName(s.GetOther()),
+			Size:       s.GetSize(),
+		}
+		if i < len(versionIndices) {
+			versionIndex := versionIndices[i] & 0x7fff
+			symbol.HiddenVersion = (versionIndices[i] &
+				VersionIndexHidden) != 0
+			if versionIndex > VersionIndexGlobal {
+				symbol.Version = versionNames[versionIndex]
+			}
+			// Symbols that are versioned with the base version aren't really
+			// versioned.
+			for _, d := range definitions {
+				if (d.Index == versionIndex) &&
+					((d.Flags & VersionFlagBase) != 0) {
+					symbol.Version = ""
+				}
+			}
+			if symbol.Version == "" {
+				symbol.HiddenVersion = false
+			}
+		}
+		toReturn.Symbols = append(toReturn.Symbols, symbol)
+	}
+	sort.SliceStable(toReturn.Symbols, func(a, b int) bool {
+		x := &(toReturn.Symbols[a])
+		y := &(toReturn.Symbols[b])
+		if x.Name != y.Name {
+			return x.Name < y.Name
+		}
+		return x.Version < y.Version
+	})
+	return toReturn, nil
+}
+
+// Identifies the kind of change reported by CompareABI.
+type ABIChangeKind uint8
+
+const (
+	ABISymbolAdded ABIChangeKind = iota
+	ABISymbolRemoved
+	ABISymbolChanged
+	ABIObjectSizeChanged
+	ABIVersionAdded
+	ABIVersionRemoved
+	ABISONameChanged
+)
+
+func (k ABIChangeKind) String() string {
+	switch k {
+	case ABISymbolAdded:
+		return "symbol added"
+	case ABISymbolRemoved:
+		return "symbol removed"
+	case ABISymbolChanged:
+		return "symbol changed"
+	case ABIObjectSizeChanged:
+		return "object size changed"
+	case ABIVersionAdded:
+		return "version added"
+	case ABIVersionRemoved:
+		return "version removed"
+	case ABISONameChanged:
+		return "SONAME changed"
+	}
+	return fmt.Sprintf("unknown ABI change %d", uint8(k))
+}
+
+// Describes a single difference between two ABI snapshots.
+type ABIChange struct {
+	Kind ABIChangeKind
+	// True if the change may break programs linked against the old version.
+	Breaking bool
+	// The versioned symbol name, version name or SONAME that changed.
+	Item   string
+	Detail string
+}
+
+func (c *ABIChange) String() string {
+	prefix := "  "
+	if c.Breaking {
+		prefix = "! "
+	}
+	if c.Detail == "" {
+		return fmt.Sprintf("%s%s: %s", prefix, c.Kind, c.Item)
+	}
+	return fmt.Sprintf("%s%s: %s: %s", prefix, c.Kind, c.Item, c.Detail)
+}
+
+// Holds the result of comparing two ABI snapshots.
+type ABIReport struct {
+	Changes []ABIChange
+}
+
+// Returns true if any of the changes may break compatibility.
+func (r *ABIReport) Breaking() bool {
+	for _, c := range r.Changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ABIReport) String() string {
+	if len(r.Changes) == 0 {
+		return "No ABI changes.\n"
+	}
+	var b strings.Builder
+	for i := range r.Changes {
+		fmt.Fprintf(&b, "%s\n", &(r.Changes[i]))
+	}
+	if r.Breaking() {
+		b.WriteString("The ABI is NOT backwards compatible.\n")
+	} else {
+		b.WriteString("The ABI is backwards compatible.\n")
+	}
+	return b.String()
+}
+
+// Compares the ABI of an old and a new version of a shared library. Removed
+// symbols and versions, changes to the size of exported objects, changes to
+// a symbol's type, and SONAME changes are treated as breaking. Added symbols
+// and versions, and other changes to existing symbols, are reported but
+// aren't considered breaking.
+func CompareABI(old, current *ABISnapshot) *ABIReport {
+	toReturn := &ABIReport{}
+	add := func(kind ABIChangeKind, breaking bool, item, detail string) {
+		toReturn.Changes = append(toReturn.Changes, ABIChange{
+			Kind:     kind,
+			Breaking: breaking,
+			Item:     item,
+			Detail:   detail,
+		})
+	}
+	if old.SOName != current.SOName {
+		add(ABISONameChanged, true, current.SOName, fmt.Sprintf(
+			"was %q", old.SOName))
+	}
+
+	currentVersions := make(map[string]bool)
+	for _, v := range current.Versions {
+		currentVersions[v] = true
+	}
+	oldVersions := make(map[string]bool)
+	for _, v := range old.Versions {
+		oldVersions[v] = true
+		if !currentVersions[v] {
+			add(ABIVersionRemoved, true, v, "")
+		}
+	}
+	for _, v := range current.Versions {
+		if !oldVersions[v] {
+			add(ABIVersionAdded, false, v, "")
+		}
+	}
+
+	// Symbols are matched by name and version. Whether a version is the
+	// default doesn't matter to programs already linked against it.
+	key := func(s *ABISymbol) string {
+		return s.Name + "@" + s.Version
+	}
+	currentSymbols := make(map[string]*ABISymbol)
+	for i := range current.Symbols {
+		currentSymbols[key(&(current.Symbols[i]))] = &(current.Symbols[i])
+	}
+	oldSymbols := make(map[string]*ABISymbol)
+	for i := range old.Symbols {
+		s := &(old.Symbols[i])
+		oldSymbols[key(s)] = s
+		n := currentSymbols[key(s)]
+		if n == nil {
+			add(ABISymbolRemoved, true, s.VersionedName(), "")
+			continue
+		}
+		if s.Type != n.Type {
+			add(ABISymbolChanged, true, s.VersionedName(), fmt.Sprintf(
+				"type changed from %s to %s", s.Type, n.Type))
+		}
+		if (s.Type == "object" || s.Type == "TLS") && (s.Size != n.Size) {
+			add(ABIObjectSizeChanged, true, s.VersionedName(), fmt.Sprintf(
+				"%d bytes -> %d bytes", s.Size, n.Size))
+		}
+		if s.Binding != n.Binding {
+			add(ABISymbolChanged, false, s.VersionedName(), fmt.Sprintf(
+				"binding changed from %s to %s", s.Binding, n.Binding))
+		}
+		if s.Visibility != n.Visibility {
+			add(ABISymbolChanged, false, s.VersionedName(), fmt.Sprintf(
+				"visibility changed from %s to %s", s.Visibility,
+				n.Visibility))
+		}
+		if s.HiddenVersion != n.HiddenVersion {
+			add(ABISymbolChanged, false, s.VersionedName(), fmt.Sprintf(
+				"now %s", n.VersionedName()))
+		}
+	}
+	for i := range current.Symbols {
+		s := &(current.Symbols[i])
+		if oldSymbols[key(s)] == nil {
+			add(ABISymbolAdded, false, s.VersionedName(), "")
+		}
+	}
+	return toReturn
+}
@@ -0,0 +1,100 @@
+package elf_reader
+
+import (
+	"testing"
+)
+
+func TestABISnapshot(t *testing.T) {
+	f := parseTestELF32("test_data/ld-linux_arm32.so", t)
+	snapshot, e := NewABISnapshot(f)
+	if e != nil {
+		t.Fatalf("Failed getting ABI snapshot: %s\n", e)
+	}
+	if snapshot.SOName != "ld-linux-armhf.so.3" {
+		t.Errorf("Incorrect SONAME: %s\n", snapshot.SOName)
+	}
+	if len(snapshot.Versions) != 2 {
+		t.Errorf("Expected 2 versions, got %v\n", snapshot.Versions)
+	}
+	found := false
+	for i := range snapshot.Symbols {
+		s := &(snapshot.Symbols[i])
+		if s.Name != "_r_debug" {
+			continue
+		}
+		found = true
+		t.Logf("Found symbol: %s\n", s)
+		if (s.Version != "GLIBC_2.4") || (s.Type != "object") ||
+			(s.Size != 20) {
+			t.Errorf("Incorrect _r_debug symbol: %s\n", s)
+		}
+	}
+	if !found {
+		t.Errorf("Didn't find the _r_debug symbol\n")
+	}
+	report := CompareABI(snapshot, snapshot)
+	if len(report.Changes) != 0 {
+		t.Errorf("Got ABI changes comparing a snapshot to itself: %s",
+			report)
+	}
+}
+
+func TestCompareABI(t *testing.T) {
+	old := &ABISnapshot{
+		SOName:   "libtest.so.1",
+		Versions: []string{"TEST_1.0", "TEST_1.1"},
+		Symbols: []ABISymbol{
+			ABISymbol{Name: "f", Version: "TEST_1.0", Type: "function",
+				Binding: "global", Visibility: "default", Size: 10},
+			ABISymbol{Name: "g", Version: "TEST_1.1", Type: "function",
+				Binding: "global", Visibility: "default", Size: 10},
+			ABISymbol{Name: "table", Version: "TEST_1.0", Type: "object",
+				Binding: "global", Visibility: "default", Size: 64},
+		},
+	}
+	// Changing a function's size and adding a symbol are compatible.
+	current := &ABISnapshot{
+		SOName:   "libtest.so.1",
+		Versions: []string{"TEST_1.0", "TEST_1.1", "TEST_1.2"},
+		Symbols: []ABISymbol{
+			ABISymbol{Name: "f", Version: "TEST_1.0", Type: "function",
+				Binding: "global", Visibility: "default", Size: 20},
+			ABISymbol{Name: "g", Version: "TEST_1.1", Type: "function",
+				Binding: "global", Visibility: "default", Size: 10},
+			ABISymbol{Name: "h", Version: "TEST_1.2", Type: "function",
+				Binding: "global", Visibility: "default", Size: 10},
+			ABISymbol{Name: "table", Version: "TEST_1.0", Type: "object",
+				Binding: "global", Visibility: "default", Size: 64},
+		},
+	}
+	report := CompareABI(old, current)
+	t.Logf("Compatible changes:\n%s", report)
+	if report.Breaking() || (len(report.Changes) != 2) {
+		t.Errorf("Expected two compatible changes\n")
+	}
+
+	// Now make some incompatible changes.
+	current.SOName = "libtest.so.2"
+	current.Versions = current.Versions[:1]
+	current.Symbols = current.Symbols[2:]
+	current.Symbols[1].Size = 128
+	report = CompareABI(old, current)
+	t.Logf("Incompatible changes:\n%s", report)
+	if !report.Breaking() {
+		t.Errorf("Incompatible changes weren't reported as breaking\n")
+	}
+	expected := map[ABIChangeKind]bool{
+		ABISONameChanged:     true,
+		ABIVersionRemoved:    true,
+		ABISymbolRemoved:     true,
+		ABIObjectSizeChanged: true,
+	}
+	for _, c := range report.Changes {
+		if c.Breaking {
+			delete(expected, c.Kind)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("Missing expected breaking changes: %v\n", expected)
+	}
+}
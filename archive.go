@@ -0,0 +1,432 @@
+package elf_reader
+
+// This file contains code for reading static libraries: ar archives such as
+// those produced by the GNU and BSD ar tools, including GNU thin archives.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The magic strings at the start of regular and thin ar archives.
+const (
+	ArchiveMagic     = "!<arch>\n"
+	ThinArchiveMagic = "!<thin>\n"
+)
+
+// The size of an ar member header.
+const archiveHeaderSize = 60
+
+// Holds a single file in an ar archive.
+type ArchiveMember struct {
+	// The member's name, after resolving long names. In thin archives, this
+	// is the path of the file relative to the archive.
+	Name string
+	// The offset of the member's header in the archive. This is the offset
+	// used by the archive's symbol index.
+	Offset uint64
+	Date   uint64
+	UID    uint32
+	GID    uint32
+	Mode   uint32
+	Size   uint64
+	// The member's content. For members of thin archives, this is nil unless
+	// the archive was read using ReadArchiveFile.
+	Content []byte
+}
+
+// Parses the member's content as an ELF file.
+func (m *ArchiveMember) ELF() (ELFFile, error) {
+	return m.ELFWithOptions(nil)
+}
+
+// Like ELF, but parses the member's content using the given options, which
+// may be nil.
+func (m *ArchiveMember) ELFWithOptions(options *ParseOptions) (ELFFile,
+	error) {
+	if m.Content == nil {
+		return nil, fmt.Errorf("The content of %s isn't available", m.Name)
+	}
+	f, e := ParseELFFileWithOptions(m.Content, options)
+	if e != nil {
+		return nil, fmt.Errorf("Failed parsing %s: %w", m.Name, e)
+	}
+	return f, nil
+}
+
+// Holds a single entry in an archive's symbol index.
+type ArchiveSymbol struct {
+	Name string
+	// The header offset of the member defining the symbol.
+	MemberOffset uint64
+}
+
+// Holds a parsed ar archive.
+type Archive struct {
+	// True if this is a GNU thin archive, where members' contents are stored
+	// in separate files.
+	Thin bool
+	// The archive's regular members, not including the symbol index or name
+	// tables.
+	Members []ArchiveMember
+	// The symbol index, in the order it's stored in the archive. Empty if
+	// the archive doesn't have one.
+	Symbols []ArchiveSymbol
+}
+
+// Returns true if the data starts with the magic string of a regular or thin
+// ar archive.
+func IsArchive(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(ArchiveMagic)) ||
+		bytes.HasPrefix(content, []byte(ThinArchiveMagic))
+}
+
+// Parses a numeric field from an ar member header, which may be padded with
+// spaces. Empty fields are treated as 0.
+func parseArchiveField(field []byte, base int, name string) (uint64,
+	error) {
+	s := strings.TrimSpace(string(field))
+	if s == "" {
+		return 0, nil
+	}
+	toReturn, e := strconv.ParseUint(s, base, 64)
+	if e != nil {
+		return 0, fmt.Errorf("Invalid %s in archive member header: %q", name,
+			s)
+	}
+	return toReturn, nil
+}
+
+// Looks up a GNU long name (a name like "/123") in the long name table.
+func archiveLongName(table []byte, offset uint64) (string, error) {
+	if offset >= uint64(len(table)) {
+		return "", fmt.Errorf("Invalid long name offset: %d", offset)
+	}
+	name := table[offset:]
+	end := bytes.Index(name, []byte("/\n"))
+	if end < 0 {
+		end = bytes.IndexByte(name, '\n')
+	}
+	if end < 0 {
+		return "", fmt.Errorf("Unterminated long name at offset %d", offset)
+	}
+	return string(name[:end]), nil
+}
+
+// Parses a GNU symbol index, from a "/" member (if wordSize is 4) or a
+// "/SYM64/" member (if wordSize is 8). The numbers are always big-endian.
+func parseGNUArchiveSymbols(data []byte, wordSize uint64) ([]ArchiveSymbol,
+	error) {
+	readWord := func(offset uint64) uint64 {
+		if wordSize == 8 {
+			return binary.BigEndian.Uint64(data[offset:])
+		}
+		return uint64(binary.BigEndian.Uint32(data[offset:]))
+	}
+	if uint64(len(data)) < wordSize {
+		return nil, fmt.Errorf("The archive symbol index is truncated")
+	}
+	count := readWord(0)
+	if count > ((uint64(len(data)) / wordSize) - 1) {
+		return nil, fmt.Errorf("Invalid archive symbol count: %d", count)
+	}
+	names := data[(count+1)*wordSize:]
+	toReturn := make([]ArchiveSymbol, count)
+	for i := uint64(0); i < count; i++ {
+		end := bytes.IndexByte(names, 0)
+		if end < 0 {
+			return nil, fmt.Errorf("Archive symbol %d's name is truncated", i)
+		}
+		toReturn[i].Name = string(names[:end])
+		toReturn[i].MemberOffset = readWord((i + 1) * wordSize)
+		names = names[end+1:]
+	}
+	return toReturn, nil
+}
+
+// Parses a BSD symbol index, from a "__.SYMDEF" member (if wordSize is 4) or
+// a "__.SYMDEF_64" member (if wordSize is 8). These are stored in the byte
+// order of the system that created them, so both orders are tried.
+func parseBSDArchiveSymbols(data []byte, wordSize uint64) ([]ArchiveSymbol,
+	error) {
+	var lastError error
+	for _, order := range []binary.ByteOrder{binary.LittleEndian,
+		binary.BigEndian} {
+		toReturn, e := parseBSDArchiveSymbolsWithOrder(data, wordSize, order)
+		if e == nil {
+			return toReturn, nil
+		}
+		lastError = e
+	}
+	return nil, lastError
+}
+
+func parseBSDArchiveSymbolsWithOrder(data []byte, wordSize uint64,
+	order binary.ByteOrder) ([]ArchiveSymbol, error) {
+	size := uint64(len(data))
+	readWord := func(offset uint64) uint64 {
+		if wordSize == 8 {
+			return order.Uint64(data[offset:])
+		}
+		return uint64(order.Uint32(data[offset:]))
+	}
+	if size < (2 * wordSize) {
+		return nil, fmt.Errorf("The archive symbol index is truncated")
+	}
+	// The index starts with the size of the array of (name offset, member
+	// offset) pairs, followed by the size of the string table.
+	arraySize := readWord(0)
+	if ((arraySize % (2 * wordSize)) != 0) ||
+		(arraySize > (size - 2*wordSize)) {
+		return nil, fmt.Errorf("Invalid archive symbol index size: %d",
+			arraySize)
+	}
+	stringsSize := readWord(wordSize + arraySize)
+	stringsStart := 2*wordSize + arraySize
+	if stringsSize > (size - stringsStart) {
+		return nil, fmt.Errorf("Invalid archive symbol string table size: %d",
+			stringsSize)
+	}
+	stringTable := data[stringsStart : stringsStart+stringsSize]
+	count := arraySize / (2 * wordSize)
+	toReturn := make([]ArchiveSymbol, count)
+	for i := uint64(0); i < count; i++ {
+		entry := wordSize + i*2*wordSize
+		name, e := ReadStringAtOffset(uint32(readWord(entry)), stringTable)
+		if e != nil {
+			return nil, fmt.Errorf("Invalid name for archive symbol %d: %w",
+				i, e)
+		}
+		toReturn[i].Name = string(name)
+		toReturn[i].MemberOffset = readWord(entry + wordSize)
+	}
+	return toReturn, nil
+}
+
+// Parses an ar archive. Both the GNU and BSD formats for long names and
+// symbol indices are supported. For thin archives, the members' contents
+// aren't loaded; use ReadArchiveFile to load them from the filesystem.
+func ParseArchive(content []byte) (*Archive, error) {
+	toReturn := &Archive{}
+	if bytes.HasPrefix(content, []byte(ThinArchiveMagic)) {
+		toReturn.Thin = true
+	} else if !bytes.HasPrefix(content, []byte(ArchiveMagic)) {
+		return nil, fmt.Errorf("Not an ar archive")
+	}
+	var longNames []byte
+	offset := uint64(len(ArchiveMagic))
+	size := uint64(len(content))
+	for offset < size {
+		// Some tools pad the end of the archive with newlines.
+		if (size - offset) < archiveHeaderSize {
+			if len(bytes.TrimSpace(content[offset:])) == 0 {
+				break
+			}
+			return nil, fmt.Errorf("Truncated archive member header at "+
+				"offset %d", offset)
+		}
+		header := content[offset : offset+archiveHeaderSize]
+		if string(header[58:60]) != "`\n" {
+			return nil, fmt.Errorf("Invalid archive member header at offset "+
+				"%d", offset)
+		}
+		member := ArchiveMember{Offset: offset}
+		var e error
+		member.Date, e = parseArchiveField(header[16:28], 10, "date")
+		if e != nil {
+			return nil, e
+		}
+		uid, e := parseArchiveField(header[28:34], 10, "UID")
+		if e != nil {
+			return nil, e
+		}
+		gid, e := parseArchiveField(header[34:40], 10, "GID")
+		if e != nil {
+			return nil, e
+		}
+		mode, e := parseArchiveField(header[40:48], 8, "mode")
+		if e != nil {
+			return nil, e
+		}
+		member.Size, e = parseArchiveField(header[48:58], 10, "size")
+		if e != nil {
+			return nil, e
+		}
+		member.UID, member.GID, member.Mode = uint32(uid), uint32(gid),
+			uint32(mode)
+		name := strings.TrimRight(string(header[:16]), " ")
+		dataStart := offset + archiveHeaderSize
+
+		// Members of thin archives don't have any data in the archive
+		// itself, apart from the symbol index and long name table.
+		special := (name == "/") || (name == "//") || (name == "/SYM64/") ||
+			strings.HasPrefix(name, "__.SYMDEF")
+		dataSize := member.Size
+		if toReturn.Thin && !special {
+			dataSize = 0
+		}
+		if dataSize > (size - dataStart) {
+			return nil, fmt.Errorf("Archive member at offset %d extends "+
+				"past the end of the file", offset)
+		}
+		data := content[dataStart : dataStart+dataSize]
+		offset = dataStart + dataSize
+		if (offset & 1) != 0 {
+			offset++
+		}
+
+		switch {
+		case name == "//":
+			longNames = data
+			continue
+		case name == "/":
+			toReturn.Symbols, e = parseGNUArchiveSymbols(data, 4)
+		case name == "/SYM64/":
+			toReturn.Symbols, e = parseGNUArchiveSymbols(data, 8)
+		case strings.HasPrefix(name, "#1/"):
+			// BSD long names are stored at the start of the data.
+			nameLength, e := strconv.ParseUint(name[3:], 10, 64)
+			if (e != nil) || (nameLength > uint64(len(data))) {
+				return nil, fmt.Errorf("Invalid BSD long name %q at offset "+
+					"%d", name, member.Offset)
+			}
+			name = strings.TrimRight(string(data[:nameLength]), "\x00")
+			data = data[nameLength:]
+			member.Size -= nameLength
+		case strings.HasPrefix(name, "/") && (len(name) > 1):
+			longOffset, e := strconv.ParseUint(name[1:], 10, 64)
+			if e != nil {
+				return nil, fmt.Errorf("Invalid long name %q at offset %d",
+					name, member.Offset)
+			}
+			name, e = archiveLongName(longNames, longOffset)
+			if e != nil {
+				return nil, e
+			}
+		default:
+			// GNU names are terminated by a slash.
+			name = strings.TrimSuffix(name, "/")
+		}
+		if e != nil {
+			return nil, e
+		}
+		if (name == "/") || (name == "/SYM64/") {
+			continue
+		}
+		if strings.HasPrefix(name, "__.SYMDEF") {
+			wordSize := uint64(4)
+			if strings.HasPrefix(name, "__.SYMDEF_64") {
+				wordSize = 8
+			}
+			toReturn.Symbols, e = parseBSDArchiveSymbols(data, wordSize)
+			if e != nil {
+				return nil, e
+			}
+			continue
+		}
+		member.Name = name
+		if !toReturn.Thin {
+			member.Content = data
+		}
+		toReturn.Members = append(toReturn.Members, member)
+	}
+	return toReturn, nil
+}
+
+// Reads and parses the ar archive at the given path. If it's a thin archive,
+// the contents of its members are read from paths relative to the archive's
+// directory.
+func ReadArchiveFile(archivePath string) (*Archive, error) {
+	content, e := os.ReadFile(archivePath)
+	if e != nil {
+		return nil, e
+	}
+	toReturn, e := ParseArchive(content)
+	if e != nil {
+		return nil, e
+	}
+	if !toReturn.Thin {
+		return toReturn, nil
+	}
+	dir := filepath.Dir(archivePath)
+	for i := range toReturn.Members {
+		m := &(toReturn.Members[i])
+		p := filepath.FromSlash(m.Name)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		m.Content, e = os.ReadFile(p)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading thin archive member: %w",
+				e)
+		}
+	}
+	return toReturn, nil
+}
+
+// Returns the member with its header at the given offset, or nil if there
+// isn't one.
+func (a *Archive) MemberAt(offset uint64) *ArchiveMember {
+	for i := range a.Members {
+		if a.Members[i].Offset == offset {
+			return &(a.Members[i])
+		}
+	}
+	return nil
+}
+
+// Returns the member that defines the given symbol, according to the
+// archive's symbol index. Returns nil if the symbol isn't in the index.
+// Archives without an index, such as those created without running ranlib,
+// can be searched using FindSymbolDefinitions instead.
+func (a *Archive) FindSymbol(name string) *ArchiveMember {
+	for _, s := range a.Symbols {
+		if s.Name == name {
+			return a.MemberAt(s.MemberOffset)
+		}
+	}
+	return nil
+}
+
+// Returns the members that define the given symbol, by reading the symbol
+// table of each ELF member rather than using the archive's symbol index.
+// Members that aren't ELF files are skipped.
+func (a *Archive) FindSymbolDefinitions(name string) ([]*ArchiveMember,
+	error) {
+	var toReturn []*ArchiveMember
+	for i := range a.Members {
+		m := &(a.Members[i])
+		if (m.Content == nil) || !bytes.HasPrefix(m.Content,
+			[]byte("\x7fELF")) {
+			continue
+		}
+		f, e := m.ELF()
+		if e != nil {
+			return nil, e
+		}
+		symbolTable := findSectionByType(f, SymbolTableSection)
+		if symbolTable == 0 {
+			continue
+		}
+		symbols, names, e := f.GetSymbols(symbolTable)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading symbols in %s: %w",
+				m.Name, e)
+		}
+		for j, s := range symbols {
+			binding := s.GetInfo().Binding()
+			if (names[j] != name) || (s.GetSectionIndex() == 0) ||
+				(binding == 0) {
+				continue
+			}
+			toReturn = append(toReturn, m)
+			break
+		}
+	}
+	return toReturn, nil
+}
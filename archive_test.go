@@ -0,0 +1,160 @@
+package elf_reader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Checks the members and symbol index of one of the test archives, which
+// all contain the same two object files.
+func checkTestArchive(a *Archive, t *testing.T) {
+	if len(a.Members) != 2 {
+		t.Fatalf("Expected 2 archive members, got %d\n", len(a.Members))
+	}
+	if (a.Members[0].Name != "short.o") ||
+		(a.Members[1].Name != "a_member_with_a_long_name.o") {
+		t.Errorf("Incorrect member names: %s, %s\n", a.Members[0].Name,
+			a.Members[1].Name)
+	}
+	for i := range a.Members {
+		m := &(a.Members[i])
+		f, e := m.ELF()
+		if e != nil {
+			t.Errorf("Failed parsing member %s: %s\n", m.Name, e)
+			continue
+		}
+		if f.GetFileType() != ELFTypeRelocatable {
+			t.Errorf("Member %s isn't a relocatable file\n", m.Name)
+		}
+	}
+	if len(a.Symbols) != 3 {
+		t.Errorf("Expected 3 symbols in the index, got %d\n", len(a.Symbols))
+	}
+	m := a.FindSymbol("archive_long_member_function")
+	if (m == nil) || (m.Name != "a_member_with_a_long_name.o") {
+		t.Errorf("Didn't find the member defining "+
+			"archive_long_member_function: %v\n", m)
+	}
+	m = a.FindSymbol("archive_shared_counter")
+	if (m == nil) || (m.Name != "short.o") {
+		t.Errorf("Didn't find the member defining archive_shared_counter\n")
+	}
+	if a.FindSymbol("archive_missing_symbol") != nil {
+		t.Errorf("Found a member defining a nonexistent symbol\n")
+	}
+}
+
+func TestParseArchive(t *testing.T) {
+	for _, name := range []string{"libarchive_amd64.a",
+		"libarchive_bsd_amd64.a", "libarchive_sym64_amd64.a"} {
+		a, e := ParseArchive(fileBytes("test_data/"+name, t))
+		if e != nil {
+			t.Errorf("Failed parsing %s: %s\n", name, e)
+			continue
+		}
+		t.Logf("Checking %s\n", name)
+		checkTestArchive(a, t)
+	}
+	a, e := ParseArchive(fileBytes("test_data/libarchive_amd64.a", t))
+	if e != nil {
+		t.Fatalf("Failed parsing archive: %s\n", e)
+	}
+	// archive_short_function is defined in short.o, and referenced by the
+	// other member.
+	members, e := a.FindSymbolDefinitions("archive_short_function")
+	if e != nil {
+		t.Fatalf("Failed finding symbol definitions: %s\n", e)
+	}
+	if (len(members) != 1) || (members[0].Name != "short.o") {
+		t.Errorf("Incorrect definitions of archive_short_function\n")
+	}
+	_, e = ParseArchive(fileBytes("test_data/sleep_amd64", t))
+	if e == nil {
+		t.Errorf("Didn't get an error parsing a non-archive\n")
+	}
+}
+
+// Returns an ar member header with the given name and size.
+func archiveHeader(name string, size int) string {
+	return fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 0, 0, 0, 0644,
+		size)
+}
+
+func TestThinArchive(t *testing.T) {
+	regular, e := ParseArchive(fileBytes("test_data/libarchive_amd64.a", t))
+	if e != nil {
+		t.Fatalf("Failed parsing archive: %s\n", e)
+	}
+	// Write the members to separate files, and create a thin archive
+	// referring to them, using the symbol index from the regular archive.
+	dir := t.TempDir()
+	e = os.Mkdir(filepath.Join(dir, "obj"), 0755)
+	if e != nil {
+		t.Fatalf("Failed creating directory: %s\n", e)
+	}
+	longNames := ""
+	for _, m := range regular.Members {
+		longNames += "obj/" + m.Name + "/\n"
+		e = os.WriteFile(filepath.Join(dir, "obj", m.Name), m.Content, 0644)
+		if e != nil {
+			t.Fatalf("Failed writing %s: %s\n", m.Name, e)
+		}
+	}
+	content := ThinArchiveMagic + archiveHeader("//", len(longNames)) +
+		longNames
+	nameOffset := 0
+	for _, m := range regular.Members {
+		header := archiveHeader(fmt.Sprintf("/%d", nameOffset),
+			len(m.Content))
+		content += header
+		nameOffset += len("obj/" + m.Name + "/\n")
+	}
+	archivePath := filepath.Join(dir, "libthin.a")
+	e = os.WriteFile(archivePath, []byte(content), 0644)
+	if e != nil {
+		t.Fatalf("Failed writing thin archive: %s\n", e)
+	}
+	a, e := ReadArchiveFile(archivePath)
+	if e != nil {
+		t.Fatalf("Failed reading thin archive: %s\n", e)
+	}
+	if !a.Thin || (len(a.Members) != 2) {
+		t.Fatalf("Incorrect thin archive members\n")
+	}
+	if a.Members[1].Name != "obj/a_member_with_a_long_name.o" {
+		t.Errorf("Incorrect thin member name: %s\n", a.Members[1].Name)
+	}
+	for _, m := range a.Members {
+		if _, e = m.ELF(); e != nil {
+			t.Errorf("Failed parsing thin member %s: %s\n", m.Name, e)
+		}
+	}
+}
+
+func TestArchiveMemberOptions(t *testing.T) {
+	a, e := ParseArchive(fileBytes("test_data/libarchive_amd64.a", t))
+	if e != nil {
+		t.Fatalf("Failed parsing archive: %s\n", e)
+	}
+	m := a.Members[0]
+	f, e := m.ELF()
+	if e != nil {
+		t.Fatalf("Failed parsing member %s: %s\n", m.Name, e)
+	}
+	// Truncate the member partway through its section header table, so it
+	// can only be parsed in lenient mode.
+	m.Content = m.Content[:f.(*ELF64File).Header.SectionHeaderOffset+64*2+10]
+	_, e = m.ELF()
+	if e == nil {
+		t.Errorf("Didn't get an error for a truncated member\n")
+	}
+	f, e = m.ELFWithOptions(&ParseOptions{Lenient: true})
+	if e != nil {
+		t.Fatalf("Lenient parsing of the truncated member failed: %s\n", e)
+	}
+	if len(GetWarnings(f)) == 0 {
+		t.Errorf("Didn't get warnings for the truncated member\n")
+	}
+}
@@ -0,0 +1,648 @@
+package elf_reader
+
+// This file contains code for simulating how the dynamic linker binds
+// symbol references to definitions, so that missing symbols and versions can
+// be found without running a program.
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// An ELF file in the global lookup scope passed to SimulateBinding.
+type BindingObject struct {
+	// The path used to refer to the object in the report.
+	Path string
+	File ELFFile
+}
+
+// Describes the definition that a single symbol reference binds to.
+type SymbolBinding struct {
+	// The path of the object containing the reference.
+	Object string
+	Symbol string
+	// The version requested by the reference, or an empty string if it's
+	// unversioned.
+	Version string `json:",omitempty"`
+	// True if the reference is weak, in which case it's not an error if the
+	// symbol isn't found.
+	Weak bool `json:",omitempty"`
+	// True if the reference is a copy relocation in the executable. In this
+	// case, Provider is the object the initial value is copied from.
+	Copy bool `json:",omitempty"`
+	// The path of the object containing the definition, or an empty string
+	// if the symbol wasn't found.
+	Provider string `json:",omitempty"`
+	// The version of the definition, if it's versioned.
+	ProviderVersion string `json:",omitempty"`
+}
+
+func (b *SymbolBinding) String() string {
+	name := b.Symbol
+	if b.Version != "" {
+		name += "@" + b.Version
+	}
+	if b.Weak {
+		name += " (weak)"
+	}
+	if b.Copy {
+		name += " (copy)"
+	}
+	if b.Provider == "" {
+		return fmt.Sprintf("%s: %s => not found", b.Object, name)
+	}
+	provided := b.Provider
+	if b.ProviderVersion != "" {
+		provided += " (" + b.ProviderVersion + ")"
+	}
+	return fmt.Sprintf("%s: %s => %s", b.Object, name, provided)
+}
+
+// Identifies the kind of problem reported by SimulateBinding.
+type BindingIssueKind uint8
+
+const (
+	// A reference to a symbol that isn't defined by any object.
+	BindingUndefinedSymbol BindingIssueKind = iota
+	// The symbol is defined, but not with the version that was requested.
+	BindingVersionMismatch
+	// An object requires a version that isn't defined by the library it
+	// expects to provide it.
+	BindingVersionNotFound
+	// An object requires versions from a library without any version
+	// information.
+	BindingNoVersionInformation
+	// A definition is overridden by a definition in an earlier object in the
+	// lookup scope.
+	BindingInterposedSymbol
+	// A copy relocation's size doesn't match the size of the object it's
+	// copied from.
+	BindingCopySizeMismatch
+	// A copy relocation refers to a protected symbol, so the library and the
+	// executable will use different copies of it.
+	BindingProtectedCopy
+)
+
+func (k BindingIssueKind) String() string {
+	switch k {
+	case BindingUndefinedSymbol:
+		return "undefined symbol"
+	case BindingVersionMismatch:
+		return "version mismatch"
+	case BindingVersionNotFound:
+		return "version not found"
+	case BindingNoVersionInformation:
+		return "no version information"
+	case BindingInterposedSymbol:
+		return "interposed symbol"
+	case BindingCopySizeMismatch:
+		return "copy relocation size mismatch"
+	case BindingProtectedCopy:
+		return "copy relocation against protected symbol"
+	}
+	return fmt.Sprintf("unknown binding issue %d", uint8(k))
+}
+
+// Describes a single problem found by SimulateBinding.
+type BindingIssue struct {
+	Kind BindingIssueKind
+	// True if the problem will prevent the program from loading or running
+	// correctly, rather than just being suspicious.
+	Error bool
+	// The path of the object the problem was found in.
+	Object string
+	// The symbol or version name the problem concerns.
+	Item   string
+	Detail string `json:",omitempty"`
+}
+
+func (i *BindingIssue) String() string {
+	prefix := "  "
+	if i.Error {
+		prefix = "! "
+	}
+	if i.Detail == "" {
+		return fmt.Sprintf("%s%s: %s: %s", prefix, i.Kind, i.Object, i.Item)
+	}
+	return fmt.Sprintf("%s%s: %s: %s: %s", prefix, i.Kind, i.Object, i.Item,
+		i.Detail)
+}
+
+// Holds the result of SimulateBinding.
+type BindingReport struct {
+	// Each symbol reference, in lookup scope order and then symbol table
+	// order.
+	Bindings []SymbolBinding
+	Issues   []BindingIssue
+}
+
+// Returns true if any of the issues are errors.
+func (r *BindingReport) Errors() bool {
+	for _, issue := range r.Issues {
+		if issue.Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the list of issues, one per line.
+func (r *BindingReport) String() string {
+	if len(r.Issues) == 0 {
+		return "No binding problems found.\n"
+	}
+	var b strings.Builder
+	for i := range r.Issues {
+		fmt.Fprintf(&b, "%s\n", &(r.Issues[i]))
+	}
+	return b.String()
+}
+
+// Returns the relocation type used for copy relocations on the given
+// machine, or 0 if it isn't known.
+func copyRelocationType(machine MachineType) uint32 {
+	switch machine {
+	case MachineTypeX86, MachineTypeAMD64:
+		return 5
+	case MachineTypeSPARC, MachineTypeSPARCV9, MachineTypePowerPC,
+		MachineTypePowerPC64:
+		return 19
+	case MachineTypeARM:
+		return 20
+	case MachineTypeMIPS:
+		return 126
+	case MachineTypeARM64:
+		return 1024
+	}
+	return 0
+}
+
+// Holds the dynamic symbol information about an object in the lookup scope.
+type bindingObject struct {
+	path     string
+	soname   string
+	symbolic bool
+	symbols  []ELFSymbol
+	names    []string
+	// The .gnu.version entry for each symbol, or nil if the object has none.
+	versions []uint16
+	// Maps version indices to names, for both defined and needed versions.
+	versionNames map[uint16]string
+	// The index of the version definition naming the object itself.
+	baseVersion  uint16
+	definitions  []ELFVersionDefinition
+	requirements []ELFVersionRequirement
+	// Maps names to the indices of the exported symbols with the name.
+	exports map[string][]int
+	// The indices of symbols referred to by dynamic relocations.
+	relocated map[uint32]bool
+	// The indices of symbols referred to by copy relocations.
+	copies map[uint32]bool
+}
+
+func newBindingObject(o *BindingObject) (*bindingObject, error) {
+	f := o.File
+	toReturn := &bindingObject{
+		path:      o.Path,
+		exports:   make(map[string][]int),
+		relocated: make(map[uint32]bool),
+		copies:    make(map[uint32]bool),
+	}
+	var e error
+	toReturn.soname, e = getSOName(f)
+	if e != nil {
+		return nil, e
+	}
+	dynamic, e := GetDynamicTable(f)
+	if e != nil {
+		return nil, e
+	}
+	if dynamic != nil {
+		toReturn.symbolic = dynamic.HasTag(DynamicTagSymbolic) ||
+			((dynamic.Flags(DynamicTagFlags) & DynamicFlagSymbolic) != 0)
+	}
+	toReturn.definitions, e = GetVersionDefinitions(f)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading version definitions: %w", e)
+	}
+	for _, d := range toReturn.definitions {
+		if (d.Flags & VersionFlagBase) != 0 {
+			toReturn.baseVersion = d.Index
+		}
+	}
+	toReturn.requirements, e = GetVersionRequirements(f)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading version requirements: %w", e)
+	}
+	toReturn.versionNames, e = GetVersionNames(f)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading version names: %w", e)
+	}
+	toReturn.versions, e = GetSymbolVersionIndices(f)
+	if e != nil {
+		return nil, e
+	}
+
+	symbolTable := findSectionByType(f, DynamicLoaderSymbolSection)
+	if symbolTable == 0 {
+		return toReturn, nil
+	}
+	toReturn.symbols, toReturn.names, e = f.GetSymbols(symbolTable)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading dynamic symbols: %w", e)
+	}
+	for i := range toReturn.symbols {
+		if toReturn.isExported(i) {
+			name := toReturn.names[i]
+			toReturn.exports[name] = append(toReturn.exports[name], i)
+		}
+	}
+	copyType := copyRelocationType(f.GetMachineType())
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		if !f.IsRelocationTable(i) {
+			continue
+		}
+		header, e := f.GetSectionHeader(i)
+		if e != nil {
+			return nil, e
+		}
+		if uint16(header.GetLinkedIndex()) != symbolTable {
+			continue
+		}
+		relocations, e := f.GetRelocations(i)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading relocations in section "+
+				"%d: %w", i, e)
+		}
+		for _, r := range relocations {
+			index := r.SymbolIndex()
+			if index == 0 {
+				continue
+			}
+			toReturn.relocated[index] = true
+			if (copyType != 0) && (r.Type() == copyType) {
+				toReturn.copies[index] = true
+			}
+		}
+	}
+	return toReturn, nil
+}
+
+// Returns true if the symbol at the given index is a definition that can be
+// found by other objects.
+func (o *bindingObject) isExported(index int) bool {
+	s := o.symbols[index]
+	binding := s.GetInfo().Binding()
+	if (binding != 1) && (binding != 2) && (binding != 10) {
+		return false
+	}
+	visibility := s.GetOther() & 3
+	if (visibility == 1) || (visibility == 2) {
+		return false
+	}
+	return (s.GetSectionIndex() != 0) && (o.names[index] != "")
+}
+
+// Returns true if the object's name or SONAME matches the given library
+// name, as used in DT_NEEDED or version requirements.
+func (o *bindingObject) matchesName(name string) bool {
+	return (name == o.soname) || (name == o.path) ||
+		(name == path.Base(o.path))
+}
+
+// Returns the version index and hidden flag for the symbol at the given
+// index.
+func (o *bindingObject) symbolVersion(index int) (uint16, bool) {
+	if index >= len(o.versions) {
+		return VersionIndexGlobal, false
+	}
+	v := o.versions[index]
+	return v & 0x7fff, (v & VersionIndexHidden) != 0
+}
+
+// Returns the name of the version of the symbol at the given index, or an
+// empty string if it's unversioned.
+func (o *bindingObject) symbolVersionName(index int) string {
+	v, _ := o.symbolVersion(index)
+	if (v <= VersionIndexGlobal) || (v == o.baseVersion) {
+		return ""
+	}
+	return o.versionNames[v]
+}
+
+// Looks for a definition matching a reference to the given symbol name and
+// version, following the same rules as the GNU dynamic linker. Returns the
+// index of the matching symbol, or -1 if there isn't one.
+func (o *bindingObject) findDefinition(name, version string,
+	hidden bool) int {
+	candidate := -1
+	for _, index := range o.exports[name] {
+		if o.versions == nil {
+			return index
+		}
+		v, hiddenDefinition := o.symbolVersion(index)
+		definedVersion := o.versionNames[v]
+		if v <= VersionIndexGlobal {
+			definedVersion = ""
+		}
+		if version != "" {
+			// A versioned reference matches the same version, or the
+			// default unversioned definition.
+			if definedVersion == version {
+				return index
+			}
+			if !hidden && !hiddenDefinition && (definedVersion == "") {
+				return index
+			}
+			continue
+		}
+		// Unversioned references match unversioned definitions, or
+		// otherwise the first default version.
+		if v < 3 {
+			return index
+		}
+		if !hiddenDefinition && (candidate < 0) {
+			candidate = index
+		}
+	}
+	return candidate
+}
+
+// Holds state while simulating symbol binding.
+type bindingSimulator struct {
+	scope  []*bindingObject
+	report *BindingReport
+	// Used to avoid reporting the same interposed definition more than once.
+	interposed map[string]bool
+}
+
+func (s *bindingSimulator) addIssue(kind BindingIssueKind, isError bool,
+	object, item, detail string) {
+	s.report.Issues = append(s.report.Issues, BindingIssue{
+		Kind:   kind,
+		Error:  isError,
+		Object: object,
+		Item:   item,
+		Detail: detail,
+	})
+}
+
+// Searches the lookup scope for a definition, skipping the given object if
+// it isn't nil. Returns nil and -1 if no definition is found.
+func (s *bindingSimulator) lookup(name, version string, hidden bool,
+	skip *bindingObject) (*bindingObject, int) {
+	for _, o := range s.scope {
+		if o == skip {
+			continue
+		}
+		index := o.findDefinition(name, version, hidden)
+		if index >= 0 {
+			return o, index
+		}
+	}
+	return nil, -1
+}
+
+// Checks that each version required by each object is defined by the
+// library it's required from.
+func (s *bindingSimulator) checkVersionRequirements() {
+	for _, o := range s.scope {
+		for _, r := range o.requirements {
+			var provider *bindingObject
+			for _, candidate := range s.scope {
+				if candidate.matchesName(r.File) {
+					provider = candidate
+					break
+				}
+			}
+			// Missing libraries are reported by ResolveDependencies.
+			if provider == nil {
+				continue
+			}
+			if len(provider.definitions) == 0 {
+				s.addIssue(BindingNoVersionInformation, false, o.path,
+					r.File, "required from "+provider.path)
+				continue
+			}
+			for _, v := range r.Versions {
+				found := false
+				for _, d := range provider.definitions {
+					if d.Name == v.Name {
+						found = true
+						break
+					}
+				}
+				if found {
+					continue
+				}
+				// Bit 2 is VER_FLG_WEAK.
+				s.addIssue(BindingVersionNotFound, (v.Flags&2) == 0, o.path,
+					v.Name, "not defined by "+provider.path)
+			}
+		}
+	}
+}
+
+// Reports the definitions overridden by the definition a reference bound
+// to.
+func (s *bindingSimulator) checkInterposition(b *SymbolBinding,
+	provider *bindingObject, hidden bool) {
+	for _, o := range s.scope {
+		if o == provider {
+			continue
+		}
+		index := o.findDefinition(b.Symbol, b.Version, hidden)
+		if index < 0 {
+			continue
+		}
+		name := b.Symbol
+		if v := o.symbolVersionName(index); v != "" {
+			name += "@" + v
+		}
+		key := o.path + "\x00" + name
+		if s.interposed[key] {
+			continue
+		}
+		s.interposed[key] = true
+		s.addIssue(BindingInterposedSymbol, false, o.path, name,
+			"interposed by "+provider.path)
+	}
+}
+
+// Returns a description of the versions a symbol is defined with, for
+// explaining why a versioned reference wasn't found.
+func (s *bindingSimulator) describeDefinitions(name string) string {
+	var found []string
+	for _, o := range s.scope {
+		for _, index := range o.exports[name] {
+			v := o.symbolVersionName(index)
+			if v == "" {
+				v = "(unversioned)"
+			}
+			found = append(found, fmt.Sprintf("%s in %s", v, o.path))
+		}
+	}
+	if len(found) == 0 {
+		return ""
+	}
+	return "only defined as " + strings.Join(found, ", ")
+}
+
+// Finds the definition for the reference to the symbol at the given index in
+// the object, adding the result to the report.
+func (s *bindingSimulator) bindReference(o *bindingObject, index int) {
+	symbol := o.symbols[index]
+	b := SymbolBinding{
+		Object:  o.path,
+		Symbol:  o.names[index],
+		Version: o.symbolVersionName(index),
+		Weak:    symbol.GetInfo().Binding() == 2,
+		Copy:    o.copies[uint32(index)],
+	}
+	_, hidden := o.symbolVersion(index)
+	var provider *bindingObject
+	providerIndex := -1
+	// Set if the reference binds to the object's own definition without
+	// looking at the rest of the scope.
+	selfBound := false
+	switch {
+	case b.Copy:
+		// Copy relocations are looked up starting after the executable.
+		provider, providerIndex = s.lookup(b.Symbol, b.Version, hidden, o)
+	case (symbol.GetSectionIndex() != 0) && ((symbol.GetOther() & 3) == 3):
+		// Protected symbols always bind to the object's own definition.
+		provider, providerIndex = o, index
+		selfBound = true
+	case (symbol.GetSectionIndex() != 0) && o.symbolic:
+		provider, providerIndex = o, index
+		selfBound = true
+	default:
+		provider, providerIndex = s.lookup(b.Symbol, b.Version, hidden, nil)
+	}
+	if provider == nil {
+		s.report.Bindings = append(s.report.Bindings, b)
+		// Unresolved weak references are legitimate, and are just left as 0.
+		if b.Weak {
+			return
+		}
+		name := b.Symbol
+		if b.Version != "" {
+			name += "@" + b.Version
+		}
+		kind := BindingUndefinedSymbol
+		detail := ""
+		if b.Version != "" {
+			detail = s.describeDefinitions(b.Symbol)
+			if detail != "" {
+				kind = BindingVersionMismatch
+			}
+		}
+		s.addIssue(kind, true, o.path, name, detail)
+		return
+	}
+	b.Provider = provider.path
+	b.ProviderVersion = provider.symbolVersionName(providerIndex)
+	s.report.Bindings = append(s.report.Bindings, b)
+
+	if b.Copy {
+		definition := provider.symbols[providerIndex]
+		if (definition.GetOther() & 3) == 3 {
+			s.addIssue(BindingProtectedCopy, true, o.path, b.Symbol,
+				"defined in "+provider.path)
+		}
+		if definition.GetSize() != symbol.GetSize() {
+			s.addIssue(BindingCopySizeMismatch, false, o.path, b.Symbol,
+				fmt.Sprintf("%d bytes, but %d bytes in %s", symbol.GetSize(),
+					definition.GetSize(), provider.path))
+		}
+		return
+	}
+	// A copy relocation is meant to override the library's definition, and
+	// protected or DT_SYMBOLIC references don't override other objects'
+	// definitions, since those are never considered.
+	if provider.copies[uint32(providerIndex)] || selfBound {
+		return
+	}
+	s.checkInterposition(&b, provider, hidden)
+}
+
+// Simulates the dynamic linker binding each symbol reference in the given
+// objects, which must be in the order of the global lookup scope: the
+// executable first, followed by its libraries in load order. References are
+// the undefined symbols in each object's dynamic symbol table, and defined
+// symbols referred to by the object's dynamic relocations, which may be
+// interposed. Lookups follow symbol versioning, DT_SYMBOLIC, protected
+// visibility and copy relocation rules. Like the GNU dynamic linker, the
+// first definition found is used, even if it's weak. Undefined weak
+// references are listed in the bindings without a provider, but aren't
+// reported as issues.
+func SimulateBinding(objects []BindingObject) (*BindingReport, error) {
+	s := &bindingSimulator{
+		scope:      make([]*bindingObject, len(objects)),
+		report:     &BindingReport{},
+		interposed: make(map[string]bool),
+	}
+	for i := range objects {
+		o, e := newBindingObject(&(objects[i]))
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading %s: %w", objects[i].Path,
+				e)
+		}
+		s.scope[i] = o
+	}
+	s.checkVersionRequirements()
+	for _, o := range s.scope {
+		for i, symbol := range o.symbols {
+			if (i == 0) || (o.names[i] == "") {
+				continue
+			}
+			binding := symbol.GetInfo().Binding()
+			if (binding != 1) && (binding != 2) && (binding != 10) {
+				continue
+			}
+			if (symbol.GetSectionIndex() != 0) && !o.relocated[uint32(i)] {
+				continue
+			}
+			s.bindReference(o, i)
+		}
+	}
+	return s.report, nil
+}
+
+// Resolves the dependencies of the ELF file at the given path using
+// ResolveDependencies, and then simulates binding its symbols using
+// SimulateBinding. Libraries that couldn't be found are left out of the
+// lookup scope.
+func SimulateBindingForFile(filePath string,
+	options *DependencyOptions) (*BindingReport, error) {
+	tree, e := ResolveDependencies(filePath, options)
+	if e != nil {
+		return nil, e
+	}
+	sysroot := ""
+	if options != nil {
+		sysroot = options.Sysroot
+	}
+	var objects []BindingObject
+	for _, node := range tree.LoadOrder() {
+		hostPath, e := sysrootPath(sysroot, node.Path)
+		if e != nil {
+			return nil, e
+		}
+		raw, e := os.ReadFile(hostPath)
+		if e != nil {
+			return nil, e
+		}
+		f, e := ParseELFFile(raw)
+		if e != nil {
+			return nil, fmt.Errorf("Failed parsing %s: %w", node.Path, e)
+		}
+		objects = append(objects, BindingObject{
+			Path: node.Path,
+			File: f,
+		})
+	}
+	return SimulateBinding(objects)
+}
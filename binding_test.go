@@ -0,0 +1,222 @@
+package elf_reader
+
+import (
+	"testing"
+)
+
+// Returns the binding for the given reference, or nil if it isn't in the
+// report.
+func findBinding(r *BindingReport, object, symbol string) *SymbolBinding {
+	for i := range r.Bindings {
+		b := &(r.Bindings[i])
+		if (b.Object == object) && (b.Symbol == symbol) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Returns the issue of the given kind concerning the given item, or nil if it
+// isn't in the report.
+func findBindingIssue(r *BindingReport, kind BindingIssueKind,
+	item string) *BindingIssue {
+	for i := range r.Issues {
+		issue := &(r.Issues[i])
+		if (issue.Kind == kind) && (issue.Item == item) {
+			return issue
+		}
+	}
+	return nil
+}
+
+func TestSimulateBinding(t *testing.T) {
+	// bind_amd64 needs libbind_b.so and then libbind_a.so. Both libraries
+	// define shared_fn, and libbind_a.so defines foo@VERS_1 and foo@@VERS_2.
+	objects := []BindingObject{
+		{"bind_amd64", parseTestELF64("test_data/bind_amd64", t)},
+		{"libbind_b.so", parseTestELF64("test_data/libbind_b_amd64.so", t)},
+		{"libbind_a.so", parseTestELF64("test_data/libbind_a_amd64.so", t)},
+	}
+	report, e := SimulateBinding(objects)
+	if e != nil {
+		t.Fatalf("Failed simulating binding: %s\n", e)
+	}
+	for i := range report.Bindings {
+		t.Logf("%s\n", &(report.Bindings[i]))
+	}
+	t.Logf("Issues:\n%s", report)
+	b := findBinding(report, "bind_amd64", "foo")
+	if (b == nil) || (b.Provider != "libbind_a.so") ||
+		(b.ProviderVersion != "VERS_2") {
+		t.Errorf("Incorrect binding for foo: %v\n", b)
+	}
+	b = findBinding(report, "bind_amd64", "shared_fn")
+	if (b == nil) || (b.Provider != "libbind_b.so") {
+		t.Errorf("shared_fn didn't bind to the first definition: %v\n", b)
+	}
+	b = findBinding(report, "bind_amd64", "counter")
+	if (b == nil) || !b.Copy || (b.Provider != "libbind_a.so") {
+		t.Errorf("Incorrect copy relocation binding for counter: %v\n", b)
+	}
+	b = findBinding(report, "libbind_a.so", "shared_fn")
+	if (b == nil) || (b.Provider != "libbind_b.so") {
+		t.Errorf("libbind_a.so's shared_fn wasn't interposed: %v\n", b)
+	}
+	if findBindingIssue(report, BindingInterposedSymbol,
+		"shared_fn@VERS_1") == nil {
+		t.Errorf("Didn't report the interposed shared_fn\n")
+	}
+	issue := findBindingIssue(report, BindingUndefinedSymbol, "missing_fn")
+	if (issue == nil) || !issue.Error {
+		t.Errorf("Didn't report missing_fn as an error\n")
+	}
+	b = findBinding(report, "bind_amd64", "optional_fn")
+	if (b == nil) || !b.Weak || (b.Provider != "") {
+		t.Errorf("Incorrect binding for optional_fn: %v\n", b)
+	}
+	if findBindingIssue(report, BindingUndefinedSymbol, "optional_fn") != nil {
+		t.Errorf("Reported the weak optional_fn as an undefined symbol\n")
+	}
+	if len(report.Issues) != 2 {
+		t.Errorf("Expected 2 issues, got %d\n", len(report.Issues))
+	}
+
+	// The old version of libbind_a.so lacks VERS_2, foo and prot_value, and
+	// has a larger counter.
+	objects[2].File = parseTestELF64("test_data/libbind_a_old_amd64.so", t)
+	report, e = SimulateBinding(objects)
+	if e != nil {
+		t.Fatalf("Failed simulating binding with old library: %s\n", e)
+	}
+	t.Logf("Issues with old library:\n%s", report)
+	issue = findBindingIssue(report, BindingVersionNotFound, "VERS_2")
+	if (issue == nil) || !issue.Error {
+		t.Errorf("Didn't report the missing VERS_2 as an error\n")
+	}
+	if findBindingIssue(report, BindingUndefinedSymbol,
+		"prot_value@VERS_1") == nil {
+		t.Errorf("Didn't report the missing prot_value\n")
+	}
+	if findBindingIssue(report, BindingCopySizeMismatch, "counter") == nil {
+		t.Errorf("Didn't report the change in counter's size\n")
+	}
+	if !report.Errors() {
+		t.Errorf("The report with the old library didn't contain errors\n")
+	}
+}
+
+func TestSimulateBindingForFile(t *testing.T) {
+	sysroot := t.TempDir()
+	copyToSysroot(sysroot, "test_data/bind_amd64", "/bin/app", t)
+	copyToSysroot(sysroot, "test_data/libbind_a_amd64.so",
+		"/lib/libbind_a.so", t)
+	report, e := SimulateBindingForFile("/bin/app", &DependencyOptions{
+		Sysroot:     sysroot,
+		IgnoreCache: true,
+		IgnoreConf:  true,
+	})
+	if e != nil {
+		t.Fatalf("Failed simulating binding: %s\n", e)
+	}
+	t.Logf("Issues without libbind_b.so:\n%s", report)
+	// Without libbind_b.so, shared_fn binds to libbind_a.so's definition.
+	b := findBinding(report, "/bin/app", "shared_fn")
+	if (b == nil) || (b.Provider != "/lib/libbind_a.so") {
+		t.Errorf("Incorrect binding for shared_fn: %v\n", b)
+	}
+	if findBindingIssue(report, BindingInterposedSymbol,
+		"shared_fn@VERS_1") != nil {
+		t.Errorf("Incorrectly reported shared_fn as interposed\n")
+	}
+}
+
+// Parses libbind_a_amd64.so after passing its content to the given function
+// to modify it.
+func parseModifiedLibbindA(modify func(f *ELF64File, raw []byte),
+	t *testing.T) *ELF64File {
+	original := parseTestELF64("test_data/libbind_a_amd64.so", t)
+	raw := append([]byte{}, original.Raw...)
+	modify(original, raw)
+	f, e := ParseELF64File(raw)
+	if e != nil {
+		t.Fatalf("Failed parsing modified libbind_a_amd64.so: %s\n", e)
+	}
+	return f
+}
+
+func TestSimulateBindingSelfBound(t *testing.T) {
+	// Make libbind_a.so's shared_fn, which it calls through the PLT,
+	// protected. The symbol is at index 2, and st_other is 5 bytes into each
+	// symbol.
+	protected := parseModifiedLibbindA(func(f *ELF64File, raw []byte) {
+		index, e := FindSectionByName(f, ".dynsym")
+		if e != nil {
+			t.Fatalf("Couldn't find .dynsym: %s\n", e)
+		}
+		raw[f.Sections[index].FileOffset+2*24+5] = 3
+	}, t)
+	// Replace libbind_a.so's DT_GNU_HASH entry, which the simulation doesn't
+	// use, with DT_SYMBOLIC.
+	symbolic := parseModifiedLibbindA(func(f *ELF64File, raw []byte) {
+		index, e := FindSectionByName(f, ".dynamic")
+		if e != nil {
+			t.Fatalf("Couldn't find .dynamic: %s\n", e)
+		}
+		offset := f.Sections[index].FileOffset + 16
+		if f.Endianness.Uint64(raw[offset:]) != 0x6ffffef5 {
+			t.Fatalf("The second dynamic entry isn't DT_GNU_HASH\n")
+		}
+		f.Endianness.PutUint64(raw[offset:], DynamicTagSymbolic)
+	}, t)
+
+	for _, library := range []*ELF64File{protected, symbolic} {
+		report, e := SimulateBinding([]BindingObject{
+			{"bind_amd64", parseTestELF64("test_data/bind_amd64", t)},
+			{"libbind_b.so", parseTestELF64("test_data/libbind_b_amd64.so",
+				t)},
+			{"libbind_a.so", library},
+		})
+		if e != nil {
+			t.Fatalf("Failed simulating binding: %s\n", e)
+		}
+		t.Logf("Issues:\n%s", report)
+		b := findBinding(report, "libbind_a.so", "shared_fn")
+		if (b == nil) || (b.Provider != "libbind_a.so") {
+			t.Errorf("libbind_a.so's shared_fn didn't bind to itself: %v\n",
+				b)
+		}
+		if findBindingIssue(report, BindingInterposedSymbol,
+			"shared_fn") != nil {
+			t.Errorf("Reported libbind_b.so's shared_fn as interposed\n")
+		}
+		// The executable's reference is still looked up normally.
+		b = findBinding(report, "bind_amd64", "shared_fn")
+		if (b == nil) || (b.Provider != "libbind_b.so") {
+			t.Errorf("Incorrect binding for bind_amd64's shared_fn: %v\n",
+				b)
+		}
+	}
+}
+
+func TestCopyRelocationType(t *testing.T) {
+	// These are R_386_COPY, R_X86_64_COPY, R_SPARC_COPY, R_PPC_COPY,
+	// R_PPC64_COPY, R_ARM_COPY, R_MIPS_COPY and R_AARCH64_COPY.
+	expected := map[MachineType]uint32{
+		MachineTypeX86:       5,
+		MachineTypeAMD64:     5,
+		MachineTypeSPARC:     19,
+		MachineTypeSPARCV9:   19,
+		MachineTypePowerPC:   19,
+		MachineTypePowerPC64: 19,
+		MachineTypeARM:       20,
+		MachineTypeMIPS:      126,
+		MachineTypeARM64:     1024,
+		MachineTypeAMDGPU:    0,
+	}
+	for machine, relocationType := range expected {
+		if copyRelocationType(machine) != relocationType {
+			t.Errorf("Expected copy relocation type %d for %s, got %d\n",
+				relocationType, machine, copyRelocationType(machine))
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package elf_reader
+
+// This file contains code for finding ELF files embedded in larger blobs,
+// such as firmware images and self-extracting installers.
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Holds an ELF file found in a larger blob by CarveELFFiles.
+type CarvedELF struct {
+	// The offset of the ELF file within the blob.
+	Offset uint64
+	// The ELF file's content. This is a sub-slice of the blob.
+	Content []byte
+	// The parsed ELF file.
+	File ELFFile
+}
+
+// Returns the end of the given range, or an error if it overflows.
+func rangeEnd(offset, size uint64) (uint64, error) {
+	end := offset + size
+	if end < offset {
+		return 0, fmt.Errorf("Offset 0x%x plus size 0x%x overflows", offset,
+			size)
+	}
+	return end, nil
+}
+
+// Returns the number of bytes spanned by the ELF file: the end of its
+// header, header tables, section contents or segment contents, whichever is
+// furthest.
+func getFileExtent(f ELFFile) (uint64, error) {
+	layout := getFileLayout(f)
+	toReturn := uint64(layout.HeaderSize)
+	end, e := rangeEnd(layout.ProgramHeaderOffset,
+		uint64(f.GetSegmentCount())*uint64(layout.ProgramHeaderEntrySize))
+	if e != nil {
+		return 0, fmt.Errorf("Invalid program header table: %w", e)
+	}
+	if (f.GetSegmentCount() != 0) && (end > toReturn) {
+		toReturn = end
+	}
+	end, e = rangeEnd(layout.SectionHeaderOffset,
+		uint64(f.GetSectionCount())*uint64(layout.SectionHeaderEntrySize))
+	if e != nil {
+		return 0, fmt.Errorf("Invalid section header table: %w", e)
+	}
+	if (f.GetSectionCount() != 0) && (end > toReturn) {
+		toReturn = end
+	}
+	for i := uint16(0); i < f.GetSectionCount(); i++ {
+		header, e := f.GetSectionHeader(i)
+		if e != nil {
+			return 0, e
+		}
+		if (header.GetType() == UninitializedSection) ||
+			(header.GetType() == 0) {
+			continue
+		}
+		end, e = rangeEnd(header.GetFileOffset(), header.GetSize())
+		if e != nil {
+			return 0, fmt.Errorf("Invalid section %d: %w", i, e)
+		}
+		if end > toReturn {
+			toReturn = end
+		}
+	}
+	for i := uint16(0); i < f.GetSegmentCount(); i++ {
+		header, e := f.GetProgramHeader(i)
+		if e != nil {
+			return 0, e
+		}
+		end, e = rangeEnd(header.GetFileOffset(), header.GetFileSize())
+		if e != nil {
+			return 0, fmt.Errorf("Invalid segment %d: %w", i, e)
+		}
+		if end > toReturn {
+			toReturn = end
+		}
+	}
+	return toReturn, nil
+}
+
+// Checks the header fields of a candidate ELF file that ReparseData doesn't,
+// in order to reject data that only happens to start with the ELF magic.
+func checkCarvedHeader(f ELFFile, data []byte) error {
+	if data[6] != 1 {
+		return fmt.Errorf("Invalid ELF version: %d", data[6])
+	}
+	fileType := f.GetFileType()
+	if (fileType == 0) || ((fileType > 4) && (fileType < 0xfe00)) {
+		return fmt.Errorf("Invalid ELF file type: %d", fileType)
+	}
+	headerSize, programHeaderSize, sectionHeaderSize :=
+		expectedHeaderSizes(f)
+	layout := getFileLayout(f)
+	if layout.HeaderSize != headerSize {
+		return fmt.Errorf("Invalid ELF header size: %d", layout.HeaderSize)
+	}
+	if (f.GetSegmentCount() == 0) && (f.GetSectionCount() == 0) {
+		return fmt.Errorf("The file has no segments or sections")
+	}
+	if (f.GetSegmentCount() != 0) &&
+		(layout.ProgramHeaderEntrySize != programHeaderSize) {
+		return fmt.Errorf("Invalid program header size: %d",
+			layout.ProgramHeaderEntrySize)
+	}
+	if (f.GetSectionCount() != 0) &&
+		(layout.SectionHeaderEntrySize != sectionHeaderSize) {
+		return fmt.Errorf("Invalid section header size: %d",
+			layout.SectionHeaderEntrySize)
+	}
+	return nil
+}
+
+// Attempts to parse an ELF file starting at the beginning of the given data,
+// which may be followed by unrelated bytes. Returns the carved file's content
+// and the file parsed from it.
+func carveELFFile(data []byte) ([]byte, ELFFile, error) {
+	f, e := ParseELFFile(data)
+	if e != nil {
+		return nil, nil, e
+	}
+	e = checkCarvedHeader(f, data)
+	if e != nil {
+		return nil, nil, e
+	}
+	extent, e := getFileExtent(f)
+	if e != nil {
+		return nil, nil, e
+	}
+	if extent > uint64(len(data)) {
+		return nil, nil, fmt.Errorf("The file's contents extend 0x%x bytes "+
+			"past the end of the data", extent-uint64(len(data)))
+	}
+	content := data[:extent]
+	// Parse the file again, so that its Raw buffer only holds its own
+	// content.
+	f, e = ParseELFFile(content)
+	if e != nil {
+		return nil, nil, e
+	}
+	return content, f, nil
+}
+
+// Finds the ELF files in the given blob, by searching for the ELF magic at
+// every offset and checking that the headers that follow it are valid and
+// lie within the blob. Each file's extent is the furthest end of its header,
+// header tables, sections and segments. ELF files embedded within other ELF
+// files are returned too, so the results may overlap. The results are sorted
+// by offset.
+func CarveELFFiles(blob []byte) []CarvedELF {
+	var toReturn []CarvedELF
+	magic := []byte("\x7fELF")
+	offset := 0
+	for {
+		i := bytes.Index(blob[offset:], magic)
+		if i < 0 {
+			break
+		}
+		offset += i
+		content, f, e := carveELFFile(blob[offset:])
+		if e == nil {
+			toReturn = append(toReturn, CarvedELF{
+				Offset:  uint64(offset),
+				Content: content,
+				File:    f,
+			})
+		}
+		offset++
+	}
+	return toReturn
+}
@@ -0,0 +1,50 @@
+package elf_reader
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCarveELFFiles(t *testing.T) {
+	sleep64 := fileBytes("test_data/sleep_amd64", t)
+	sleep32 := fileBytes("test_data/sleep_arm32", t)
+	// Build a blob with the files at odd offsets, separated by junk,
+	// including a bogus ELF magic and a truncated file at the end.
+	var blob bytes.Buffer
+	blob.WriteString("firmware header\x00\x7fELF junk")
+	offset64 := blob.Len()
+	blob.Write(sleep64)
+	blob.WriteString("\x00\x01\x02")
+	offset32 := blob.Len()
+	blob.Write(sleep32)
+	blob.Write(sleep64[:len(sleep64)/2])
+	results := CarveELFFiles(blob.Bytes())
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 carved ELF files, got %d\n", len(results))
+	}
+	expected := []struct {
+		offset  int
+		content []byte
+		machine MachineType
+	}{
+		{offset64, sleep64, MachineTypeAMD64},
+		{offset32, sleep32, MachineTypeARM},
+	}
+	for i, x := range expected {
+		r := &(results[i])
+		t.Logf("Found %s ELF file at offset %d, %d bytes\n",
+			r.File.GetMachineType(), r.Offset, len(r.Content))
+		if r.Offset != uint64(x.offset) {
+			t.Errorf("Expected file %d at offset %d, got %d\n", i, x.offset,
+				r.Offset)
+		}
+		if !bytes.Equal(r.Content, x.content) {
+			t.Errorf("File %d has incorrect content: expected %d bytes, "+
+				"got %d\n", i, len(x.content), len(r.Content))
+		}
+		if r.File.GetMachineType() != x.machine {
+			t.Errorf("File %d has the wrong machine type: %s\n", i,
+				r.File.GetMachineType())
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package elf_reader
+
+// This file contains code for attributing each byte of an ELF file to the
+// structure that contains it, in order to find data hidden in gaps between
+// sections or appended to the end of the file.
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Identifies what a CoverageRegion contains.
+type CoverageRegionKind uint8
+
+const (
+	// The ELF header at the start of the file.
+	CoverageELFHeader CoverageRegionKind = iota
+	// The program header table.
+	CoverageProgramHeaders
+	// The section header table.
+	CoverageSectionHeaders
+	// The content of a section.
+	CoverageSection
+	// Part of a segment that isn't in any section.
+	CoverageSegment
+	// Bytes between other regions, not covered by anything.
+	CoverageGap
+	// Bytes after the end of everything else in the file.
+	CoverageOverlay
+)
+
+func (k CoverageRegionKind) String() string {
+	switch k {
+	case CoverageELFHeader:
+		return "ELF header"
+	case CoverageProgramHeaders:
+		return "program headers"
+	case CoverageSectionHeaders:
+		return "section headers"
+	case CoverageSection:
+		return "section"
+	case CoverageSegment:
+		return "segment only"
+	case CoverageGap:
+		return "gap"
+	case CoverageOverlay:
+		return "overlay"
+	}
+	return fmt.Sprintf("unknown region kind %d", k)
+}
+
+// Holds a range of bytes in an ELF file, and what it contains.
+type CoverageRegion struct {
+	Offset uint64
+	Size   uint64
+	Kind   CoverageRegionKind
+	// The section name for sections, or the segment's index and type for
+	// segment-only regions. Empty for other kinds of region.
+	Name string `json:",omitempty"`
+	// The Shannon entropy of the region's content, from 0 to 8 bits per
+	// byte. Only set for gaps and overlays. Zero padding has an entropy of 0,
+	// while compressed or encrypted data is close to 8.
+	Entropy float64 `json:",omitempty"`
+}
+
+func (r *CoverageRegion) String() string {
+	s := fmt.Sprintf("0x%08x  0x%08x  %-15s", r.Offset, r.Size, r.Kind)
+	switch r.Kind {
+	case CoverageGap, CoverageOverlay:
+		s += fmt.Sprintf("  entropy %.2f", r.Entropy)
+	default:
+		if r.Name != "" {
+			s += "  " + r.Name
+		}
+	}
+	return strings.TrimRight(s, " ")
+}
+
+// Attributes every byte in an ELF file to the ELF header, one of the header
+// tables, a section, a segment, a gap or a trailing overlay.
+type CoverageMap struct {
+	// The size of the file, in bytes.
+	FileSize uint64
+	// Contiguous regions covering the entire file, sorted by offset. Where
+	// structures overlap, bytes are attributed to the ELF header first, then
+	// the program header table, the section header table, sections, and
+	// finally segments.
+	Regions []CoverageRegion
+}
+
+// Returns the gaps between other regions.
+func (m *CoverageMap) Gaps() []CoverageRegion {
+	var toReturn []CoverageRegion
+	for _, r := range m.Regions {
+		if r.Kind == CoverageGap {
+			toReturn = append(toReturn, r)
+		}
+	}
+	return toReturn
+}
+
+// Returns the data appended after the end of everything else in the file, or
+// nil if there isn't any.
+func (m *CoverageMap) Overlay() *CoverageRegion {
+	if len(m.Regions) == 0 {
+		return nil
+	}
+	last := &(m.Regions[len(m.Regions)-1])
+	if last.Kind != CoverageOverlay {
+		return nil
+	}
+	return last
+}
+
+func (m *CoverageMap) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-10s  %-10s  %s\n", "Offset", "Size", "Contents")
+	var gapBytes uint64
+	gaps := m.Gaps()
+	for i := range m.Regions {
+		fmt.Fprintf(&b, "%s\n", &(m.Regions[i]))
+	}
+	for _, g := range gaps {
+		gapBytes += g.Size
+	}
+	fmt.Fprintf(&b, "%d bytes in %d gaps", gapBytes, len(gaps))
+	overlay := m.Overlay()
+	if overlay == nil {
+		b.WriteString(", no overlay\n")
+	} else {
+		fmt.Fprintf(&b, ", %d-byte overlay with entropy %.2f\n",
+			overlay.Size, overlay.Entropy)
+	}
+	return b.String()
+}
+
+// Returns the Shannon entropy of the data, in bits per byte.
+func getEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	toReturn := 0.0
+	total := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / total
+		toReturn -= p * math.Log2(p)
+	}
+	return toReturn
+}
+
+// A structure in the file that is attributed the bytes it spans, unless an
+// earlier structure also spans them.
+type coverageSpan struct {
+	start, end uint64
+	kind       CoverageRegionKind
+	name       string
+}
+
+// A min-heap of indices into a slice of coverageSpans, used to find the
+// highest-priority span containing an offset.
+type coverageSpanHeap []int
+
+func (h coverageSpanHeap) Len() int {
+	return len(h)
+}
+
+func (h coverageSpanHeap) Less(i, j int) bool {
+	return h[i] < h[j]
+}
+
+func (h coverageSpanHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *coverageSpanHeap) Push(v interface{}) {
+	*h = append(*h, v.(int))
+}
+
+func (h *coverageSpanHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+// Returns the structures in the file that contain bytes, in priority order,
+// with their ends limited to the size of the file.
+func getCoverageSpans(f ELFFile, fileSize uint64) ([]coverageSpan, error) {
+	var toReturn []coverageSpan
+	add := func(offset, size uint64, kind CoverageRegionKind,
+		name string) {
+		if (size == 0) || (offset >= fileSize) {
+			return
+		}
+		end := offset + size
+		if (end > fileSize) || (end < offset) {
+			end = fileSize
+		}
+		toReturn = append(toReturn, coverageSpan{
+			start: offset,
+			end:   end,
+			kind:  kind,
+			name:  name,
+		})
+	}
+	layout := getFileLayout(f)
+	add(0, uint64(layout.HeaderSize), CoverageELFHeader, "")
+	if f.GetSegmentCount() != 0 {
+		add(layout.ProgramHeaderOffset, uint64(f.GetSegmentCount())*
+			uint64(layout.ProgramHeaderEntrySize), CoverageProgramHeaders, "")
+	}
+	if f.GetSectionCount() != 0 {
+		add(layout.SectionHeaderOffset, uint64(f.GetSectionCount())*
+			uint64(layout.SectionHeaderEntrySize), CoverageSectionHeaders, "")
+	}
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		header, e := f.GetSectionHeader(i)
+		if e != nil {
+			return nil, e
+		}
+		if header.GetType() == UninitializedSection {
+			continue
+		}
+		name, e := f.GetSectionName(i)
+		if (e != nil) || (name == "") {
+			name = fmt.Sprintf("section %d", i)
+		}
+		add(header.GetFileOffset(), header.GetSize(), CoverageSection, name)
+	}
+	for i := uint16(0); i < f.GetSegmentCount(); i++ {
+		header, e := f.GetProgramHeader(i)
+		if e != nil {
+			return nil, e
+		}
+		add(header.GetFileOffset(), header.GetFileSize(), CoverageSegment,
+			fmt.Sprintf("segment %d (%s)", i, header.GetType()))
+	}
+	return toReturn, nil
+}
+
+// Returns a map attributing every byte of the file's Raw buffer to the
+// structure that contains it, including gaps not covered by any structure,
+// and any overlay appended after the end of the last structure.
+func GetCoverageMap(f ELFFile) (*CoverageMap, error) {
+	raw := fileRaw(f)
+	fileSize := uint64(len(raw))
+	spans, e := getCoverageSpans(f, fileSize)
+	if e != nil {
+		return nil, e
+	}
+	// Split the file at each span boundary, and find the first span
+	// covering each piece.
+	boundaryMap := map[uint64]bool{0: true, fileSize: true}
+	var lastEnd uint64
+	for _, s := range spans {
+		boundaryMap[s.start] = true
+		boundaryMap[s.end] = true
+		if s.end > lastEnd {
+			lastEnd = s.end
+		}
+	}
+	boundaries := make([]uint64, 0, len(boundaryMap))
+	for b := range boundaryMap {
+		boundaries = append(boundaries, b)
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i] < boundaries[j]
+	})
+	toReturn := &CoverageMap{
+		FileSize: fileSize,
+	}
+	// Sweep over the pieces in order, keeping a heap of the spans that have
+	// started, so the first span covering each piece is at the top once the
+	// spans ending before it are removed.
+	byStart := make([]int, len(spans))
+	for i := range byStart {
+		byStart[i] = i
+	}
+	sort.SliceStable(byStart, func(i, j int) bool {
+		return spans[byStart[i]].start < spans[byStart[j]].start
+	})
+	var active coverageSpanHeap
+	nextSpan := 0
+	for i := 0; i < (len(boundaries) - 1); i++ {
+		start, end := boundaries[i], boundaries[i+1]
+		for (nextSpan < len(byStart)) &&
+			(spans[byStart[nextSpan]].start <= start) {
+			heap.Push(&active, byStart[nextSpan])
+			nextSpan++
+		}
+		// Spans never end between two boundaries, so any remaining span
+		// covers the whole piece.
+		for (len(active) != 0) && (spans[active[0]].end <= start) {
+			heap.Pop(&active)
+		}
+		var covering *coverageSpan
+		if len(active) != 0 {
+			covering = &(spans[active[0]])
+		}
+		region := CoverageRegion{
+			Offset: start,
+			Size:   end - start,
+		}
+		if covering != nil {
+			region.Kind = covering.kind
+			region.Name = covering.name
+		} else if start >= lastEnd {
+			region.Kind = CoverageOverlay
+		} else {
+			region.Kind = CoverageGap
+		}
+		// Merge adjacent pieces attributed to the same thing.
+		count := len(toReturn.Regions)
+		if count != 0 {
+			previous := &(toReturn.Regions[count-1])
+			if (previous.Kind == region.Kind) &&
+				(previous.Name == region.Name) {
+				previous.Size += region.Size
+				continue
+			}
+		}
+		toReturn.Regions = append(toReturn.Regions, region)
+	}
+	for i := range toReturn.Regions {
+		r := &(toReturn.Regions[i])
+		if (r.Kind == CoverageGap) || (r.Kind == CoverageOverlay) {
+			r.Entropy = getEntropy(raw[r.Offset : r.Offset+r.Size])
+		}
+	}
+	return toReturn, nil
+}
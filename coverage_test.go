@@ -0,0 +1,90 @@
+package elf_reader
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoverageMap(t *testing.T) {
+	original := fileBytes("test_data/sleep_amd64", t)
+	f, e := ParseELFFile(original)
+	if e != nil {
+		t.Fatalf("Failed parsing test file: %s\n", e)
+	}
+	m, e := GetCoverageMap(f)
+	if e != nil {
+		t.Fatalf("Failed getting coverage map: %s\n", e)
+	}
+	t.Logf("Coverage map:\n%s", m)
+	var total uint64
+	for i, r := range m.Regions {
+		if r.Offset != total {
+			t.Errorf("Region %d starts at 0x%x, expected 0x%x\n", i, r.Offset,
+				total)
+		}
+		total += r.Size
+	}
+	if total != uint64(len(original)) {
+		t.Errorf("Regions cover %d bytes, expected %d\n", total,
+			len(original))
+	}
+	if (m.Regions[0].Kind != CoverageELFHeader) || (m.Regions[0].Size != 64) {
+		t.Errorf("Incorrect first region: %s\n", &(m.Regions[0]))
+	}
+	if m.Overlay() != nil {
+		t.Errorf("Got an unexpected overlay: %s\n", m.Overlay())
+	}
+	foundText := false
+	for _, r := range m.Regions {
+		if (r.Kind == CoverageSection) && (r.Name == ".text") {
+			foundText = true
+		}
+	}
+	if !foundText {
+		t.Errorf("Didn't find the .text section\n")
+	}
+
+	// Append an overlay, and hide some data in the gap between the two
+	// loadable segments.
+	modified := append([]byte{}, original...)
+	copy(modified[0x900:], "hidden")
+	modified = append(modified, []byte("appended overlay data")...)
+	f, e = ParseELFFile(modified)
+	if e != nil {
+		t.Fatalf("Failed parsing modified file: %s\n", e)
+	}
+	m, e = GetCoverageMap(f)
+	if e != nil {
+		t.Fatalf("Failed getting modified coverage map: %s\n", e)
+	}
+	overlay := m.Overlay()
+	if overlay == nil {
+		t.Fatalf("Didn't find the appended overlay\n")
+	}
+	if (overlay.Offset != uint64(len(original))) || (overlay.Size != 21) {
+		t.Errorf("Incorrect overlay: %s\n", overlay)
+	}
+	if (overlay.Entropy < 3) || (overlay.Entropy > 5) {
+		t.Errorf("Unexpected overlay entropy: %f\n", overlay.Entropy)
+	}
+	foundHidden := false
+	for _, g := range m.Gaps() {
+		if (g.Offset <= 0x900) && ((g.Offset + g.Size) >= 0x906) {
+			foundHidden = g.Entropy > 0
+		}
+	}
+	if !foundHidden {
+		t.Errorf("Didn't find the gap containing hidden data\n")
+	}
+	zeros := make([]byte, 100)
+	if getEntropy(zeros) != 0 {
+		t.Errorf("Got nonzero entropy for zeros: %f\n", getEntropy(zeros))
+	}
+	for i := range zeros {
+		zeros[i] = byte(i)
+	}
+	if math.Abs(getEntropy(zeros[:64])-6) > 0.0001 {
+		t.Errorf("Expected entropy 6 for 64 distinct bytes, got %f\n",
+			getEntropy(zeros[:64]))
+	}
+}
@@ -0,0 +1,218 @@
+package elf_reader
+
+// This file contains a reader for cpio archives, which are used as the
+// payload of .rpm packages and initramfs images. The "new" (newc), "crc" and
+// portable ASCII (odc) formats are supported.
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The magic strings at the start of each header in the supported cpio
+// formats.
+const (
+	CPIONewMagic      = "070701"
+	CPIOCRCMagic      = "070702"
+	CPIOPortableMagic = "070707"
+)
+
+// The name of the entry marking the end of a cpio archive.
+const cpioTrailerName = "TRAILER!!!"
+
+// The limit on the length of names in cpio headers, to avoid allocating
+// huge buffers for corrupt headers.
+const cpioMaxNameSize = 65536
+
+// Holds the header of a single entry in a cpio archive.
+type CPIOHeader struct {
+	Name    string
+	Inode   uint32
+	Mode    uint32
+	UID     uint32
+	GID     uint32
+	Links   uint32
+	ModTime uint64
+	Size    uint64
+}
+
+// Returns true if the entry is a regular file.
+func (h *CPIOHeader) IsRegular() bool {
+	return (h.Mode & 0170000) == 0100000
+}
+
+// Returns true if the data starts with the magic string of a supported cpio
+// format.
+func IsCPIOArchive(content []byte) bool {
+	if len(content) < 6 {
+		return false
+	}
+	magic := string(content[:6])
+	return (magic == CPIONewMagic) || (magic == CPIOCRCMagic) ||
+		(magic == CPIOPortableMagic)
+}
+
+// Reads the entries in a cpio archive, in the same way as tar.Reader.
+type CPIOReader struct {
+	input io.Reader
+	// The number of bytes of the current entry's content that haven't been
+	// read yet.
+	remaining uint64
+	// The number of padding bytes following the current entry's content.
+	padding uint64
+	done    bool
+}
+
+// Returns a reader for the cpio archive read from the given input.
+func NewCPIOReader(input io.Reader) *CPIOReader {
+	return &CPIOReader{
+		input: input,
+	}
+}
+
+// Parses the fields of a cpio header. Each field is the given number of
+// digits in the given base.
+func parseCPIOFields(data []byte, sizes []int, base int) ([]uint64, error) {
+	toReturn := make([]uint64, len(sizes))
+	offset := 0
+	for i, size := range sizes {
+		v, e := strconv.ParseUint(string(data[offset:offset+size]), base, 64)
+		if e != nil {
+			return nil, fmt.Errorf("Invalid cpio header field %d: %w", i, e)
+		}
+		toReturn[i] = v
+		offset += size
+	}
+	return toReturn, nil
+}
+
+// Returns the number of bytes needed to pad the given size to a multiple of
+// 4.
+func cpioPadding(size uint64) uint64 {
+	return (4 - (size & 3)) & 3
+}
+
+// Skips the remainder of the current entry, including its padding.
+func (r *CPIOReader) skipEntry() error {
+	toSkip := int64(r.remaining + r.padding)
+	r.remaining = 0
+	r.padding = 0
+	if toSkip == 0 {
+		return nil
+	}
+	_, e := io.CopyN(io.Discard, r.input, toSkip)
+	if e == io.EOF {
+		e = io.ErrUnexpectedEOF
+	}
+	return e
+}
+
+// Advances to the next entry in the archive, skipping any unread content of
+// the current one. Returns io.EOF at the end of the archive.
+func (r *CPIOReader) Next() (*CPIOHeader, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	e := r.skipEntry()
+	if e != nil {
+		return nil, fmt.Errorf("Failed skipping cpio entry: %w", e)
+	}
+	magic := make([]byte, 6)
+	_, e = io.ReadFull(r.input, magic)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading cpio header: %w", e)
+	}
+	var fields []uint64
+	var nameSize, headerSize uint64
+	toReturn := &CPIOHeader{}
+	portable := string(magic) == CPIOPortableMagic
+	if portable {
+		data := make([]byte, 70)
+		_, e = io.ReadFull(r.input, data)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading cpio header: %w", e)
+		}
+		// dev, ino, mode, uid, gid, nlink, rdev, mtime, namesize, filesize
+		fields, e = parseCPIOFields(data, []int{6, 6, 6, 6, 6, 6, 6, 11, 6,
+			11}, 8)
+		if e != nil {
+			return nil, e
+		}
+		toReturn.Inode = uint32(fields[1])
+		toReturn.Mode = uint32(fields[2])
+		toReturn.UID = uint32(fields[3])
+		toReturn.GID = uint32(fields[4])
+		toReturn.Links = uint32(fields[5])
+		toReturn.ModTime = fields[7]
+		nameSize = fields[8]
+		toReturn.Size = fields[9]
+		headerSize = 76
+	} else if (string(magic) == CPIONewMagic) ||
+		(string(magic) == CPIOCRCMagic) {
+		data := make([]byte, 104)
+		_, e = io.ReadFull(r.input, data)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading cpio header: %w", e)
+		}
+		// ino, mode, uid, gid, nlink, mtime, filesize, devmajor, devminor,
+		// rdevmajor, rdevminor, namesize, check
+		sizes := make([]int, 13)
+		for i := range sizes {
+			sizes[i] = 8
+		}
+		fields, e = parseCPIOFields(data, sizes, 16)
+		if e != nil {
+			return nil, e
+		}
+		toReturn.Inode = uint32(fields[0])
+		toReturn.Mode = uint32(fields[1])
+		toReturn.UID = uint32(fields[2])
+		toReturn.GID = uint32(fields[3])
+		toReturn.Links = uint32(fields[4])
+		toReturn.ModTime = fields[5]
+		toReturn.Size = fields[6]
+		nameSize = fields[11]
+		headerSize = 110
+	} else {
+		return nil, fmt.Errorf("Invalid cpio header magic: %q", magic)
+	}
+	if (nameSize == 0) || (nameSize > cpioMaxNameSize) {
+		return nil, fmt.Errorf("Invalid cpio name size: %d", nameSize)
+	}
+	// In the newc and crc formats, the name is padded so that the header
+	// and name are a multiple of 4 bytes, as is the content.
+	nameBytes := nameSize
+	if !portable {
+		nameBytes += cpioPadding(headerSize + nameSize)
+		r.padding = cpioPadding(toReturn.Size)
+	}
+	name := make([]byte, nameBytes)
+	_, e = io.ReadFull(r.input, name)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading cpio entry name: %w", e)
+	}
+	toReturn.Name = string(name[:nameSize-1])
+	r.remaining = toReturn.Size
+	if toReturn.Name == cpioTrailerName {
+		r.done = true
+		return nil, io.EOF
+	}
+	return toReturn, nil
+}
+
+// Reads the content of the current entry.
+func (r *CPIOReader) Read(data []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	if uint64(len(data)) > r.remaining {
+		data = data[:r.remaining]
+	}
+	n, e := r.input.Read(data)
+	r.remaining -= uint64(n)
+	if (e == io.EOF) && (r.remaining != 0) {
+		e = io.ErrUnexpectedEOF
+	}
+	return n, e
+}
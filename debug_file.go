@@ -0,0 +1,237 @@
+package elf_reader
+
+// This file contains code for finding the separate debug files referred to by
+// stripped ELF files, using the same search paths as gdb.
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+// The directory searched for separate debug files if no other directories
+// are specified.
+const DefaultDebugRoot = "/usr/lib/debug"
+
+// Holds the content of a .gnu_debuglink section.
+type DebugLink struct {
+	// The name of the debug file, without any directories.
+	Name string
+	// The CRC32 checksum of the debug file's content.
+	CRC uint32
+}
+
+// Holds the content of a .gnu_debugaltlink section, which refers to a
+// supplementary debug file containing debugging information shared between
+// several files, e.g. as created by dwz.
+type DebugAltLink struct {
+	// The path to the supplementary file. If it's relative, it's relative to
+	// the directory containing the file with the link.
+	Name string
+	// The build ID of the supplementary file.
+	BuildID []byte
+}
+
+// Controls where FindDebugFile and FindAltDebugFile search for files. A nil
+// *DebugFileOptions searches only DefaultDebugRoot.
+type DebugFileOptions struct {
+	// The directories to search for debug files, in order. Each directory is
+	// searched for paths based on the build ID, e.g.
+	// <root>/.build-id/ab/cdef.debug, and for the name in the debug link
+	// under the directory containing the binary, e.g. <root>/usr/bin/name.
+	// If this is empty, DefaultDebugRoot is used.
+	DebugRoots []string
+}
+
+func (o *DebugFileOptions) debugRoots() []string {
+	if (o == nil) || (len(o.DebugRoots) == 0) {
+		return []string{DefaultDebugRoot}
+	}
+	return o.DebugRoots
+}
+
+// Returns the content of the section with the given name.
+func namedSectionContent(f ELFFile, name string) ([]byte, error) {
+	index, e := FindSectionByName(f, name)
+	if e != nil {
+		return nil, e
+	}
+	return f.GetSectionContent(index)
+}
+
+// Returns the content of the file's .gnu_debuglink section.
+func GetDebugLink(f ELFFile) (*DebugLink, error) {
+	content, e := namedSectionContent(f, ".gnu_debuglink")
+	if e != nil {
+		return nil, e
+	}
+	end := bytes.IndexByte(content, 0)
+	if end <= 0 {
+		return nil, fmt.Errorf("Invalid .gnu_debuglink file name")
+	}
+	// The CRC follows the name's null terminator, aligned to 4 bytes.
+	crcOffset := alignUp(uint64(end)+1, 4)
+	if (crcOffset + 4) > uint64(len(content)) {
+		return nil, fmt.Errorf("The .gnu_debuglink section is missing the "+
+			"CRC: %w", ErrTruncated)
+	}
+	return &DebugLink{
+		Name: string(content[:end]),
+		CRC:  fileEndianness(f).Uint32(content[crcOffset:]),
+	}, nil
+}
+
+// Returns the content of the file's .gnu_debugaltlink section.
+func GetDebugAltLink(f ELFFile) (*DebugAltLink, error) {
+	content, e := namedSectionContent(f, ".gnu_debugaltlink")
+	if e != nil {
+		return nil, e
+	}
+	end := bytes.IndexByte(content, 0)
+	if end <= 0 {
+		return nil, fmt.Errorf("Invalid .gnu_debugaltlink file name")
+	}
+	if (end + 1) >= len(content) {
+		return nil, fmt.Errorf("The .gnu_debugaltlink section is missing "+
+			"the build ID: %w", ErrTruncated)
+	}
+	return &DebugAltLink{
+		Name:    string(content[:end]),
+		BuildID: append([]byte{}, content[end+1:]...),
+	}, nil
+}
+
+// Returns the path to the debug file with the given build ID under the root
+// directory, e.g. <root>/.build-id/ab/cdef.debug. Returns an empty string if
+// the build ID is too short.
+func buildIDPath(root string, buildID []byte) string {
+	if len(buildID) < 2 {
+		return ""
+	}
+	s := hex.EncodeToString(buildID)
+	return filepath.Join(root, ".build-id", s[:2], s[2:]+".debug")
+}
+
+// Reads and parses the ELF file at the given path, returning nil if it can't
+// be read or parsed, or if check returns false for its content.
+func readDebugFile(path string, check func(content []byte,
+	f ELFFile) bool) ELFFile {
+	content, e := os.ReadFile(path)
+	if e != nil {
+		return nil
+	}
+	f, e := ParseELFFile(content)
+	if (e != nil) || !check(content, f) {
+		return nil
+	}
+	return f
+}
+
+// Returns a function that checks whether a file has the given build ID.
+func matchBuildID(buildID []byte) func([]byte, ELFFile) bool {
+	return func(content []byte, f ELFFile) bool {
+		id, e := GetBuildID(f)
+		return (e == nil) && bytes.Equal(id, buildID)
+	}
+}
+
+// Searches for the separate debug file for f, which was read from the given
+// path. Files are first looked up by f's build ID under each of the debug
+// roots. Next, if f has a .gnu_debuglink section, the file it names is looked
+// for in the directory containing f, in a .debug subdirectory of it, and
+// under each debug root, e.g. <root>/usr/bin/<name> for /usr/bin/<binary>.
+// Files found using the build ID must have the same build ID, and files found
+// using the debug link must match its CRC. Returns the debug file and its
+// path. The returned error wraps os.ErrNotExist if no debug file was found.
+func FindDebugFile(f ELFFile, path string,
+	options *DebugFileOptions) (ELFFile, string, error) {
+	roots := options.debugRoots()
+	buildID, e := GetBuildID(f)
+	if e == nil {
+		check := matchBuildID(buildID)
+		for _, root := range roots {
+			candidate := buildIDPath(root, buildID)
+			if candidate == "" {
+				break
+			}
+			debugFile := readDebugFile(candidate, check)
+			if debugFile != nil {
+				return debugFile, candidate, nil
+			}
+		}
+	}
+	link, e := GetDebugLink(f)
+	if e != nil {
+		return nil, "", fmt.Errorf("No debug file found by build ID, and "+
+			"no usable debug link: %s: %w", e, os.ErrNotExist)
+	}
+	directory, e := filepath.Abs(filepath.Dir(path))
+	if e != nil {
+		return nil, "", fmt.Errorf("Failed getting the binary's "+
+			"directory: %w", e)
+	}
+	candidates := []string{
+		filepath.Join(directory, link.Name),
+		filepath.Join(directory, ".debug", link.Name),
+	}
+	for _, root := range roots {
+		candidates = append(candidates, filepath.Join(root, directory,
+			link.Name))
+	}
+	check := func(content []byte, f ELFFile) bool {
+		return crc32.ChecksumIEEE(content) == link.CRC
+	}
+	binaryPath, _ := filepath.Abs(path)
+	for _, candidate := range candidates {
+		// Don't return the binary itself if it happens to share the name.
+		if candidate == binaryPath {
+			continue
+		}
+		debugFile := readDebugFile(candidate, check)
+		if debugFile != nil {
+			return debugFile, candidate, nil
+		}
+	}
+	return nil, "", fmt.Errorf("Couldn't find debug file %s: %w", link.Name,
+		os.ErrNotExist)
+}
+
+// Searches for the supplementary debug file named in the .gnu_debugaltlink
+// section of debugFile, which was read from the given path. The file is
+// first looked up by its build ID under each of the debug roots, and then
+// using the path in the link, relative to the directory containing
+// debugFile. The file must have the build ID given in the link. Returns the
+// supplementary file and its path. The returned error wraps os.ErrNotExist if
+// the file wasn't found.
+func FindAltDebugFile(debugFile ELFFile, path string,
+	options *DebugFileOptions) (ELFFile, string, error) {
+	link, e := GetDebugAltLink(debugFile)
+	if e != nil {
+		return nil, "", e
+	}
+	var candidates []string
+	for _, root := range options.debugRoots() {
+		candidate := buildIDPath(root, link.BuildID)
+		if candidate != "" {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if filepath.IsAbs(link.Name) {
+		candidates = append(candidates, link.Name)
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(path),
+			link.Name))
+	}
+	check := matchBuildID(link.BuildID)
+	for _, candidate := range candidates {
+		f := readDebugFile(candidate, check)
+		if f != nil {
+			return f, candidate, nil
+		}
+	}
+	return nil, "", fmt.Errorf("Couldn't find supplementary debug file %s: "+
+		"%w", link.Name, os.ErrNotExist)
+}
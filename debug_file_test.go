@@ -0,0 +1,174 @@
+package elf_reader
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes the content to the given path, creating any missing directories.
+func writeTestFile(path string, content []byte, t *testing.T) {
+	e := os.MkdirAll(filepath.Dir(path), 0755)
+	if e != nil {
+		t.Fatalf("Failed creating directory for %s: %s\n", path, e)
+	}
+	e = os.WriteFile(path, content, 0644)
+	if e != nil {
+		t.Fatalf("Failed writing %s: %s\n", path, e)
+	}
+}
+
+// Checks that searching for a debug file finds the expected path. An empty
+// expected path means that no file should be found.
+func checkDebugFileSearch(found ELFFile, path string, e error,
+	expectedPath string, t *testing.T) {
+	if expectedPath == "" {
+		if !errors.Is(e, os.ErrNotExist) {
+			t.Errorf("Expected a not-found error, got %v (found %s)\n", e,
+				path)
+		}
+		return
+	}
+	if e != nil {
+		t.Errorf("Failed finding %s: %s\n", expectedPath, e)
+		return
+	}
+	if (found == nil) || (path != expectedPath) {
+		t.Errorf("Expected to find %s, got %s\n", expectedPath, path)
+	}
+}
+
+func TestFindDebugFile(t *testing.T) {
+	original, e := ParseELFFile(fileBytes("test_data/sleep_arm32", t))
+	if e != nil {
+		t.Fatalf("Failed parsing sleep_arm32: %s\n", e)
+	}
+	debugContent, e := Strip(original, &StripOptions{
+		Mode: StripOnlyKeepDebug,
+	})
+	if e != nil {
+		t.Fatalf("Failed creating debug file: %s\n", e)
+	}
+	stripped, e := Strip(original, &StripOptions{
+		Mode:             StripAll,
+		DebugLinkName:    "sleep_arm32.debug",
+		DebugFileContent: debugContent,
+	})
+	if e != nil {
+		t.Fatalf("Failed stripping file: %s\n", e)
+	}
+	f, e := ParseELFFile(stripped)
+	if e != nil {
+		t.Fatalf("Failed parsing stripped file: %s\n", e)
+	}
+	link, e := GetDebugLink(f)
+	if e != nil {
+		t.Fatalf("Failed reading debug link: %s\n", e)
+	}
+	if (link.Name != "sleep_arm32.debug") ||
+		(link.CRC != crc32.ChecksumIEEE(debugContent)) {
+		t.Errorf("Incorrect debug link: %v\n", link)
+	}
+	_, e = GetDebugLink(original)
+	if e == nil {
+		t.Errorf("Didn't get an error for a file without a debug link\n")
+	}
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "debug")
+	options := &DebugFileOptions{
+		DebugRoots: []string{root},
+	}
+	binDir := filepath.Join(dir, "bin")
+	binaryPath := filepath.Join(binDir, "sleep_arm32")
+	writeTestFile(binaryPath, stripped, t)
+	found, path, e := FindDebugFile(f, binaryPath, options)
+	checkDebugFileSearch(found, path, e, "", t)
+
+	// Files with the wrong CRC or build ID must be ignored.
+	writeTestFile(filepath.Join(binDir, "sleep_arm32.debug"), stripped, t)
+	writeTestFile(filepath.Join(root, ".build-id", "17",
+		"5e726d21fdda821839f4fe38428f8ad6c5e5fa.debug"),
+		fileBytes("test_data/sleep_amd64", t), t)
+	found, path, e = FindDebugFile(f, binaryPath, options)
+	checkDebugFileSearch(found, path, e, "", t)
+
+	expected := filepath.Join(root, binDir, "sleep_arm32.debug")
+	writeTestFile(expected, debugContent, t)
+	found, path, e = FindDebugFile(f, binaryPath, options)
+	checkDebugFileSearch(found, path, e, expected, t)
+
+	// The .debug directory takes precedence over the debug roots.
+	expected = filepath.Join(binDir, ".debug", "sleep_arm32.debug")
+	writeTestFile(expected, debugContent, t)
+	found, path, e = FindDebugFile(f, binaryPath, options)
+	checkDebugFileSearch(found, path, e, expected, t)
+
+	// Build IDs take precedence over debug links.
+	expected = filepath.Join(root, ".build-id", "17",
+		"5e726d21fdda821839f4fe38428f8ad6c5e5fa.debug")
+	writeTestFile(expected, debugContent, t)
+	found, path, e = FindDebugFile(f, binaryPath, options)
+	checkDebugFileSearch(found, path, e, expected, t)
+	if found == nil {
+		return
+	}
+	index, e := FindSectionByName(found, ".symtab")
+	if e != nil {
+		t.Errorf("The debug file doesn't contain a symbol table\n")
+	}
+	if _, _, e = found.GetSymbols(index); e != nil {
+		t.Errorf("Failed reading the debug file's symbols: %s\n", e)
+	}
+}
+
+func TestFindAltDebugFile(t *testing.T) {
+	f := parseTestELF64("test_data/layout_altlink_amd64.o", t)
+	link, e := GetDebugAltLink(f)
+	if e != nil {
+		t.Fatalf("Failed reading debug alt link: %s\n", e)
+	}
+	common := parseTestELF64("test_data/hello_debug_amd64", t)
+	buildID, e := GetBuildID(common)
+	if e != nil {
+		t.Fatalf("Failed reading build ID: %s\n", e)
+	}
+	if (link.Name != "../dwz/hello_common.debug") ||
+		!bytes.Equal(link.BuildID, buildID) {
+		t.Errorf("Incorrect debug alt link: %s, % x\n", link.Name,
+			link.BuildID)
+	}
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "debug")
+	options := &DebugFileOptions{
+		DebugRoots: []string{root},
+	}
+	debugPath := filepath.Join(dir, "files", "layout.debug")
+	found, path, e := FindAltDebugFile(f, debugPath, options)
+	checkDebugFileSearch(found, path, e, "", t)
+
+	// The file is ignored if the build ID doesn't match.
+	expected := filepath.Join(dir, "dwz", "hello_common.debug")
+	writeTestFile(expected, fileBytes("test_data/sleep_amd64", t), t)
+	found, path, e = FindAltDebugFile(f, debugPath, options)
+	checkDebugFileSearch(found, path, e, "", t)
+
+	writeTestFile(expected, common.Raw, t)
+	found, path, e = FindAltDebugFile(f, debugPath, options)
+	checkDebugFileSearch(found, path, e, expected, t)
+
+	expected = filepath.Join(root, ".build-id", "59",
+		"b74a252132bc988b7e3c7e3fc80c099f1f2f60.debug")
+	writeTestFile(expected, common.Raw, t)
+	found, path, e = FindAltDebugFile(f, debugPath, options)
+	checkDebugFileSearch(found, path, e, expected, t)
+
+	_, _, e = FindAltDebugFile(common, "hello_debug_amd64", options)
+	if e == nil {
+		t.Errorf("Didn't get an error for a file without an alt link\n")
+	}
+}
@@ -0,0 +1,630 @@
+package elf_reader
+
+// This file contains code for finding structural differences between two ELF
+// files, e.g. to find out why two builds of the same program aren't
+// identical.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Indicates whether an ELFDifference is for something that was added,
+// removed or changed.
+type DifferenceKind uint8
+
+const (
+	DifferenceChanged DifferenceKind = iota
+	DifferenceAdded
+	DifferenceRemoved
+)
+
+func (k DifferenceKind) String() string {
+	switch k {
+	case DifferenceChanged:
+		return "changed"
+	case DifferenceAdded:
+		return "added"
+	case DifferenceRemoved:
+		return "removed"
+	}
+	return fmt.Sprintf("unknown difference kind %d", uint8(k))
+}
+
+// Describes a single difference between two ELF files.
+type ELFDifference struct {
+	Kind DifferenceKind
+	// Identifies the item that differs, e.g. "entry point" or "main in
+	// .symtab".
+	Item string
+	// The item's value in the first file. Empty if the item was added.
+	Old string
+	// The item's value in the second file. Empty if the item was removed.
+	New string
+}
+
+func (d *ELFDifference) String() string {
+	switch d.Kind {
+	case DifferenceAdded:
+		return fmt.Sprintf("+ %s: %s", d.Item, d.New)
+	case DifferenceRemoved:
+		return fmt.Sprintf("- %s: %s", d.Item, d.Old)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", d.Item, d.Old, d.New)
+}
+
+// A range of byte offsets, relative to the start of a section. The End is
+// one past the last differing byte.
+type ByteRange struct {
+	Start uint64
+	End   uint64
+}
+
+// Describes a section whose content differs between two ELF files.
+type SectionContentDifference struct {
+	// The name of the section. Sections with duplicate names are followed by
+	// a number in parentheses, e.g. ".text (2)".
+	Section string
+	// SHA-256 hashes of the section's content in each file, in hex.
+	OldHash string
+	NewHash string
+	OldSize uint64
+	NewSize uint64
+	// The ranges of bytes that differ. If the sizes differ, the final range
+	// covers everything past the end of the shorter content.
+	Ranges []ByteRange
+}
+
+func (d *SectionContentDifference) String() string {
+	const maxRanges = 8
+	ranges := make([]string, 0, maxRanges+1)
+	for i, r := range d.Ranges {
+		if i >= maxRanges {
+			ranges = append(ranges, fmt.Sprintf("%d more",
+				len(d.Ranges)-maxRanges))
+			break
+		}
+		ranges = append(ranges, fmt.Sprintf("0x%x-0x%x", r.Start, r.End))
+	}
+	return fmt.Sprintf("~ %s content: %d bytes (sha256 %s) -> %d bytes "+
+		"(sha256 %s), differing at %s", d.Section, d.OldSize, d.OldHash,
+		d.NewSize, d.NewHash, strings.Join(ranges, ", "))
+}
+
+// Holds the result of comparing two ELF files with Diff(...). Sections are
+// matched by name rather than index, and items within sections (symbols,
+// relocations, etc.) are matched by the section's name.
+type ELFDiff struct {
+	// Differences in the ELF header fields.
+	Header []ELFDifference
+	// Sections that were added or removed, or whose headers differ.
+	Sections []ELFDifference
+	// Sections whose content differs.
+	Content []SectionContentDifference
+	// Symbols that were added, removed, or have a different value, size,
+	// type, binding or section.
+	Symbols []ELFDifference
+	// Differences in dynamic linking table entries.
+	Dynamic []ELFDifference
+	// Relocations that were added, removed, or changed at each offset.
+	Relocations []ELFDifference
+	// Differences in notes, not including the build ID.
+	Notes []ELFDifference
+	// The build IDs of the two files, if they have one. Build IDs are
+	// reported separately since they're expected to differ whenever anything
+	// else does.
+	OldBuildID []byte
+	NewBuildID []byte
+}
+
+// Returns true if the two files had different build IDs, or if only one of
+// them has a build ID.
+func (d *ELFDiff) BuildIDChanged() bool {
+	return !bytes.Equal(d.OldBuildID, d.NewBuildID)
+}
+
+// Returns true if no differences were found, apart from possibly the build
+// ID.
+func (d *ELFDiff) Empty() bool {
+	return (len(d.Header) == 0) && (len(d.Sections) == 0) &&
+		(len(d.Content) == 0) && (len(d.Symbols) == 0) &&
+		(len(d.Dynamic) == 0) && (len(d.Relocations) == 0) &&
+		(len(d.Notes) == 0)
+}
+
+// Returns a human-readable list of the differences, grouped by category.
+func (d *ELFDiff) String() string {
+	var b strings.Builder
+	if d.BuildIDChanged() {
+		fmt.Fprintf(&b, "Build ID changed: %s -> %s\n",
+			hex.EncodeToString(d.OldBuildID), hex.EncodeToString(d.NewBuildID))
+	}
+	writeGroup := func(title string, differences []ELFDifference) {
+		if len(differences) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", title)
+		for i := range differences {
+			fmt.Fprintf(&b, "  %s\n", &(differences[i]))
+		}
+	}
+	writeGroup("Header", d.Header)
+	writeGroup("Sections", d.Sections)
+	if len(d.Content) != 0 {
+		b.WriteString("Section content:\n")
+		for i := range d.Content {
+			fmt.Fprintf(&b, "  %s\n", &(d.Content[i]))
+		}
+	}
+	writeGroup("Symbols", d.Symbols)
+	writeGroup("Dynamic entries", d.Dynamic)
+	writeGroup("Relocations", d.Relocations)
+	writeGroup("Notes", d.Notes)
+	if d.Empty() && !d.BuildIDChanged() {
+		b.WriteString("No differences found.\n")
+	}
+	return b.String()
+}
+
+// Holds a list of values associated with each key, remembering the order in
+// which keys were first added.
+type keyedValues struct {
+	keys   []string
+	values map[string][]string
+}
+
+func newKeyedValues() *keyedValues {
+	return &keyedValues{
+		values: make(map[string][]string),
+	}
+}
+
+func (k *keyedValues) add(key, value string) {
+	existing, ok := k.values[key]
+	if !ok {
+		k.keys = append(k.keys, key)
+	}
+	k.values[key] = append(existing, value)
+}
+
+// Compares the values for each key in a and b, treating the values for each
+// key as a multiset. If exactly one value was removed and one added for a
+// key, it's reported as a change.
+func diffKeyedValues(a, b *keyedValues) []ELFDifference {
+	var toReturn []ELFDifference
+	keys := append([]string{}, a.keys...)
+	for _, key := range b.keys {
+		if _, ok := a.values[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		remaining := make(map[string]int)
+		for _, v := range b.values[key] {
+			remaining[v]++
+		}
+		var removed, added []string
+		for _, v := range a.values[key] {
+			if remaining[v] > 0 {
+				remaining[v]--
+				continue
+			}
+			removed = append(removed, v)
+		}
+		for _, v := range b.values[key] {
+			if remaining[v] > 0 {
+				remaining[v]--
+				added = append(added, v)
+			}
+		}
+		if (len(removed) == 1) && (len(added) == 1) {
+			toReturn = append(toReturn, ELFDifference{
+				Kind: DifferenceChanged,
+				Item: key,
+				Old:  removed[0],
+				New:  added[0],
+			})
+			continue
+		}
+		for _, v := range removed {
+			toReturn = append(toReturn, ELFDifference{
+				Kind: DifferenceRemoved,
+				Item: key,
+				Old:  v,
+			})
+		}
+		for _, v := range added {
+			toReturn = append(toReturn, ELFDifference{
+				Kind: DifferenceAdded,
+				Item: key,
+				New:  v,
+			})
+		}
+	}
+	return toReturn
+}
+
+// Returns a name for each section in the file, used to match sections
+// between files. Duplicate names are given a suffix with the occurrence
+// number. The null section at index 0 gets an empty name.
+func sectionKeys(f ELFFile) []string {
+	count := f.GetSectionCount()
+	toReturn := make([]string, count)
+	seen := make(map[string]int)
+	for i := uint16(1); i < count; i++ {
+		name, e := f.GetSectionName(i)
+		if e != nil {
+			name = fmt.Sprintf("<section %d>", i)
+		}
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s (%d)", name, seen[name])
+		}
+		toReturn[i] = name
+	}
+	return toReturn
+}
+
+// Returns the key of the section at the given index, or a placeholder if the
+// index isn't a valid section.
+func sectionKeyAt(keys []string, index uint32) string {
+	if index == 0 {
+		return "none"
+	}
+	if index >= uint32(len(keys)) {
+		return fmt.Sprintf("<invalid section %d>", index)
+	}
+	return keys[index]
+}
+
+// Returns the name of the section referred to by a symbol's section index.
+func symbolSectionName(keys []string, index uint16) string {
+	switch index {
+	case 0:
+		return "undefined"
+	case 0xfff1:
+		return "absolute"
+	case 0xfff2:
+		return "common"
+	}
+	if index >= 0xff00 {
+		return fmt.Sprintf("special section 0x%x", index)
+	}
+	return sectionKeyAt(keys, uint32(index))
+}
+
+// Returns the given file's header fields, keyed by name.
+func headerValues(f ELFFile) *keyedValues {
+	var d ELFDocument
+	d.loadHeader(f)
+	h := &(d.Header)
+	toReturn := newKeyedValues()
+	toReturn.add("class", fmt.Sprintf("%d-bit", h.Bits))
+	toReturn.add("endianness", h.Endianness)
+	toReturn.add("version", fmt.Sprintf("%d", h.Version))
+	toReturn.add("OS ABI", fmt.Sprintf("%d", h.OSABI))
+	toReturn.add("ABI version", fmt.Sprintf("%d", h.ABIVersion))
+	toReturn.add("file type", h.Type.String())
+	toReturn.add("machine", h.Machine.String())
+	toReturn.add("entry point", fmt.Sprintf("0x%x", uint64(h.EntryPoint)))
+	toReturn.add("flags", fmt.Sprintf("0x%x", uint64(h.Flags)))
+	toReturn.add("program header offset", fmt.Sprintf("0x%x",
+		uint64(h.ProgramHeaderOffset)))
+	toReturn.add("section header offset", fmt.Sprintf("0x%x",
+		uint64(h.SectionHeaderOffset)))
+	toReturn.add("segment count", fmt.Sprintf("%d", f.GetSegmentCount()))
+	toReturn.add("section count", fmt.Sprintf("%d", f.GetSectionCount()))
+	return toReturn
+}
+
+// Returns a description of each section header field, keyed by section name
+// and field name.
+func sectionHeaderValues(f ELFFile, keys []string) *keyedValues {
+	toReturn := newKeyedValues()
+	for i, h := range sectionHeaders64(f) {
+		if i == 0 {
+			continue
+		}
+		name := keys[i]
+		toReturn.add(name+" type", h.Type.String())
+		toReturn.add(name+" flags", h.Flags.String())
+		toReturn.add(name+" address", fmt.Sprintf("0x%x", h.VirtualAddress))
+		toReturn.add(name+" offset", fmt.Sprintf("0x%x", h.FileOffset))
+		toReturn.add(name+" size", fmt.Sprintf("%d", h.Size))
+		toReturn.add(name+" link", sectionKeyAt(keys, h.LinkedIndex))
+		toReturn.add(name+" info", fmt.Sprintf("%d", h.Info))
+		toReturn.add(name+" alignment", fmt.Sprintf("%d", h.Align))
+		toReturn.add(name+" entry size", fmt.Sprintf("%d", h.EntrySize))
+	}
+	return toReturn
+}
+
+// Returns the index of each section in the file, keyed by section name.
+func sectionIndices(keys []string) map[string]uint16 {
+	toReturn := make(map[string]uint16)
+	for i := 1; i < len(keys); i++ {
+		toReturn[keys[i]] = uint16(i)
+	}
+	return toReturn
+}
+
+// Returns the ranges of bytes that differ between a and b.
+func differingRanges(a, b []byte) []ByteRange {
+	var toReturn []ByteRange
+	length := len(a)
+	if len(b) < length {
+		length = len(b)
+	}
+	i := 0
+	for i < length {
+		if a[i] == b[i] {
+			i++
+			continue
+		}
+		start := i
+		for (i < length) && (a[i] != b[i]) {
+			i++
+		}
+		toReturn = append(toReturn, ByteRange{
+			Start: uint64(start),
+			End:   uint64(i),
+		})
+	}
+	if len(a) != len(b) {
+		end := len(a)
+		if len(b) > end {
+			end = len(b)
+		}
+		// Extend the last range if it ends where the content does.
+		last := len(toReturn) - 1
+		if (last >= 0) && (toReturn[last].End == uint64(length)) {
+			toReturn[last].End = uint64(end)
+		} else {
+			toReturn = append(toReturn, ByteRange{
+				Start: uint64(length),
+				End:   uint64(end),
+			})
+		}
+	}
+	return toReturn
+}
+
+// Returns the content of the section, or nil if it has no content.
+func diffSectionContent(f ELFFile, index uint16) []byte {
+	header, e := f.GetSectionHeader(index)
+	if (e != nil) || (header.GetType() == UninitializedSection) {
+		return nil
+	}
+	content, e := f.GetSectionContent(index)
+	if e != nil {
+		return nil
+	}
+	return content
+}
+
+// Returns true if the section is a note section containing a GNU build ID.
+// Any other notes in such a section are still compared by noteValues.
+func isBuildIDSection(f ELFFile, index uint16) bool {
+	if !isNoteSection(f, index) {
+		return false
+	}
+	notes, e := getNotes(f, index)
+	if e != nil {
+		return false
+	}
+	for _, n := range notes {
+		if (n.Name == "GNU") && (n.Type == GNUNoteBuildID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compares the content of sections present in both files. Sections holding
+// the build ID are skipped, since build IDs are reported separately.
+func diffContent(a, b ELFFile, keysA, keysB []string) []SectionContentDifference {
+	var toReturn []SectionContentDifference
+	indicesB := sectionIndices(keysB)
+	for i := 1; i < len(keysA); i++ {
+		j, ok := indicesB[keysA[i]]
+		if !ok {
+			continue
+		}
+		if isBuildIDSection(a, uint16(i)) || isBuildIDSection(b, j) {
+			continue
+		}
+		contentA := diffSectionContent(a, uint16(i))
+		contentB := diffSectionContent(b, j)
+		if bytes.Equal(contentA, contentB) {
+			continue
+		}
+		hashA := sha256.Sum256(contentA)
+		hashB := sha256.Sum256(contentB)
+		toReturn = append(toReturn, SectionContentDifference{
+			Section: keysA[i],
+			OldHash: hex.EncodeToString(hashA[:]),
+			NewHash: hex.EncodeToString(hashB[:]),
+			OldSize: uint64(len(contentA)),
+			NewSize: uint64(len(contentB)),
+			Ranges:  differingRanges(contentA, contentB),
+		})
+	}
+	return toReturn
+}
+
+// Returns a description of each symbol in each symbol table, keyed by the
+// symbol and table names. Symbols without names aren't included.
+func symbolValues(f ELFFile, keys []string) *keyedValues {
+	toReturn := newKeyedValues()
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		if !f.IsSymbolTable(i) {
+			continue
+		}
+		symbols, names, e := f.GetSymbols(i)
+		if e != nil {
+			continue
+		}
+		for j, s := range symbols {
+			if names[j] == "" {
+				continue
+			}
+			toReturn.add(fmt.Sprintf("%s in %s", names[j], keys[i]),
+				fmt.Sprintf("value 0x%x, size %d, %s, section %s",
+					s.GetValue(), s.GetSize(), s.GetInfo(),
+					symbolSectionName(keys, s.GetSectionIndex())))
+		}
+	}
+	return toReturn
+}
+
+// Returns a description of each dynamic table entry, keyed by the tag. Tags
+// with string values are resolved to the strings.
+func dynamicValues(f ELFFile, keys []string) *keyedValues {
+	toReturn := newKeyedValues()
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		if !f.IsDynamicSection(i) {
+			continue
+		}
+		entries, e := f.DynamicEntries(i)
+		if e != nil {
+			continue
+		}
+		var stringTable []byte
+		header, e := f.GetSectionHeader(i)
+		if e == nil {
+			stringTable, _ = f.GetSectionContent(uint16(header.GetLinkedIndex()))
+		}
+		for _, entry := range entries {
+			tag := entry.GetTag()
+			if tag.GetValue() == 0 {
+				break
+			}
+			value := fmt.Sprintf("0x%x", entry.GetValue())
+			switch tag.GetValue() {
+			case 1, 14, 15, 29:
+				s, e := ReadStringAtOffset(uint32(entry.GetValue()),
+					stringTable)
+				if e == nil {
+					value = string(s)
+				}
+			}
+			toReturn.add(fmt.Sprintf("%s in %s", tag, keys[i]), value)
+		}
+	}
+	return toReturn
+}
+
+// Returns a description of each relocation, keyed by the relocation table's
+// name and offset.
+func relocationValues(f ELFFile, keys []string) *keyedValues {
+	toReturn := newKeyedValues()
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		if !f.IsRelocationTable(i) {
+			continue
+		}
+		relocations, e := f.GetRelocations(i)
+		if e != nil {
+			continue
+		}
+		var names []string
+		header, e := f.GetSectionHeader(i)
+		if (e == nil) && f.IsSymbolTable(uint16(header.GetLinkedIndex())) {
+			_, names, _ = f.GetSymbols(uint16(header.GetLinkedIndex()))
+		}
+		for _, r := range relocations {
+			symbol := fmt.Sprintf("symbol %d", r.SymbolIndex())
+			if int(r.SymbolIndex()) < len(names) {
+				symbol = names[r.SymbolIndex()]
+				if symbol == "" {
+					symbol = fmt.Sprintf("symbol %d", r.SymbolIndex())
+				}
+			}
+			toReturn.add(fmt.Sprintf("0x%x in %s", r.Offset(), keys[i]),
+				fmt.Sprintf("type %d, %s, addend %d", r.Type(), symbol,
+					r.Addend()))
+		}
+	}
+	return toReturn
+}
+
+// Returns a description of each note, keyed by the section and note name and
+// type. Build ID notes are skipped.
+func noteValues(f ELFFile, keys []string) *keyedValues {
+	toReturn := newKeyedValues()
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		if !isNoteSection(f, i) {
+			continue
+		}
+		notes, e := getNotes(f, i)
+		if e != nil {
+			continue
+		}
+		for _, n := range notes {
+			if (n.Name == "GNU") && (n.Type == GNUNoteBuildID) {
+				continue
+			}
+			toReturn.add(fmt.Sprintf("%s note type %d in %s", n.Name, n.Type,
+				keys[i]), hex.EncodeToString(n.Description))
+		}
+	}
+	return toReturn
+}
+
+// Compares the two ELF files, and returns their differences. Sections, and
+// the symbols, relocations, dynamic entries and notes they contain, are
+// matched by section name rather than index, so inserting or reordering
+// sections doesn't cause everything following them to differ.
+func Diff(a, b ELFFile) (*ELFDiff, error) {
+	if (fileRaw(a) == nil) || (fileRaw(b) == nil) {
+		return nil, fmt.Errorf("Unsupported ELF file types: %T, %T", a, b)
+	}
+	toReturn := &ELFDiff{}
+	toReturn.OldBuildID, _ = GetBuildID(a)
+	toReturn.NewBuildID, _ = GetBuildID(b)
+	toReturn.Header = diffKeyedValues(headerValues(a), headerValues(b))
+
+	keysA := sectionKeys(a)
+	keysB := sectionKeys(b)
+	indicesA := sectionIndices(keysA)
+	indicesB := sectionIndices(keysB)
+	for i := 1; i < len(keysA); i++ {
+		if _, ok := indicesB[keysA[i]]; !ok {
+			toReturn.Sections = append(toReturn.Sections, ELFDifference{
+				Kind: DifferenceRemoved,
+				Item: "section " + keysA[i],
+				Old:  fmt.Sprintf("index %d", i),
+			})
+		}
+	}
+	for i := 1; i < len(keysB); i++ {
+		if _, ok := indicesA[keysB[i]]; !ok {
+			toReturn.Sections = append(toReturn.Sections, ELFDifference{
+				Kind: DifferenceAdded,
+				Item: "section " + keysB[i],
+				New:  fmt.Sprintf("index %d", i),
+			})
+		}
+	}
+	// Only report header changes for sections that are in both files.
+	headerChanges := diffKeyedValues(sectionHeaderValues(a, keysA),
+		sectionHeaderValues(b, keysB))
+	for _, d := range headerChanges {
+		if d.Kind == DifferenceChanged {
+			toReturn.Sections = append(toReturn.Sections, d)
+		}
+	}
+
+	toReturn.Content = diffContent(a, b, keysA, keysB)
+	toReturn.Symbols = diffKeyedValues(symbolValues(a, keysA),
+		symbolValues(b, keysB))
+	toReturn.Dynamic = diffKeyedValues(dynamicValues(a, keysA),
+		dynamicValues(b, keysB))
+	toReturn.Relocations = diffKeyedValues(relocationValues(a, keysA),
+		relocationValues(b, keysB))
+	toReturn.Notes = diffKeyedValues(noteValues(a, keysA),
+		noteValues(b, keysB))
+	return toReturn, nil
+}
@@ -0,0 +1,161 @@
+package elf_reader
+
+import (
+	"testing"
+)
+
+func TestDiffIdentical(t *testing.T) {
+	a := parseTestELF64("test_data/sleep_amd64", t)
+	b := parseTestELF64("test_data/sleep_amd64", t)
+	diff, e := Diff(a, b)
+	if e != nil {
+		t.Fatalf("Failed comparing identical files: %s\n", e)
+	}
+	if !diff.Empty() || diff.BuildIDChanged() {
+		t.Errorf("Got differences for identical files:\n%s", diff)
+	}
+}
+
+func TestDiffModified(t *testing.T) {
+	original := parseTestELF64("test_data/sleep_amd64", t)
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	f.Header.EntryPoint++
+	// Change a byte in .comment and in the build ID.
+	commentIndex, e := FindSectionByName(f, ".comment")
+	if e != nil {
+		t.Fatalf("Couldn't find .comment: %s\n", e)
+	}
+	f.Raw[f.Sections[commentIndex].FileOffset+2] ^= 0xff
+	buildIDIndex, e := FindSectionByName(f, ".note.gnu.build-id")
+	if e != nil {
+		t.Fatalf("Couldn't find the build ID: %s\n", e)
+	}
+	buildIDEnd := f.Sections[buildIDIndex].FileOffset +
+		f.Sections[buildIDIndex].Size
+	f.Raw[buildIDEnd-1] ^= 0xff
+	// Change the value of a symbol in .symtab.
+	symtabIndex, e := FindSectionByName(f, ".symtab")
+	if e != nil {
+		t.Fatalf("Couldn't find .symtab: %s\n", e)
+	}
+	symbols, names, e := f.GetSymbols(symtabIndex)
+	if e != nil {
+		t.Fatalf("Couldn't read .symtab: %s\n", e)
+	}
+	for i := range symbols {
+		if names[i] != "main" {
+			continue
+		}
+		// The value is 8 bytes into each 64-bit symbol.
+		offset := f.Sections[symtabIndex].FileOffset + uint64(i)*24 + 8
+		f.Raw[offset]++
+	}
+	modifiedContent, e := f.Serialize()
+	if e != nil {
+		t.Fatalf("Failed serializing the modified file: %s\n", e)
+	}
+	modified, e := ParseELFFile(modifiedContent)
+	if e != nil {
+		t.Fatalf("Failed parsing the modified file: %s\n", e)
+	}
+	diff, e := Diff(original, modified)
+	if e != nil {
+		t.Fatalf("Failed comparing files: %s\n", e)
+	}
+	t.Logf("Differences:\n%s", diff)
+	if !diff.BuildIDChanged() {
+		t.Errorf("The build ID change wasn't detected\n")
+	}
+	if len(diff.Notes) != 0 {
+		t.Errorf("The build ID change was reported as a note difference\n")
+	}
+	if (len(diff.Header) != 1) || (diff.Header[0].Item != "entry point") {
+		t.Errorf("Expected only an entry point header difference\n")
+	}
+	if (len(diff.Symbols) != 1) || (diff.Symbols[0].Item !=
+		"main in .symtab") {
+		t.Errorf("Expected only a change to main in .symtab\n")
+	}
+	foundComment := false
+	for _, c := range diff.Content {
+		if c.Section != ".comment" {
+			continue
+		}
+		foundComment = true
+		if (len(c.Ranges) != 1) || (c.Ranges[0].Start != 2) ||
+			(c.Ranges[0].End != 3) {
+			t.Errorf("Incorrect .comment byte ranges: %v\n", c.Ranges)
+		}
+	}
+	if !foundComment {
+		t.Errorf("The .comment content change wasn't detected\n")
+	}
+}
+
+func TestDiffBuildIDOnly(t *testing.T) {
+	original := parseTestELF64("test_data/sleep_amd64", t)
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	buildIDIndex, e := FindSectionByName(f, ".note.gnu.build-id")
+	if e != nil {
+		t.Fatalf("Couldn't find the build ID: %s\n", e)
+	}
+	buildIDEnd := f.Sections[buildIDIndex].FileOffset +
+		f.Sections[buildIDIndex].Size
+	f.Raw[buildIDEnd-1] ^= 0xff
+	diff, e := Diff(original, f)
+	if e != nil {
+		t.Fatalf("Failed comparing files: %s\n", e)
+	}
+	if !diff.BuildIDChanged() {
+		t.Errorf("The build ID change wasn't detected\n")
+	}
+	if !diff.Empty() {
+		t.Errorf("Got differences other than the build ID:\n%s", diff)
+	}
+}
+
+func TestDiffStripped(t *testing.T) {
+	original := parseTestELF64("test_data/sleep_amd64", t)
+	stripped, e := Strip(original, &StripOptions{Mode: StripAll})
+	if e != nil {
+		t.Fatalf("Failed stripping sleep_amd64: %s\n", e)
+	}
+	f, e := ParseELFFile(stripped)
+	if e != nil {
+		t.Fatalf("Failed parsing the stripped file: %s\n", e)
+	}
+	diff, e := Diff(original, f)
+	if e != nil {
+		t.Fatalf("Failed comparing files: %s\n", e)
+	}
+	removed := make(map[string]bool)
+	for _, d := range diff.Sections {
+		if d.Kind == DifferenceRemoved {
+			removed[d.Item] = true
+		}
+	}
+	if !removed["section .symtab"] || !removed["section .strtab"] {
+		t.Errorf("The removed symbol table wasn't reported: %v\n",
+			diff.Sections)
+	}
+	if len(diff.Dynamic) != 0 {
+		t.Errorf("Stripping shouldn't change dynamic entries\n")
+	}
+	if len(diff.Symbols) == 0 {
+		t.Errorf("Removed symbols weren't reported\n")
+	}
+}
+
+func TestDifferingRanges(t *testing.T) {
+	ranges := differingRanges([]byte{1, 2, 3, 4}, []byte{1, 0, 3, 0, 5})
+	expected := []ByteRange{ByteRange{1, 2}, ByteRange{3, 5}}
+	if len(ranges) != len(expected) {
+		t.Fatalf("Expected %d ranges, got %v\n", len(expected), ranges)
+	}
+	for i := range expected {
+		if ranges[i] != expected[i] {
+			t.Errorf("Expected range %d to be %v, got %v\n", i, expected[i],
+				ranges[i])
+		}
+	}
+}
@@ -0,0 +1,796 @@
+package elf_reader
+
+// This file contains code for converting ELF files to and from a text-based
+// document, similar to the obj2yaml and yaml2obj tools. The document is
+// intended to be encoded as JSON, and can be edited by hand before being
+// built back into an ELF file.
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A 64-bit value that is written as a hexadecimal string in JSON documents.
+// Either hexadecimal strings or plain numbers are accepted when reading.
+type HexUint64 uint64
+
+func (v HexUint64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("0x%x", uint64(v)))
+}
+
+func (v *HexUint64) UnmarshalJSON(data []byte) error {
+	var s string
+	e := json.Unmarshal(data, &s)
+	if e != nil {
+		// Not a string, so try a plain number instead.
+		var n uint64
+		e = json.Unmarshal(data, &n)
+		if e != nil {
+			return fmt.Errorf("Invalid hex value %s: %w", data, e)
+		}
+		*v = HexUint64(n)
+		return nil
+	}
+	n, e := strconv.ParseUint(s, 0, 64)
+	if e != nil {
+		return fmt.Errorf("Invalid hex value %q: %w", s, e)
+	}
+	*v = HexUint64(n)
+	return nil
+}
+
+// The number of bytes written on each line of a HexBytes value.
+const hexBytesPerLine = 32
+
+// A byte slice that is written as a list of hexadecimal strings in JSON
+// documents, to keep lines reasonably short. When reading, either a single
+// string or a list of strings is accepted, and whitespace is ignored.
+type HexBytes []byte
+
+func (b HexBytes) MarshalJSON() ([]byte, error) {
+	lines := make([]string, 0, (len(b)/hexBytesPerLine)+1)
+	for i := 0; i < len(b); i += hexBytesPerLine {
+		end := i + hexBytesPerLine
+		if end > len(b) {
+			end = len(b)
+		}
+		lines = append(lines, hex.EncodeToString(b[i:end]))
+	}
+	return json.Marshal(lines)
+}
+
+func (b *HexBytes) UnmarshalJSON(data []byte) error {
+	var lines []string
+	e := json.Unmarshal(data, &lines)
+	if e != nil {
+		var line string
+		e = json.Unmarshal(data, &line)
+		if e != nil {
+			return fmt.Errorf("Invalid hex data: %w", e)
+		}
+		lines = []string{line}
+	}
+	joined := strings.Join(strings.Fields(strings.Join(lines, " ")), "")
+	decoded, e := hex.DecodeString(joined)
+	if e != nil {
+		return fmt.Errorf("Invalid hex data: %w", e)
+	}
+	*b = decoded
+	return nil
+}
+
+// Holds the ELF header fields in an ELFDocument. The number of program and
+// section headers isn't included; it's taken from the number of segments and
+// sections in the document.
+type DocumentHeader struct {
+	// Either 32 or 64.
+	Bits int
+	// Either "little" or "big".
+	Endianness             string
+	Version                uint8
+	OSABI                  uint8
+	ABIVersion             uint8
+	Padding                HexBytes `json:",omitempty"`
+	Type                   ELFFileType
+	TypeName               string `json:",omitempty"`
+	Machine                MachineType
+	MachineName            string `json:",omitempty"`
+	ObjectVersion          uint32
+	EntryPoint             HexUint64
+	ProgramHeaderOffset    HexUint64
+	SectionHeaderOffset    HexUint64
+	Flags                  HexUint64
+	HeaderSize             uint16
+	ProgramHeaderEntrySize uint16
+	SectionHeaderEntrySize uint16
+	SectionNamesTable      uint16
+}
+
+// Holds a single program header in an ELFDocument.
+type DocumentSegment struct {
+	Type            ProgramHeaderType
+	TypeName        string `json:",omitempty"`
+	Flags           ProgramHeaderFlags
+	FileOffset      HexUint64
+	VirtualAddress  HexUint64
+	PhysicalAddress HexUint64
+	FileSize        HexUint64
+	MemorySize      HexUint64
+	Align           HexUint64
+}
+
+// Holds a single symbol in an ELFDocument. The Name is informational; the
+// NameOffset determines the symbol's name in the built file.
+type DocumentSymbol struct {
+	Name         string `json:",omitempty"`
+	NameOffset   uint32
+	Binding      uint8
+	Type         uint8
+	Other        uint8
+	SectionIndex uint16
+	Value        HexUint64
+	Size         uint64
+}
+
+// Holds a single relocation in an ELFDocument. The SymbolName is
+// informational.
+type DocumentRelocation struct {
+	Offset     HexUint64
+	Type       uint32
+	Symbol     uint32
+	SymbolName string `json:",omitempty"`
+	Addend     int64
+}
+
+// Holds a single entry from a dynamic table in an ELFDocument. The TagName
+// is informational.
+type DocumentDynamicEntry struct {
+	Tag     int64
+	TagName string `json:",omitempty"`
+	Value   HexUint64
+}
+
+// Holds a single note in an ELFDocument.
+type DocumentNote struct {
+	Name        string
+	Type        uint32
+	Description HexBytes
+}
+
+// Holds a single section in an ELFDocument. At most one of the content
+// fields (Content, Strings, Symbols, Relocations, Dynamic or Notes) should be
+// set. If none are set, the section's content will be filled with zeros.
+// Structured content is only used when dumping a file if it re-encodes to
+// exactly the original bytes. The Name is informational, but building a
+// document fails if it doesn't match the name at NameOffset.
+type DocumentSection struct {
+	Name           string `json:",omitempty"`
+	NameOffset     uint32
+	Type           SectionHeaderType
+	TypeName       string `json:",omitempty"`
+	Flags          HexUint64
+	VirtualAddress HexUint64
+	FileOffset     HexUint64
+	Size           HexUint64
+	LinkedIndex    uint32
+	Info           uint32
+	Align          HexUint64
+	EntrySize      HexUint64
+	Content        HexBytes               `json:",omitempty"`
+	Strings        []string               `json:",omitempty"`
+	Symbols        []DocumentSymbol       `json:",omitempty"`
+	Relocations    []DocumentRelocation   `json:",omitempty"`
+	Dynamic        []DocumentDynamicEntry `json:",omitempty"`
+	Notes          []DocumentNote         `json:",omitempty"`
+}
+
+// Holds bytes in the file that aren't part of a section or header table, such
+// as non-zero padding.
+type DocumentFill struct {
+	FileOffset HexUint64
+	Content    HexBytes
+}
+
+// A text-friendly representation of an entire ELF file, which can be built
+// back into an identical ELF file.
+type ELFDocument struct {
+	Header   DocumentHeader
+	Segments []DocumentSegment `json:",omitempty"`
+	Sections []DocumentSection `json:",omitempty"`
+	Fill     []DocumentFill    `json:",omitempty"`
+	// The total size of the file. Any bytes not covered by the headers,
+	// sections or fill regions will be zero.
+	FileSize HexUint64
+}
+
+// Returns the byte order named in the document header.
+func (h *DocumentHeader) endianness() (binary.ByteOrder, error) {
+	switch h.Endianness {
+	case "little":
+		return binary.LittleEndian, nil
+	case "big":
+		return binary.BigEndian, nil
+	}
+	return nil, fmt.Errorf("Invalid endianness: %q", h.Endianness)
+}
+
+// Fills in the document header from the given file.
+func (d *ELFDocument) loadHeader(f ELFFile) {
+	h := &(d.Header)
+	switch v := f.(type) {
+	case *ELF64File:
+		x := &(v.Header)
+		h.Bits = 64
+		h.Version, h.OSABI, h.ABIVersion = x.Version, x.OSABI, x.EABI
+		h.Padding = HexBytes(append([]byte{}, x.Padding[:]...))
+		h.Type, h.Machine = x.Type, x.Machine
+		h.ObjectVersion = x.Version2
+		h.EntryPoint = HexUint64(x.EntryPoint)
+		h.ProgramHeaderOffset = HexUint64(x.ProgramHeaderOffset)
+		h.SectionHeaderOffset = HexUint64(x.SectionHeaderOffset)
+		h.Flags = HexUint64(x.Flags)
+		h.HeaderSize = x.HeaderSize
+		h.ProgramHeaderEntrySize = x.ProgramHeaderEntrySize
+		h.SectionHeaderEntrySize = x.SectionHeaderEntrySize
+		h.SectionNamesTable = x.SectionNamesTable
+	case *ELF32File:
+		x := &(v.Header)
+		h.Bits = 32
+		h.Version, h.OSABI, h.ABIVersion = x.Version, x.OSABI, x.EABI
+		h.Padding = HexBytes(append([]byte{}, x.Padding[:]...))
+		h.Type, h.Machine = x.Type, x.Machine
+		h.ObjectVersion = x.Version2
+		h.EntryPoint = HexUint64(x.EntryPoint)
+		h.ProgramHeaderOffset = HexUint64(x.ProgramHeaderOffset)
+		h.SectionHeaderOffset = HexUint64(x.SectionHeaderOffset)
+		h.Flags = HexUint64(x.Flags)
+		h.HeaderSize = x.HeaderSize
+		h.ProgramHeaderEntrySize = x.ProgramHeaderEntrySize
+		h.SectionHeaderEntrySize = x.SectionHeaderEntrySize
+		h.SectionNamesTable = x.SectionNamesTable
+	}
+	h.Endianness = "little"
+	if fileEndianness(f) == binary.BigEndian {
+		h.Endianness = "big"
+	}
+	h.TypeName = h.Type.String()
+	h.MachineName = h.Machine.String()
+	isZero := true
+	for _, b := range h.Padding {
+		if b != 0 {
+			isZero = false
+			break
+		}
+	}
+	if isZero {
+		h.Padding = nil
+	}
+}
+
+// Tries to convert the content of the section at the given index into a
+// structured form in the document section. Returns false if the section
+// doesn't have a supported structured format, or if re-encoding the
+// structured form doesn't reproduce the original content.
+func (d *ELFDocument) loadStructuredContent(f ELFFile, index uint16,
+	s *DocumentSection, content []byte) bool {
+	var e error
+	switch {
+	case f.IsStringTable(index):
+		if (len(content) == 0) || (content[len(content)-1] != 0) {
+			return false
+		}
+		s.Strings, e = f.GetStringTable(index)
+	case f.IsSymbolTable(index):
+		var symbols []ELFSymbol
+		var names []string
+		symbols, names, e = f.GetSymbols(index)
+		if e != nil {
+			break
+		}
+		s.Symbols = make([]DocumentSymbol, len(symbols))
+		for i, symbol := range symbols {
+			s.Symbols[i] = DocumentSymbol{
+				Name:         names[i],
+				NameOffset:   symbol.GetName(),
+				Binding:      symbol.GetInfo().Binding(),
+				Type:         symbol.GetInfo().SymbolType(),
+				Other:        symbol.GetOther(),
+				SectionIndex: symbol.GetSectionIndex(),
+				Value:        HexUint64(symbol.GetValue()),
+				Size:         symbol.GetSize(),
+			}
+		}
+	case f.IsRelocationTable(index):
+		var relocations []ELFRelocation
+		relocations, e = f.GetRelocations(index)
+		if e != nil {
+			break
+		}
+		// Include symbol names if they're available.
+		var names []string
+		header, _ := f.GetSectionHeader(index)
+		if (header != nil) && f.IsSymbolTable(uint16(
+			header.GetLinkedIndex())) {
+			_, names, _ = f.GetSymbols(uint16(header.GetLinkedIndex()))
+		}
+		s.Relocations = make([]DocumentRelocation, len(relocations))
+		for i, r := range relocations {
+			s.Relocations[i] = DocumentRelocation{
+				Offset: HexUint64(r.Offset()),
+				Type:   r.Type(),
+				Symbol: r.SymbolIndex(),
+				Addend: r.Addend(),
+			}
+			if int(r.SymbolIndex()) < len(names) {
+				s.Relocations[i].SymbolName = names[r.SymbolIndex()]
+			}
+		}
+	case f.IsDynamicSection(index):
+		var entries []ELFDynamicEntry
+		entries, e = f.DynamicEntries(index)
+		if e != nil {
+			break
+		}
+		s.Dynamic = make([]DocumentDynamicEntry, len(entries))
+		for i, entry := range entries {
+			s.Dynamic[i] = DocumentDynamicEntry{
+				Tag:     entry.GetTag().GetValue(),
+				TagName: entry.GetTag().String(),
+				Value:   HexUint64(entry.GetValue()),
+			}
+		}
+	case isNoteSection(f, index):
+		var notes []ELFNote
+		notes, e = getNotes(f, index)
+		if e != nil {
+			break
+		}
+		s.Notes = make([]DocumentNote, len(notes))
+		for i, n := range notes {
+			s.Notes[i] = DocumentNote{
+				Name:        n.Name,
+				Type:        n.Type,
+				Description: HexBytes(n.Description),
+			}
+		}
+	default:
+		return false
+	}
+	clearStructured := func() {
+		s.Strings = nil
+		s.Symbols = nil
+		s.Relocations = nil
+		s.Dynamic = nil
+		s.Notes = nil
+	}
+	if e != nil {
+		clearStructured()
+		return false
+	}
+	encoded, e := d.encodeSectionContent(s)
+	if (e != nil) || (string(encoded) != string(content)) {
+		clearStructured()
+		return false
+	}
+	return true
+}
+
+// Returns a document describing the given ELF file. The document can be
+// converted to JSON, and converted back into an identical ELF file using
+// Build().
+func NewELFDocument(f ELFFile) (*ELFDocument, error) {
+	raw := fileRaw(f)
+	if raw == nil {
+		return nil, fmt.Errorf("Unsupported ELF file type: %T", f)
+	}
+	toReturn := &ELFDocument{
+		FileSize: HexUint64(len(raw)),
+	}
+	toReturn.loadHeader(f)
+	for _, p := range programHeaders64(f) {
+		toReturn.Segments = append(toReturn.Segments, DocumentSegment{
+			Type:            p.Type,
+			TypeName:        p.Type.String(),
+			Flags:           p.Flags,
+			FileOffset:      HexUint64(p.FileOffset),
+			VirtualAddress:  HexUint64(p.VirtualAddress),
+			PhysicalAddress: HexUint64(p.PhysicalAddress),
+			FileSize:        HexUint64(p.FileSize),
+			MemorySize:      HexUint64(p.MemorySize),
+			Align:           HexUint64(p.Align),
+		})
+	}
+	layout := getFileLayout(f)
+	covered := []fileRegion{
+		fileRegion{start: 0, end: uint64(layout.HeaderSize)},
+		fileRegion{
+			start: layout.ProgramHeaderOffset,
+			end: layout.ProgramHeaderOffset +
+				uint64(layout.ProgramHeaderEntrySize)*
+					uint64(f.GetSegmentCount()),
+		},
+		fileRegion{
+			start: layout.SectionHeaderOffset,
+			end: layout.SectionHeaderOffset +
+				uint64(layout.SectionHeaderEntrySize)*
+					uint64(f.GetSectionCount()),
+		},
+	}
+	for i, h := range sectionHeaders64(f) {
+		s := DocumentSection{
+			NameOffset:     h.Name,
+			Type:           h.Type,
+			TypeName:       h.Type.String(),
+			Flags:          HexUint64(h.Flags),
+			VirtualAddress: HexUint64(h.VirtualAddress),
+			FileOffset:     HexUint64(h.FileOffset),
+			Size:           HexUint64(h.Size),
+			LinkedIndex:    h.LinkedIndex,
+			Info:           h.Info,
+			Align:          HexUint64(h.Align),
+			EntrySize:      HexUint64(h.EntrySize),
+		}
+		if i == 0 {
+			toReturn.Sections = append(toReturn.Sections, s)
+			continue
+		}
+		name, e := f.GetSectionName(uint16(i))
+		if e != nil {
+			return nil, fmt.Errorf("Couldn't get section %d name: %w", i, e)
+		}
+		s.Name = name
+		if (h.Type == UninitializedSection) || (h.Size == 0) {
+			toReturn.Sections = append(toReturn.Sections, s)
+			continue
+		}
+		content, e := f.GetSectionContent(uint16(i))
+		if e != nil {
+			return nil, fmt.Errorf("Couldn't get section %s content: %w",
+				name, e)
+		}
+		covered = append(covered, fileRegion{
+			start: h.FileOffset,
+			end:   h.FileOffset + h.Size,
+		})
+		if !toReturn.loadStructuredContent(f, uint16(i), &s, content) {
+			s.Content = HexBytes(append([]byte{}, content...))
+		}
+		toReturn.Sections = append(toReturn.Sections, s)
+	}
+	toReturn.Fill = findFill(raw, covered)
+	return toReturn, nil
+}
+
+// Returns the regions of the file that aren't covered by any of the given
+// regions and contain non-zero bytes.
+func findFill(raw []byte, covered []fileRegion) []DocumentFill {
+	isCovered := make([]bool, len(raw))
+	for _, r := range covered {
+		end := r.end
+		if end > uint64(len(raw)) {
+			end = uint64(len(raw))
+		}
+		for i := r.start; i < end; i++ {
+			isCovered[i] = true
+		}
+	}
+	var toReturn []DocumentFill
+	i := 0
+	for i < len(raw) {
+		if isCovered[i] || (raw[i] == 0) {
+			i++
+			continue
+		}
+		start := i
+		for (i < len(raw)) && !isCovered[i] && (raw[i] != 0) {
+			i++
+		}
+		toReturn = append(toReturn, DocumentFill{
+			FileOffset: HexUint64(start),
+			Content:    HexBytes(append([]byte{}, raw[start:i]...)),
+		})
+	}
+	return toReturn
+}
+
+// Returns the binary content of the given section, using whichever content
+// field is set.
+func (d *ELFDocument) encodeSectionContent(s *DocumentSection) ([]byte,
+	error) {
+	order, e := d.Header.endianness()
+	if e != nil {
+		return nil, e
+	}
+	is64 := d.Header.Bits == 64
+	switch {
+	case s.Content != nil:
+		return s.Content, nil
+	case s.Strings != nil:
+		return []byte(strings.Join(s.Strings, "\x00") + "\x00"), nil
+	case s.Symbols != nil:
+		symbols := make([]ELF64Symbol, len(s.Symbols))
+		for i, symbol := range s.Symbols {
+			symbols[i] = ELF64Symbol{
+				Name: symbol.NameOffset,
+				Info: ELFSymbolInfo((symbol.Binding << 4) |
+					(symbol.Type & 0xf)),
+				Other:        symbol.Other,
+				SectionIndex: symbol.SectionIndex,
+				Value:        uint64(symbol.Value),
+				Size:         symbol.Size,
+			}
+		}
+		return encodeSymbols(is64, order, symbols)
+	case s.Relocations != nil:
+		relocations := make([]ELFRelocation, len(s.Relocations))
+		for i, r := range s.Relocations {
+			relocations[i] = &ELF64Rela{
+				Address: uint64(r.Offset),
+				RelocationInfo: ELF64RelocationInfo(r.Type) |
+					(ELF64RelocationInfo(r.Symbol) << 32),
+				AddendValue: r.Addend,
+			}
+		}
+		return encodeRelocations(is64, order, s.Type == RelaSection,
+			relocations)
+	case s.Dynamic != nil:
+		if is64 {
+			entries := make([]ELF64DynamicEntry, len(s.Dynamic))
+			for i, entry := range s.Dynamic {
+				entries[i].Tag = ELF64DynamicTag(entry.Tag)
+				entries[i].Value = uint64(entry.Value)
+			}
+			return encodeBinary(order, entries)
+		}
+		entries := make([]ELF32DynamicEntry, len(s.Dynamic))
+		for i, entry := range s.Dynamic {
+			entries[i].Tag = ELF32DynamicTag(entry.Tag)
+			entries[i].Value = uint32(entry.Value)
+		}
+		return encodeBinary(order, entries)
+	case s.Notes != nil:
+		notes := make([]ELFNote, len(s.Notes))
+		for i, n := range s.Notes {
+			notes[i] = ELFNote{
+				Name:        n.Name,
+				Type:        n.Type,
+				Description: n.Description,
+			}
+		}
+		return EncodeNotes(notes, order, uint64(s.Align)), nil
+	}
+	return make([]byte, s.Size), nil
+}
+
+// Returns the binary form of the document's ELF header.
+func (d *ELFDocument) encodeHeader() ([]byte, error) {
+	h := &(d.Header)
+	order, e := h.endianness()
+	if e != nil {
+		return nil, e
+	}
+	if len(h.Padding) > 7 {
+		return nil, fmt.Errorf("The header padding is too long")
+	}
+	var padding [7]uint8
+	copy(padding[:], h.Padding)
+	var endianness uint8 = 1
+	if order == binary.BigEndian {
+		endianness = 2
+	}
+	var toReturn []byte
+	switch h.Bits {
+	case 64:
+		toReturn, e = encodeBinary(order, &ELF64Header{
+			Class:                  2,
+			Endianness:             endianness,
+			Version:                h.Version,
+			OSABI:                  h.OSABI,
+			EABI:                   h.ABIVersion,
+			Padding:                padding,
+			Type:                   h.Type,
+			Machine:                h.Machine,
+			Version2:               h.ObjectVersion,
+			EntryPoint:             uint64(h.EntryPoint),
+			ProgramHeaderOffset:    uint64(h.ProgramHeaderOffset),
+			SectionHeaderOffset:    uint64(h.SectionHeaderOffset),
+			Flags:                  uint32(h.Flags),
+			HeaderSize:             h.HeaderSize,
+			ProgramHeaderEntrySize: h.ProgramHeaderEntrySize,
+			ProgramHeaderEntries:   uint16(len(d.Segments)),
+			SectionHeaderEntrySize: h.SectionHeaderEntrySize,
+			SectionHeaderEntries:   uint16(len(d.Sections)),
+			SectionNamesTable:      h.SectionNamesTable,
+		})
+	case 32:
+		if (h.EntryPoint > 0xffffffff) ||
+			(h.ProgramHeaderOffset > 0xffffffff) ||
+			(h.SectionHeaderOffset > 0xffffffff) {
+			return nil, fmt.Errorf("Header field too large for a 32-bit ELF")
+		}
+		toReturn, e = encodeBinary(order, &ELF32Header{
+			Class:                  1,
+			Endianness:             endianness,
+			Version:                h.Version,
+			OSABI:                  h.OSABI,
+			EABI:                   h.ABIVersion,
+			Padding:                padding,
+			Type:                   h.Type,
+			Machine:                h.Machine,
+			Version2:               h.ObjectVersion,
+			EntryPoint:             uint32(h.EntryPoint),
+			ProgramHeaderOffset:    uint32(h.ProgramHeaderOffset),
+			SectionHeaderOffset:    uint32(h.SectionHeaderOffset),
+			Flags:                  uint32(h.Flags),
+			HeaderSize:             h.HeaderSize,
+			ProgramHeaderEntrySize: h.ProgramHeaderEntrySize,
+			ProgramHeaderEntries:   uint16(len(d.Segments)),
+			SectionHeaderEntrySize: h.SectionHeaderEntrySize,
+			SectionHeaderEntries:   uint16(len(d.Sections)),
+			SectionNamesTable:      h.SectionNamesTable,
+		})
+	default:
+		return nil, fmt.Errorf("Invalid number of bits: %d", h.Bits)
+	}
+	if e != nil {
+		return nil, e
+	}
+	binary.LittleEndian.PutUint32(toReturn, 0x464c457f)
+	return toReturn, nil
+}
+
+// The largest file Build will produce. Documents are usually hand-edited or
+// generated from existing files, so anything larger is almost certainly a
+// mistake, and would otherwise require an enormous allocation.
+const maxDocumentFileSize = 1 << 30
+
+// Writes the content at the given offset in the destination, growing the
+// destination if necessary. Returns an error if the content would end past
+// maxDocumentFileSize.
+func writeContentAt(destination []byte, offset uint64,
+	content []byte) ([]byte, error) {
+	end, e := rangeEnd(offset, uint64(len(content)))
+	if e != nil {
+		return nil, e
+	}
+	if end > maxDocumentFileSize {
+		return nil, fmt.Errorf("Content at offset 0x%x ends past the "+
+			"maximum file size of 0x%x", offset, maxDocumentFileSize)
+	}
+	if end > uint64(len(destination)) {
+		destination = append(destination,
+			make([]byte, end-uint64(len(destination)))...)
+	}
+	copy(destination[offset:], content)
+	return destination, nil
+}
+
+// Builds the ELF file described by the document, and returns its content.
+// Fill regions are written first, followed by section content, and finally
+// the header tables. Returns an error if the document is invalid, or if a
+// section's name doesn't match its NameOffset.
+func (d *ELFDocument) Build() ([]byte, error) {
+	order, e := d.Header.endianness()
+	if e != nil {
+		return nil, e
+	}
+	if (len(d.Segments) > 0xffff) || (len(d.Sections) > 0xffff) {
+		return nil, fmt.Errorf("Too many segments or sections")
+	}
+	is64 := d.Header.Bits == 64
+	header, e := d.encodeHeader()
+	if e != nil {
+		return nil, fmt.Errorf("Invalid ELF header: %w", e)
+	}
+	if d.FileSize > maxDocumentFileSize {
+		return nil, fmt.Errorf("File size 0x%x is more than the maximum of "+
+			"0x%x", uint64(d.FileSize), maxDocumentFileSize)
+	}
+	toReturn := make([]byte, d.FileSize)
+	for i, fill := range d.Fill {
+		toReturn, e = writeContentAt(toReturn, uint64(fill.FileOffset),
+			fill.Content)
+		if e != nil {
+			return nil, fmt.Errorf("Invalid fill region %d: %w", i, e)
+		}
+	}
+	sections := make([]ELF64SectionHeader, len(d.Sections))
+	for i := range d.Sections {
+		s := &(d.Sections[i])
+		sections[i] = ELF64SectionHeader{
+			Name:           s.NameOffset,
+			Type:           s.Type,
+			Flags:          SectionHeaderFlags64(s.Flags),
+			VirtualAddress: uint64(s.VirtualAddress),
+			FileOffset:     uint64(s.FileOffset),
+			Size:           uint64(s.Size),
+			LinkedIndex:    s.LinkedIndex,
+			Info:           s.Info,
+			Align:          uint64(s.Align),
+			EntrySize:      uint64(s.EntrySize),
+		}
+		if (i == 0) || (s.Type == UninitializedSection) {
+			continue
+		}
+		content, e := d.encodeSectionContent(s)
+		if e != nil {
+			return nil, fmt.Errorf("Failed encoding section %d (%s): %w", i,
+				s.Name, e)
+		}
+		if uint64(len(content)) != uint64(s.Size) {
+			return nil, fmt.Errorf("Section %d (%s) has %d bytes of "+
+				"content, but its size is %d", i, s.Name, len(content),
+				s.Size)
+		}
+		toReturn, e = writeContentAt(toReturn, uint64(s.FileOffset), content)
+		if e != nil {
+			return nil, fmt.Errorf("Invalid section %d (%s): %w", i, s.Name,
+				e)
+		}
+	}
+	segments := make([]ELF64ProgramHeader, len(d.Segments))
+	for i, p := range d.Segments {
+		segments[i] = ELF64ProgramHeader{
+			Type:            p.Type,
+			Flags:           p.Flags,
+			FileOffset:      uint64(p.FileOffset),
+			VirtualAddress:  uint64(p.VirtualAddress),
+			PhysicalAddress: uint64(p.PhysicalAddress),
+			FileSize:        uint64(p.FileSize),
+			MemorySize:      uint64(p.MemorySize),
+			Align:           uint64(p.Align),
+		}
+	}
+	if len(segments) != 0 {
+		table, e := encodeProgramHeaders(is64, order, segments)
+		if e != nil {
+			return nil, e
+		}
+		toReturn, e = writeContentAt(toReturn,
+			uint64(d.Header.ProgramHeaderOffset), table)
+		if e != nil {
+			return nil, fmt.Errorf("Invalid program header offset: %w", e)
+		}
+	}
+	if len(sections) != 0 {
+		table, e := encodeSectionHeaders(is64, order, sections)
+		if e != nil {
+			return nil, e
+		}
+		toReturn, e = writeContentAt(toReturn,
+			uint64(d.Header.SectionHeaderOffset), table)
+		if e != nil {
+			return nil, fmt.Errorf("Invalid section header offset: %w", e)
+		}
+	}
+	toReturn, e = writeContentAt(toReturn, 0, header)
+	if e != nil {
+		return nil, e
+	}
+
+	// Finally, make sure the section names are consistent with the names
+	// table.
+	f, e := ParseELFFile(toReturn)
+	if e != nil {
+		return nil, fmt.Errorf("The built file couldn't be parsed: %w", e)
+	}
+	for i := 1; i < len(d.Sections); i++ {
+		if d.Sections[i].Name == "" {
+			continue
+		}
+		name, e := f.GetSectionName(uint16(i))
+		if e != nil {
+			return nil, fmt.Errorf("Couldn't read section %d name: %w", i, e)
+		}
+		if name != d.Sections[i].Name {
+			return nil, fmt.Errorf("Section %d is named %s in the document, "+
+				"but its name offset refers to %s", i, d.Sections[i].Name,
+				name)
+		}
+	}
+	return toReturn, nil
+}
@@ -0,0 +1,174 @@
+package elf_reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDocumentRoundTrip(t *testing.T) {
+	testFile := func(filename string) {
+		contents := fileBytes(filename, t)
+		f, e := ParseELFFile(contents)
+		if e != nil {
+			t.Errorf("Failed parsing %s: %s\n", filename, e)
+			return
+		}
+		document, e := NewELFDocument(f)
+		if e != nil {
+			t.Errorf("Failed creating document for %s: %s\n", filename, e)
+			return
+		}
+		encoded, e := json.Marshal(document)
+		if e != nil {
+			t.Errorf("Failed encoding %s document: %s\n", filename, e)
+			return
+		}
+		var decoded ELFDocument
+		e = json.Unmarshal(encoded, &decoded)
+		if e != nil {
+			t.Errorf("Failed decoding %s document: %s\n", filename, e)
+			return
+		}
+		built, e := decoded.Build()
+		if e != nil {
+			t.Errorf("Failed building %s from its document: %s\n", filename,
+				e)
+			return
+		}
+		if !bytes.Equal(built, contents) {
+			t.Errorf("Building %s from its document changed its content\n",
+				filename)
+		}
+	}
+	testFile("test_data/bash32_freebsd")
+	testFile("test_data/sleep_amd64")
+	testFile("test_data/sleep_arm32")
+	testFile("test_data/ld-linux_arm32.so")
+	testFile("test_data/hello_debug_amd64.o")
+}
+
+func TestBuildDocumentFixture(t *testing.T) {
+	var document ELFDocument
+	e := json.Unmarshal(fileBytes("test_data/sleep_amd64.json", t),
+		&document)
+	if e != nil {
+		t.Fatalf("Failed parsing the JSON fixture: %s\n", e)
+	}
+	built, e := document.Build()
+	if e != nil {
+		t.Fatalf("Failed building the JSON fixture: %s\n", e)
+	}
+	if !bytes.Equal(built, fileBytes("test_data/sleep_amd64", t)) {
+		t.Errorf("The JSON fixture didn't build into sleep_amd64\n")
+	}
+
+	// Edit a structured section and make sure the change is reflected.
+	for i := range document.Sections {
+		s := &(document.Sections[i])
+		if s.Name != ".dynstr" {
+			continue
+		}
+		for j := range s.Strings {
+			s.Strings[j] = strings.Replace(s.Strings[j], "libc.so.6",
+				"libd.so.6", 1)
+		}
+	}
+	built, e = document.Build()
+	if e != nil {
+		t.Fatalf("Failed building the edited document: %s\n", e)
+	}
+	f, e := ParseELF64File(built)
+	if e != nil {
+		t.Fatalf("Failed parsing the edited file: %s\n", e)
+	}
+	dynstrIndex, e := FindSectionByName(f, ".dynstr")
+	if e != nil {
+		t.Fatalf("Couldn't find .dynstr in the edited file: %s\n", e)
+	}
+	dynstr, e := f.GetSectionContent(dynstrIndex)
+	if e != nil {
+		t.Fatalf("Couldn't read the edited .dynstr: %s\n", e)
+	}
+	if !bytes.Contains(dynstr, []byte("libd.so.6\x00")) {
+		t.Errorf("The edited string wasn't in the built file\n")
+	}
+
+	// Mismatched names should be reported.
+	document.Sections[1].Name = "not the right name"
+	_, e = document.Build()
+	if e == nil {
+		t.Errorf("Didn't get an error for a mismatched section name\n")
+	} else {
+		t.Logf("Got expected error for a mismatched name: %s\n", e)
+	}
+}
+
+func TestHexValues(t *testing.T) {
+	var v struct {
+		A HexUint64
+		B HexUint64
+		C HexBytes
+		D HexBytes
+	}
+	e := json.Unmarshal([]byte(`{"A": "0x1f", "B": 31, "C": "01 02",
+		"D": ["0304", "05"]}`), &v)
+	if e != nil {
+		t.Fatalf("Failed parsing hex values: %s\n", e)
+	}
+	if (v.A != 31) || (v.B != 31) {
+		t.Errorf("Incorrect hex numbers: %d, %d\n", v.A, v.B)
+	}
+	if !bytes.Equal(v.C, []byte{1, 2}) || !bytes.Equal(v.D,
+		[]byte{3, 4, 5}) {
+		t.Errorf("Incorrect hex bytes: %v, %v\n", v.C, v.D)
+	}
+	e = json.Unmarshal([]byte(`{"A": "zz"}`), &v)
+	if e == nil {
+		t.Errorf("Didn't get an error for an invalid hex number\n")
+	}
+}
+
+func TestBuildInvalidDocument(t *testing.T) {
+	// Each of these documents must produce an error rather than a panic.
+	expectError := func(description string, edit func(d *ELFDocument)) {
+		var d ELFDocument
+		e := json.Unmarshal(fileBytes("test_data/sleep_amd64.json", t), &d)
+		if e != nil {
+			t.Fatalf("Failed parsing the JSON fixture: %s\n", e)
+		}
+		edit(&d)
+		_, e = d.Build()
+		if e == nil {
+			t.Errorf("Didn't get an error for %s\n", description)
+			return
+		}
+		t.Logf("Got expected error for %s: %s\n", description, e)
+	}
+	expectError("a huge file size", func(d *ELFDocument) {
+		d.FileSize = 0xffffffffffffff00
+	})
+	expectError("a fill region at a huge offset", func(d *ELFDocument) {
+		d.Fill = append(d.Fill, DocumentFill{
+			FileOffset: 0xfffffffffffffffe,
+			Content:    HexBytes{1, 2, 3, 4},
+		})
+	})
+	expectError("a fill region past the maximum size", func(d *ELFDocument) {
+		d.Fill = append(d.Fill, DocumentFill{
+			FileOffset: maxDocumentFileSize,
+			Content:    HexBytes{1},
+		})
+	})
+	expectError("a section at a huge offset", func(d *ELFDocument) {
+		for i := range d.Sections {
+			if d.Sections[i].Name == ".interp" {
+				d.Sections[i].FileOffset = 0xfffffffffffffff8
+			}
+		}
+	})
+	expectError("a huge section header offset", func(d *ELFDocument) {
+		d.Header.SectionHeaderOffset = 0xffffffffffffffc0
+	})
+}
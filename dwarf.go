@@ -0,0 +1,447 @@
+package elf_reader
+
+// This file contains code for loading the DWARF debugging information from
+// an ELF file's .debug_* sections, using the standard library's debug/dwarf
+// package to parse it.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The section flag bit indicating that a section's content is compressed.
+const sectionFlagCompressed = 0x800
+
+// The compression type, in a compression header, for zlib.
+const compressionZlib = 1
+
+// Holds the content of the DWARF sections in a file, keyed by their names
+// without the ".debug_" or ".zdebug_" prefix or the ".dwo" suffix, e.g.
+// "info" for .debug_info.
+type dwarfSections struct {
+	content map[string][]byte
+	// The content of each .debug_types section, in order.
+	types [][]byte
+	// True if the sections came from a split DWARF (.dwo) file.
+	split bool
+}
+
+// Returns the name of the DWARF section, without the ".debug_" or
+// ".zdebug_" prefix or the ".dwo" suffix, or an empty string if the section
+// isn't a DWARF section. Also returns true if the section is compressed using
+// the old .zdebug format, and true if it's a split DWARF section.
+func dwarfSectionKey(name string) (string, bool, bool) {
+	zdebug := false
+	switch {
+	case strings.HasPrefix(name, ".debug_"):
+		name = name[len(".debug_"):]
+	case strings.HasPrefix(name, ".zdebug_"):
+		name = name[len(".zdebug_"):]
+		zdebug = true
+	default:
+		return "", false, false
+	}
+	split := strings.HasSuffix(name, ".dwo")
+	return strings.TrimSuffix(name, ".dwo"), zdebug, split
+}
+
+// Decompresses the content of a section with the SHF_COMPRESSED flag, which
+// starts with a compression header.
+func decompressSection(content []byte, is64 bool,
+	order binary.ByteOrder) ([]byte, error) {
+	var size uint64
+	headerSize := 12
+	if is64 {
+		headerSize = 24
+	}
+	if len(content) < headerSize {
+		return nil, fmt.Errorf("%w: compression header", ErrTruncated)
+	}
+	compressionType := order.Uint32(content)
+	if is64 {
+		size = order.Uint64(content[8:])
+	} else {
+		size = uint64(order.Uint32(content[4:]))
+	}
+	if compressionType != compressionZlib {
+		return nil, fmt.Errorf("Unsupported compression type: %d",
+			compressionType)
+	}
+	return inflate(content[headerSize:], size)
+}
+
+// Decompresses the content of a .zdebug_* section, which starts with "ZLIB"
+// and the decompressed size as a big-endian 64-bit integer.
+func decompressZdebugSection(content []byte) ([]byte, error) {
+	if (len(content) < 12) || (string(content[:4]) != "ZLIB") {
+		return nil, fmt.Errorf("Invalid .zdebug section header")
+	}
+	return inflate(content[12:], binary.BigEndian.Uint64(content[4:]))
+}
+
+// Decompresses the zlib data, which must decompress to the given size.
+func inflate(data []byte, size uint64) ([]byte, error) {
+	// Each byte of compressed data can expand to at most about 1032 bytes,
+	// so reject sizes that can't be correct before allocating anything.
+	if (size / 1032) > uint64(len(data)) {
+		return nil, fmt.Errorf("Decompressed size %d is too large for %d "+
+			"bytes of compressed data", size, len(data))
+	}
+	reader, e := zlib.NewReader(bytes.NewReader(data))
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading zlib data: %w", e)
+	}
+	defer reader.Close()
+	toReturn := make([]byte, size)
+	_, e = io.ReadFull(reader, toReturn)
+	if e != nil {
+		return nil, fmt.Errorf("Failed decompressing section: %w", e)
+	}
+	return toReturn, nil
+}
+
+// Returns the size of the value modified by the given relocation type, for
+// the relocations that can appear in debug sections, or 0 if the relocation
+// type isn't supported. Returns an error if the machine isn't supported.
+func dwarfRelocationSize(machine MachineType, relocationType uint32) (int,
+	error) {
+	switch machine {
+	case MachineTypeAMD64:
+		switch relocationType {
+		case 1: // R_X86_64_64
+			return 8, nil
+		case 10, 11: // R_X86_64_32, R_X86_64_32S
+			return 4, nil
+		}
+		return 0, nil
+	case MachineTypeX86:
+		if relocationType == 1 { // R_386_32
+			return 4, nil
+		}
+		return 0, nil
+	case MachineTypeARM:
+		if relocationType == 2 { // R_ARM_ABS32
+			return 4, nil
+		}
+		return 0, nil
+	case MachineTypeARM64:
+		switch relocationType {
+		case 257: // R_AARCH64_ABS64
+			return 8, nil
+		case 258: // R_AARCH64_ABS32
+			return 4, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("Relocations for %s aren't supported", machine)
+}
+
+// Applies the relocations in the relocation section at the given index to the
+// content of the section that they modify. The content must be a copy of the
+// section's content, since it's modified in place.
+func applyDWARFRelocations(f ELFFile, index uint16, content []byte) error {
+	header, e := f.GetSectionHeader(index)
+	if e != nil {
+		return e
+	}
+	relocations, e := f.GetRelocations(index)
+	if e != nil {
+		return e
+	}
+	symbols, _, e := f.GetSymbols(uint16(header.GetLinkedIndex()))
+	if e != nil {
+		return fmt.Errorf("Failed reading symbols for relocations: %w", e)
+	}
+	order := fileEndianness(f)
+	withAddends := header.GetType() == RelaSection
+	for i, r := range relocations {
+		size, e := dwarfRelocationSize(f.GetMachineType(), r.Type())
+		if e != nil {
+			return e
+		}
+		symbolIndex := uint64(r.SymbolIndex())
+		if (size == 0) || (symbolIndex == 0) {
+			continue
+		}
+		if symbolIndex >= uint64(len(symbols)) {
+			return &InvalidIndexError{"symbol", symbolIndex}
+		}
+		// Relocations against undefined or special symbols can't be applied
+		// without linking.
+		symbol := symbols[symbolIndex]
+		if (symbol.GetSectionIndex() == 0) ||
+			(symbol.GetSectionIndex() >= 0xff00) {
+			continue
+		}
+		offset := r.Offset()
+		if (offset > uint64(len(content))) ||
+			(uint64(size) > (uint64(len(content)) - offset)) {
+			return sectionError(f, index, "relocation table",
+				uint64(i)*header.GetEntrySize(), ErrTruncated)
+		}
+		target := content[offset:]
+		value := symbol.GetValue()
+		if withAddends {
+			value += uint64(r.Addend())
+		} else if size == 8 {
+			value += order.Uint64(target)
+		} else {
+			value += uint64(order.Uint32(target))
+		}
+		if size == 8 {
+			order.PutUint64(target, value)
+		} else {
+			order.PutUint32(target, uint32(value))
+		}
+	}
+	return nil
+}
+
+// Returns the content of the DWARF sections in the file, after decompressing
+// them and, for relocatable files, applying relocations.
+func getDWARFSections(f ELFFile) (*dwarfSections, error) {
+	toReturn := &dwarfSections{
+		content: make(map[string][]byte),
+	}
+	is64 := is64Bit(f)
+	order := fileEndianness(f)
+	indices := make(map[uint16][]byte)
+	var typesIndices []uint16
+	headers := sectionHeaders64(f)
+	for i := 1; i < len(headers); i++ {
+		header := &(headers[i])
+		name, e := f.GetSectionName(uint16(i))
+		if e != nil {
+			return nil, e
+		}
+		key, zdebug, split := dwarfSectionKey(name)
+		if (key == "") || (header.Type == UninitializedSection) {
+			continue
+		}
+		content, e := f.GetSectionContent(uint16(i))
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading %s: %w", name, e)
+		}
+		if (header.Flags & sectionFlagCompressed) != 0 {
+			content, e = decompressSection(content, is64, order)
+		} else if zdebug {
+			content, e = decompressZdebugSection(content)
+		} else {
+			// Copy the content, since relocations modify it in place.
+			content = append([]byte(nil), content...)
+		}
+		if e != nil {
+			return nil, fmt.Errorf("Failed decompressing %s: %w", name, e)
+		}
+		if split {
+			toReturn.split = true
+		}
+		indices[uint16(i)] = content
+		if key == "types" {
+			typesIndices = append(typesIndices, uint16(i))
+			continue
+		}
+		if _, ok := toReturn.content[key]; !ok {
+			toReturn.content[key] = content
+		}
+	}
+	if f.GetFileType() == ELFTypeRelocatable {
+		for i := 1; i < len(headers); i++ {
+			t := headers[i].Type
+			if (t != RelaSection) && (t != RelSection) {
+				continue
+			}
+			content, ok := indices[uint16(headers[i].Info)]
+			if !ok {
+				continue
+			}
+			e := applyDWARFRelocations(f, uint16(i), content)
+			if e != nil {
+				return nil, fmt.Errorf("Failed applying relocations in "+
+					"section %d: %w", i, e)
+			}
+		}
+	}
+	for _, i := range typesIndices {
+		toReturn.types = append(toReturn.types, indices[i])
+	}
+	return toReturn, nil
+}
+
+// Returns the given DWARF 5 .debug_str_offsets or .debug_rnglists content from
+// a split DWARF file without the header at its start. The units in a .dwo file
+// don't have DW_AT_str_offsets_base or DW_AT_rnglists_base attributes, since
+// their tables implicitly start after the header, but debug/dwarf uses a base
+// of 0 when the attributes are missing. The header size is the size of the
+// fields after the unit length.
+func skipSplitTableHeader(content []byte, order binary.ByteOrder,
+	headerSize int) []byte {
+	lengthSize := 4
+	if (len(content) >= 4) && (order.Uint32(content) == 0xffffffff) {
+		lengthSize = 12
+	}
+	if len(content) < (lengthSize + headerSize) {
+		return content
+	}
+	if order.Uint16(content[lengthSize:]) != 5 {
+		return content
+	}
+	return content[lengthSize+headerSize:]
+}
+
+// Returns the ID of the first unit in the given .debug_info content if it's a
+// DWARF 5 skeleton or split compilation unit. Returns false if it isn't.
+func splitUnitID(info []byte, order binary.ByteOrder) (uint64, bool) {
+	// The version follows the unit length, and is followed by the unit type,
+	// address size, abbreviation offset and unit ID.
+	lengthSize, offsetSize := 4, 4
+	if (len(info) >= 4) && (order.Uint32(info) == 0xffffffff) {
+		lengthSize, offsetSize = 12, 8
+	}
+	idOffset := lengthSize + 4 + offsetSize
+	if len(info) < (idOffset + 8) {
+		return 0, false
+	}
+	version := order.Uint16(info[lengthSize:])
+	unitType := info[lengthSize+2]
+	// The unit types are DW_UT_skeleton and DW_UT_split_compile.
+	if (version != 5) || ((unitType != 4) && (unitType != 5)) {
+		return 0, false
+	}
+	return order.Uint64(info[idOffset:]), true
+}
+
+// Creates the dwarf.Data from the given sections. If addr isn't nil, it's used
+// as the .debug_addr content instead of the section in the file.
+func newDWARFData(sections *dwarfSections, order binary.ByteOrder,
+	addr []byte) (*dwarf.Data, error) {
+	c := sections.content
+	if len(c["info"]) == 0 {
+		return nil, fmt.Errorf("The file doesn't contain a .debug_info " +
+			"section")
+	}
+	if sections.split {
+		// The version, padding and, for range lists, the address size,
+		// segment selector size and offset count follow the unit length.
+		c["str_offsets"] = skipSplitTableHeader(c["str_offsets"], order, 4)
+		c["rnglists"] = skipSplitTableHeader(c["rnglists"], order, 8)
+	}
+	toReturn, e := dwarf.New(c["abbrev"], c["aranges"], c["frame"], c["info"],
+		c["line"], c["pubnames"], c["ranges"], c["str"])
+	if e != nil {
+		return nil, fmt.Errorf("Failed parsing DWARF data: %w", e)
+	}
+	if addr == nil {
+		addr = c["addr"]
+	}
+	additional := map[string][]byte{
+		".debug_addr":        addr,
+		".debug_line_str":    c["line_str"],
+		".debug_str_offsets": c["str_offsets"],
+		".debug_rnglists":    c["rnglists"],
+	}
+	for name, content := range additional {
+		if content == nil {
+			continue
+		}
+		e = toReturn.AddSection(name, content)
+		if e != nil {
+			return nil, fmt.Errorf("Failed adding %s: %w", name, e)
+		}
+	}
+	for i, content := range sections.types {
+		e = toReturn.AddTypes(fmt.Sprintf("types %d", i), content)
+		if e != nil {
+			return nil, fmt.Errorf("Failed adding .debug_types: %w", e)
+		}
+	}
+	return toReturn, nil
+}
+
+// Returns the DWARF debugging information in the given file.
+func loadDWARF(f ELFFile) (*dwarf.Data, error) {
+	sections, e := getDWARFSections(f)
+	if e != nil {
+		return nil, e
+	}
+	return newDWARFData(sections, fileEndianness(f), nil)
+}
+
+// Returns the DWARF debugging information from the file's .debug_* sections,
+// which may be compressed, or from its .debug_*.dwo sections if it's a split
+// DWARF file. Relocations are applied to the sections in relocatable files.
+// Addresses in a .dwo file can only be read using LoadSplitDWARF.
+func (f *ELF64File) DWARF() (*dwarf.Data, error) {
+	return loadDWARF(f)
+}
+
+// Returns the DWARF debugging information from the file's .debug_* sections.
+// See the documentation for ELF64File.DWARF.
+func (f *ELF32File) DWARF() (*dwarf.Data, error) {
+	return loadDWARF(f)
+}
+
+// Returns the DWARF debugging information from a split DWARF (.dwo) file,
+// using the .debug_addr section from the skeleton file that refers to it,
+// which is needed to read the addresses in the .dwo file. Returns an error if
+// the skeleton and split units' IDs don't match. Only files containing a
+// single compilation unit are supported.
+func LoadSplitDWARF(skeleton, dwo ELFFile) (*dwarf.Data, error) {
+	skeletonSections, e := getDWARFSections(skeleton)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading skeleton file: %w", e)
+	}
+	dwoSections, e := getDWARFSections(dwo)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading .dwo file: %w", e)
+	}
+	if !dwoSections.split {
+		return nil, fmt.Errorf("The .dwo file doesn't contain split DWARF " +
+			"sections")
+	}
+	skeletonID, ok := splitUnitID(skeletonSections.content["info"],
+		fileEndianness(skeleton))
+	if !ok {
+		return nil, fmt.Errorf("The skeleton file doesn't start with a " +
+			"skeleton unit")
+	}
+	dwoID, ok := splitUnitID(dwoSections.content["info"], fileEndianness(dwo))
+	if !ok {
+		return nil, fmt.Errorf("The .dwo file doesn't start with a split " +
+			"compilation unit")
+	}
+	if skeletonID != dwoID {
+		return nil, fmt.Errorf("The .dwo file's unit ID (0x%x) doesn't "+
+			"match the skeleton's (0x%x)", dwoID, skeletonID)
+	}
+	// The skeleton unit's DW_AT_addr_base gives the start of its addresses.
+	// The split unit doesn't have the attribute, so provide the addresses
+	// starting from the base.
+	skeletonData, e := newDWARFData(skeletonSections,
+		fileEndianness(skeleton), nil)
+	if e != nil {
+		return nil, fmt.Errorf("Failed parsing skeleton DWARF: %w", e)
+	}
+	unit, e := skeletonData.Reader().Next()
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading skeleton unit: %w", e)
+	}
+	addr := skeletonSections.content["addr"]
+	if unit != nil {
+		if base, ok := unit.Val(dwarf.AttrAddrBase).(int64); ok {
+			if (base < 0) || (uint64(base) > uint64(len(addr))) {
+				return nil, fmt.Errorf("Invalid address base: %d", base)
+			}
+			addr = addr[base:]
+		}
+	}
+	if addr == nil {
+		addr = []byte{}
+	}
+	return newDWARFData(dwoSections, fileEndianness(dwo), addr)
+}
@@ -0,0 +1,164 @@
+package elf_reader
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/dwarf"
+	"encoding/binary"
+	"testing"
+)
+
+// Returns the first DWARF entry with the given tag and name. Fails the test if
+// there isn't one.
+func findDWARFEntry(d *dwarf.Data, tag dwarf.Tag, name string,
+	t *testing.T) *dwarf.Entry {
+	reader := d.Reader()
+	for {
+		entry, e := reader.Next()
+		if e != nil {
+			t.Fatalf("Failed reading DWARF entries: %s\n", e)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag != tag {
+			continue
+		}
+		if entryName, _ := entry.Val(dwarf.AttrName).(string); entryName ==
+			name {
+			return entry
+		}
+	}
+	t.Fatalf("Couldn't find DWARF entry for %s\n", name)
+	return nil
+}
+
+// Returns the value of the named symbol in the file's .symtab section.
+func testSymbolValue(f ELFFile, name string, t *testing.T) uint64 {
+	index := testSectionIndex(f, ".symtab", t)
+	symbols, names, e := f.GetSymbols(index)
+	if e != nil {
+		t.Fatalf("Failed reading symbols: %s\n", e)
+	}
+	for i := range names {
+		if names[i] == name {
+			return symbols[i].GetValue()
+		}
+	}
+	t.Fatalf("Couldn't find symbol %s\n", name)
+	return 0
+}
+
+// Checks that the DWARF information for hello.c contains the expected
+// entries, and that the address of main matches its symbol.
+func checkHelloDWARF(d *dwarf.Data, mainAddress uint64, t *testing.T) {
+	unit := findDWARFEntry(d, dwarf.TagCompileUnit, "hello.c", t)
+	findDWARFEntry(d, dwarf.TagStructType, "packet", t)
+	findDWARFEntry(d, dwarf.TagSubprogram, "checksum", t)
+	mainEntry := findDWARFEntry(d, dwarf.TagSubprogram, "main", t)
+	address, ok := mainEntry.Val(dwarf.AttrLowpc).(uint64)
+	if !ok || (address != mainAddress) {
+		t.Errorf("Expected main at 0x%x, got 0x%x\n", mainAddress, address)
+	}
+	lines, e := d.LineReader(unit)
+	if (e != nil) || (lines == nil) {
+		t.Fatalf("Failed getting line reader: %v\n", e)
+	}
+	var line dwarf.LineEntry
+	e = lines.Next(&line)
+	if e != nil {
+		t.Fatalf("Failed reading line table: %s\n", e)
+	}
+	t.Logf("First line table entry: %s:%d at 0x%x\n", line.File.Name,
+		line.Line, line.Address)
+}
+
+func TestDWARF(t *testing.T) {
+	for _, name := range []string{"hello_debug_amd64.o",
+		"hello_debug_amd64"} {
+		f := parseTestELF64("test_data/"+name, t)
+		d, e := f.DWARF()
+		if e != nil {
+			t.Fatalf("Failed loading DWARF from %s: %s\n", name, e)
+		}
+		// Without applying relocations, main's address would be 0 in the
+		// relocatable file.
+		checkHelloDWARF(d, testSymbolValue(f, "main", t), t)
+	}
+
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	_, e := f.DWARF()
+	if e == nil {
+		t.Errorf("Didn't get an error for a file without DWARF info\n")
+	}
+}
+
+func TestCompressedDWARF(t *testing.T) {
+	original := parseTestELF64("test_data/hello_debug_amd64", t)
+	index := testSectionIndex(original, ".debug_info", t)
+	content, e := original.GetSectionContent(index)
+	if e != nil {
+		t.Fatalf("Failed reading .debug_info: %s\n", e)
+	}
+	var compressed bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, compressionZlib)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(content)))
+	binary.LittleEndian.PutUint64(header[16:], 1)
+	compressed.Write(header)
+	w := zlib.NewWriter(&compressed)
+	w.Write(content)
+	w.Close()
+	f := replaceSectionContent(original.Raw, ".debug_info",
+		compressed.Bytes()).(*ELF64File)
+	f.Sections[index].Flags |= sectionFlagCompressed
+	d, e := f.DWARF()
+	if e != nil {
+		t.Fatalf("Failed loading compressed DWARF: %s\n", e)
+	}
+	checkHelloDWARF(d, testSymbolValue(f, "main", t), t)
+
+	// Claim a decompressed size that's too large.
+	binary.LittleEndian.PutUint64(f.Raw[f.Sections[index].FileOffset+8:],
+		0xffffffffff)
+	_, e = f.DWARF()
+	if e == nil {
+		t.Errorf("Didn't get an error for an invalid decompressed size\n")
+	}
+}
+
+func TestSplitDWARF(t *testing.T) {
+	skeleton := parseTestELF64("test_data/hello_split_amd64.o", t)
+	dwo := parseTestELF64("test_data/hello_split_amd64.dwo", t)
+	d, e := LoadSplitDWARF(skeleton, dwo)
+	if e != nil {
+		t.Fatalf("Failed loading split DWARF: %s\n", e)
+	}
+	findDWARFEntry(d, dwarf.TagCompileUnit, "hello.c", t)
+	findDWARFEntry(d, dwarf.TagStructType, "packet", t)
+	mainEntry := findDWARFEntry(d, dwarf.TagSubprogram, "main", t)
+	address, ok := mainEntry.Val(dwarf.AttrLowpc).(uint64)
+	expected := testSymbolValue(skeleton, "main", t)
+	if !ok || (address != expected) {
+		t.Errorf("Expected main at 0x%x, got 0x%x\n", expected, address)
+	}
+
+	// The skeleton's DWARF data should be readable on its own, too.
+	d, e = skeleton.DWARF()
+	if e != nil {
+		t.Fatalf("Failed loading skeleton DWARF: %s\n", e)
+	}
+	entry, e := d.Reader().Next()
+	if (e != nil) || (entry == nil) {
+		t.Fatalf("Failed reading skeleton unit: %v\n", e)
+	}
+	if name, _ := entry.Val(dwarf.AttrDwoName).(string); name == "" {
+		t.Errorf("The skeleton unit doesn't have a .dwo name\n")
+	}
+
+	other := parseTestELF64("test_data/hello_debug_amd64.o", t)
+	_, e = LoadSplitDWARF(other, dwo)
+	if e == nil {
+		t.Errorf("Didn't get an error for a non-skeleton file\n")
+	}
+}
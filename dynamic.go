@@ -0,0 +1,158 @@
+package elf_reader
+
+// This file contains 32- or 64-bit agnostic helpers for reading the dynamic
+// linking table.
+
+import (
+	"fmt"
+)
+
+// Values of dynamic table tags. These can be compared against the value
+// returned by ELFDynamicTag.GetValue().
+const (
+	DynamicTagNull           = 0
+	DynamicTagNeeded         = 1
+	DynamicTagPLTRelSize     = 2
+	DynamicTagPLTGOT         = 3
+	DynamicTagHash           = 4
+	DynamicTagStringTable    = 5
+	DynamicTagSymbolTable    = 6
+	DynamicTagRela           = 7
+	DynamicTagRelaSize       = 8
+	DynamicTagRelaEntrySize  = 9
+	DynamicTagStringSize     = 10
+	DynamicTagSymbolSize     = 11
+	DynamicTagInit           = 12
+	DynamicTagFini           = 13
+	DynamicTagSOName         = 14
+	DynamicTagRPath          = 15
+	DynamicTagSymbolic       = 16
+	DynamicTagRel            = 17
+	DynamicTagRelSize        = 18
+	DynamicTagRelEntrySize   = 19
+	DynamicTagPLTRel         = 20
+	DynamicTagDebug          = 21
+	DynamicTagTextRel        = 22
+	DynamicTagJumpRel        = 23
+	DynamicTagBindNow        = 24
+	DynamicTagInitArray      = 25
+	DynamicTagFiniArray      = 26
+	DynamicTagInitArraySize  = 27
+	DynamicTagFiniArraySize  = 28
+	DynamicTagRunPath        = 29
+	DynamicTagFlags          = 30
+	DynamicTagGNUHash        = 0x6ffffef5
+	DynamicTagVersionSymbols = 0x6ffffff0
+	DynamicTagFlags1         = 0x6ffffffb
+	DynamicTagVersionDef     = 0x6ffffffc
+	DynamicTagVersionDefNum  = 0x6ffffffd
+	DynamicTagVersionNeed    = 0x6ffffffe
+	DynamicTagVersionNeedNum = 0x6fffffff
+)
+
+// Bits in the value of a DynamicTagFlags entry.
+const (
+	DynamicFlagOrigin    = 0x1
+	DynamicFlagSymbolic  = 0x2
+	DynamicFlagTextRel   = 0x4
+	DynamicFlagBindNow   = 0x8
+	DynamicFlagStaticTLS = 0x10
+)
+
+// Bits in the value of a DynamicTagFlags1 entry.
+const (
+	DynamicFlag1Now      = 0x1
+	DynamicFlag1Global   = 0x2
+	DynamicFlag1NoDelete = 0x8
+	DynamicFlag1NoOpen   = 0x40
+	DynamicFlag1Origin   = 0x80
+	DynamicFlag1PIE      = 0x8000000
+)
+
+// Holds the parsed dynamic linking table of an ELF file, along with the
+// string table it refers to.
+type DynamicTable struct {
+	// The section index of the dynamic table.
+	SectionIndex uint16
+	// The entries in the table, not including the terminating null entry or
+	// anything following it.
+	Entries []ELFDynamicEntry
+	// The content of the table's string table.
+	StringTable []byte
+}
+
+// Returns the dynamic linking table in the given file. Returns nil and no
+// error if the file doesn't have a dynamic table.
+func GetDynamicTable(f ELFFile) (*DynamicTable, error) {
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		if !f.IsDynamicSection(i) {
+			continue
+		}
+		entries, e := f.DynamicEntries(i)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading the dynamic table: %w", e)
+		}
+		for j, entry := range entries {
+			if entry.GetTag().GetValue() == DynamicTagNull {
+				entries = entries[:j]
+				break
+			}
+		}
+		header, e := f.GetSectionHeader(i)
+		if e != nil {
+			return nil, e
+		}
+		stringTable, e := f.GetSectionContent(uint16(
+			header.GetLinkedIndex()))
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading dynamic strings: %w", e)
+		}
+		return &DynamicTable{
+			SectionIndex: i,
+			Entries:      entries,
+			StringTable:  stringTable,
+		}, nil
+	}
+	return nil, nil
+}
+
+// Returns the values of all entries with the given tag.
+func (t *DynamicTable) Values(tag int64) []uint64 {
+	var toReturn []uint64
+	for _, entry := range t.Entries {
+		if entry.GetTag().GetValue() == tag {
+			toReturn = append(toReturn, entry.GetValue())
+		}
+	}
+	return toReturn
+}
+
+// Returns true if the table contains an entry with the given tag.
+func (t *DynamicTable) HasTag(tag int64) bool {
+	return len(t.Values(tag)) != 0
+}
+
+// Returns the combined value of all entries with the given tag. Intended for
+// flags entries, such as DynamicTagFlags1.
+func (t *DynamicTable) Flags(tag int64) uint64 {
+	var toReturn uint64
+	for _, v := range t.Values(tag) {
+		toReturn |= v
+	}
+	return toReturn
+}
+
+// Returns the strings referred to by all entries with the given tag. Intended
+// for tags such as DynamicTagNeeded or DynamicTagRunPath.
+func (t *DynamicTable) Strings(tag int64) ([]string, error) {
+	var toReturn []string
+	for _, v := range t.Values(tag) {
+		s, e := ReadStringAtOffset(uint32(v), t.StringTable)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading the string for dynamic "+
+				"tag %d: %w", tag, e)
+		}
+		toReturn = append(toReturn, string(s))
+	}
+	return toReturn, nil
+}
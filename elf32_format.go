@@ -19,7 +19,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"io"
 	"strings"
 )
 
@@ -32,7 +31,9 @@ const (
 	MachineTypeX86               = 0x03
 	MachineTypeMIPS              = 0x08
 	MachineTypePowerPC           = 0x14
+	MachineTypePowerPC64         = 0x15
 	MachineTypeARM               = 0x28
+	MachineTypeSPARCV9           = 0x2b
 	MachineTypeAMD64             = 0x3e
 	MachineTypeARM64             = 0xb7
 	MachineTypeAMDGPU            = 0xe0
@@ -43,6 +44,11 @@ const (
 	NoteSegment                  = 4
 	ReservedSegment              = 5
 	ProgramHeaderSegment         = 6
+	TLSSegment                   = 7
+	GNUEHFrameSegment            = 0x6474e550
+	GNUStackSegment              = 0x6474e551
+	GNURelroSegment              = 0x6474e552
+	GNUPropertySegment           = 0x6474e553
 	NullSection                  = 0
 	BitsSection                  = 1
 	SymbolTableSection           = 2
@@ -55,7 +61,12 @@ const (
 	RelSection                   = 9
 	ReservedSection              = 10
 	DynamicLoaderSymbolSection   = 11
-	GNUHashSection               = 0x6ffffff5
+	InitArraySection             = 14
+	FiniArraySection             = 15
+	PreinitArraySection          = 16
+	GroupSection                 = 17
+	SymbolTableIndexSection      = 18
+	GNUHashSection               = 0x6ffffff6
 	GNUVersionDefinitionSection  = 0x6ffffffd
 	GNUVersionRequirementSection = 0x6ffffffe
 	GNUVersionSymbolSection      = 0x6fffffff
@@ -91,8 +102,12 @@ func (t MachineType) String() string {
 		return "MIPS"
 	case MachineTypePowerPC:
 		return "PowerPC"
+	case MachineTypePowerPC64:
+		return "64-bit PowerPC"
 	case MachineTypeARM:
 		return "ARM"
+	case MachineTypeSPARCV9:
+		return "SPARC V9"
 	case MachineTypeAMD64:
 		return "AMD64"
 	case MachineTypeARM64:
@@ -123,10 +138,16 @@ func (ht ProgramHeaderType) String() string {
 		return "reserved segment type"
 	case ProgramHeaderSegment:
 		return "program header table"
-	case 0x6474e551:
+	case TLSSegment:
+		return "thread-local storage segment"
+	case GNUEHFrameSegment:
+		return "exception handling frame header (GNU)"
+	case GNUStackSegment:
 		return "stack executability (GNU)"
-	case 0x6474e552:
+	case GNURelroSegment:
 		return "read-only after relocation (GNU)"
+	case GNUPropertySegment:
+		return "program properties (GNU)"
 	}
 	if (t >= 0x70000000) && (t < 0x80000000) {
 		return fmt.Sprintf("processor-specific segment: 0x%x", t)
@@ -184,6 +205,16 @@ func (ht SectionHeaderType) String() string {
 		return "reserved"
 	case DynamicLoaderSymbolSection:
 		return "dynamic loader symbol table"
+	case InitArraySection:
+		return "initialization function pointers"
+	case FiniArraySection:
+		return "termination function pointers"
+	case PreinitArraySection:
+		return "pre-initialization function pointers"
+	case GroupSection:
+		return "section group"
+	case SymbolTableIndexSection:
+		return "extended symbol section indices"
 	case GNUHashSection:
 		return "GNU symbol hash table"
 	case GNUVersionDefinitionSection:
@@ -205,6 +236,10 @@ func (ht SectionHeaderType) String() string {
 	return fmt.Sprintf("invalid section type: 0x%x", t)
 }
 
+// The SHF_INFO_LINK section flag, indicating that the Info field of a section
+// header holds a section index.
+const SectionFlagInfoLink = 0x40
+
 type SectionHeaderFlags32 uint32
 
 func (f SectionHeaderFlags32) String() string {
@@ -448,27 +483,33 @@ type ELF32File struct {
 	Segments   []ELF32ProgramHeader
 	Raw        []byte
 	Endianness binary.ByteOrder
+	// A copy of the section headers as they were when the file was last
+	// parsed. Used to find the original location of section content when
+	// serializing the file.
+	parsedSections []ELF32SectionHeader
+	// The options the file was parsed with. May be nil.
+	options *ParseOptions
+	// Problems found when parsing the file in lenient mode.
+	warnings []error
 }
 
 // Returns the bytes of the section at the given index, or an error if one
 // occurs.
 func (f *ELF32File) GetSectionContent(sectionIndex uint16) ([]byte, error) {
 	if int(sectionIndex) >= len(f.Sections) {
-		return nil, fmt.Errorf("Invalid section index: %d", sectionIndex)
+		return nil, &InvalidIndexError{"section", uint64(sectionIndex)}
 	}
 	sectionHeader := f.Sections[sectionIndex]
 	if sectionHeader.Type == UninitializedSection {
 		return nil, UninitializedDataSectionError(sectionIndex)
 	}
 	start := sectionHeader.FileOffset
-	if (int(start) < 0) || (int(start) > len(f.Raw)) {
-		return nil, fmt.Errorf("Bad file offset for section %d: %d",
-			sectionIndex, start)
-	}
 	end := start + sectionHeader.Size
-	if (int(end) < int(start)) || (int(end) > len(f.Raw)) {
-		return nil, fmt.Errorf("Bad end offset for %d-byte section %d: %d",
-			f.Sections[sectionIndex].Size, sectionIndex, end)
+	if (uint64(start) > uint64(len(f.Raw))) ||
+		(uint64(end) > uint64(len(f.Raw))) || (end < start) {
+		return nil, sectionError(f, sectionIndex, "section content", 0,
+			fmt.Errorf("%w: the %d-byte section extends past the end of "+
+				"the file", ErrTruncated, sectionHeader.Size))
 	}
 	return f.Raw[start:end], nil
 }
@@ -476,16 +517,20 @@ func (f *ELF32File) GetSectionContent(sectionIndex uint16) ([]byte, error) {
 // Returns the bytes of the segment at the given index, or an error if one
 // occurs.
 func (f *ELF32File) GetSegmentContent(segmentIndex uint16) ([]byte, error) {
-	if int(segmentIndex) > len(f.Segments) {
-		return nil, fmt.Errorf("Invalid segment index: %d", segmentIndex)
+	if int(segmentIndex) >= len(f.Segments) {
+		return nil, &InvalidIndexError{"segment", uint64(segmentIndex)}
 	}
 	start := f.Segments[segmentIndex].FileOffset
 	if uint64(start) > uint64(len(f.Raw)) {
-		return nil, fmt.Errorf("Bad file offset for segment %d", segmentIndex)
+		return nil, headerError("segment content", uint64(start),
+			fmt.Errorf("%w: segment %d starts past the end of the file",
+				ErrTruncated, segmentIndex))
 	}
 	end := start + f.Segments[segmentIndex].FileSize
 	if (uint64(end) > uint64(len(f.Raw))) || (end < start) {
-		return nil, fmt.Errorf("Bad size for segment %d", segmentIndex)
+		return nil, headerError("segment content", uint64(start),
+			fmt.Errorf("%w: segment %d extends past the end of the file",
+				ErrTruncated, segmentIndex))
 	}
 	return f.Raw[start:end], nil
 }
@@ -496,7 +541,7 @@ func (f *ELF32File) ReadStringTable(sectionIndex uint16, offset uint32) (
 	string, error) {
 	content, e := f.GetSectionContent(sectionIndex)
 	if e != nil {
-		return "", fmt.Errorf("Couldn't get string table content: %s", e)
+		return "", fmt.Errorf("Couldn't get string table content: %w", e)
 	}
 	if f.Sections[sectionIndex].Type != StringTableSection {
 		return "", fmt.Errorf("Section %d wasn't a string table", sectionIndex)
@@ -511,15 +556,26 @@ func (f *ELF32File) GetSectionName(sectionIndex uint16) (string, error) {
 	if sectionIndex == 0 {
 		return "", fmt.Errorf("The null (0-index) section doesn't have a name")
 	}
+	if int(sectionIndex) >= len(f.Sections) {
+		return "", &InvalidIndexError{"section", uint64(sectionIndex)}
+	}
 	stringContent, e := f.GetSectionContent(f.Header.SectionNamesTable)
 	if e != nil {
-		return "", fmt.Errorf("Couldn't read section names table: %s", e)
+		e = fmt.Errorf("Couldn't read section names table: %w", e)
+	} else {
+		var name []byte
+		name, e = ReadStringAtOffset(f.Sections[sectionIndex].Name,
+			stringContent)
+		if e == nil {
+			return string(name), nil
+		}
+		e = sectionError(f, f.Header.SectionNamesTable, "section name",
+			uint64(f.Sections[sectionIndex].Name), e)
 	}
-	name, e := ReadStringAtOffset(f.Sections[sectionIndex].Name, stringContent)
-	if e != nil {
-		return "", fmt.Errorf("Couldn't read section name: %s", e)
+	if f.options.isLenient() {
+		return placeholderSectionName(sectionIndex), nil
 	}
-	return string(name), nil
+	return "", e
 }
 
 // Returns true if the section at the given index is a string table.
@@ -558,14 +614,19 @@ func (f *ELF32File) GetSymbolTable(sectionIndex uint16) ([]ELF32Symbol,
 	header := &(f.Sections[sectionIndex])
 	nameTable, e := f.GetSectionContent(uint16(header.LinkedIndex))
 	if e != nil {
-		return nil, nil, fmt.Errorf("Failed reading symbol name table: %s", e)
+		return nil, nil, fmt.Errorf("Failed reading symbol name table: %w", e)
 	}
 	entryCount := header.Size / uint32(binary.Size(&ELF32Symbol{}))
+	e = f.options.checkSymbolCount(uint64(entryCount),
+		uint64(binary.Size(&ELF32Symbol{})))
+	if e != nil {
+		return nil, nil, sectionError(f, sectionIndex, "symbol table", 0, e)
+	}
 	symbols := make([]ELF32Symbol, entryCount)
 	data := bytes.NewReader(content)
 	e = binary.Read(data, f.Endianness, symbols)
 	if e != nil {
-		return nil, nil, fmt.Errorf("Failed parsing symbol table: %s", e)
+		return nil, nil, sectionError(f, sectionIndex, "symbol table", 0, e)
 	}
 	names := make([]string, entryCount)
 	var nameOffset uint32
@@ -580,8 +641,9 @@ func (f *ELF32File) GetSymbolTable(sectionIndex uint16) ([]ELF32Symbol,
 		}
 		tmp, e = ReadStringAtOffset(nameOffset, nameTable)
 		if e != nil {
-			return nil, nil, fmt.Errorf("Couldn't read name for symbol %d: %s",
-				i, e)
+			return nil, nil, sectionError(f, uint16(header.LinkedIndex),
+				"symbol name", uint64(nameOffset), fmt.Errorf("Couldn't "+
+					"read name for symbol %d: %w", i, e))
 		}
 		names[i] = string(tmp)
 	}
@@ -597,10 +659,12 @@ func (f *ELF32File) GetStringTable(sectionIndex uint16) ([]string, error) {
 	}
 	content, e := f.GetSectionContent(sectionIndex)
 	if e != nil {
-		return nil, fmt.Errorf("Failed reading string table: %s", e)
+		return nil, fmt.Errorf("Failed reading string table: %w", e)
 	}
-	if content[len(content)-1] != 0 {
-		return nil, fmt.Errorf("The string table wasn't null-terminated")
+	if (len(content) == 0) || (content[len(content)-1] != 0) {
+		return nil, sectionError(f, sectionIndex, "string table", 0,
+			fmt.Errorf("%w: the string table isn't null-terminated",
+				ErrTruncated))
 	}
 	// Trim the last null byte from the table to avoid having an extra empty
 	// string in the slice we return.
@@ -630,15 +694,20 @@ func (f *ELF32File) GetRelocationTable(sectionIndex uint16) ([]ELF32Relocation,
 	header := &(f.Sections[sectionIndex])
 	content, e := f.GetSectionContent(sectionIndex)
 	if e != nil {
-		return nil, fmt.Errorf("Failed reading relocation table: %s", e)
+		return nil, fmt.Errorf("Failed reading relocation table: %w", e)
 	}
 	data := bytes.NewReader(content)
 	if header.Type == RelaSection {
 		entryCount := int(header.Size) / binary.Size(&ELF32Rela{})
+		e = f.options.checkAllocation(uint64(entryCount),
+			uint64(binary.Size(&ELF32Rela{})))
+		if e != nil {
+			return nil, sectionError(f, sectionIndex, "rela table", 0, e)
+		}
 		toReturnData := make([]ELF32Rela, entryCount)
 		e = binary.Read(data, f.Endianness, toReturnData)
 		if e != nil {
-			return nil, fmt.Errorf("Failed parsing rela table: %s", e)
+			return nil, sectionError(f, sectionIndex, "rela table", 0, e)
 		}
 		// Unfortunately, a slice of structs doesn't equal a slice of
 		// relocation interfaces because the interface is implemented on top of
@@ -652,10 +721,15 @@ func (f *ELF32File) GetRelocationTable(sectionIndex uint16) ([]ELF32Relocation,
 	}
 	// We're assuming this is a .rel section, since it wasn't .rela
 	entryCount := int(header.Size) / binary.Size(&ELF32Rel{})
+	e = f.options.checkAllocation(uint64(entryCount),
+		uint64(binary.Size(&ELF32Rel{})))
+	if e != nil {
+		return nil, sectionError(f, sectionIndex, "rel table", 0, e)
+	}
 	toReturnData := make([]ELF32Rel, entryCount)
 	e = binary.Read(data, f.Endianness, toReturnData)
 	if e != nil {
-		return nil, fmt.Errorf("Failed parsing rel table: %s", e)
+		return nil, sectionError(f, sectionIndex, "rel table", 0, e)
 	}
 	toReturn := make([]ELF32Relocation, entryCount)
 	for i := range toReturnData {
@@ -781,15 +855,20 @@ func (f *ELF32File) GetDynamicTable(sectionIndex uint16) ([]ELF32DynamicEntry,
 	}
 	content, e := f.GetSectionContent(sectionIndex)
 	if e != nil {
-		return nil, fmt.Errorf("Failed reading dynamic section: %s", e)
+		return nil, fmt.Errorf("Failed reading dynamic section: %w", e)
 	}
 	data := bytes.NewReader(content)
 	entryCount := f.Sections[sectionIndex].Size /
 		uint32(binary.Size(&ELF32DynamicEntry{}))
+	e = f.options.checkAllocation(uint64(entryCount),
+		uint64(binary.Size(&ELF32DynamicEntry{})))
+	if e != nil {
+		return nil, sectionError(f, sectionIndex, "dynamic table", 0, e)
+	}
 	toReturn := make([]ELF32DynamicEntry, entryCount)
 	e = binary.Read(data, f.Endianness, toReturn)
 	if e != nil {
-		return nil, fmt.Errorf("Failed parsing dynamic section: %s", e)
+		return nil, sectionError(f, sectionIndex, "dynamic table", 0, e)
 	}
 	return toReturn, nil
 }
@@ -830,39 +909,6 @@ func (f *ELF32File) IsVersionRequirementSection(sectionIndex uint16) bool {
 	return f.Sections[sectionIndex].Type == GNUVersionRequirementSection
 }
 
-// Parses and returns a chain of ELF32VersionNeedAux structures, with the first
-// structure starting at the given offset in a section's content. Requires the
-// number of version aux structures to expect.
-func (f *ELF32File) parseVersionNeedAux(content []byte, firstOffset int64,
-	count uint16) ([]ELF32VersionNeedAux, error) {
-	data := bytes.NewReader(content)
-	_, e := data.Seek(firstOffset, io.SeekStart)
-	if e != nil {
-		return nil, fmt.Errorf("Failed seeking first version aux: %s", e)
-	}
-	toReturn := make([]ELF32VersionNeedAux, 0, count)
-	// Like ParseVersionRequirementSection, we need to get these 1 at a time.
-	var current ELF32VersionNeedAux
-	var startOffset int64
-	for count > 0 {
-		startOffset, e = data.Seek(0, io.SeekCurrent)
-		if e != nil {
-			return nil, fmt.Errorf("Failed getting current offset: %s", e)
-		}
-		e = binary.Read(data, f.Endianness, &current)
-		if e != nil {
-			return nil, fmt.Errorf("Failed parsing req. aux struct: %s", e)
-		}
-		toReturn = append(toReturn, current)
-		_, e = data.Seek(startOffset+int64(current.Next), io.SeekStart)
-		if e != nil {
-			return nil, fmt.Errorf("Failed seeking to next aux struct: %s", e)
-		}
-		count--
-	}
-	return toReturn, nil
-}
-
 // Reads the dynamic linking table to find the number of entries in the GNU
 // version dependency table.
 func (f *ELF32File) getVersionDependencyTableSize() (uint32, error) {
@@ -874,7 +920,7 @@ func (f *ELF32File) getVersionDependencyTableSize() (uint32, error) {
 		}
 		entries, e = f.GetDynamicTable(uint16(i))
 		if e != nil {
-			return 0, fmt.Errorf("Failed reading the dynamic table: %s", e)
+			return 0, fmt.Errorf("Failed reading the dynamic table: %w", e)
 		}
 		break
 	}
@@ -913,58 +959,11 @@ func (f *ELF32File) ParseVersionRequirementSection(sectionIndex uint16) (
 		return nil, nil, fmt.Errorf("Not a version requirement section: %d",
 			sectionIndex)
 	}
-	content, e := f.GetSectionContent(sectionIndex)
-	if e != nil {
-		return nil, nil, fmt.Errorf(
-			"Failed reading version requirement section: %s", e)
-	}
-	data := bytes.NewReader(content)
 	entryCount, e := f.getVersionDependencyTableSize()
 	if e != nil {
 		return nil, nil, e
 	}
-	if entryCount == 0 {
-		return nil, nil, nil
-	}
-	toReturn := make([]ELF32VersionNeed, 0, entryCount)
-	auxData := make([][]ELF32VersionNeedAux, 0, entryCount)
-	// Unlike other ELF structures, we need to read these version entries one
-	// at a time--they may not be directly adjacent.
-	var current ELF32VersionNeed
-	var currentAux []ELF32VersionNeedAux
-	var startOffset int64
-	var totalRead uint32
-	for {
-		startOffset, e = data.Seek(0, io.SeekCurrent)
-		if e != nil {
-			return nil, nil, fmt.Errorf("Failed getting current offset: %s", e)
-		}
-		e = binary.Read(data, f.Endianness, &current)
-		if e != nil {
-			return nil, nil, fmt.Errorf(
-				"Failed reading version requirement: %s", e)
-		}
-		toReturn = append(toReturn, current)
-		currentAux, e = f.parseVersionNeedAux(content, startOffset+
-			int64(current.AuxOffset), current.Count)
-		if e != nil {
-			return nil, nil, fmt.Errorf("Failed parsing version requirement "+
-				"aux data: %s", e)
-		}
-		auxData = append(auxData, currentAux)
-		totalRead++
-		if totalRead >= entryCount {
-			break
-		}
-		// The Next field contains an offset relative to the start of the
-		// version need structure.
-		_, e = data.Seek(startOffset+int64(current.Next), io.SeekStart)
-		if e != nil {
-			return nil, nil, fmt.Errorf(
-				"Failed seeking to next requirement: %s", e)
-		}
-	}
-	return toReturn, auxData, nil
+	return parseVersionRequirementSection(f, sectionIndex, entryCount)
 }
 
 // This is the analogue to the Elf32_Verdef structure, used in GNU version
@@ -1011,7 +1010,7 @@ func (f *ELF32File) getVersionDefinitionTableSize() (uint32, error) {
 		}
 		entries, e = f.GetDynamicTable(uint16(i))
 		if e != nil {
-			return 0, fmt.Errorf("Failed reading the dynamic table: %s", e)
+			return 0, fmt.Errorf("Failed reading the dynamic table: %w", e)
 		}
 		break
 	}
@@ -1038,39 +1037,6 @@ func (f *ELF32File) getVersionDefinitionTableSize() (uint32, error) {
 	return toReturn, nil
 }
 
-// Parses and returns a chain of ELF32VersionDefAux structures, with the first
-// structure starting at the given offset in a section's content. Requires the
-// number of definition aux structures to expect.
-func (f *ELF32File) parseVersionDefAux(content []byte, firstOffset int64,
-	count uint16) ([]ELF32VersionDefAux, error) {
-	data := bytes.NewReader(content)
-	_, e := data.Seek(firstOffset, io.SeekStart)
-	if e != nil {
-		return nil, fmt.Errorf("Failed seeking first version aux: %s", e)
-	}
-	toReturn := make([]ELF32VersionDefAux, 0, count)
-	// Like ParseVersionDefintionSection, we need to get these 1 at a time.
-	var current ELF32VersionDefAux
-	var startOffset int64
-	for count > 0 {
-		startOffset, e = data.Seek(0, io.SeekCurrent)
-		if e != nil {
-			return nil, fmt.Errorf("Failed getting current offset: %s", e)
-		}
-		e = binary.Read(data, f.Endianness, &current)
-		if e != nil {
-			return nil, fmt.Errorf("Failed parsing defn. aux struct: %s", e)
-		}
-		toReturn = append(toReturn, current)
-		_, e = data.Seek(startOffset+int64(current.Next), io.SeekStart)
-		if e != nil {
-			return nil, fmt.Errorf("Failed seeking to next aux struct: %s", e)
-		}
-		count--
-	}
-	return toReturn, nil
-}
-
 // This parses a GNU version definition section with the given index. Returns
 // a slice of version definition structs, and a slice of auxiliary structures
 // corresponding to each definition. This behaves similarly to
@@ -1081,71 +1047,33 @@ func (f *ELF32File) ParseVersionDefinitionSection(sectionIndex uint16) (
 		return nil, nil, fmt.Errorf("Not a version definition section: %d",
 			sectionIndex)
 	}
-	content, e := f.GetSectionContent(sectionIndex)
-	if e != nil {
-		return nil, nil, fmt.Errorf(
-			"Failed reading version definition section: %s", e)
-	}
-	data := bytes.NewReader(content)
 	entryCount, e := f.getVersionDefinitionTableSize()
 	if e != nil {
 		return nil, nil, e
 	}
-	if entryCount == 0 {
-		return nil, nil, nil
-	}
-	toReturn := make([]ELF32VersionDef, 0, entryCount)
-	auxData := make([][]ELF32VersionDefAux, 0, entryCount)
-	// Like with version requirements, we need to read these entires one at a
-	// time.
-	var current ELF32VersionDef
-	var currentAux []ELF32VersionDefAux
-	var startOffset int64
-	var totalRead uint32
-	for {
-		startOffset, e = data.Seek(0, io.SeekCurrent)
-		if e != nil {
-			return nil, nil, fmt.Errorf("Failed getting current offset: %s", e)
-		}
-		e = binary.Read(data, f.Endianness, &current)
-		if e != nil {
-			return nil, nil, fmt.Errorf(
-				"Failed reading version definition: %s", e)
-		}
-		toReturn = append(toReturn, current)
-		currentAux, e = f.parseVersionDefAux(content, startOffset+
-			int64(current.AuxOffset), current.Count)
-		if e != nil {
-			return nil, nil, fmt.Errorf("Failed parsing version definition "+
-				"aux data: %s", e)
-		}
-		auxData = append(auxData, currentAux)
-		totalRead++
-		if totalRead >= entryCount {
-			break
-		}
-		// The Next field contains an offset relative to the start of the
-		// version need structure.
-		_, e = data.Seek(startOffset+int64(current.Next), io.SeekStart)
-		if e != nil {
-			return nil, nil, fmt.Errorf(
-				"Failed seeking to next definition: %s", e)
-		}
-	}
-	return toReturn, auxData, nil
+	return parseVersionDefinitionSection(f, sectionIndex, entryCount)
 }
 
 // Used during initialization to fill in the Segments slice.
 func (f *ELF32File) parseProgramHeaders() error {
-	offset := f.Header.ProgramHeaderOffset
-	if offset >= uint32(len(f.Raw)) {
-		return fmt.Errorf("Invalid program header offset: 0x%x", offset)
+	offset := uint64(f.Header.ProgramHeaderOffset)
+	count, e := f.options.getHeaderTableCount(&f.warnings,
+		"program header table", offset, uint64(f.Header.ProgramHeaderEntries),
+		uint64(binary.Size(&ELF32ProgramHeader{})), uint64(len(f.Raw)),
+		f.options.maxSegments())
+	if e != nil {
+		return e
+	}
+	f.Header.ProgramHeaderEntries = uint16(count)
+	if count == 0 {
+		f.Segments = nil
+		return nil
 	}
 	data := bytes.NewReader(f.Raw[offset:])
-	segments := make([]ELF32ProgramHeader, f.Header.ProgramHeaderEntries)
-	e := binary.Read(data, f.Endianness, segments)
+	segments := make([]ELF32ProgramHeader, count)
+	e = binary.Read(data, f.Endianness, segments)
 	if e != nil {
-		return fmt.Errorf("Failed reading program header table: %s", e)
+		return headerError("program header table", offset, readError(e))
 	}
 	f.Segments = segments
 	return nil
@@ -1153,23 +1081,30 @@ func (f *ELF32File) parseProgramHeaders() error {
 
 // Used during initialization to fill in the Sections slice.
 func (f *ELF32File) parseSectionHeaders() error {
+	offset := uint64(f.Header.SectionHeaderOffset)
+	count, e := f.options.getHeaderTableCount(&f.warnings,
+		"section header table", offset, uint64(f.Header.SectionHeaderEntries),
+		uint64(binary.Size(&ELF32SectionHeader{})), uint64(len(f.Raw)),
+		f.options.maxSections())
+	if e != nil {
+		return e
+	}
+	f.Header.SectionHeaderEntries = uint16(count)
 	// Don't require a valid section header offset if there are no sections.
-	if f.Header.SectionHeaderEntries == 0 {
+	if count == 0 {
 		f.Sections = nil
+		f.parsedSections = nil
 		return nil
 	}
-
-	offset := f.Header.SectionHeaderOffset
-	if offset >= uint32(len(f.Raw)) {
-		return fmt.Errorf("Invalid section header offset: 0x%x", offset)
-	}
 	data := bytes.NewReader(f.Raw[offset:])
-	sections := make([]ELF32SectionHeader, f.Header.SectionHeaderEntries)
-	e := binary.Read(data, f.Endianness, sections)
+	sections := make([]ELF32SectionHeader, count)
+	e = binary.Read(data, f.Endianness, sections)
 	if e != nil {
-		return fmt.Errorf("Failed reading section header table: %s", e)
+		return headerError("section header table", offset, readError(e))
 	}
 	f.Sections = sections
+	f.parsedSections = make([]ELF32SectionHeader, len(sections))
+	copy(f.parsedSections, sections)
 	return nil
 }
 
@@ -1178,20 +1113,22 @@ func (f *ELF32File) parseSectionHeaders() error {
 func (f *ELF32File) ReparseData() error {
 	var header ELF32Header
 	raw := f.Raw
+	f.warnings = nil
 	data := bytes.NewReader(raw)
 	var signature uint32
 	var e error
 	e = binary.Read(data, binary.LittleEndian, &signature)
 	if e != nil {
-		return fmt.Errorf("Failed reading ELF signature: %s", e)
+		return fmt.Errorf("Failed reading ELF signature: %w", ErrTruncated)
 	}
 	if signature != 0x464c457f {
-		return fmt.Errorf("Invalid ELF signature: 0x%08x", signature)
+		return fmt.Errorf("%w: 0x%08x", ErrBadMagic, signature)
 	}
 	// Rewind the input back to the beginning.
 	data = bytes.NewReader(raw)
 	if len(raw) < 6 {
-		return fmt.Errorf("Insufficient size for an ELF file")
+		return fmt.Errorf("Insufficient size for an ELF file: %w",
+			ErrTruncated)
 	}
 	var endianness binary.ByteOrder
 	if raw[5] != 1 {
@@ -1204,7 +1141,7 @@ func (f *ELF32File) ReparseData() error {
 	}
 	e = binary.Read(data, endianness, &header)
 	if e != nil {
-		return fmt.Errorf("Failed reading ELF32 header: %s", e)
+		return headerError("ELF header", 0, ErrTruncated)
 	}
 	// This may have been incorrectly reversed if we're big-endian, so we'll
 	// copy the correct little-endian version just in case.
@@ -1222,14 +1159,23 @@ func (f *ELF32File) ReparseData() error {
 	if e != nil {
 		return e
 	}
+	if f.options.isLenient() {
+		checkLenientSections(f, &f.warnings)
+	}
 	return nil
 }
 
 // Attempts to parse the given data buffer as a 32-bit ELF file. Returns an
 // error if the file isn't a 32-bit ELF.
 func ParseELF32File(raw []byte) (*ELF32File, error) {
+	return parseELF32File(raw, nil)
+}
+
+func parseELF32File(raw []byte, options *ParseOptions) (*ELF32File,
+	error) {
 	var toReturn ELF32File
 	toReturn.Raw = raw
+	toReturn.options = options
 	e := (&toReturn).ReparseData()
 	if e != nil {
 		return nil, e
@@ -99,27 +99,33 @@ type ELF64File struct {
 	Segments   []ELF64ProgramHeader
 	Raw        []byte
 	Endianness binary.ByteOrder
+	// A copy of the section headers as they were when the file was last
+	// parsed. Used to find the original location of section content when
+	// serializing the file.
+	parsedSections []ELF64SectionHeader
+	// The options the file was parsed with. May be nil.
+	options *ParseOptions
+	// Problems found when parsing the file in lenient mode.
+	warnings []error
 }
 
 // Returns the bytes of the section at the given index, or an error if one
 // occurs.
 func (f *ELF64File) GetSectionContent(sectionIndex uint16) ([]byte, error) {
 	if int(sectionIndex) >= len(f.Sections) {
-		return nil, fmt.Errorf("Invalid section index: %d", sectionIndex)
+		return nil, &InvalidIndexError{"section", uint64(sectionIndex)}
 	}
 	sectionHeader := f.Sections[sectionIndex]
 	if sectionHeader.Type == UninitializedSection {
 		return nil, UninitializedDataSectionError(sectionIndex)
 	}
 	start := sectionHeader.FileOffset
-	if start > uint64(len(f.Raw)) {
-		return nil, fmt.Errorf("Bad file offset for section %d: %d",
-			sectionIndex, start)
-	}
 	end := start + sectionHeader.Size
-	if (end > uint64(len(f.Raw))) || (end < start) {
-		return nil, fmt.Errorf("Bad end offset for %d-byte section %d: %d",
-			f.Sections[sectionIndex].Size, sectionIndex, end)
+	if (start > uint64(len(f.Raw))) || (end > uint64(len(f.Raw))) ||
+		(end < start) {
+		return nil, sectionError(f, sectionIndex, "section content", 0,
+			fmt.Errorf("%w: the %d-byte section extends past the end of "+
+				"the file", ErrTruncated, sectionHeader.Size))
 	}
 	return f.Raw[start:end], nil
 }
@@ -127,16 +133,20 @@ func (f *ELF64File) GetSectionContent(sectionIndex uint16) ([]byte, error) {
 // Returns the bytes of the segment at the given index, or an error if one
 // occurs.
 func (f *ELF64File) GetSegmentContent(segmentIndex uint16) ([]byte, error) {
-	if int(segmentIndex) > len(f.Segments) {
-		return nil, fmt.Errorf("Invalid segment index: %d", segmentIndex)
+	if int(segmentIndex) >= len(f.Segments) {
+		return nil, &InvalidIndexError{"segment", uint64(segmentIndex)}
 	}
 	start := f.Segments[segmentIndex].FileOffset
 	if start > uint64(len(f.Raw)) {
-		return nil, fmt.Errorf("Bad file offset for segment %d", segmentIndex)
+		return nil, headerError("segment content", uint64(start),
+			fmt.Errorf("%w: segment %d starts past the end of the file",
+				ErrTruncated, segmentIndex))
 	}
 	end := start + f.Segments[segmentIndex].FileSize
 	if (end > uint64(len(f.Raw))) || (end < start) {
-		return nil, fmt.Errorf("Bad size for segment %d", segmentIndex)
+		return nil, headerError("segment content", uint64(start),
+			fmt.Errorf("%w: segment %d extends past the end of the file",
+				ErrTruncated, segmentIndex))
 	}
 	return f.Raw[start:end], nil
 }
@@ -147,15 +157,26 @@ func (f *ELF64File) GetSectionName(sectionIndex uint16) (string, error) {
 	if sectionIndex == 0 {
 		return "", fmt.Errorf("The null (0-index) section doesn't have a name")
 	}
+	if int(sectionIndex) >= len(f.Sections) {
+		return "", &InvalidIndexError{"section", uint64(sectionIndex)}
+	}
 	stringContent, e := f.GetSectionContent(f.Header.SectionNamesTable)
 	if e != nil {
-		return "", fmt.Errorf("Couldn't read section names table: %s", e)
+		e = fmt.Errorf("Couldn't read section names table: %w", e)
+	} else {
+		var name []byte
+		name, e = ReadStringAtOffset(f.Sections[sectionIndex].Name,
+			stringContent)
+		if e == nil {
+			return string(name), nil
+		}
+		e = sectionError(f, f.Header.SectionNamesTable, "section name",
+			uint64(f.Sections[sectionIndex].Name), e)
 	}
-	name, e := ReadStringAtOffset(f.Sections[sectionIndex].Name, stringContent)
-	if e != nil {
-		return "", fmt.Errorf("Couldn't read section name: %s", e)
+	if f.options.isLenient() {
+		return placeholderSectionName(sectionIndex), nil
 	}
-	return string(name), nil
+	return "", e
 }
 
 // Returns true if the section at the given index is a string table.
@@ -175,10 +196,12 @@ func (f *ELF64File) GetStringTable(sectionIndex uint16) ([]string, error) {
 	}
 	content, e := f.GetSectionContent(sectionIndex)
 	if e != nil {
-		return nil, fmt.Errorf("Failed reading string table: %s", e)
+		return nil, fmt.Errorf("Failed reading string table: %w", e)
 	}
-	if content[len(content)-1] != 0 {
-		return nil, fmt.Errorf("The string table wasn't null-terminated")
+	if (len(content) == 0) || (content[len(content)-1] != 0) {
+		return nil, sectionError(f, sectionIndex, "string table", 0,
+			fmt.Errorf("%w: the string table isn't null-terminated",
+				ErrTruncated))
 	}
 	// Trim the last null byte from the table to avoid having an extra empty
 	// string at the end.
@@ -228,14 +251,19 @@ func (f *ELF64File) GetSymbolTable(sectionIndex uint16) ([]ELF64Symbol,
 	header := &(f.Sections[sectionIndex])
 	nameTable, e := f.GetSectionContent(uint16(header.LinkedIndex))
 	if e != nil {
-		return nil, nil, fmt.Errorf("Failed reading symbol name table: %s", e)
+		return nil, nil, fmt.Errorf("Failed reading symbol name table: %w", e)
 	}
 	entryCount := header.Size / uint64(binary.Size(&ELF64Symbol{}))
+	e = f.options.checkSymbolCount(uint64(entryCount),
+		uint64(binary.Size(&ELF64Symbol{})))
+	if e != nil {
+		return nil, nil, sectionError(f, sectionIndex, "symbol table", 0, e)
+	}
 	symbols := make([]ELF64Symbol, entryCount)
 	data := bytes.NewReader(content)
 	e = binary.Read(data, f.Endianness, symbols)
 	if e != nil {
-		return nil, nil, fmt.Errorf("Failed parsing symbol table: %s", e)
+		return nil, nil, sectionError(f, sectionIndex, "symbol table", 0, e)
 	}
 	names := make([]string, entryCount)
 	var nameOffset uint32
@@ -250,8 +278,9 @@ func (f *ELF64File) GetSymbolTable(sectionIndex uint16) ([]ELF64Symbol,
 		}
 		tmp, e = ReadStringAtOffset(nameOffset, nameTable)
 		if e != nil {
-			return nil, nil, fmt.Errorf("Couldn't read name for symbol %d: %s",
-				i, e)
+			return nil, nil, sectionError(f, uint16(header.LinkedIndex),
+				"symbol name", uint64(nameOffset), fmt.Errorf("Couldn't "+
+					"read name for symbol %d: %w", i, e))
 		}
 		names[i] = string(tmp)
 	}
@@ -373,15 +402,20 @@ func (f *ELF64File) GetRelocationTable(sectionIndex uint16) ([]ELF64Relocation,
 	header := &(f.Sections[sectionIndex])
 	content, e := f.GetSectionContent(sectionIndex)
 	if e != nil {
-		return nil, fmt.Errorf("Failed reading relocation table: %s", e)
+		return nil, fmt.Errorf("Failed reading relocation table: %w", e)
 	}
 	data := bytes.NewReader(content)
 	if header.Type == RelaSection {
 		entryCount := int(header.Size) / binary.Size(&ELF64Rela{})
+		e = f.options.checkAllocation(uint64(entryCount),
+			uint64(binary.Size(&ELF64Rela{})))
+		if e != nil {
+			return nil, sectionError(f, sectionIndex, "rela table", 0, e)
+		}
 		toReturnData := make([]ELF64Rela, entryCount)
 		e = binary.Read(data, f.Endianness, toReturnData)
 		if e != nil {
-			return nil, fmt.Errorf("Failed parsing rela table: %s", e)
+			return nil, sectionError(f, sectionIndex, "rela table", 0, e)
 		}
 		// Unfortunately, a slice of structs doesn't equal a slice of
 		// relocation interfaces because the interface is implemented on top of
@@ -395,10 +429,15 @@ func (f *ELF64File) GetRelocationTable(sectionIndex uint16) ([]ELF64Relocation,
 	}
 	// This wasn't a .rela section, so it must be a .rel section.
 	entryCount := int(header.Size) / binary.Size(&ELF64Rel{})
+	e = f.options.checkAllocation(uint64(entryCount),
+		uint64(binary.Size(&ELF64Rel{})))
+	if e != nil {
+		return nil, sectionError(f, sectionIndex, "rel table", 0, e)
+	}
 	toReturnData := make([]ELF64Rel, entryCount)
 	e = binary.Read(data, f.Endianness, toReturnData)
 	if e != nil {
-		return nil, fmt.Errorf("Failed parsing rel table: %s", e)
+		return nil, sectionError(f, sectionIndex, "rel table", 0, e)
 	}
 	toReturn := make([]ELF64Relocation, entryCount)
 	for i := range toReturnData {
@@ -443,30 +482,44 @@ func (f *ELF64File) GetDynamicTable(sectionIndex uint16) ([]ELF64DynamicEntry,
 	}
 	content, e := f.GetSectionContent(sectionIndex)
 	if e != nil {
-		return nil, fmt.Errorf("Failed reading dynamic section: %s", e)
+		return nil, fmt.Errorf("Failed reading dynamic section: %w", e)
 	}
 	data := bytes.NewReader(content)
 	entryCount := f.Sections[sectionIndex].Size /
 		uint64(binary.Size(&ELF64DynamicEntry{}))
+	e = f.options.checkAllocation(uint64(entryCount),
+		uint64(binary.Size(&ELF64DynamicEntry{})))
+	if e != nil {
+		return nil, sectionError(f, sectionIndex, "dynamic table", 0, e)
+	}
 	toReturn := make([]ELF64DynamicEntry, entryCount)
 	e = binary.Read(data, f.Endianness, toReturn)
 	if e != nil {
-		return nil, fmt.Errorf("Failed parsing dynamic section: %s", e)
+		return nil, sectionError(f, sectionIndex, "dynamic table", 0, e)
 	}
 	return toReturn, nil
 }
 
 // Used during initialization to fill in the Segments slice.
 func (f *ELF64File) parseProgramHeaders() error {
-	offset := f.Header.ProgramHeaderOffset
-	if offset >= uint64(len(f.Raw)) {
-		return fmt.Errorf("Invalid program header offset: 0x%x", offset)
+	offset := uint64(f.Header.ProgramHeaderOffset)
+	count, e := f.options.getHeaderTableCount(&f.warnings,
+		"program header table", offset, uint64(f.Header.ProgramHeaderEntries),
+		uint64(binary.Size(&ELF64ProgramHeader{})), uint64(len(f.Raw)),
+		f.options.maxSegments())
+	if e != nil {
+		return e
+	}
+	f.Header.ProgramHeaderEntries = uint16(count)
+	if count == 0 {
+		f.Segments = nil
+		return nil
 	}
 	data := bytes.NewReader(f.Raw[offset:])
-	segments := make([]ELF64ProgramHeader, f.Header.ProgramHeaderEntries)
-	e := binary.Read(data, f.Endianness, segments)
+	segments := make([]ELF64ProgramHeader, count)
+	e = binary.Read(data, f.Endianness, segments)
 	if e != nil {
-		return fmt.Errorf("Failed reading program header table: %s", e)
+		return headerError("program header table", offset, readError(e))
 	}
 	f.Segments = segments
 	return nil
@@ -474,23 +527,30 @@ func (f *ELF64File) parseProgramHeaders() error {
 
 // Used during initialization to fill in the Sections slice.
 func (f *ELF64File) parseSectionHeaders() error {
+	offset := uint64(f.Header.SectionHeaderOffset)
+	count, e := f.options.getHeaderTableCount(&f.warnings,
+		"section header table", offset, uint64(f.Header.SectionHeaderEntries),
+		uint64(binary.Size(&ELF64SectionHeader{})), uint64(len(f.Raw)),
+		f.options.maxSections())
+	if e != nil {
+		return e
+	}
+	f.Header.SectionHeaderEntries = uint16(count)
 	// Don't require a valid section header offset if there are no sections.
-	if f.Header.SectionHeaderEntries == 0 {
+	if count == 0 {
 		f.Sections = nil
+		f.parsedSections = nil
 		return nil
 	}
-
-	offset := f.Header.SectionHeaderOffset
-	if offset >= uint64(len(f.Raw)) {
-		return fmt.Errorf("Invalid section header offset: 0x%x", offset)
-	}
 	data := bytes.NewReader(f.Raw[offset:])
-	sections := make([]ELF64SectionHeader, f.Header.SectionHeaderEntries)
-	e := binary.Read(data, f.Endianness, sections)
+	sections := make([]ELF64SectionHeader, count)
+	e = binary.Read(data, f.Endianness, sections)
 	if e != nil {
-		return fmt.Errorf("Failed reading section header table: %s", e)
+		return headerError("section header table", offset, readError(e))
 	}
 	f.Sections = sections
+	f.parsedSections = make([]ELF64SectionHeader, len(sections))
+	copy(f.parsedSections, sections)
 	return nil
 }
 
@@ -499,17 +559,22 @@ func (f *ELF64File) parseSectionHeaders() error {
 func (f *ELF64File) ReparseData() error {
 	var header ELF64Header
 	raw := f.Raw
+	f.warnings = nil
 	data := bytes.NewReader(raw)
 	var signature uint32
 	var e error
 	e = binary.Read(data, binary.LittleEndian, &signature)
 	if e != nil {
-		return fmt.Errorf("Failed reading ELF signature: %s", e)
+		return fmt.Errorf("Failed reading ELF signature: %w", ErrTruncated)
+	}
+	if signature != 0x464c457f {
+		return fmt.Errorf("%w: 0x%08x", ErrBadMagic, signature)
 	}
 	// Rewind the input back to the beginning.
 	data = bytes.NewReader(raw)
 	if len(raw) < 6 {
-		return fmt.Errorf("Insufficient size for an ELF file")
+		return fmt.Errorf("Insufficient size for an ELF file: %w",
+			ErrTruncated)
 	}
 	var endianness binary.ByteOrder
 	if raw[5] != 1 {
@@ -522,7 +587,7 @@ func (f *ELF64File) ReparseData() error {
 	}
 	e = binary.Read(data, endianness, &header)
 	if e != nil {
-		return fmt.Errorf("Failed reading ELF64 header: %s", e)
+		return headerError("ELF header", 0, ErrTruncated)
 	}
 	// The signature may have been incorrectly read backwards if we're reading
 	// a big-endian ELF, so we'll copy the correct little endian version to
@@ -541,12 +606,21 @@ func (f *ELF64File) ReparseData() error {
 	if e != nil {
 		return e
 	}
+	if f.options.isLenient() {
+		checkLenientSections(f, &f.warnings)
+	}
 	return nil
 }
 
 func ParseELF64File(raw []byte) (*ELF64File, error) {
+	return parseELF64File(raw, nil)
+}
+
+func parseELF64File(raw []byte, options *ParseOptions) (*ELF64File,
+	error) {
 	var toReturn ELF64File
 	toReturn.Raw = raw
+	toReturn.options = options
 	e := (&toReturn).ReparseData()
 	if e != nil {
 		return nil, e
@@ -146,3 +146,23 @@ func TestParseDynamicTable64(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestMalformedHeaders64(t *testing.T) {
+	raw := append([]byte{}, fileBytes("test_data/sleep_amd64", t)...)
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	_, e := f.GetSegmentContent(uint16(len(f.Segments)))
+	if e == nil {
+		t.Logf("Didn't get an error for an invalid segment index.\n")
+		t.Fail()
+	}
+	// Claim more program headers than fit in the file. The e_phnum field is
+	// at offset 56.
+	f.Raw = raw
+	f.Endianness.PutUint16(raw[56:], 0xffff)
+	e = f.ReparseData()
+	if e == nil {
+		t.Logf("Didn't get an error for too many program headers.\n")
+		t.FailNow()
+	}
+	t.Logf("Got expected error for too many program headers: %s\n", e)
+}
@@ -0,0 +1,102 @@
+// The elf_abi executable records the ABI of a shared library, and checks
+// whether a new build of the library is backwards compatible with an old
+// one. It exits with status 2 if an incompatible change is found, making it
+// suitable for use in CI scripts.
+//
+// Example usage:
+//
+//	./elf_abi -file libfoo.so -snapshot libfoo.abi.json
+//	./elf_abi -file new/libfoo.so -baseline libfoo.abi.json
+//
+// The baseline may either be a snapshot or another shared library.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/yalue/elf_reader"
+	"log"
+	"os"
+)
+
+// Returns an ABI snapshot from the given path, which may be either an ELF
+// file or a JSON snapshot. Files starting with the ELF magic are always
+// parsed as ELF files, so a corrupt library is reported as such rather than as
+// invalid JSON.
+func loadSnapshot(path string) (*elf_reader.ABISnapshot, error) {
+	raw, e := os.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+	if bytes.HasPrefix(raw, []byte("\x7fELF")) {
+		elf, e := elf_reader.ParseELFFile(raw)
+		if e != nil {
+			return nil, e
+		}
+		return elf_reader.NewABISnapshot(elf)
+	}
+	var toReturn elf_reader.ABISnapshot
+	e = json.Unmarshal(raw, &toReturn)
+	if e != nil {
+		return nil, e
+	}
+	return &toReturn, nil
+}
+
+func run() int {
+	var inputFile, snapshotFile, baselineFile string
+	flag.StringVar(&inputFile, "file", "",
+		"The path to the shared library. This is required.")
+	flag.StringVar(&snapshotFile, "snapshot", "",
+		"If set, a JSON snapshot of the library's ABI is written to this "+
+			"path.")
+	flag.StringVar(&baselineFile, "baseline", "",
+		"The path to an older version of the library or a snapshot of it. "+
+			"If set, the library is checked for compatibility with the "+
+			"baseline.")
+	flag.Parse()
+	if (inputFile == "") || ((snapshotFile == "") && (baselineFile == "")) {
+		log.Println("Invalid arguments. Run with -help for more information.")
+		return 1
+	}
+	current, e := loadSnapshot(inputFile)
+	if e != nil {
+		log.Printf("Failed reading the ABI of %s: %s\n", inputFile, e)
+		return 1
+	}
+	if snapshotFile != "" {
+		output, e := json.MarshalIndent(current, "", "  ")
+		if e != nil {
+			log.Printf("Failed encoding the snapshot: %s\n", e)
+			return 1
+		}
+		e = os.WriteFile(snapshotFile, append(output, '\n'), 0644)
+		if e != nil {
+			log.Printf("Failed writing the snapshot: %s\n", e)
+			return 1
+		}
+		log.Printf("Wrote a snapshot of %d symbols to %s\n",
+			len(current.Symbols), snapshotFile)
+	}
+	if baselineFile == "" {
+		return 0
+	}
+	baseline, e := loadSnapshot(baselineFile)
+	if e != nil {
+		log.Printf("Failed reading the baseline ABI: %s\n", e)
+		return 1
+	}
+	report := elf_reader.CompareABI(baseline, current)
+	log.Printf("%s", report)
+	if report.Breaking() {
+		return 2
+	}
+	return 0
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetOutput(os.Stdout)
+	os.Exit(run())
+}
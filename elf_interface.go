@@ -5,6 +5,7 @@ package elf_reader
 // implementing this interface are also kept in this file.
 
 import (
+	"bytes"
 	"fmt"
 )
 
@@ -103,30 +104,55 @@ func (f *ELF32File) GetSegmentCount() uint16 {
 	return f.Header.ProgramHeaderEntries
 }
 
+// Returns the recoverable problems found while parsing the file in lenient
+// mode. Returns nil if the file wasn't parsed in lenient mode.
+func (f *ELF64File) GetWarnings() []error {
+	return f.warnings
+}
+
+// Returns the recoverable problems found while parsing the file in lenient
+// mode. Returns nil if the file wasn't parsed in lenient mode.
+func (f *ELF32File) GetWarnings() []error {
+	return f.warnings
+}
+
+// Returns the recoverable problems found while parsing the given file in
+// lenient mode. Returns nil if the file wasn't parsed in lenient mode, or
+// isn't an *ELF32File or *ELF64File.
+func GetWarnings(f ELFFile) []error {
+	switch v := f.(type) {
+	case *ELF64File:
+		return v.warnings
+	case *ELF32File:
+		return v.warnings
+	}
+	return nil
+}
+
 func (f *ELF64File) GetSectionHeader(index uint16) (ELFSectionHeader, error) {
 	if int(index) >= len(f.Sections) {
-		return nil, fmt.Errorf("Invalid section index: %d", index)
+		return nil, &InvalidIndexError{"section", uint64(index)}
 	}
 	return &(f.Sections[index]), nil
 }
 
 func (f *ELF32File) GetSectionHeader(index uint16) (ELFSectionHeader, error) {
 	if int(index) >= len(f.Sections) {
-		return nil, fmt.Errorf("Invalid section index: %d", index)
+		return nil, &InvalidIndexError{"section", uint64(index)}
 	}
 	return &(f.Sections[index]), nil
 }
 
 func (f *ELF64File) GetProgramHeader(index uint16) (ELFProgramHeader, error) {
 	if int(index) >= len(f.Segments) {
-		return nil, fmt.Errorf("Invalid segment index: %d", index)
+		return nil, &InvalidIndexError{"segment", uint64(index)}
 	}
 	return &(f.Segments[index]), nil
 }
 
 func (f *ELF32File) GetProgramHeader(index uint16) (ELFProgramHeader, error) {
 	if int(index) >= len(f.Segments) {
-		return nil, fmt.Errorf("Invalid segment index: %d", index)
+		return nil, &InvalidIndexError{"segment", uint64(index)}
 	}
 	return &(f.Segments[index]), nil
 }
@@ -520,14 +546,37 @@ func (n *ELF32DynamicEntry) GetValue() uint64 {
 	return uint64(n.Value)
 }
 
+// Returns an error if the data is too short to contain the ELF magic and
+// class.
+func checkELFIdentity(raw []byte) error {
+	if len(raw) < 5 {
+		if !bytes.HasPrefix([]byte("\x7fELF"), raw) {
+			return ErrBadMagic
+		}
+		return fmt.Errorf("%w: the file is only %d bytes", ErrTruncated,
+			len(raw))
+	}
+	return nil
+}
+
 // This function parses any ELF file and returns an instance of the ELFFile
 // interface if no errors occur.
 func ParseELFFile(raw []byte) (ELFFile, error) {
-	if len(raw) < 5 {
-		return nil, fmt.Errorf("Invalid ELF file: is only %d bytes", len(raw))
-	}
-	if raw[4] == 2 {
-		return ParseELF64File(raw)
+	return ParseELFFileWithOptions(raw, nil)
+}
+
+// Returns the index of the first section with the given name, or an error if
+// no such section exists.
+func FindSectionByName(f ELFFile, name string) (uint16, error) {
+	count := f.GetSectionCount()
+	for i := uint16(1); i < count; i++ {
+		sectionName, e := f.GetSectionName(i)
+		if e != nil {
+			return 0, fmt.Errorf("Couldn't get section %d name: %w", i, e)
+		}
+		if sectionName == name {
+			return i, nil
+		}
 	}
-	return ParseELF32File(raw)
+	return 0, fmt.Errorf("Couldn't find a section named %s", name)
 }
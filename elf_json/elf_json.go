@@ -0,0 +1,99 @@
+// The elf_json executable converts ELF files to and from an editable JSON
+// document, in the same manner as the obj2yaml and yaml2obj tools.
+//
+// Example usage:
+//
+//	./elf_json -dump -file <elf_file> > <elf_file>.json
+//	./elf_json -build -file <elf_file>.json -output <elf_file>
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/yalue/elf_reader"
+	"log"
+	"os"
+)
+
+func dumpDocument(inputFile string) int {
+	rawInput, e := os.ReadFile(inputFile)
+	if e != nil {
+		log.Printf("Failed reading input file: %s\n", e)
+		return 1
+	}
+	elf, e := elf_reader.ParseELFFile(rawInput)
+	if e != nil {
+		log.Printf("Failed parsing the input file: %s\n", e)
+		return 1
+	}
+	document, e := elf_reader.NewELFDocument(elf)
+	if e != nil {
+		log.Printf("Failed converting %s to a document: %s\n", inputFile, e)
+		return 1
+	}
+	output, e := json.MarshalIndent(document, "", "  ")
+	if e != nil {
+		log.Printf("Failed encoding JSON: %s\n", e)
+		return 1
+	}
+	os.Stdout.Write(append(output, '\n'))
+	return 0
+}
+
+func buildDocument(inputFile, outputFile string) int {
+	rawInput, e := os.ReadFile(inputFile)
+	if e != nil {
+		log.Printf("Failed reading input file: %s\n", e)
+		return 1
+	}
+	var document elf_reader.ELFDocument
+	e = json.Unmarshal(rawInput, &document)
+	if e != nil {
+		log.Printf("Failed parsing %s: %s\n", inputFile, e)
+		return 1
+	}
+	output, e := document.Build()
+	if e != nil {
+		log.Printf("Failed building ELF file: %s\n", e)
+		return 1
+	}
+	e = os.WriteFile(outputFile, output, 0755)
+	if e != nil {
+		log.Printf("Failed writing output file: %s\n", e)
+		return 1
+	}
+	log.Printf("Wrote %d bytes to %s\n", len(output), outputFile)
+	return 0
+}
+
+func run() int {
+	var inputFile, outputFile string
+	var dump, build bool
+	flag.StringVar(&inputFile, "file", "",
+		"The path to the input file. This is required.")
+	flag.StringVar(&outputFile, "output", "",
+		"The path to which the built ELF file will be written. Required "+
+			"with -build.")
+	flag.BoolVar(&dump, "dump", false,
+		"Print a JSON document describing the input ELF file.")
+	flag.BoolVar(&build, "build", false,
+		"Build an ELF file from the input JSON document.")
+	flag.Parse()
+	if (inputFile == "") || (dump == build) {
+		log.Println("Invalid arguments. Run with -help for more information.")
+		return 1
+	}
+	if dump {
+		return dumpDocument(inputFile)
+	}
+	if outputFile == "" {
+		log.Println("An -output path is required with -build.")
+		return 1
+	}
+	return buildDocument(inputFile, outputFile)
+}
+
+func main() {
+	log.SetFlags(0)
+	os.Exit(run())
+}
@@ -0,0 +1,128 @@
+// The elf_ldd executable lists the shared libraries needed by an ELF file,
+// like the ldd tool, but without running the file. This makes it safe to use
+// on untrusted files, and allows resolving libraries within a sysroot for a
+// different architecture.
+//
+// Example usage:
+//
+//	./elf_ldd -file /usr/bin/ls
+//	./elf_ldd -sysroot /path/to/arm/rootfs -file /usr/bin/ls
+//	./elf_ldd -bindings -file /usr/bin/ls
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/yalue/elf_reader"
+	"log"
+	"os"
+	"strings"
+)
+
+// Prints the result of simulating symbol binding for the file. Returns the
+// exit status.
+func printBindings(inputFile string, options *elf_reader.DependencyOptions,
+	jsonOutput, verbose bool) int {
+	report, e := elf_reader.SimulateBindingForFile(inputFile, options)
+	if e != nil {
+		log.Printf("Failed simulating symbol binding: %s\n", e)
+		return 1
+	}
+	if jsonOutput {
+		output, e := json.MarshalIndent(report, "", "  ")
+		if e != nil {
+			log.Printf("Failed encoding JSON: %s\n", e)
+			return 1
+		}
+		log.Printf("%s\n", output)
+	} else {
+		if verbose {
+			for i := range report.Bindings {
+				log.Printf("%s\n", &(report.Bindings[i]))
+			}
+		}
+		log.Printf("%s", report)
+	}
+	if report.Errors() {
+		return 2
+	}
+	return 0
+}
+
+func run() int {
+	var inputFile, sysroot, libraryPath, platform, libDir, workingDir string
+	var ignoreCache, ignoreConf, jsonOutput, bindings, verbose bool
+	flag.StringVar(&inputFile, "file", "",
+		"The path to the ELF file. If -sysroot is given, this is relative "+
+			"to the sysroot. This is required.")
+	flag.StringVar(&sysroot, "sysroot", "",
+		"If set, all absolute paths are relative to this directory.")
+	flag.StringVar(&libraryPath, "library_path", "",
+		"A colon-separated list of directories, used in the same way as "+
+			"the LD_LIBRARY_PATH environment variable.")
+	flag.StringVar(&platform, "platform", "",
+		"The value of $PLATFORM in search paths. Defaults to a value based "+
+			"on the file's machine type.")
+	flag.StringVar(&libDir, "lib", "",
+		"The value of $LIB in search paths. Defaults to lib64 for 64-bit "+
+			"files and lib for 32-bit files.")
+	flag.StringVar(&workingDir, "working_dir", "",
+		"The directory that relative paths in DT_NEEDED entries are "+
+			"relative to. Defaults to the root of the sysroot if -sysroot "+
+			"is given, or the current directory otherwise.")
+	flag.BoolVar(&ignoreCache, "ignore_cache", false,
+		"Don't use /etc/ld.so.cache.")
+	flag.BoolVar(&ignoreConf, "ignore_conf", false,
+		"Don't search the directories in /etc/ld.so.conf.")
+	flag.BoolVar(&jsonOutput, "json", false,
+		"Print the dependency tree, or binding report, as JSON.")
+	flag.BoolVar(&bindings, "bindings", false,
+		"Simulate binding each symbol reference to a library, and report "+
+			"undefined symbols, missing versions and interposed symbols.")
+	flag.BoolVar(&verbose, "verbose", false,
+		"With -bindings, list the library each reference binds to.")
+	flag.Parse()
+	if inputFile == "" {
+		log.Println("Invalid arguments. Run with -help for more information.")
+		return 1
+	}
+	options := elf_reader.DependencyOptions{
+		Sysroot:          sysroot,
+		Platform:         platform,
+		LibDir:           libDir,
+		IgnoreCache:      ignoreCache,
+		IgnoreConf:       ignoreConf,
+		WorkingDirectory: workingDir,
+	}
+	if libraryPath != "" {
+		options.LibraryPath = strings.Split(libraryPath, ":")
+	}
+	if bindings {
+		return printBindings(inputFile, &options, jsonOutput, verbose)
+	}
+	tree, e := elf_reader.ResolveDependencies(inputFile, &options)
+	if e != nil {
+		log.Printf("Failed resolving dependencies: %s\n", e)
+		return 1
+	}
+	if jsonOutput {
+		output, e := json.MarshalIndent(tree, "", "  ")
+		if e != nil {
+			log.Printf("Failed encoding JSON: %s\n", e)
+			return 1
+		}
+		log.Printf("%s\n", output)
+	} else {
+		log.Printf("%s", tree)
+	}
+	if !tree.Resolved() {
+		return 2
+	}
+	return 0
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetOutput(os.Stdout)
+	os.Exit(run())
+}
@@ -0,0 +1,88 @@
+// The elf_lint executable checks ELF files for malformed or inconsistent
+// headers, sections, segments, symbols and hash tables. It exits with status
+// 2 if any errors are found, or if any warnings are found when -strict is
+// set.
+//
+// Example usage:
+//
+//	./elf_lint build/bin/*
+//	./elf_lint -json -strict build/lib/libfoo.so
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/yalue/elf_reader"
+	"log"
+	"os"
+)
+
+// Holds the diagnostics for a single file, for JSON output.
+type fileDiagnostics struct {
+	File        string
+	Error       string `json:",omitempty"`
+	Diagnostics elf_reader.ValidationDiagnostics
+}
+
+func run() int {
+	var jsonOutput, strict bool
+	flag.BoolVar(&jsonOutput, "json", false,
+		"Print the diagnostics for each file as JSON.")
+	flag.BoolVar(&strict, "strict", false,
+		"Exit with status 2 if there are any warnings, not only errors.")
+	flag.Parse()
+	if len(flag.Args()) == 0 {
+		log.Println("Invalid arguments. Run with -help for more information. " +
+			"The ELF files to check must follow the other arguments.")
+		return 1
+	}
+	var results []fileDiagnostics
+	status := 0
+	for _, path := range flag.Args() {
+		result := fileDiagnostics{
+			File: path,
+		}
+		raw, e := os.ReadFile(path)
+		if e == nil {
+			var elf elf_reader.ELFFile
+			elf, e = elf_reader.ParseELFFile(raw)
+			if e == nil {
+				result.Diagnostics = elf_reader.ValidateELFFile(elf)
+			}
+		}
+		if e != nil {
+			result.Error = e.Error()
+			status = 2
+		}
+		if result.Diagnostics.HasErrors() ||
+			(strict && (len(result.Diagnostics) != 0)) {
+			status = 2
+		}
+		results = append(results, result)
+	}
+	if jsonOutput {
+		output, e := json.MarshalIndent(results, "", "  ")
+		if e != nil {
+			log.Printf("Failed encoding JSON: %s\n", e)
+			return 1
+		}
+		log.Printf("%s\n", output)
+		return status
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			log.Printf("%s: error: %s\n", result.File, result.Error)
+			continue
+		}
+		for i := range result.Diagnostics {
+			log.Printf("%s: %s\n", result.File, &(result.Diagnostics[i]))
+		}
+	}
+	return status
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetOutput(os.Stdout)
+	os.Exit(run())
+}
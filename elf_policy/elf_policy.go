@@ -0,0 +1,105 @@
+// The elf_policy executable checks ELF files against a set of rules defined
+// in a JSON policy file, e.g. to enforce hardening requirements across all
+// of a build's outputs. It exits with status 2 if any rule with the "error"
+// level is violated.
+//
+// Example usage:
+//
+//	./elf_policy -policy policy.json -format sarif build/bin/* > out.sarif
+//
+// An example policy:
+//
+//	{"Rules": [
+//	  {"ID": "nx", "Type": "no_executable_stack"},
+//	  {"ID": "banned", "Type": "forbidden_imports",
+//	   "Symbols": ["gets", "strcpy"]},
+//	  {"ID": "runpath", "Type": "no_absolute_runpath", "Level": "warning"},
+//	  {"ID": "glibc", "Type": "max_symbol_version",
+//	   "MaxVersion": "GLIBC_2.28"},
+//	  {"ID": "relro", "Type": "require_hardening", "Feature": "RELRO"}
+//	]}
+package main
+
+import (
+	"flag"
+	"github.com/yalue/elf_reader"
+	"log"
+	"os"
+)
+
+func run() int {
+	var policyFile, format string
+	flag.StringVar(&policyFile, "policy", "",
+		"The path to the JSON policy file. This is required.")
+	flag.StringVar(&format, "format", "text",
+		"The output format: text, json or sarif.")
+	flag.Parse()
+	if (policyFile == "") || (len(flag.Args()) == 0) {
+		log.Println("Invalid arguments. Run with -help for more information. " +
+			"The ELF files to check must follow the other arguments.")
+		return 1
+	}
+	if (format != "text") && (format != "json") && (format != "sarif") {
+		log.Printf("Invalid output format: %s\n", format)
+		return 1
+	}
+	rawPolicy, e := os.ReadFile(policyFile)
+	if e != nil {
+		log.Printf("Failed reading policy file: %s\n", e)
+		return 1
+	}
+	policy, e := elf_reader.ParsePolicy(rawPolicy)
+	if e != nil {
+		log.Printf("Invalid policy: %s\n", e)
+		return 1
+	}
+	var results []elf_reader.PolicyResult
+	for _, path := range flag.Args() {
+		raw, e := os.ReadFile(path)
+		if e != nil {
+			log.Printf("Failed reading %s: %s\n", path, e)
+			return 1
+		}
+		elf, e := elf_reader.ParseELFFile(raw)
+		if e != nil {
+			log.Printf("Failed parsing %s: %s\n", path, e)
+			return 1
+		}
+		fileResults, e := policy.Evaluate(path, elf)
+		if e != nil {
+			log.Printf("Failed checking %s: %s\n", path, e)
+			return 1
+		}
+		results = append(results, fileResults...)
+	}
+	switch format {
+	case "text":
+		os.Stdout.WriteString(elf_reader.FormatPolicyResultsText(results))
+	case "json":
+		output, e := elf_reader.FormatPolicyResultsJSON(results)
+		if e != nil {
+			log.Printf("Failed formatting results: %s\n", e)
+			return 1
+		}
+		os.Stdout.Write(append(output, '\n'))
+	case "sarif":
+		output, e := elf_reader.FormatPolicyResultsSARIF(policy, "elf_policy",
+			results)
+		if e != nil {
+			log.Printf("Failed formatting results: %s\n", e)
+			return 1
+		}
+		os.Stdout.Write(append(output, '\n'))
+	}
+	for _, r := range results {
+		if r.Level == "error" {
+			return 2
+		}
+	}
+	return 0
+}
+
+func main() {
+	log.SetFlags(0)
+	os.Exit(run())
+}
@@ -0,0 +1,158 @@
+// The elf_strip executable removes sections and symbols from ELF files, in
+// the same manner as the strip utility. It exists primarily to expose the
+// elf_reader package's Strip function on the command line.
+//
+// Example usage, producing a stripped binary and a separate debug file:
+//
+//	./elf_strip -file <elf_file> -only_keep_debug -output <elf_file>.debug
+//	./elf_strip -file <elf_file> -add_gnu_debuglink <elf_file>.debug \
+//	    -output <stripped_file>
+//
+// It can also rebuild the section header table of a file whose section
+// headers were removed, e.g. by sstrip:
+//
+//	./elf_strip -file <sstripped_file> -reconstruct_sections \
+//	    -output <repaired_file>
+package main
+
+import (
+	"flag"
+	"github.com/yalue/elf_reader"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func run() int {
+	var inputFile, outputFile, keepSymbols, debugLink string
+	var stripDebug, stripAll, onlyKeepDebug, reconstruct bool
+	flag.StringVar(&inputFile, "file", "",
+		"The path to the input ELF file. This is required.")
+	flag.StringVar(&outputFile, "output", "",
+		"The path to which the output file will be written. This is "+
+			"required.")
+	flag.BoolVar(&stripAll, "strip_all", false,
+		"Remove everything not needed at runtime. This is the default if "+
+			"no other mode is given.")
+	flag.BoolVar(&stripDebug, "strip_debug", false,
+		"Only remove debugging sections.")
+	flag.BoolVar(&onlyKeepDebug, "only_keep_debug", false,
+		"Produce a separate debug file, containing only the debugging "+
+			"sections, symbol table and notes.")
+	flag.StringVar(&keepSymbols, "keep_symbols", "",
+		"A comma-separated list of symbol names. If set, only these symbols "+
+			"(and those needed by relocations) are kept in .symtab.")
+	flag.StringVar(&debugLink, "add_gnu_debuglink", "",
+		"The path to a debug file. If set, a .gnu_debuglink section "+
+			"referring to the file is added to the output.")
+	flag.BoolVar(&reconstruct, "reconstruct_sections", false,
+		"Instead of stripping the file, write a copy with a section header "+
+			"table rebuilt from the program headers and dynamic table. "+
+			"Intended for files with missing or corrupt section headers.")
+	flag.Parse()
+	if (inputFile == "") || (outputFile == "") {
+		log.Println("Invalid arguments. Run with -help for more information.")
+		return 1
+	}
+	var options elf_reader.StripOptions
+	modeCount := 0
+	if stripAll {
+		options.Mode = elf_reader.StripAll
+		modeCount++
+	}
+	if stripDebug {
+		options.Mode = elf_reader.StripDebug
+		modeCount++
+	}
+	if onlyKeepDebug {
+		options.Mode = elf_reader.StripOnlyKeepDebug
+		modeCount++
+	}
+	if modeCount > 1 {
+		log.Println("Only one of -strip_all, -strip_debug or " +
+			"-only_keep_debug may be given.")
+		return 1
+	}
+	if (modeCount == 0) && ((keepSymbols != "") || (debugLink != "")) {
+		// Only filtering symbols or adding a debug link shouldn't remove
+		// anything else.
+		options.Mode = elf_reader.StripNone
+	}
+	if keepSymbols != "" {
+		options.KeepSymbols = strings.Split(keepSymbols, ",")
+	}
+	rawInput, e := os.ReadFile(inputFile)
+	if e != nil {
+		log.Printf("Failed reading input file: %s\n", e)
+		return 1
+	}
+	if reconstruct {
+		if (modeCount != 0) || (keepSymbols != "") || (debugLink != "") {
+			log.Println("-reconstruct_sections can't be combined with other " +
+				"options.")
+			return 1
+		}
+		return reconstructSections(rawInput, outputFile)
+	}
+	if debugLink != "" {
+		options.DebugFileContent, e = os.ReadFile(debugLink)
+		if e != nil {
+			log.Printf("Failed reading debug file: %s\n", e)
+			return 1
+		}
+		options.DebugLinkName = filepath.Base(debugLink)
+	}
+	elf, e := elf_reader.ParseELFFile(rawInput)
+	if e != nil {
+		log.Printf("Failed parsing the input file: %s\n", e)
+		return 1
+	}
+	output, e := elf_reader.Strip(elf, &options)
+	if e != nil {
+		log.Printf("Failed stripping %s: %s\n", inputFile, e)
+		return 1
+	}
+	e = os.WriteFile(outputFile, output, 0755)
+	if e != nil {
+		log.Printf("Failed writing output file: %s\n", e)
+		return 1
+	}
+	log.Printf("Wrote %d bytes to %s (%s)\n", len(output), outputFile,
+		options.Mode)
+	return 0
+}
+
+// Writes a copy of the given file with reconstructed section headers to the
+// output path. Returns the exit status.
+func reconstructSections(rawInput []byte, outputFile string) int {
+	// The section headers are being replaced, so don't fail if they're
+	// corrupt.
+	elf, e := elf_reader.ParseELFFileWithOptions(rawInput,
+		&elf_reader.ParseOptions{
+			Lenient: true,
+		})
+	if e != nil {
+		log.Printf("Failed parsing the input file: %s\n", e)
+		return 1
+	}
+	output, e := elf_reader.ReconstructSections(elf)
+	if e != nil {
+		log.Printf("Failed reconstructing sections: %s\n", e)
+		return 1
+	}
+	e = os.WriteFile(outputFile, output, 0755)
+	if e != nil {
+		log.Printf("Failed writing output file: %s\n", e)
+		return 1
+	}
+	log.Printf("Wrote %d bytes to %s (reconstructed sections)\n",
+		len(output), outputFile)
+	return 0
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetOutput(os.Stdout)
+	os.Exit(run())
+}
@@ -3,6 +3,14 @@
 // to facilitate testing of the elf_reader package.
 //
 // Example usage: ./elf_view -file <elf_file> -sections -segments
+//
+// To compare two ELF files: ./elf_view -file <elf_file> -diff <other_file>
+//
+// To look up the source lines for addresses, in the same manner as addr2line:
+// ./elf_view -file <elf_file> -addr2line 0x1149,0x117b
+//
+// If the file is a static library (an ar archive), the output is printed for
+// each member: ./elf_view -file <library.a> -symbols
 package main
 
 import (
@@ -11,6 +19,8 @@ import (
 	"github.com/yalue/elf_reader"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
 func printSections(f elf_reader.ELFFile) error {
@@ -24,11 +34,11 @@ func printSections(f elf_reader.ELFFile) error {
 			name, e = "<null section>", nil
 		}
 		if e != nil {
-			return fmt.Errorf("Error getting section %d name: %s", i, e)
+			return fmt.Errorf("Error getting section %d name: %w", i, e)
 		}
 		header, e := f.GetSectionHeader(i)
 		if e != nil {
-			return fmt.Errorf("Error getting section %d header: %s", i, e)
+			return fmt.Errorf("Error getting section %d header: %w", i, e)
 		}
 		log.Printf("%d. %s: %s\n", i, name, header)
 	}
@@ -80,13 +90,38 @@ func printSegments(f elf_reader.ELFFile) error {
 	for i := uint16(0); i < count; i++ {
 		header, e := f.GetProgramHeader(i)
 		if e != nil {
-			return fmt.Errorf("Error getting segment %d header: %s", i, e)
+			return fmt.Errorf("Error getting segment %d header: %w", i, e)
 		}
 		log.Printf("%d. %s\n", i, header)
 	}
 	return nil
 }
 
+func printSectionSegmentMap(f elf_reader.ELFFile) error {
+	count := f.GetSegmentCount()
+	for i := uint16(0); i < count; i++ {
+		header, e := f.GetProgramHeader(i)
+		if e != nil {
+			return fmt.Errorf("Error getting segment %d header: %w", i, e)
+		}
+		sections, e := elf_reader.GetSegmentSections(f, i)
+		if e != nil {
+			return fmt.Errorf("Error getting segment %d sections: %w", i, e)
+		}
+		names := make([]string, len(sections))
+		for j, index := range sections {
+			names[j], e = f.GetSectionName(index)
+			if e != nil {
+				return fmt.Errorf("Error getting section %d name: %w", index,
+					e)
+			}
+		}
+		log.Printf("%d. %s: %s\n", i, header.GetType(),
+			strings.Join(names, " "))
+	}
+	return nil
+}
+
 func printSymbols(f elf_reader.ELFFile) error {
 	count := f.GetSectionCount()
 	for i := uint16(0); i < count; i++ {
@@ -95,18 +130,26 @@ func printSymbols(f elf_reader.ELFFile) error {
 		}
 		name, e := f.GetSectionName(uint16(i))
 		if e != nil {
-			return fmt.Errorf("Error getting symbol table name: %s", e)
+			return fmt.Errorf("Error getting symbol table name: %w", e)
 		}
 		symbols, names, e := f.GetSymbols(uint16(i))
 		if e != nil {
-			return fmt.Errorf("Couldn't read symbol table: %s", e)
+			return fmt.Errorf("Couldn't read symbol table: %w", e)
 		}
 		log.Printf("%d symbols in section %s:\n", len(symbols), name)
 		for j := range symbols {
 			log.Printf("  %d. %s: %s\n", j, names[j], symbols[j])
 		}
 	}
-	return nil
+	if !elf_reader.HasMiniDebugInfo(f) {
+		return nil
+	}
+	mini, e := elf_reader.GetMiniDebugInfo(f)
+	if e != nil {
+		return fmt.Errorf("Couldn't read the MiniDebugInfo: %w", e)
+	}
+	log.Println("Symbols in the MiniDebugInfo (.gnu_debugdata):")
+	return printSymbols(mini)
 }
 
 func printStrings(f elf_reader.ELFFile) error {
@@ -117,11 +160,11 @@ func printStrings(f elf_reader.ELFFile) error {
 		}
 		name, e := f.GetSectionName(uint16(i))
 		if e != nil {
-			return fmt.Errorf("Error getting string table name: %s", e)
+			return fmt.Errorf("Error getting string table name: %w", e)
 		}
 		splitStrings, e := f.GetStringTable(uint16(i))
 		if e != nil {
-			return fmt.Errorf("Couldn't read string table: %s", e)
+			return fmt.Errorf("Couldn't read string table: %w", e)
 		}
 		log.Printf("%d strings in section %s:\n", len(splitStrings), name)
 		for j, s := range splitStrings {
@@ -139,11 +182,11 @@ func printRelocations(f elf_reader.ELFFile) error {
 		}
 		name, e := f.GetSectionName(uint16(i))
 		if e != nil {
-			return fmt.Errorf("Error getting relocation table name: %s", e)
+			return fmt.Errorf("Error getting relocation table name: %w", e)
 		}
 		relocations, e := f.GetRelocations(uint16(i))
 		if e != nil {
-			return fmt.Errorf("Couldn't read relocation table: %s", e)
+			return fmt.Errorf("Couldn't read relocation table: %w", e)
 		}
 		log.Printf("%d relocations in section %s:\n", len(relocations), name)
 		for j, r := range relocations {
@@ -170,21 +213,21 @@ func printDynamicLinkingTable(f elf_reader.ELFFile) error {
 	}
 	name, e := f.GetSectionName(sectionIndex)
 	if e != nil {
-		return fmt.Errorf("Failed getting dynamic table section name: %s",
+		return fmt.Errorf("Failed getting dynamic table section name: %w",
 			e)
 	}
 	entries, e := f.DynamicEntries(sectionIndex)
 	if e != nil {
-		return fmt.Errorf("Failed parsing the dynamic section: %s", e)
+		return fmt.Errorf("Failed parsing the dynamic section: %w", e)
 	}
 	log.Printf("Dynamic linking table in section %s:\n", name)
 	header, e := f.GetSectionHeader(sectionIndex)
 	if e != nil {
-		return fmt.Errorf("Failed getting .dynamic section header: %s", e)
+		return fmt.Errorf("Failed getting .dynamic section header: %w", e)
 	}
 	stringContent, e := f.GetSectionContent(uint16(header.GetLinkedIndex()))
 	if e != nil {
-		return fmt.Errorf("Failed getting strings for dynamic section: %s", e)
+		return fmt.Errorf("Failed getting strings for dynamic section: %w", e)
 	}
 	var stringValue []byte
 	for i := range entries {
@@ -196,7 +239,7 @@ func printDynamicLinkingTable(f elf_reader.ELFFile) error {
 			stringValue, e = elf_reader.ReadStringAtOffset(
 				uint32(entry.GetValue()), stringContent)
 			if e != nil {
-				return fmt.Errorf("Failed getting string value for tag %s: %s",
+				return fmt.Errorf("Failed getting string value for tag %s: %w",
 					entry.GetTag(), e)
 			}
 			log.Printf("  %d. %s: %s\n", i, entry.GetTag(), stringValue)
@@ -228,15 +271,15 @@ func printGNUVersionRequirements(f *elf_reader.ELF32File) error {
 	stringContent, e := f.GetSectionContent(uint16(section.LinkedIndex))
 	if e != nil {
 		return fmt.Errorf("Couldn't get string table for GNU version "+
-			"requirement section: %s", e)
+			"requirement section: %w", e)
 	}
 	need, aux, e := f.ParseVersionRequirementSection(sectionIndex)
 	if e != nil {
-		return fmt.Errorf("Failed parsing GNU version req. section: %s", e)
+		return fmt.Errorf("Failed parsing GNU version req. section: %w", e)
 	}
 	sectionName, e := f.GetSectionName(uint16(sectionIndex))
 	if e != nil {
-		return fmt.Errorf("Failed getting GBU version req. section name: %s",
+		return fmt.Errorf("Failed getting GBU version req. section name: %w",
 			e)
 	}
 	log.Printf("GNU version requirements in section %s:\n", sectionName)
@@ -244,14 +287,14 @@ func printGNUVersionRequirements(f *elf_reader.ELF32File) error {
 	for i, n := range need {
 		fileName, e = elf_reader.ReadStringAtOffset(n.File, stringContent)
 		if e != nil {
-			return fmt.Errorf("Failed reading required file name: %s", e)
+			return fmt.Errorf("Failed reading required file name: %w", e)
 		}
 		log.Printf(" File %d: %s, version %d\n", i, fileName, n.Version)
 		for j, x := range aux[i] {
 			requirementName, e = elf_reader.ReadStringAtOffset(x.Name,
 				stringContent)
 			if e != nil {
-				return fmt.Errorf("Failed reading requirement name: %s", e)
+				return fmt.Errorf("Failed reading requirement name: %w", e)
 			}
 			log.Printf("   Requirement %d: %s, hash 0x%08x\n", j,
 				requirementName, x.Hash)
@@ -278,15 +321,15 @@ func printGNUVersionDefinitions(f *elf_reader.ELF32File) error {
 	stringContent, e := f.GetSectionContent(uint16(section.LinkedIndex))
 	if e != nil {
 		return fmt.Errorf("Couldn't get string table for GNU version "+
-			"definition section: %s", e)
+			"definition section: %w", e)
 	}
 	def, aux, e := f.ParseVersionDefinitionSection(sectionIndex)
 	if e != nil {
-		return fmt.Errorf("Failed parsing GNU version def. section: %s", e)
+		return fmt.Errorf("Failed parsing GNU version def. section: %w", e)
 	}
 	sectionName, e := f.GetSectionName(uint16(sectionIndex))
 	if e != nil {
-		return fmt.Errorf("Failed getting GBU version def. section name: %s",
+		return fmt.Errorf("Failed getting GBU version def. section name: %w",
 			e)
 	}
 	log.Printf("GNU version definitions in section %s:\n", sectionName)
@@ -297,7 +340,7 @@ func printGNUVersionDefinitions(f *elf_reader.ELF32File) error {
 			definitionName, e = elf_reader.ReadStringAtOffset(x.Name,
 				stringContent)
 			if e != nil {
-				return fmt.Errorf("Failed reading definition name: %s", e)
+				return fmt.Errorf("Failed reading definition name: %w", e)
 			}
 			log.Printf("   Name %d: %s\n", j, definitionName)
 		}
@@ -305,61 +348,75 @@ func printGNUVersionDefinitions(f *elf_reader.ELF32File) error {
 	return nil
 }
 
-func run() int {
-	var inputFile string
-	var showSections, showSegments, showSymbols, showStrings,
-		showRelocations, showDynamic, showRequirements,
-		showDefinitions, showSectionHeaderOffsets,
-		showProgramHeaderOffsets bool
-	var dumpSection, dumpSegment int
-	flag.StringVar(&inputFile, "file", "",
-		"The path to the input ELF file. This is required.")
-	flag.BoolVar(&showSections, "sections", false,
-		"Print a list of sections in the ELF file if set.")
-	flag.BoolVar(&showSegments, "segments", false,
-		"Print a list of segments (program headers) if set.")
-	flag.BoolVar(&showSymbols, "symbols", false,
-		"Print a list of symbols if set.")
-	flag.BoolVar(&showStrings, "strings", false,
-		"Prints the contents of the string tables if set.")
-	flag.BoolVar(&showRelocations, "relocations", false,
-		"Prints a list of relocations if set.")
-	flag.BoolVar(&showDynamic, "dynamic", false,
-		"Prints a list of dynamic linking table entries if set.")
-	flag.BoolVar(&showRequirements, "requirements", false,
-		"Prints a list of the GNU version requirements if set.")
-	flag.BoolVar(&showDefinitions, "definitions", false,
-		"Prints a list of GNU version definitions if set.")
-	flag.BoolVar(&showSectionHeaderOffsets, "section_header_offsets", false,
-		"Prints a list of the offsets of the section headers in the file if "+
-			"set.")
-	flag.BoolVar(&showProgramHeaderOffsets, "program_header_offsets", false,
-		"Prints a list of the offsets of the program headers in the file if "+
-			"set.")
-	flag.IntVar(&dumpSection, "dump_section", -1,
-		"If a valid section index is provided, binary contents of the section"+
-			" will be dumped to stdout and other output will be surpressed.")
-	flag.IntVar(&dumpSegment, "dump_segment", -1,
-		"If a valid segment index is provided, binary contents of the segment"+
-			" will be dumped to stdout and other output will be surpressed. "+
-			"Ignored in favor of -dump_section if -dump_section is provided.")
-	flag.Parse()
-	if inputFile == "" {
-		log.Println("Invalid arguments. Run with -help for more information.")
+// Prints the source file, line and function for each address in the given
+// comma-separated list of hexadecimal addresses, including any functions they
+// were inlined into.
+func printAddr2Line(f elf_reader.ELFFile, addressList string) error {
+	resolver, e := elf_reader.NewLineResolver(f)
+	if e != nil {
+		return fmt.Errorf("Error loading debugging information: %w", e)
+	}
+	for _, s := range strings.Split(addressList, ",") {
+		s = strings.TrimSpace(s)
+		address, e := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+		if e != nil {
+			return fmt.Errorf("Invalid address %s: %w", s, e)
+		}
+		frames, e := resolver.LineFor(address)
+		if e != nil {
+			log.Printf("0x%x: %s\n", address, e)
+			continue
+		}
+		log.Printf("0x%x: %s\n", address, &(frames[0]))
+		for i := 1; i < len(frames); i++ {
+			log.Printf(" (inlined by) %s\n", &(frames[i]))
+		}
+	}
+	return nil
+}
+
+// Prints the differences between the given file and the file at the given
+// path. Returns the exit code, which is 2 if the files differ.
+func printDiff(f elf_reader.ELFFile, otherPath string) int {
+	rawOther, e := os.ReadFile(otherPath)
+	if e != nil {
+		log.Printf("Failed reading %s: %s\n", otherPath, e)
 		return 1
 	}
-	rawInput, e := os.ReadFile(inputFile)
+	other, e := elf_reader.ParseELFFile(rawOther)
 	if e != nil {
-		log.Printf("Failed reading input file: %s\n", e)
+		log.Printf("Failed parsing %s: %s\n", otherPath, e)
 		return 1
 	}
-	elf, e := elf_reader.ParseELFFile(rawInput)
+	diff, e := elf_reader.Diff(f, other)
 	if e != nil {
-		log.Printf("Failed parsing the input file: %s\n", e)
+		log.Printf("Failed comparing the files: %s\n", e)
 		return 1
 	}
-	if dumpSection != -1 {
-		content, e := elf.GetSectionContent(uint16(dumpSection))
+	log.Printf("%s", diff)
+	if diff.Empty() && !diff.BuildIDChanged() {
+		return 0
+	}
+	return 2
+}
+
+// Holds the command-line options controlling what's printed for each ELF
+// file.
+type viewOptions struct {
+	showSections, showSegments, showSymbols, showStrings, showRelocations,
+	showDynamic, showRequirements, showDefinitions,
+	showSectionHeaderOffsets, showProgramHeaderOffsets, showHardening,
+	showPlatform, showLayout, showSectionSegmentMap bool
+	dumpSection, dumpSegment int
+	addr2line, structLayout  string
+}
+
+// Prints the requested information about a single ELF file. Returns the exit
+// status.
+func showFile(elf elf_reader.ELFFile, name string, opts *viewOptions) int {
+	var e error
+	if opts.dumpSection != -1 {
+		content, e := elf.GetSectionContent(uint16(opts.dumpSection))
 		if e != nil {
 			log.Printf("Failed dumping section contents: %s\n", e)
 			return 1
@@ -367,8 +424,8 @@ func run() int {
 		log.Printf("%s", content)
 		return 0
 	}
-	if dumpSegment != -1 {
-		content, e := elf.GetSegmentContent(uint16(dumpSegment))
+	if opts.dumpSegment != -1 {
+		content, e := elf.GetSegmentContent(uint16(opts.dumpSegment))
 		if e != nil {
 			log.Printf("Failed dumping segment contents: %s\n", e)
 			return 1
@@ -376,9 +433,9 @@ func run() int {
 		log.Printf("%s", content)
 		return 0
 	}
-	log.Printf("Successfully parsed file %s\n", inputFile)
+	log.Printf("Successfully parsed file %s\n", name)
 	log.Printf("It is a %s for %s\n", elf.GetFileType(), elf.GetMachineType())
-	if showSections {
+	if opts.showSections {
 		log.Println("==== Sections ====")
 		e = printSections(elf)
 		if e != nil {
@@ -386,7 +443,7 @@ func run() int {
 			return 1
 		}
 	}
-	if showSegments {
+	if opts.showSegments {
 		log.Println("==== Segments ====")
 		e = printSegments(elf)
 		if e != nil {
@@ -394,7 +451,16 @@ func run() int {
 			return 1
 		}
 	}
-	if showSymbols {
+	if opts.showSectionSegmentMap {
+		log.Println("==== Section to segment mapping ====")
+		e = printSectionSegmentMap(elf)
+		if e != nil {
+			log.Printf("Error printing the section to segment mapping: %s\n",
+				e)
+			return 1
+		}
+	}
+	if opts.showSymbols {
 		log.Println("==== Symbols ====")
 		e = printSymbols(elf)
 		if e != nil {
@@ -402,7 +468,7 @@ func run() int {
 			return 1
 		}
 	}
-	if showStrings {
+	if opts.showStrings {
 		log.Println("==== Strings ====")
 		e = printStrings(elf)
 		if e != nil {
@@ -410,7 +476,7 @@ func run() int {
 			return 1
 		}
 	}
-	if showRelocations {
+	if opts.showRelocations {
 		log.Println("==== Relocations ====")
 		e = printRelocations(elf)
 		if e != nil {
@@ -418,7 +484,7 @@ func run() int {
 			return 1
 		}
 	}
-	if showDynamic {
+	if opts.showDynamic {
 		log.Println("==== Dynamic linking table ====")
 		e = printDynamicLinkingTable(elf)
 		if e != nil {
@@ -426,7 +492,7 @@ func run() int {
 			return 1
 		}
 	}
-	if showSectionHeaderOffsets {
+	if opts.showSectionHeaderOffsets {
 		log.Println("==== Section header offsets ====")
 		e = printSectionHeaderOffsets(elf)
 		if e != nil {
@@ -434,7 +500,7 @@ func run() int {
 			return 1
 		}
 	}
-	if showProgramHeaderOffsets {
+	if opts.showProgramHeaderOffsets {
 		log.Println("==== Program header offsets ====")
 		e = printProgramHeaderOffsets(elf)
 		if e != nil {
@@ -442,13 +508,57 @@ func run() int {
 			return 1
 		}
 	}
+	if opts.showHardening {
+		log.Println("==== Hardening ====")
+		report, e := elf_reader.GetHardeningReport(elf)
+		if e != nil {
+			log.Printf("Error checking hardening features: %s\n", e)
+			return 1
+		}
+		log.Printf("%s", report)
+	}
+	if opts.showPlatform {
+		log.Println("==== Platform requirements ====")
+		requirements, e := elf_reader.GetPlatformRequirements(elf)
+		if e != nil {
+			log.Printf("Error checking platform requirements: %s\n", e)
+			return 1
+		}
+		log.Printf("%s", requirements)
+	}
+	if opts.showLayout {
+		log.Println("==== File layout ====")
+		coverage, e := elf_reader.GetCoverageMap(elf)
+		if e != nil {
+			log.Printf("Error mapping the file layout: %s\n", e)
+			return 1
+		}
+		log.Printf("%s", coverage)
+	}
+	if opts.addr2line != "" {
+		log.Println("==== Source locations ====")
+		e = printAddr2Line(elf, opts.addr2line)
+		if e != nil {
+			log.Printf("Error printing source locations: %s\n", e)
+			return 1
+		}
+	}
+	if opts.structLayout != "" {
+		log.Println("==== Struct layout ====")
+		layout, e := elf_reader.GetStructLayout(elf, opts.structLayout)
+		if e != nil {
+			log.Printf("Error getting the struct layout: %s\n", e)
+			return 1
+		}
+		log.Printf("%s", layout)
+	}
 	// The following functionality is only implemented for 32-bit ELF files for
 	// now.
 	elf32, ok := elf.(*elf_reader.ELF32File)
 	if !ok {
 		return 0
 	}
-	if showRequirements {
+	if opts.showRequirements {
 		log.Println("==== GNU version requirements ====")
 		e = printGNUVersionRequirements(elf32)
 		if e != nil {
@@ -456,7 +566,7 @@ func run() int {
 			return 1
 		}
 	}
-	if showDefinitions {
+	if opts.showDefinitions {
 		log.Println("==== GNU version definitions ====")
 		e = printGNUVersionDefinitions(elf32)
 		if e != nil {
@@ -468,6 +578,159 @@ func run() int {
 	return 0
 }
 
+// Prints any warnings recorded while parsing the file, unless section or
+// segment content is being dumped.
+func printWarnings(elf elf_reader.ELFFile, opts *viewOptions) {
+	// Don't mix warnings into dumped section or segment content.
+	if (opts.dumpSection != -1) || (opts.dumpSegment != -1) {
+		return
+	}
+	for _, w := range elf_reader.GetWarnings(elf) {
+		log.Printf("Warning: %s\n", w)
+	}
+}
+
+// Prints the archive's symbol index if symbols were requested, followed by
+// the requested information about each member. Members are parsed using the
+// given options. Returns the exit status.
+func showArchive(inputFile string, parseOptions *elf_reader.ParseOptions,
+	opts *viewOptions) int {
+	archive, e := elf_reader.ReadArchiveFile(inputFile)
+	if e != nil {
+		log.Printf("Failed parsing the archive: %s\n", e)
+		return 1
+	}
+	log.Printf("Successfully parsed archive %s with %d members\n", inputFile,
+		len(archive.Members))
+	if opts.showSymbols {
+		log.Println("==== Archive symbol index ====")
+		for _, s := range archive.Symbols {
+			member := archive.MemberAt(s.MemberOffset)
+			if member == nil {
+				log.Printf("%s: invalid member offset %d\n", s.Name,
+					s.MemberOffset)
+				continue
+			}
+			log.Printf("%s: %s\n", s.Name, member.Name)
+		}
+	}
+	for i := range archive.Members {
+		member := &(archive.Members[i])
+		log.Printf("==== Archive member %s ====\n", member.Name)
+		elf, e := member.ELFWithOptions(parseOptions)
+		if e != nil {
+			log.Printf("Skipping member: %s\n", e)
+			continue
+		}
+		printWarnings(elf, opts)
+		status := showFile(elf, member.Name, opts)
+		if status != 0 {
+			return status
+		}
+	}
+	return 0
+}
+
+func run() int {
+	var inputFile, diffFile string
+	var lenient bool
+	var opts viewOptions
+	flag.StringVar(&inputFile, "file", "",
+		"The path to the input ELF file or ar archive. This is required.")
+	flag.BoolVar(&opts.showSections, "sections", false,
+		"Print a list of sections in the ELF file if set.")
+	flag.BoolVar(&opts.showSegments, "segments", false,
+		"Print a list of segments (program headers) if set.")
+	flag.BoolVar(&opts.showSectionSegmentMap, "section_segment_map", false,
+		"Prints the names of the sections contained in each segment, in the "+
+			"same manner as readelf -l, if set.")
+	flag.BoolVar(&opts.showSymbols, "symbols", false,
+		"Print a list of symbols if set.")
+	flag.BoolVar(&opts.showStrings, "strings", false,
+		"Prints the contents of the string tables if set.")
+	flag.BoolVar(&opts.showRelocations, "relocations", false,
+		"Prints a list of relocations if set.")
+	flag.BoolVar(&opts.showDynamic, "dynamic", false,
+		"Prints a list of dynamic linking table entries if set.")
+	flag.BoolVar(&opts.showRequirements, "requirements", false,
+		"Prints a list of the GNU version requirements if set.")
+	flag.BoolVar(&opts.showDefinitions, "definitions", false,
+		"Prints a list of GNU version definitions if set.")
+	flag.BoolVar(&opts.showSectionHeaderOffsets, "section_header_offsets",
+		false,
+		"Prints a list of the offsets of the section headers in the file if "+
+			"set.")
+	flag.BoolVar(&opts.showProgramHeaderOffsets, "program_header_offsets",
+		false,
+		"Prints a list of the offsets of the program headers in the file if "+
+			"set.")
+	flag.StringVar(&diffFile, "diff", "",
+		"The path to a second ELF file. If set, the structural differences "+
+			"between the input file and this file are printed, and other "+
+			"output is suppressed.")
+	flag.BoolVar(&opts.showHardening, "hardening", false,
+		"Prints a report of the security hardening features used by the "+
+			"file, with the evidence for each, if set.")
+	flag.BoolVar(&opts.showPlatform, "platform", false,
+		"Prints the minimum platform the file requires, including the "+
+			"newest glibc symbol versions, the kernel version, the CPU "+
+			"features and the interpreter, if set.")
+	flag.BoolVar(&opts.showLayout, "layout", false,
+		"Prints a table attributing each range of bytes in the file to a "+
+			"header, section or segment, including gaps and data appended "+
+			"to the end of the file, if set.")
+	flag.StringVar(&opts.addr2line, "addr2line", "",
+		"A comma-separated list of hexadecimal virtual addresses. If set, "+
+			"prints the source file, line and function for each address, "+
+			"including any functions it was inlined into, using the DWARF "+
+			"debugging information.")
+	flag.StringVar(&opts.structLayout, "struct_layout", "",
+		"The name of a struct, class, union or typedef. If set, prints the "+
+			"offset and size of each of its members, along with any holes, "+
+			"padding and cache line boundaries, using the DWARF debugging "+
+			"information.")
+	flag.BoolVar(&lenient, "lenient", false,
+		"Parses damaged files as far as possible, printing a warning for "+
+			"each problem found, if set.")
+	flag.IntVar(&opts.dumpSection, "dump_section", -1,
+		"If a valid section index is provided, binary contents of the section"+
+			" will be dumped to stdout and other output will be surpressed.")
+	flag.IntVar(&opts.dumpSegment, "dump_segment", -1,
+		"If a valid segment index is provided, binary contents of the segment"+
+			" will be dumped to stdout and other output will be surpressed. "+
+			"Ignored in favor of -dump_section if -dump_section is provided.")
+	flag.Parse()
+	if inputFile == "" {
+		log.Println("Invalid arguments. Run with -help for more information.")
+		return 1
+	}
+	rawInput, e := os.ReadFile(inputFile)
+	if e != nil {
+		log.Printf("Failed reading input file: %s\n", e)
+		return 1
+	}
+	parseOptions := &elf_reader.ParseOptions{
+		Lenient: lenient,
+	}
+	if elf_reader.IsArchive(rawInput) {
+		if diffFile != "" {
+			log.Printf("Archives can't be compared using -diff\n")
+			return 1
+		}
+		return showArchive(inputFile, parseOptions, &opts)
+	}
+	elf, e := elf_reader.ParseELFFileWithOptions(rawInput, parseOptions)
+	if e != nil {
+		log.Printf("Failed parsing the input file: %s\n", e)
+		return 1
+	}
+	printWarnings(elf, &opts)
+	if diffFile != "" {
+		return printDiff(elf, diffFile)
+	}
+	return showFile(elf, inputFile, &opts)
+}
+
 func main() {
 	log.SetFlags(0)
 	log.SetOutput(os.Stdout)
@@ -0,0 +1,374 @@
+package elf_reader
+
+// This file contains functions for converting ELF structures back into their
+// binary representation. Code that rewrites ELF files works with the 64-bit
+// versions of each structure, and these functions take care of converting
+// them into the 32-bit layout when the file being written is a 32-bit ELF.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Returns true if the given ELF file is a 64-bit ELF.
+func is64Bit(f ELFFile) bool {
+	_, ok := f.(*ELF64File)
+	return ok
+}
+
+// Returns the byte order used by the given ELF file.
+func fileEndianness(f ELFFile) binary.ByteOrder {
+	switch v := f.(type) {
+	case *ELF64File:
+		return v.Endianness
+	case *ELF32File:
+		return v.Endianness
+	}
+	return binary.LittleEndian
+}
+
+// Returns the raw bytes of the given ELF file.
+func fileRaw(f ELFFile) []byte {
+	switch v := f.(type) {
+	case *ELF64File:
+		return v.Raw
+	case *ELF32File:
+		return v.Raw
+	}
+	return nil
+}
+
+// Holds the fields from an ELF header that describe where the header tables
+// are, in a format that doesn't depend on the ELF class.
+type fileLayout struct {
+	HeaderSize             uint16
+	ProgramHeaderOffset    uint64
+	ProgramHeaderEntrySize uint16
+	SectionHeaderOffset    uint64
+	SectionHeaderEntrySize uint16
+	SectionNamesTable      uint16
+}
+
+// Returns the table locations from the given file's ELF header.
+func getFileLayout(f ELFFile) fileLayout {
+	switch v := f.(type) {
+	case *ELF64File:
+		return fileLayout{
+			HeaderSize:             v.Header.HeaderSize,
+			ProgramHeaderOffset:    v.Header.ProgramHeaderOffset,
+			ProgramHeaderEntrySize: v.Header.ProgramHeaderEntrySize,
+			SectionHeaderOffset:    v.Header.SectionHeaderOffset,
+			SectionHeaderEntrySize: v.Header.SectionHeaderEntrySize,
+			SectionNamesTable:      v.Header.SectionNamesTable,
+		}
+	case *ELF32File:
+		return fileLayout{
+			HeaderSize:             v.Header.HeaderSize,
+			ProgramHeaderOffset:    uint64(v.Header.ProgramHeaderOffset),
+			ProgramHeaderEntrySize: v.Header.ProgramHeaderEntrySize,
+			SectionHeaderOffset:    uint64(v.Header.SectionHeaderOffset),
+			SectionHeaderEntrySize: v.Header.SectionHeaderEntrySize,
+			SectionNamesTable:      v.Header.SectionNamesTable,
+		}
+	}
+	return fileLayout{}
+}
+
+// Returns the binary representation of the given fixed-size value, or
+// structure composed of fixed-size values.
+func encodeBinary(order binary.ByteOrder, value interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	e := binary.Write(&b, order, value)
+	if e != nil {
+		return nil, e
+	}
+	return b.Bytes(), nil
+}
+
+// Returns the header for every section in the file, converted to the 64-bit
+// format if necessary.
+func sectionHeaders64(f ELFFile) []ELF64SectionHeader {
+	switch v := f.(type) {
+	case *ELF64File:
+		toReturn := make([]ELF64SectionHeader, len(v.Sections))
+		copy(toReturn, v.Sections)
+		return toReturn
+	case *ELF32File:
+		toReturn := make([]ELF64SectionHeader, len(v.Sections))
+		for i, h := range v.Sections {
+			toReturn[i] = ELF64SectionHeader{
+				Name:           h.Name,
+				Type:           h.Type,
+				Flags:          SectionHeaderFlags64(h.Flags),
+				VirtualAddress: uint64(h.VirtualAddress),
+				FileOffset:     uint64(h.FileOffset),
+				Size:           uint64(h.Size),
+				LinkedIndex:    h.LinkedIndex,
+				Info:           h.Info,
+				Align:          uint64(h.Align),
+				EntrySize:      uint64(h.EntrySize),
+			}
+		}
+		return toReturn
+	}
+	return nil
+}
+
+// Returns the header for every segment in the file, converted to the 64-bit
+// format if necessary.
+func programHeaders64(f ELFFile) []ELF64ProgramHeader {
+	switch v := f.(type) {
+	case *ELF64File:
+		toReturn := make([]ELF64ProgramHeader, len(v.Segments))
+		copy(toReturn, v.Segments)
+		return toReturn
+	case *ELF32File:
+		toReturn := make([]ELF64ProgramHeader, len(v.Segments))
+		for i, h := range v.Segments {
+			toReturn[i] = ELF64ProgramHeader{
+				Type:            h.Type,
+				Flags:           h.Flags,
+				FileOffset:      uint64(h.FileOffset),
+				VirtualAddress:  uint64(h.VirtualAddress),
+				PhysicalAddress: uint64(h.PhysicalAddress),
+				FileSize:        uint64(h.FileSize),
+				MemorySize:      uint64(h.MemorySize),
+				Align:           uint64(h.Align),
+			}
+		}
+		return toReturn
+	}
+	return nil
+}
+
+// Converts a 64-bit section header into the 32-bit format. Returns an error if
+// any field doesn't fit.
+func sectionHeaderTo32(h *ELF64SectionHeader) (ELF32SectionHeader, error) {
+	if (h.Flags > 0xffffffff) || (h.VirtualAddress > 0xffffffff) ||
+		(h.FileOffset > 0xffffffff) || (h.Size > 0xffffffff) ||
+		(h.Align > 0xffffffff) || (h.EntrySize > 0xffffffff) {
+		return ELF32SectionHeader{}, fmt.Errorf("Section header field too "+
+			"large for a 32-bit ELF: %s", h)
+	}
+	return ELF32SectionHeader{
+		Name:           h.Name,
+		Type:           h.Type,
+		Flags:          SectionHeaderFlags32(h.Flags),
+		VirtualAddress: uint32(h.VirtualAddress),
+		FileOffset:     uint32(h.FileOffset),
+		Size:           uint32(h.Size),
+		LinkedIndex:    h.LinkedIndex,
+		Info:           h.Info,
+		Align:          uint32(h.Align),
+		EntrySize:      uint32(h.EntrySize),
+	}, nil
+}
+
+// Converts a 64-bit program header into the 32-bit format. Returns an error
+// if any field doesn't fit.
+func programHeaderTo32(h *ELF64ProgramHeader) (ELF32ProgramHeader, error) {
+	if (h.FileOffset > 0xffffffff) || (h.VirtualAddress > 0xffffffff) ||
+		(h.PhysicalAddress > 0xffffffff) || (h.FileSize > 0xffffffff) ||
+		(h.MemorySize > 0xffffffff) || (h.Align > 0xffffffff) {
+		return ELF32ProgramHeader{}, fmt.Errorf("Program header field too "+
+			"large for a 32-bit ELF: %s", h)
+	}
+	return ELF32ProgramHeader{
+		Type:            h.Type,
+		FileOffset:      uint32(h.FileOffset),
+		VirtualAddress:  uint32(h.VirtualAddress),
+		PhysicalAddress: uint32(h.PhysicalAddress),
+		FileSize:        uint32(h.FileSize),
+		MemorySize:      uint32(h.MemorySize),
+		Flags:           h.Flags,
+		Align:           uint32(h.Align),
+	}, nil
+}
+
+// Returns the binary content of a section header table containing the given
+// headers.
+func encodeSectionHeaders(is64 bool, order binary.ByteOrder,
+	headers []ELF64SectionHeader) ([]byte, error) {
+	if is64 {
+		return encodeBinary(order, headers)
+	}
+	headers32 := make([]ELF32SectionHeader, len(headers))
+	var e error
+	for i := range headers {
+		headers32[i], e = sectionHeaderTo32(&(headers[i]))
+		if e != nil {
+			return nil, fmt.Errorf("Bad header for section %d: %w", i, e)
+		}
+	}
+	return encodeBinary(order, headers32)
+}
+
+// Returns the binary content of a program header table containing the given
+// headers.
+func encodeProgramHeaders(is64 bool, order binary.ByteOrder,
+	headers []ELF64ProgramHeader) ([]byte, error) {
+	if is64 {
+		return encodeBinary(order, headers)
+	}
+	headers32 := make([]ELF32ProgramHeader, len(headers))
+	var e error
+	for i := range headers {
+		headers32[i], e = programHeaderTo32(&(headers[i]))
+		if e != nil {
+			return nil, fmt.Errorf("Bad header for segment %d: %w", i, e)
+		}
+	}
+	return encodeBinary(order, headers32)
+}
+
+// Converts any ELFSymbol into the 64-bit symbol structure.
+func toELF64Symbol(s ELFSymbol) ELF64Symbol {
+	return ELF64Symbol{
+		Name:         s.GetName(),
+		Info:         s.GetInfo(),
+		Other:        s.GetOther(),
+		SectionIndex: s.GetSectionIndex(),
+		Value:        s.GetValue(),
+		Size:         s.GetSize(),
+	}
+}
+
+// Returns the binary content of a symbol table containing the given symbols.
+func encodeSymbols(is64 bool, order binary.ByteOrder,
+	symbols []ELF64Symbol) ([]byte, error) {
+	if is64 {
+		return encodeBinary(order, symbols)
+	}
+	symbols32 := make([]ELF32Symbol, len(symbols))
+	for i, s := range symbols {
+		if (s.Value > 0xffffffff) || (s.Size > 0xffffffff) {
+			return nil, fmt.Errorf("Symbol %d doesn't fit in a 32-bit ELF", i)
+		}
+		symbols32[i] = ELF32Symbol{
+			Name:         s.Name,
+			Value:        uint32(s.Value),
+			Size:         uint32(s.Size),
+			Info:         s.Info,
+			Other:        s.Other,
+			SectionIndex: s.SectionIndex,
+		}
+	}
+	return encodeBinary(order, symbols32)
+}
+
+// Returns the binary content of a relocation table containing the given
+// relocations. If withAddends is false, the table will be encoded as a REL
+// table, ignoring the addend field. Otherwise it will be encoded as a RELA
+// table.
+func encodeRelocations(is64 bool, order binary.ByteOrder, withAddends bool,
+	relocations []ELFRelocation) ([]byte, error) {
+	if is64 {
+		if withAddends {
+			values := make([]ELF64Rela, len(relocations))
+			for i, r := range relocations {
+				values[i].Address = r.Offset()
+				values[i].RelocationInfo = ELF64RelocationInfo(r.Type()) |
+					(ELF64RelocationInfo(r.SymbolIndex()) << 32)
+				values[i].AddendValue = r.Addend()
+			}
+			return encodeBinary(order, values)
+		}
+		values := make([]ELF64Rel, len(relocations))
+		for i, r := range relocations {
+			values[i].Address = r.Offset()
+			values[i].RelocationInfo = ELF64RelocationInfo(r.Type()) |
+				(ELF64RelocationInfo(r.SymbolIndex()) << 32)
+		}
+		return encodeBinary(order, values)
+	}
+	var info ELF32RelocationInfo
+	for i, r := range relocations {
+		if (r.Offset() > 0xffffffff) || (r.Type() > 0xff) ||
+			(r.SymbolIndex() > 0xffffff) {
+			return nil, fmt.Errorf("Relocation %d doesn't fit in a 32-bit "+
+				"ELF", i)
+		}
+	}
+	if withAddends {
+		values := make([]ELF32Rela, len(relocations))
+		for i, r := range relocations {
+			info = ELF32RelocationInfo(r.Type()) |
+				(ELF32RelocationInfo(r.SymbolIndex()) << 8)
+			values[i].Address = uint32(r.Offset())
+			values[i].RelocationInfo = info
+			values[i].AddendValue = int32(r.Addend())
+		}
+		return encodeBinary(order, values)
+	}
+	values := make([]ELF32Rel, len(relocations))
+	for i, r := range relocations {
+		info = ELF32RelocationInfo(r.Type()) |
+			(ELF32RelocationInfo(r.SymbolIndex()) << 8)
+		values[i].Address = uint32(r.Offset())
+		values[i].RelocationInfo = info
+	}
+	return encodeBinary(order, values)
+}
+
+// Returns a copy of the ELF header from the given file, in its binary form,
+// after setting the section and program header table locations to the given
+// values. The section header entry size is also set if there are sections, in
+// case the original file had none.
+func encodeFileHeader(f ELFFile, programHeaderOffset,
+	sectionHeaderOffset uint64, sectionCount,
+	sectionNamesTable uint16) ([]byte, error) {
+	var order binary.ByteOrder
+	var toEncode interface{}
+	switch v := f.(type) {
+	case *ELF64File:
+		header := v.Header
+		header.ProgramHeaderOffset = programHeaderOffset
+		header.SectionHeaderOffset = sectionHeaderOffset
+		header.SectionHeaderEntries = sectionCount
+		header.SectionNamesTable = sectionNamesTable
+		if sectionCount != 0 {
+			header.SectionHeaderEntrySize = 64
+		}
+		order = v.Endianness
+		toEncode = &header
+	case *ELF32File:
+		if (programHeaderOffset > 0xffffffff) ||
+			(sectionHeaderOffset > 0xffffffff) {
+			return nil, fmt.Errorf("Header table offsets too large for a " +
+				"32-bit ELF")
+		}
+		header := v.Header
+		header.ProgramHeaderOffset = uint32(programHeaderOffset)
+		header.SectionHeaderOffset = uint32(sectionHeaderOffset)
+		header.SectionHeaderEntries = sectionCount
+		header.SectionNamesTable = sectionNamesTable
+		if sectionCount != 0 {
+			header.SectionHeaderEntrySize = 40
+		}
+		order = v.Endianness
+		toEncode = &header
+	default:
+		return nil, fmt.Errorf("Unsupported ELF file type: %T", f)
+	}
+	toReturn, e := encodeBinary(order, toEncode)
+	if e != nil {
+		return nil, e
+	}
+	// The signature is always kept in the little-endian byte order.
+	binary.LittleEndian.PutUint32(toReturn, 0x464c457f)
+	return toReturn, nil
+}
+
+// Appends the given content to the data, after padding the data to the given
+// alignment. Returns the new data and the offset at which the content was
+// written.
+func appendAligned(data, content []byte, align uint64) ([]byte, uint64) {
+	offset := uint64(len(data))
+	if (align > 1) && ((offset % align) != 0) {
+		padding := align - (offset % align)
+		data = append(data, make([]byte, padding)...)
+		offset += padding
+	}
+	return append(data, content...), offset
+}
@@ -0,0 +1,97 @@
+package elf_reader
+
+// This file contains the error values returned by the parsing functions, which
+// can be inspected using errors.Is and errors.As.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Returned, possibly wrapped, when data doesn't start with the ELF magic.
+var ErrBadMagic = errors.New("Invalid ELF signature")
+
+// Returned, possibly wrapped, when a structure or string extends past the end
+// of the file or section containing it.
+var ErrTruncated = errors.New("Truncated data")
+
+// Returned, possibly wrapped, when a table is larger than a limit set in the
+// ParseOptions.
+var ErrLimitExceeded = errors.New("Resource limit exceeded")
+
+// Returned when an index, such as a section or segment index, is out of
+// range.
+type InvalidIndexError struct {
+	// The kind of thing the index refers to, e.g. "section" or "segment".
+	Kind  string
+	Index uint64
+}
+
+func (e *InvalidIndexError) Error() string {
+	return fmt.Sprintf("Invalid %s index: %d", e.Kind, e.Index)
+}
+
+// Returned when a header, table or other structure in a file can't be parsed.
+// The underlying cause, which is often ErrTruncated, can be retrieved using
+// errors.Is, errors.As or Unwrap.
+type MalformedTableError struct {
+	// The kind of structure that couldn't be parsed, e.g. "symbol table".
+	Structure string
+	// The index of the section containing the structure, or -1 if it isn't
+	// in a section, e.g. for the ELF header and header tables.
+	SectionIndex int
+	// The offset in the file of the structure, or of the entry within it
+	// that couldn't be parsed.
+	Offset uint64
+	// The underlying cause.
+	Err error
+}
+
+func (e *MalformedTableError) Error() string {
+	if e.SectionIndex < 0 {
+		return fmt.Sprintf("Malformed %s at offset 0x%x: %s", e.Structure,
+			e.Offset, e.Err)
+	}
+	return fmt.Sprintf("Malformed %s in section %d at offset 0x%x: %s",
+		e.Structure, e.SectionIndex, e.Offset, e.Err)
+}
+
+func (e *MalformedTableError) Unwrap() error {
+	return e.Err
+}
+
+// Returns a MalformedTableError for a structure that isn't in a section.
+func headerError(structure string, offset uint64, cause error) error {
+	return &MalformedTableError{
+		Structure:    structure,
+		SectionIndex: -1,
+		Offset:       offset,
+		Err:          cause,
+	}
+}
+
+// Returns a MalformedTableError for a structure at the given offset within the
+// content of the section at the given index.
+func sectionError(f ELFFile, sectionIndex uint16, structure string,
+	offset uint64, cause error) error {
+	header, e := f.GetSectionHeader(sectionIndex)
+	if e == nil {
+		offset += header.GetFileOffset()
+	}
+	return &MalformedTableError{
+		Structure:    structure,
+		SectionIndex: int(sectionIndex),
+		Offset:       offset,
+		Err:          cause,
+	}
+}
+
+// Converts the io.EOF or io.ErrUnexpectedEOF returned by binary.Read for short
+// data into ErrTruncated. Other errors are returned unchanged.
+func readError(e error) error {
+	if (e == io.EOF) || (e == io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+	return e
+}
@@ -0,0 +1,83 @@
+package elf_reader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorTypes(t *testing.T) {
+	_, e := ParseELFFile([]byte("Not an ELF file"))
+	if !errors.Is(e, ErrBadMagic) {
+		t.Errorf("Expected ErrBadMagic for a non-ELF file, got %v\n", e)
+	}
+	_, e = ParseELFFile([]byte("ab"))
+	if !errors.Is(e, ErrBadMagic) {
+		t.Errorf("Expected ErrBadMagic for a short non-ELF file, got %v\n", e)
+	}
+	_, e = ParseELFFile([]byte("\x7fEL"))
+	if !errors.Is(e, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated for a short ELF file, got %v\n", e)
+	}
+	raw := fileBytes("test_data/sleep_amd64", t)
+	_, e = ParseELFFile(raw[:40])
+	if !errors.Is(e, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated for a truncated header, got %v\n", e)
+	}
+	var malformed *MalformedTableError
+	_, e = ParseELFFile(raw[:1000])
+	if !errors.As(e, &malformed) || !errors.Is(e, ErrTruncated) {
+		t.Errorf("Expected a truncated MalformedTableError, got %v\n", e)
+	} else {
+		t.Logf("Got expected error: %s\n", e)
+		if (malformed.Structure != "section header table") ||
+			(malformed.SectionIndex != -1) {
+			t.Errorf("Incorrect error fields: %+v\n", malformed)
+		}
+	}
+
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	var invalidIndex *InvalidIndexError
+	_, e = f.GetSectionContent(1000)
+	if !errors.As(e, &invalidIndex) {
+		t.Errorf("Expected an InvalidIndexError, got %v\n", e)
+	} else if (invalidIndex.Kind != "section") ||
+		(invalidIndex.Index != 1000) {
+		t.Errorf("Incorrect error fields: %+v\n", invalidIndex)
+	}
+	_, e = f.GetSegmentContent(1000)
+	if !errors.As(e, &invalidIndex) || (invalidIndex.Kind != "segment") {
+		t.Errorf("Expected an InvalidIndexError for a segment, got %v\n", e)
+	}
+
+	// Point a symbol's name past the end of the string table. The error
+	// should refer to the string table, at the bad name's offset.
+	index := testSectionIndex(f, ".dynsym", t)
+	header := &(f.Sections[index])
+	symbolOffset := header.FileOffset + 24
+	f.Endianness.PutUint32(f.Raw[symbolOffset:], 0xffffff)
+	_, _, e = f.GetSymbols(index)
+	if !errors.As(e, &malformed) || !errors.Is(e, ErrTruncated) {
+		t.Errorf("Expected a truncated MalformedTableError, got %v\n", e)
+	} else {
+		t.Logf("Got expected error: %s\n", e)
+		stringTable := &(f.Sections[header.LinkedIndex])
+		if (malformed.SectionIndex != int(header.LinkedIndex)) ||
+			(malformed.Offset != (stringTable.FileOffset + 0xffffff)) {
+			t.Errorf("Incorrect error fields: %+v\n", malformed)
+		}
+	}
+
+	// Version requirements with an aux offset outside of the section.
+	f = parseTestELF64("test_data/sleep_amd64", t)
+	index = testSectionIndex(f, ".gnu.version_r", t)
+	f.Endianness.PutUint32(f.Raw[f.Sections[index].FileOffset+8:], 0xffff)
+	_, e = GetVersionRequirements(f)
+	if !errors.As(e, &malformed) || !errors.Is(e, ErrTruncated) {
+		t.Errorf("Expected a truncated MalformedTableError, got %v\n", e)
+	} else {
+		t.Logf("Got expected error: %s\n", e)
+		if malformed.SectionIndex != int(index) {
+			t.Errorf("Incorrect error section: %d\n", malformed.SectionIndex)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package elf_reader
+
+import (
+	"os"
+	"testing"
+)
+
+// Adds the contents of the given files in test_data to the fuzzer's corpus.
+func addFuzzFiles(f *testing.F, names ...string) {
+	for _, name := range names {
+		content, e := os.ReadFile("test_data/" + name)
+		if e != nil {
+			f.Fatalf("Failed reading fuzz seed: %s\n", e)
+		}
+		f.Add(content)
+	}
+}
+
+// Calls every parsing function on the file, ignoring errors. Used by the fuzz
+// targets to check that nothing panics or hangs.
+func exerciseELFFile(f ELFFile) {
+	for i := uint16(0); i < f.GetSectionCount(); i++ {
+		f.GetSectionName(i)
+		f.GetSectionContent(i)
+		f.GetStringTable(i)
+		f.GetSymbols(i)
+		f.GetRelocations(i)
+		f.DynamicEntries(i)
+		getNotes(f, i)
+		GetSectionSegments(f, i)
+		if f32, ok := f.(*ELF32File); ok {
+			f32.ParseVersionRequirementSection(i)
+			f32.ParseVersionDefinitionSection(i)
+		}
+	}
+	for i := uint16(0); i < f.GetSegmentCount(); i++ {
+		f.GetSegmentContent(i)
+		GetSegmentSections(f, i)
+	}
+	if t, _ := GetDynamicTable(f); t != nil {
+		t.Strings(1)
+	}
+	GetVersionNames(f)
+	GetSymbolVersionIndices(f)
+	GetBuildID(f)
+	GetDebugLink(f)
+	GetDebugAltLink(f)
+	if l, e := NewSymbolLookup(f); e == nil {
+		l.ForAddress(entryPoint(f))
+	}
+	GetGNUProperties(f)
+	GetHardeningReport(f)
+	GetPlatformRequirements(f)
+	NewABISnapshot(f)
+	NewELFDocument(f)
+	if m, e := GetCoverageMap(f); e == nil {
+		_ = m.String()
+	}
+	_ = ValidateELFFile(f).String()
+	serializeTestFile(f)
+	ReconstructSections(f)
+	if r, e := NewLineResolver(f); e == nil {
+		r.LineFor(entryPoint(f))
+	}
+	if layouts, _ := GetStructLayouts(f); len(layouts) != 0 {
+		_ = layouts[0].String()
+	}
+}
+
+func FuzzParseELFFile(f *testing.F) {
+	addFuzzFiles(f, "sleep_amd64", "sleep_arm32", "bash32_freebsd",
+		"hello_debug_amd64.o", "ld-linux_arm32.so", "libbind_a_amd64.so",
+		"hello_minidebug_amd64")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		elf, e := ParseELFFile(data)
+		if e == nil {
+			exerciseELFFile(elf)
+		}
+		elf, e = ParseELFFileWithOptions(data, &ParseOptions{
+			Lenient: true,
+		})
+		if e == nil {
+			exerciseELFFile(elf)
+		}
+	})
+}
+
+func FuzzReconstructSections(f *testing.F) {
+	// Section headers are only reconstructed for files without them, so the
+	// corpus contains files with their section headers removed.
+	for _, name := range []string{"sleep_amd64", "sleep_arm32"} {
+		content, e := os.ReadFile("test_data/" + name)
+		if e != nil {
+			f.Fatalf("Failed reading fuzz seed: %s\n", e)
+		}
+		f.Add(removeSectionHeaders(content, content[4] == 2))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		elf, e := ParseELFFileWithOptions(data, &ParseOptions{
+			Lenient: true,
+		})
+		if e != nil {
+			return
+		}
+		repaired, e := ReconstructSections(elf)
+		if e != nil {
+			return
+		}
+		elf, e = ParseELFFile(repaired)
+		if e == nil {
+			exerciseELFFile(elf)
+		}
+	})
+}
+
+func FuzzReadStringAtOffset(f *testing.F) {
+	f.Add(uint32(1), []byte("\x00Hi there!\x00"))
+	f.Add(uint32(3), []byte("\x00Hi"))
+	f.Fuzz(func(t *testing.T, offset uint32, data []byte) {
+		s, e := ReadStringAtOffset(offset, data)
+		if e != nil {
+			return
+		}
+		if (len(s) + int(offset)) >= len(data) {
+			t.Fatalf("String at offset %d overruns %d bytes\n", offset,
+				len(data))
+		}
+	})
+}
+
+// Returns the given test file, modified so that the named section's content
+// is replaced with the given content. Returns nil if the file can't be
+// modified.
+func replaceSectionContent(raw []byte, name string,
+	content []byte) ELFFile {
+	raw = append(append([]byte{}, raw...), content...)
+	f, e := ParseELFFile(raw)
+	if e != nil {
+		return nil
+	}
+	index, e := FindSectionByName(f, name)
+	if e != nil {
+		return nil
+	}
+	offset := len(raw) - len(content)
+	switch v := f.(type) {
+	case *ELF64File:
+		v.Sections[index].FileOffset = uint64(offset)
+		v.Sections[index].Size = uint64(len(content))
+	case *ELF32File:
+		v.Sections[index].FileOffset = uint32(offset)
+		v.Sections[index].Size = uint32(len(content))
+	}
+	return f
+}
+
+// Runs a fuzz target replacing the content of the named section in either a
+// 32- or 64-bit file. The initial corpus contains the original section
+// content from both files.
+func fuzzSection(f *testing.F, file32, name32, file64, name64 string,
+	parse func(f ELFFile, index uint16)) {
+	files := []string{file32, file64}
+	names := []string{name32, name64}
+	raw := make([][]byte, 2)
+	for i := range files {
+		content, e := os.ReadFile("test_data/" + files[i])
+		if e != nil {
+			f.Fatalf("Failed reading %s: %s\n", files[i], e)
+		}
+		raw[i] = content
+		elf, e := ParseELFFile(content)
+		if e != nil {
+			f.Fatalf("Failed parsing %s: %s\n", files[i], e)
+		}
+		index, e := FindSectionByName(elf, names[i])
+		if e != nil {
+			f.Fatalf("%s\n", e)
+		}
+		content, e = elf.GetSectionContent(index)
+		if e != nil {
+			f.Fatalf("Failed reading %s: %s\n", names[i], e)
+		}
+		f.Add(i == 1, content)
+	}
+	f.Fuzz(func(t *testing.T, is64 bool, content []byte) {
+		i := 0
+		if is64 {
+			i = 1
+		}
+		elf := replaceSectionContent(raw[i], names[i], content)
+		if elf == nil {
+			t.Fatalf("Failed replacing %s content\n", names[i])
+		}
+		index, _ := FindSectionByName(elf, names[i])
+		parse(elf, index)
+	})
+}
+
+func FuzzSymbolTable(f *testing.F) {
+	fuzzSection(f, "sleep_arm32", ".dynsym", "sleep_amd64", ".dynsym",
+		func(f ELFFile, index uint16) {
+			f.GetSymbols(index)
+			NewABISnapshot(f)
+			ValidateELFFile(f)
+		})
+}
+
+func FuzzRelocationTable(f *testing.F) {
+	fuzzSection(f, "sleep_arm32", ".rel.dyn", "sleep_amd64", ".rela.dyn",
+		func(f ELFFile, index uint16) {
+			f.GetRelocations(index)
+		})
+}
+
+func FuzzDynamicTable(f *testing.F) {
+	fuzzSection(f, "sleep_arm32", ".dynamic", "sleep_amd64", ".dynamic",
+		func(f ELFFile, index uint16) {
+			f.DynamicEntries(index)
+			if t, _ := GetDynamicTable(f); t != nil {
+				t.Strings(1)
+			}
+			GetHardeningReport(f)
+			exerciseELFFile(f)
+		})
+}
+
+func FuzzVersionRequirements(f *testing.F) {
+	fuzzSection(f, "sleep_arm32", ".gnu.version_r", "sleep_amd64",
+		".gnu.version_r", func(f ELFFile, index uint16) {
+			GetVersionRequirements(f)
+			if f32, ok := f.(*ELF32File); ok {
+				f32.ParseVersionRequirementSection(index)
+			}
+		})
+}
+
+func FuzzVersionDefinitions(f *testing.F) {
+	fuzzSection(f, "ld-linux_arm32.so", ".gnu.version_d",
+		"libbind_a_amd64.so", ".gnu.version_d", func(f ELFFile, index uint16) {
+			GetVersionDefinitions(f)
+			if f32, ok := f.(*ELF32File); ok {
+				f32.ParseVersionDefinitionSection(index)
+			}
+		})
+}
+
+func FuzzNoteSection(f *testing.F) {
+	fuzzSection(f, "sleep_arm32", ".note.gnu.build-id", "sleep_amd64",
+		".note.gnu.build-id", func(f ELFFile, index uint16) {
+			getNotes(f, index)
+			GetBuildID(f)
+			GetGNUProperties(f)
+		})
+}
@@ -1,3 +1,3 @@
 module github.com/yalue/elf_reader
 
-go 1.15
+go 1.18
@@ -0,0 +1,510 @@
+package elf_reader
+
+// This file contains code for reporting which security hardening features an
+// ELF executable or shared library was built with, similar to the checksec
+// tool.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The result of checking a single hardening feature.
+type HardeningStatus uint8
+
+const (
+	// The feature is fully enabled, or the weakness is absent.
+	HardeningPass HardeningStatus = iota
+	// The feature is only partially enabled.
+	HardeningPartial
+	// The feature is disabled, or the weakness is present.
+	HardeningFail
+	// The feature doesn't apply to this kind of file or architecture.
+	HardeningNotApplicable
+)
+
+func (s HardeningStatus) String() string {
+	switch s {
+	case HardeningPass:
+		return "pass"
+	case HardeningPartial:
+		return "partial"
+	case HardeningFail:
+		return "fail"
+	case HardeningNotApplicable:
+		return "n/a"
+	}
+	return fmt.Sprintf("unknown hardening status %d", uint8(s))
+}
+
+// The result of checking for a single hardening feature, along with the
+// evidence used to reach it.
+type HardeningFinding struct {
+	// A short name for the feature, e.g. "RELRO" or "NX".
+	Feature string
+	Status  HardeningStatus
+	// A short description of the result, e.g. "Full RELRO".
+	Summary string
+	// The facts about the file that led to this result, e.g. "PT_GNU_RELRO
+	// segment at offset 0x2db8".
+	Evidence []string
+}
+
+func (f *HardeningFinding) String() string {
+	return fmt.Sprintf("%s: %s (%s)", f.Feature, f.Summary, f.Status)
+}
+
+// Holds the results of checking an ELF file for hardening features.
+type HardeningReport struct {
+	Findings []HardeningFinding
+}
+
+// Returns the finding for the feature with the given name, or nil if the
+// report doesn't contain it.
+func (r *HardeningReport) Finding(feature string) *HardeningFinding {
+	for i := range r.Findings {
+		if r.Findings[i].Feature == feature {
+			return &(r.Findings[i])
+		}
+	}
+	return nil
+}
+
+func (r *HardeningReport) String() string {
+	var b strings.Builder
+	for i := range r.Findings {
+		finding := &(r.Findings[i])
+		fmt.Fprintf(&b, "%-16s %-8s %s\n", finding.Feature+":",
+			finding.Status, finding.Summary)
+		for _, evidence := range finding.Evidence {
+			fmt.Fprintf(&b, "    - %s\n", evidence)
+		}
+	}
+	return b.String()
+}
+
+// The names of every feature that may be reported in a HardeningReport. The
+// control-flow protection features are only reported for the architectures
+// that support them.
+var hardeningFeatures = map[string]bool{
+	"RELRO":          true,
+	"NX":             true,
+	"PIE":            true,
+	"Stack canary":   true,
+	"FORTIFY_SOURCE": true,
+	"TEXTREL":        true,
+	"RPATH/RUNPATH":  true,
+	"CET IBT":        true,
+	"CET SHSTK":      true,
+	"BTI":            true,
+	"PAC":            true,
+}
+
+// Holds the information needed by the individual hardening checks.
+type hardeningState struct {
+	f        ELFFile
+	dynamic  *DynamicTable
+	segments []ELF64ProgramHeader
+	// Maps the names of the symbols imported from other objects, i.e. the
+	// undefined symbols in the dynamic symbol table, to the name of the
+	// table containing them. For files without a dynamic symbol table, this
+	// contains every symbol in the regular symbol table instead.
+	symbols map[string]string
+	// Set if the file contains any symbol table used to fill in symbols.
+	hasSymbols bool
+}
+
+// Returns a description of the segment for use as evidence.
+func segmentEvidence(name string, p *ELF64ProgramHeader) string {
+	return fmt.Sprintf("%s segment at offset 0x%x (%s)", name, p.FileOffset,
+		p.Flags)
+}
+
+// Returns the first segment of the given type, or nil if there isn't one.
+func (s *hardeningState) findSegment(
+	t ProgramHeaderType) *ELF64ProgramHeader {
+	for i := range s.segments {
+		if s.segments[i].Type == t {
+			return &(s.segments[i])
+		}
+	}
+	return nil
+}
+
+// Returns evidence of immediate binding in the dynamic table, if any.
+func (s *hardeningState) bindNowEvidence() []string {
+	if s.dynamic == nil {
+		return nil
+	}
+	var toReturn []string
+	if s.dynamic.HasTag(DynamicTagBindNow) {
+		toReturn = append(toReturn, "DT_BIND_NOW dynamic entry")
+	}
+	if (s.dynamic.Flags(DynamicTagFlags) & DynamicFlagBindNow) != 0 {
+		toReturn = append(toReturn, "DF_BIND_NOW set in DT_FLAGS")
+	}
+	if (s.dynamic.Flags(DynamicTagFlags1) & DynamicFlag1Now) != 0 {
+		toReturn = append(toReturn, "DF_1_NOW set in DT_FLAGS_1")
+	}
+	return toReturn
+}
+
+func (s *hardeningState) checkRELRO() HardeningFinding {
+	toReturn := HardeningFinding{Feature: "RELRO"}
+	relro := s.findSegment(GNURelroSegment)
+	if relro == nil {
+		toReturn.Status = HardeningFail
+		toReturn.Summary = "No RELRO"
+		toReturn.Evidence = []string{"no PT_GNU_RELRO segment"}
+		return toReturn
+	}
+	toReturn.Evidence = []string{segmentEvidence("PT_GNU_RELRO", relro)}
+	bindNow := s.bindNowEvidence()
+	if len(bindNow) == 0 {
+		toReturn.Status = HardeningPartial
+		toReturn.Summary = "Partial RELRO"
+		toReturn.Evidence = append(toReturn.Evidence,
+			"no BIND_NOW, DF_BIND_NOW or DF_1_NOW dynamic flags")
+		return toReturn
+	}
+	toReturn.Status = HardeningPass
+	toReturn.Summary = "Full RELRO"
+	toReturn.Evidence = append(toReturn.Evidence, bindNow...)
+	return toReturn
+}
+
+func (s *hardeningState) checkNX() HardeningFinding {
+	toReturn := HardeningFinding{Feature: "NX"}
+	stack := s.findSegment(GNUStackSegment)
+	if stack == nil {
+		toReturn.Status = HardeningFail
+		toReturn.Summary = "Stack may be executable"
+		toReturn.Evidence = []string{"no PT_GNU_STACK segment, so the " +
+			"default stack permissions apply"}
+		return toReturn
+	}
+	toReturn.Evidence = []string{segmentEvidence("PT_GNU_STACK", stack)}
+	if (stack.Flags & 1) != 0 {
+		toReturn.Status = HardeningFail
+		toReturn.Summary = "Executable stack"
+		return toReturn
+	}
+	toReturn.Status = HardeningPass
+	toReturn.Summary = "Non-executable stack"
+	return toReturn
+}
+
+func (s *hardeningState) checkPIE() HardeningFinding {
+	toReturn := HardeningFinding{Feature: "PIE"}
+	fileType := s.f.GetFileType()
+	switch fileType {
+	case ELFTypeExecutable:
+		toReturn.Status = HardeningFail
+		toReturn.Summary = "Not position-independent"
+		toReturn.Evidence = []string{"file type is ET_EXEC"}
+		return toReturn
+	case ELFTypeShared:
+	default:
+		toReturn.Status = HardeningNotApplicable
+		toReturn.Summary = fmt.Sprintf("Not an executable (%s)", fileType)
+		return toReturn
+	}
+	toReturn.Evidence = []string{"file type is ET_DYN"}
+	if (s.dynamic != nil) &&
+		((s.dynamic.Flags(DynamicTagFlags1) & DynamicFlag1PIE) != 0) {
+		toReturn.Status = HardeningPass
+		toReturn.Summary = "Position-independent executable"
+		toReturn.Evidence = append(toReturn.Evidence,
+			"DF_1_PIE set in DT_FLAGS_1")
+		return toReturn
+	}
+	// Older linkers don't set DF_1_PIE, but shared libraries usually don't
+	// have an interpreter.
+	interpreter := s.findSegment(InterpreterSegment)
+	if interpreter != nil {
+		toReturn.Status = HardeningPass
+		toReturn.Summary = "Position-independent executable"
+		toReturn.Evidence = append(toReturn.Evidence,
+			segmentEvidence("PT_INTERP", interpreter))
+		return toReturn
+	}
+	toReturn.Status = HardeningNotApplicable
+	toReturn.Summary = "Shared object"
+	toReturn.Evidence = append(toReturn.Evidence,
+		"no DF_1_PIE flag or PT_INTERP segment")
+	return toReturn
+}
+
+// Adds the names of the symbols in every symbol table of the given type to
+// s.symbols. Symbols defined by the file are only included if includeDefined
+// is true.
+func (s *hardeningState) loadSymbols(t SectionHeaderType,
+	includeDefined bool) error {
+	f := s.f
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		header, e := f.GetSectionHeader(i)
+		if e != nil {
+			return e
+		}
+		if header.GetType() != t {
+			continue
+		}
+		s.hasSymbols = true
+		tableName, e := f.GetSectionName(i)
+		if e != nil {
+			return e
+		}
+		symbols, names, e := f.GetSymbols(i)
+		if e != nil {
+			return fmt.Errorf("Failed reading symbols from %s: %w",
+				tableName, e)
+		}
+		for j, name := range names {
+			if !includeDefined && (symbols[j].GetSectionIndex() != 0) {
+				continue
+			}
+			if (name == "") || (s.symbols[name] != "") {
+				continue
+			}
+			s.symbols[name] = tableName
+		}
+	}
+	return nil
+}
+
+// Returns evidence for each of the given symbols that are present.
+func (s *hardeningState) symbolEvidence(names []string) []string {
+	var toReturn []string
+	for _, name := range names {
+		table, ok := s.symbols[name]
+		if ok {
+			toReturn = append(toReturn, fmt.Sprintf("symbol %s in %s", name,
+				table))
+		}
+	}
+	return toReturn
+}
+
+// Returns the given finding, marked as not applicable because the file has no
+// symbol table to look for evidence in.
+func noSymbolsFinding(f HardeningFinding) HardeningFinding {
+	f.Status = HardeningNotApplicable
+	f.Summary = "No symbol table"
+	return f
+}
+
+func (s *hardeningState) checkCanary() HardeningFinding {
+	toReturn := HardeningFinding{Feature: "Stack canary"}
+	if !s.hasSymbols {
+		return noSymbolsFinding(toReturn)
+	}
+	toReturn.Evidence = s.symbolEvidence([]string{"__stack_chk_fail",
+		"__stack_chk_guard", "__stack_chk_fail_local",
+		"__intel_security_cookie"})
+	if len(toReturn.Evidence) == 0 {
+		toReturn.Status = HardeningFail
+		toReturn.Summary = "No stack canary found"
+		toReturn.Evidence = []string{"no __stack_chk_fail or " +
+			"__stack_chk_guard symbols"}
+		return toReturn
+	}
+	toReturn.Status = HardeningPass
+	toReturn.Summary = "Stack canary found"
+	return toReturn
+}
+
+func (s *hardeningState) checkFortify() HardeningFinding {
+	toReturn := HardeningFinding{Feature: "FORTIFY_SOURCE"}
+	if !s.hasSymbols {
+		return noSymbolsFinding(toReturn)
+	}
+	var fortified []string
+	for name := range s.symbols {
+		if !strings.HasPrefix(name, "__") || !strings.HasSuffix(name, "_chk") {
+			continue
+		}
+		if strings.HasPrefix(name, "__stack_chk") {
+			continue
+		}
+		fortified = append(fortified, name)
+	}
+	sort.Strings(fortified)
+	if len(fortified) == 0 {
+		toReturn.Status = HardeningFail
+		toReturn.Summary = "No fortified functions found"
+		toReturn.Evidence = []string{"no __*_chk symbols"}
+		return toReturn
+	}
+	toReturn.Status = HardeningPass
+	toReturn.Summary = fmt.Sprintf("%d fortified functions", len(fortified))
+	toReturn.Evidence = s.symbolEvidence(fortified)
+	return toReturn
+}
+
+func (s *hardeningState) checkTextRel() HardeningFinding {
+	toReturn := HardeningFinding{Feature: "TEXTREL"}
+	if s.dynamic == nil {
+		toReturn.Status = HardeningNotApplicable
+		toReturn.Summary = "No dynamic table"
+		return toReturn
+	}
+	if s.dynamic.HasTag(DynamicTagTextRel) {
+		toReturn.Evidence = append(toReturn.Evidence,
+			"DT_TEXTREL dynamic entry")
+	}
+	if (s.dynamic.Flags(DynamicTagFlags) & DynamicFlagTextRel) != 0 {
+		toReturn.Evidence = append(toReturn.Evidence,
+			"DF_TEXTREL set in DT_FLAGS")
+	}
+	if len(toReturn.Evidence) != 0 {
+		toReturn.Status = HardeningFail
+		toReturn.Summary = "Text relocations present"
+		return toReturn
+	}
+	toReturn.Status = HardeningPass
+	toReturn.Summary = "No text relocations"
+	toReturn.Evidence = []string{"no DT_TEXTREL entry or DF_TEXTREL flag"}
+	return toReturn
+}
+
+func (s *hardeningState) checkRPath() (HardeningFinding, error) {
+	toReturn := HardeningFinding{Feature: "RPATH/RUNPATH"}
+	if s.dynamic == nil {
+		toReturn.Status = HardeningNotApplicable
+		toReturn.Summary = "No dynamic table"
+		return toReturn, nil
+	}
+	rpaths, e := s.dynamic.Strings(DynamicTagRPath)
+	if e != nil {
+		return toReturn, e
+	}
+	runpaths, e := s.dynamic.Strings(DynamicTagRunPath)
+	if e != nil {
+		return toReturn, e
+	}
+	for _, p := range rpaths {
+		toReturn.Evidence = append(toReturn.Evidence, "DT_RPATH: "+p)
+	}
+	for _, p := range runpaths {
+		toReturn.Evidence = append(toReturn.Evidence, "DT_RUNPATH: "+p)
+	}
+	if len(toReturn.Evidence) != 0 {
+		toReturn.Status = HardeningFail
+		toReturn.Summary = "Library search path set"
+		return toReturn, nil
+	}
+	toReturn.Status = HardeningPass
+	toReturn.Summary = "No RPATH or RUNPATH"
+	toReturn.Evidence = []string{"no DT_RPATH or DT_RUNPATH entries"}
+	return toReturn, nil
+}
+
+// Returns findings for control-flow protection features recorded in GNU
+// property notes: CET (IBT and SHSTK) on x86, and BTI and PAC on ARM64.
+func (s *hardeningState) checkControlFlow() ([]HardeningFinding, error) {
+	properties, e := GetGNUProperties(s.f)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading GNU properties: %w", e)
+	}
+	var propertyType uint32
+	var names []string
+	var bits []uint32
+	switch s.f.GetMachineType() {
+	case MachineTypeX86, MachineTypeAMD64:
+		propertyType = GNUPropertyX86Feature1
+		names = []string{"CET IBT", "CET SHSTK"}
+		bits = []uint32{GNUPropertyX86FeatureIBT,
+			GNUPropertyX86FeatureSHSTK}
+	case MachineTypeARM64:
+		propertyType = GNUPropertyAArch64Feature1
+		names = []string{"BTI", "PAC"}
+		bits = []uint32{GNUPropertyAArch64FeatureBTI,
+			GNUPropertyAArch64FeaturePAC}
+	default:
+		return nil, nil
+	}
+	var features uint32
+	found := false
+	for _, p := range properties {
+		if (p.Type != propertyType) || (len(p.Data) < 4) {
+			continue
+		}
+		features = fileEndianness(s.f).Uint32(p.Data)
+		found = true
+	}
+	toReturn := make([]HardeningFinding, len(names))
+	for i, name := range names {
+		finding := &(toReturn[i])
+		finding.Feature = name
+		if !found {
+			finding.Status = HardeningFail
+			finding.Summary = "Not enabled"
+			finding.Evidence = []string{fmt.Sprintf("no GNU property 0x%x "+
+				"note", propertyType)}
+			continue
+		}
+		evidence := fmt.Sprintf("GNU property 0x%x has value 0x%x",
+			propertyType, features)
+		finding.Evidence = []string{evidence}
+		if (features & bits[i]) != 0 {
+			finding.Status = HardeningPass
+			finding.Summary = "Enabled"
+		} else {
+			finding.Status = HardeningFail
+			finding.Summary = "Not enabled"
+		}
+	}
+	return toReturn, nil
+}
+
+// Checks the given ELF file for common hardening features, and returns a
+// report containing the result of each check, along with the evidence for
+// it. Reports RELRO, NX, PIE, stack canaries, FORTIFY_SOURCE, text
+// relocations, RPATH and RUNPATH, and control-flow protection features
+// recorded in GNU property notes.
+func GetHardeningReport(f ELFFile) (*HardeningReport, error) {
+	dynamic, e := GetDynamicTable(f)
+	if e != nil {
+		return nil, e
+	}
+	s := &hardeningState{
+		f:        f,
+		dynamic:  dynamic,
+		segments: programHeaders64(f),
+		symbols:  make(map[string]string),
+	}
+	// Only imported symbols are used as evidence. A file that defines
+	// __stack_chk_fail or __*_chk functions itself doesn't necessarily call
+	// them.
+	e = s.loadSymbols(DynamicLoaderSymbolSection, false)
+	if e != nil {
+		return nil, e
+	}
+	// Files without a dynamic symbol table, such as statically linked
+	// executables and object files, are checked using their regular symbol
+	// table instead. Statically linked executables contain their own copies
+	// of __stack_chk_fail and the __*_chk functions, so defined symbols are
+	// used as evidence in this case.
+	if !s.hasSymbols {
+		e = s.loadSymbols(SymbolTableSection, true)
+		if e != nil {
+			return nil, e
+		}
+	}
+	toReturn := &HardeningReport{}
+	toReturn.Findings = append(toReturn.Findings, s.checkRELRO(),
+		s.checkNX(), s.checkPIE(), s.checkCanary(), s.checkFortify(),
+		s.checkTextRel())
+	rpath, e := s.checkRPath()
+	if e != nil {
+		return nil, e
+	}
+	toReturn.Findings = append(toReturn.Findings, rpath)
+	controlFlow, e := s.checkControlFlow()
+	if e != nil {
+		return nil, e
+	}
+	toReturn.Findings = append(toReturn.Findings, controlFlow...)
+	return toReturn, nil
+}
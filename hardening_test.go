@@ -0,0 +1,128 @@
+package elf_reader
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func checkHardeningStatus(r *HardeningReport, feature string,
+	expected HardeningStatus, t *testing.T) {
+	finding := r.Finding(feature)
+	if finding == nil {
+		t.Errorf("The report didn't include %s\n", feature)
+		return
+	}
+	if finding.Status != expected {
+		t.Errorf("Expected %s to be %s, got %s\n", feature, expected, finding)
+	}
+	if (finding.Status != HardeningNotApplicable) &&
+		(len(finding.Evidence) == 0) {
+		t.Errorf("No evidence was given for %s\n", finding)
+	}
+}
+
+func TestHardeningReport(t *testing.T) {
+	// hardened_amd64 was built from a small C program using:
+	// gcc -O2 -fstack-protector-all -D_FORTIFY_SOURCE=2 -fPIE -pie \
+	//     -Wl,-z,relro,-z,now -Wl,-rpath,/opt/test/lib -s
+	f := parseTestELF64("test_data/hardened_amd64", t)
+	report, e := GetHardeningReport(f)
+	if e != nil {
+		t.Fatalf("Failed getting hardening report: %s\n", e)
+	}
+	t.Logf("hardened_amd64 report:\n%s", report)
+	checkHardeningStatus(report, "RELRO", HardeningPass, t)
+	checkHardeningStatus(report, "NX", HardeningPass, t)
+	checkHardeningStatus(report, "PIE", HardeningPass, t)
+	checkHardeningStatus(report, "Stack canary", HardeningPass, t)
+	checkHardeningStatus(report, "FORTIFY_SOURCE", HardeningPass, t)
+	checkHardeningStatus(report, "TEXTREL", HardeningPass, t)
+	checkHardeningStatus(report, "RPATH/RUNPATH", HardeningFail, t)
+
+	g := parseTestELF32("test_data/sleep_arm32", t)
+	report, e = GetHardeningReport(g)
+	if e != nil {
+		t.Fatalf("Failed getting hardening report: %s\n", e)
+	}
+	t.Logf("sleep_arm32 report:\n%s", report)
+	checkHardeningStatus(report, "RELRO", HardeningPartial, t)
+	checkHardeningStatus(report, "PIE", HardeningFail, t)
+	checkHardeningStatus(report, "Stack canary", HardeningFail, t)
+	if report.Finding("CET IBT") != nil {
+		t.Errorf("Got a CET finding for an ARM file\n")
+	}
+}
+
+func TestHardeningReportDefinedSymbols(t *testing.T) {
+	// defines_chk_amd64 defines, but doesn't import, __stack_chk_fail and
+	// __memcpy_chk. It was built from a small C program using:
+	// gcc -O2 -fno-stack-protector -U_FORTIFY_SOURCE -rdynamic
+	f := parseTestELF64("test_data/defines_chk_amd64", t)
+	report, e := GetHardeningReport(f)
+	if e != nil {
+		t.Fatalf("Failed getting hardening report: %s\n", e)
+	}
+	t.Logf("defines_chk_amd64 report:\n%s", report)
+	checkHardeningStatus(report, "Stack canary", HardeningFail, t)
+	checkHardeningStatus(report, "FORTIFY_SOURCE", HardeningFail, t)
+}
+
+func TestHardeningReportStaticSymbols(t *testing.T) {
+	// canary_amd64.o has no dynamic symbol table, so the regular symbol table
+	// must be used. It was built from a small C program using:
+	// gcc -O2 -fstack-protector-all -D_FORTIFY_SOURCE=2 -c
+	f := parseTestELF64("test_data/canary_amd64.o", t)
+	report, e := GetHardeningReport(f)
+	if e != nil {
+		t.Fatalf("Failed getting hardening report: %s\n", e)
+	}
+	t.Logf("canary_amd64.o report:\n%s", report)
+	checkHardeningStatus(report, "Stack canary", HardeningPass, t)
+	checkHardeningStatus(report, "FORTIFY_SOURCE", HardeningPass, t)
+
+	// Without any symbol table, neither feature can be checked.
+	index, e := FindSectionByName(f, ".symtab")
+	if e != nil {
+		t.Fatalf("Failed finding .symtab: %s\n", e)
+	}
+	f.Sections[index].Type = BitsSection
+	report, e = GetHardeningReport(f)
+	if e != nil {
+		t.Fatalf("Failed getting hardening report: %s\n", e)
+	}
+	checkHardeningStatus(report, "Stack canary", HardeningNotApplicable, t)
+	checkHardeningStatus(report, "FORTIFY_SOURCE", HardeningNotApplicable,
+		t)
+}
+
+func TestParseGNUProperties(t *testing.T) {
+	// An x86 feature property with IBT and SHSTK set, followed by a 64-bit
+	// padded stack size property.
+	description := make([]byte, 32)
+	binary.LittleEndian.PutUint32(description[0:], GNUPropertyX86Feature1)
+	binary.LittleEndian.PutUint32(description[4:], 4)
+	binary.LittleEndian.PutUint32(description[8:], 3)
+	binary.LittleEndian.PutUint32(description[16:], GNUPropertyStackSize)
+	binary.LittleEndian.PutUint32(description[20:], 8)
+	binary.LittleEndian.PutUint64(description[24:], 0x800000)
+	properties, e := ParseGNUProperties(description, binary.LittleEndian,
+		true)
+	if e != nil {
+		t.Fatalf("Failed parsing GNU properties: %s\n", e)
+	}
+	if len(properties) != 2 {
+		t.Fatalf("Expected 2 properties, got %d\n", len(properties))
+	}
+	if (properties[0].Type != GNUPropertyX86Feature1) ||
+		(binary.LittleEndian.Uint32(properties[0].Data) != 3) {
+		t.Errorf("Incorrect x86 feature property: %v\n", properties[0])
+	}
+	if (properties[1].Type != GNUPropertyStackSize) ||
+		(binary.LittleEndian.Uint64(properties[1].Data) != 0x800000) {
+		t.Errorf("Incorrect stack size property: %v\n", properties[1])
+	}
+	_, e = ParseGNUProperties(description[:20], binary.LittleEndian, true)
+	if e == nil {
+		t.Errorf("Didn't get an error for truncated properties\n")
+	}
+}
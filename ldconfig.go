@@ -0,0 +1,241 @@
+package elf_reader
+
+// This file contains code for reading the dynamic linker's configuration:
+// /etc/ld.so.conf and the /etc/ld.so.cache file generated by ldconfig.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The magic string at the start of the current ld.so.cache format.
+const ldCacheMagic = "glibc-ld.so.cache1.1"
+
+// Holds the header of an ld.so.cache file in the current format.
+type ldCacheHeader struct {
+	Magic           [20]byte
+	LibraryCount    uint32
+	StringTableSize uint32
+	Flags           uint8
+	Padding         [3]uint8
+	ExtensionOffset uint32
+	Unused          [3]uint32
+}
+
+// Holds a single entry in an ld.so.cache file in the current format.
+type ldCacheEntry struct {
+	Flags     int32
+	Key       uint32
+	Value     uint32
+	OSVersion uint32
+	HWCap     uint64
+}
+
+// Holds a single library listed in ld.so.cache.
+type LDCacheEntry struct {
+	// The library's name, e.g. "libc.so.6".
+	Name string
+	// The full path to the library.
+	Path string
+	// The flags from the cache entry, indicating the library's type and
+	// architecture.
+	Flags int32
+}
+
+// Parses the content of an ld.so.cache file, and returns the libraries it
+// lists, in the order they appear. Only the format used by glibc 2.2 and
+// later is supported, though it may follow a section in the old format. The
+// byte order must match the system that generated the cache.
+func ParseLDCache(content []byte, order binary.ByteOrder) ([]LDCacheEntry,
+	error) {
+	start := bytes.Index(content, []byte(ldCacheMagic))
+	if start < 0 {
+		return nil, fmt.Errorf("Unsupported ld.so.cache format")
+	}
+	data := content[start:]
+	var header ldCacheHeader
+	e := readStructAt(data, 0, order, &header)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading ld.so.cache header: %w", e)
+	}
+	headerSize := uint64(binary.Size(&header))
+	entrySize := uint64(binary.Size(&ldCacheEntry{}))
+	if uint64(header.LibraryCount) > (uint64(len(data)) / entrySize) {
+		return nil, fmt.Errorf("Invalid ld.so.cache library count: %d",
+			header.LibraryCount)
+	}
+	toReturn := make([]LDCacheEntry, 0, header.LibraryCount)
+	for i := uint64(0); i < uint64(header.LibraryCount); i++ {
+		var entry ldCacheEntry
+		e = readStructAt(data, headerSize+i*entrySize, order, &entry)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading ld.so.cache entry %d: %w",
+				i, e)
+		}
+		name, e := ReadStringAtOffset(entry.Key, data)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading ld.so.cache entry %d "+
+				"name: %w", i, e)
+		}
+		libraryPath, e := ReadStringAtOffset(entry.Value, data)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading ld.so.cache entry %d "+
+				"path: %w", i, e)
+		}
+		toReturn = append(toReturn, LDCacheEntry{
+			Name:  string(name),
+			Path:  string(libraryPath),
+			Flags: entry.Flags,
+		})
+	}
+	return toReturn, nil
+}
+
+// The maximum number of symbolic links followed when resolving a path within
+// a sysroot. This is the same as the Linux kernel's limit.
+const maxSysrootSymlinks = 40
+
+// Returns the host path of the given path within the sysroot. Relative paths
+// are relative to the sysroot's root directory. Symbolic links are resolved
+// as if the sysroot were the root directory, so absolute links refer to
+// files within it. Returns an error if a ".." component would leave the
+// sysroot. If the sysroot is empty, the path is returned unchanged.
+func sysrootPath(sysroot, p string) (string, error) {
+	if sysroot == "" {
+		return p, nil
+	}
+	remaining := strings.Split(p, "/")
+	resolved := "/"
+	linkCount := 0
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "/" {
+				return "", fmt.Errorf("%s refers to a path outside of "+
+					"the sysroot", p)
+			}
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, component)
+		hostPath := filepath.Join(sysroot, filepath.FromSlash(next))
+		info, e := os.Lstat(hostPath)
+		if (e != nil) || ((info.Mode() & os.ModeSymlink) == 0) {
+			// Missing files are left for the caller to report.
+			resolved = next
+			continue
+		}
+		linkCount++
+		if linkCount > maxSysrootSymlinks {
+			return "", fmt.Errorf("Too many symbolic links in %s", p)
+		}
+		target, e := os.Readlink(hostPath)
+		if e != nil {
+			return "", e
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+	return filepath.Join(sysroot, filepath.FromSlash(resolved)), nil
+}
+
+// Reads an ld.so.conf file, following include directives, and returns the
+// list of directories it contains. The path is an absolute path within the
+// sysroot. Directories that have already been seen are skipped, so include
+// loops don't cause problems.
+func ParseLDSOConf(sysroot, confPath string) ([]string, error) {
+	seenFiles := make(map[string]bool)
+	seenDirs := make(map[string]bool)
+	var toReturn []string
+	var parseFile func(confPath string) error
+	parseFile = func(confPath string) error {
+		if seenFiles[confPath] {
+			return nil
+		}
+		seenFiles[confPath] = true
+		hostPath, e := sysrootPath(sysroot, confPath)
+		if e != nil {
+			return e
+		}
+		content, e := os.ReadFile(hostPath)
+		if e != nil {
+			return e
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if i := strings.IndexByte(line, '#'); i >= 0 {
+				line = line[:i]
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "include":
+				for _, pattern := range fields[1:] {
+					if !path.IsAbs(pattern) {
+						pattern = path.Join(path.Dir(confPath), pattern)
+					}
+					hostPattern, e := sysrootPath(sysroot, pattern)
+					if e != nil {
+						return fmt.Errorf("Bad include pattern in %s: %w",
+							confPath, e)
+					}
+					matches, e := filepath.Glob(hostPattern)
+					if e != nil {
+						return fmt.Errorf("Bad include pattern in %s: %w",
+							confPath, e)
+					}
+					for _, m := range matches {
+						rel := m
+						if sysroot != "" {
+							rel, e = filepath.Rel(sysroot, m)
+							if e != nil {
+								return e
+							}
+							rel = "/" + filepath.ToSlash(rel)
+						}
+						// Missing or unreadable included files are ignored,
+						// like the dynamic linker does.
+						parseFile(rel)
+					}
+				}
+				continue
+			case "hwcap":
+				continue
+			}
+			// Very old versions allowed a library type after the directory,
+			// e.g. "/usr/lib=libc5".
+			for _, dir := range fields {
+				if i := strings.IndexByte(dir, '='); i >= 0 {
+					dir = dir[:i]
+				}
+				dir = strings.TrimSuffix(dir, ":")
+				if (dir == "") || seenDirs[dir] {
+					continue
+				}
+				seenDirs[dir] = true
+				toReturn = append(toReturn, dir)
+			}
+		}
+		return nil
+	}
+	e := parseFile(confPath)
+	if e != nil {
+		return nil, e
+	}
+	return toReturn, nil
+}
@@ -0,0 +1,497 @@
+package elf_reader
+
+// This file contains code for resolving the shared libraries needed by an
+// ELF file without running it, similar to the ldd tool. It follows the same
+// search order as the GNU dynamic linker, and can resolve libraries within a
+// sysroot for a different system or architecture.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Options for ResolveDependencies. The zero value searches the host's root
+// filesystem using the default settings.
+type DependencyOptions struct {
+	// All absolute paths are interpreted relative to this directory, if it's
+	// set. Symbolic links are resolved within it, and paths that would leave
+	// it are treated as errors.
+	Sysroot string
+	// Directories to search, as if they were given in the LD_LIBRARY_PATH
+	// environment variable.
+	LibraryPath []string
+	// The directories searched after all others. Defaults to /lib and
+	// /usr/lib, preceded by /lib64 and /usr/lib64 for 64-bit files.
+	DefaultPaths []string
+	// The value of $PLATFORM in search paths. Defaults to a name based on the
+	// file's machine type, e.g. "x86_64".
+	Platform string
+	// The value of $LIB in search paths. Defaults to "lib64" for 64-bit files
+	// and "lib" for 32-bit files.
+	LibDir string
+	// If set, /etc/ld.so.cache isn't used.
+	IgnoreCache bool
+	// If set, the directories in /etc/ld.so.conf aren't searched. Normally
+	// they're searched after the cache, in case the cache is out of date.
+	IgnoreConf bool
+	// The dynamic linker loads DT_NEEDED entries containing a slash
+	// directly, interpreting relative ones, e.g. "lib/libfoo.so", relative
+	// to the process's working directory rather than the object's
+	// directory. This sets the working directory used for them, within the
+	// sysroot. Defaults to the root of the sysroot if a sysroot is given, or
+	// the current directory otherwise.
+	WorkingDirectory string
+}
+
+// Describes how a library was found, or why it wasn't.
+type DependencyNode struct {
+	// The name of the library, as given in the DT_NEEDED entry. For the root
+	// node, this is the path that was passed to ResolveDependencies.
+	Name string
+	// The path the library was found at, within the sysroot. Empty if the
+	// library wasn't found.
+	Path string
+	// Where the library was found, e.g. "RUNPATH" or "ld.so.cache".
+	Source string `json:",omitempty"`
+	// If the library couldn't be found, this explains why.
+	Error string `json:",omitempty"`
+	// True if the library was already loaded as a dependency of another
+	// library, in which case its dependencies aren't listed again.
+	AlreadyLoaded bool `json:",omitempty"`
+	// The libraries needed by this library.
+	Dependencies []*DependencyNode `json:",omitempty"`
+}
+
+// Returns true if this library and all of its dependencies were found.
+func (n *DependencyNode) Resolved() bool {
+	if n.Path == "" {
+		return false
+	}
+	for _, d := range n.Dependencies {
+		if !d.Resolved() {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *DependencyNode) writeTree(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("    ", depth))
+	switch {
+	case depth == 0:
+		fmt.Fprintf(b, "%s\n", n.Name)
+	case n.Path == "":
+		fmt.Fprintf(b, "%s => not found (%s)\n", n.Name, n.Error)
+	case n.AlreadyLoaded:
+		fmt.Fprintf(b, "%s => %s (already loaded)\n", n.Name, n.Path)
+	default:
+		fmt.Fprintf(b, "%s => %s (%s)\n", n.Name, n.Path, n.Source)
+	}
+	for _, d := range n.Dependencies {
+		d.writeTree(b, depth+1)
+	}
+}
+
+// Returns the dependency tree, with one library per line.
+func (n *DependencyNode) String() string {
+	var b strings.Builder
+	n.writeTree(&b, 0)
+	return b.String()
+}
+
+// Returns the root and each library it loads, in the order the dynamic linker
+// would load them. This is also the order of the global symbol lookup scope.
+// Libraries that weren't found, or were already loaded, aren't included.
+func (n *DependencyNode) LoadOrder() []*DependencyNode {
+	toReturn := []*DependencyNode{n}
+	for i := 0; i < len(toReturn); i++ {
+		for _, d := range toReturn[i].Dependencies {
+			if (d.Path == "") || d.AlreadyLoaded {
+				continue
+			}
+			toReturn = append(toReturn, d)
+		}
+	}
+	return toReturn
+}
+
+// Holds the parts of a loaded object needed while resolving dependencies.
+type loadedObject struct {
+	node    *DependencyNode
+	needed  []string
+	rpath   []string
+	runpath []string
+	soname  string
+	// The object that caused this object to be loaded, used for searching
+	// the DT_RPATH of its ancestors.
+	parent *loadedObject
+}
+
+// Holds state while resolving dependencies.
+type dependencyResolver struct {
+	options *DependencyOptions
+	// The root file's class, machine and byte order. Libraries must match
+	// these.
+	is64    bool
+	machine MachineType
+	order   binary.ByteOrder
+	// Loaded objects, keyed by both their path and their SONAME.
+	loaded      map[string]*loadedObject
+	cache       []LDCacheEntry
+	confDirs    []string
+	defaultDirs []string
+}
+
+// Returns the default value of $PLATFORM for the given machine type.
+func defaultPlatform(machine MachineType) string {
+	switch machine {
+	case MachineTypeAMD64:
+		return "x86_64"
+	case MachineTypeX86:
+		return "i686"
+	case MachineTypeARM64:
+		return "aarch64"
+	case MachineTypeARM:
+		return "v7l"
+	case MachineTypePowerPC:
+		return "powerpc"
+	case MachineTypeMIPS:
+		return "mips"
+	case MachineTypeSPARC:
+		return "sparc"
+	}
+	return "unknown"
+}
+
+// Expands $ORIGIN, $LIB and $PLATFORM in the given search path directory.
+// The origin is the directory containing the object with the search path.
+func (r *dependencyResolver) expandPath(dir, origin string) string {
+	for _, name := range []string{"ORIGIN", "LIB", "PLATFORM"} {
+		var value string
+		switch name {
+		case "ORIGIN":
+			value = origin
+		case "LIB":
+			value = r.options.LibDir
+		case "PLATFORM":
+			value = r.options.Platform
+		}
+		dir = strings.ReplaceAll(dir, "${"+name+"}", value)
+		dir = strings.ReplaceAll(dir, "$"+name, value)
+	}
+	return dir
+}
+
+// Splits a colon-separated search path, expanding variables in each
+// directory. Empty entries refer to the current directory, like in the
+// dynamic linker.
+func (r *dependencyResolver) splitSearchPath(paths []string,
+	origin string) []string {
+	var toReturn []string
+	for _, p := range paths {
+		for _, dir := range strings.Split(p, ":") {
+			if dir == "" {
+				dir = "."
+			}
+			toReturn = append(toReturn, r.expandPath(dir, origin))
+		}
+	}
+	return toReturn
+}
+
+// Reads and parses the file at the given path, returning an error if it
+// doesn't exist or doesn't match the class and machine of the root file.
+func (r *dependencyResolver) loadCandidate(p string) (ELFFile, error) {
+	hostPath, e := sysrootPath(r.options.Sysroot, p)
+	if e != nil {
+		return nil, e
+	}
+	raw, e := os.ReadFile(hostPath)
+	if e != nil {
+		return nil, e
+	}
+	f, e := ParseELFFile(raw)
+	if e != nil {
+		return nil, fmt.Errorf("%s isn't a valid ELF file: %w", p, e)
+	}
+	if is64Bit(f) != r.is64 {
+		return nil, fmt.Errorf("%s has the wrong ELF class", p)
+	}
+	if f.GetMachineType() != r.machine {
+		return nil, fmt.Errorf("%s is for the wrong machine (%s)", p,
+			f.GetMachineType())
+	}
+	if fileEndianness(f) != r.order {
+		return nil, fmt.Errorf("%s has the wrong byte order", p)
+	}
+	return f, nil
+}
+
+// Reads the dynamic table information needed to resolve an object's
+// dependencies.
+func (r *dependencyResolver) newLoadedObject(f ELFFile, node *DependencyNode,
+	parent *loadedObject) (*loadedObject, error) {
+	toReturn := &loadedObject{
+		node:   node,
+		parent: parent,
+	}
+	dynamic, e := GetDynamicTable(f)
+	if (e != nil) || (dynamic == nil) {
+		return toReturn, e
+	}
+	toReturn.needed, e = dynamic.Strings(DynamicTagNeeded)
+	if e != nil {
+		return nil, e
+	}
+	toReturn.rpath, e = dynamic.Strings(DynamicTagRPath)
+	if e != nil {
+		return nil, e
+	}
+	toReturn.runpath, e = dynamic.Strings(DynamicTagRunPath)
+	if e != nil {
+		return nil, e
+	}
+	sonames, e := dynamic.Strings(DynamicTagSOName)
+	if e != nil {
+		return nil, e
+	}
+	if len(sonames) != 0 {
+		toReturn.soname = sonames[0]
+	}
+	return toReturn, nil
+}
+
+// Searches the given directories for the library, returning the parsed file
+// and its path if a compatible one is found. Rejected candidates are added
+// to the list of reasons.
+func (r *dependencyResolver) searchDirs(name string, dirs []string,
+	reasons *[]string) (ELFFile, string) {
+	for _, dir := range dirs {
+		p := path.Join(dir, name)
+		f, e := r.loadCandidate(p)
+		if e == nil {
+			return f, p
+		}
+		if !os.IsNotExist(e) {
+			*reasons = append(*reasons, e.Error())
+		}
+	}
+	return nil, ""
+}
+
+// Finds the library with the given name needed by the given object. Returns
+// the parsed library, its path, and the source of the path. If it isn't
+// found, the path will be empty and the source will explain why.
+func (r *dependencyResolver) findLibrary(name string,
+	requester *loadedObject) (ELFFile, string, string) {
+	var reasons []string
+	origin := path.Dir(requester.node.Path)
+	if strings.Contains(name, "/") {
+		p := r.expandPath(name, origin)
+		if !path.IsAbs(p) {
+			if r.options.WorkingDirectory != "" {
+				p = path.Join(r.options.WorkingDirectory, p)
+			} else if r.options.Sysroot != "" {
+				p = path.Join("/", p)
+			}
+		}
+		f, e := r.loadCandidate(p)
+		if e != nil {
+			return nil, "", e.Error()
+		}
+		return f, p, "path"
+	}
+
+	// DT_RPATH is only used if the requesting object doesn't have a
+	// DT_RUNPATH, and the RPATHs of each of its ancestors are searched too.
+	if len(requester.runpath) == 0 {
+		for o := requester; o != nil; o = o.parent {
+			dirs := r.splitSearchPath(o.rpath, path.Dir(o.node.Path))
+			f, p := r.searchDirs(name, dirs, &reasons)
+			if f != nil {
+				return f, p, "RPATH of " + o.node.Name
+			}
+		}
+	}
+	dirs := r.splitSearchPath(r.options.LibraryPath, origin)
+	f, p := r.searchDirs(name, dirs, &reasons)
+	if f != nil {
+		return f, p, "LD_LIBRARY_PATH"
+	}
+	dirs = r.splitSearchPath(requester.runpath, origin)
+	f, p = r.searchDirs(name, dirs, &reasons)
+	if f != nil {
+		return f, p, "RUNPATH"
+	}
+	for _, entry := range r.cache {
+		if entry.Name != name {
+			continue
+		}
+		f, e := r.loadCandidate(entry.Path)
+		if e == nil {
+			return f, entry.Path, "ld.so.cache"
+		}
+		if !os.IsNotExist(e) {
+			reasons = append(reasons, e.Error())
+		}
+	}
+	f, p = r.searchDirs(name, r.confDirs, &reasons)
+	if f != nil {
+		return f, p, "ld.so.conf"
+	}
+	f, p = r.searchDirs(name, r.defaultDirs, &reasons)
+	if f != nil {
+		return f, p, "default path"
+	}
+	if len(reasons) == 0 {
+		return nil, "", "no file with this name in any search path"
+	}
+	// The same file may have been rejected more than once, e.g. if it's in
+	// both the cache and a default directory.
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		if !seen[reason] {
+			seen[reason] = true
+			unique = append(unique, reason)
+		}
+	}
+	return nil, "", "no compatible file found; skipped " +
+		strings.Join(unique, "; ")
+}
+
+// Resolves the dependencies of the given object, breadth-first like the
+// dynamic linker, so that libraries are found in the same order.
+func (r *dependencyResolver) resolve(root *loadedObject) error {
+	queue := []*loadedObject{root}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, name := range current.needed {
+			node := &DependencyNode{Name: name}
+			current.node.Dependencies = append(current.node.Dependencies,
+				node)
+			if existing := r.loaded[name]; existing != nil {
+				node.Path = existing.node.Path
+				node.AlreadyLoaded = true
+				continue
+			}
+			f, p, source := r.findLibrary(name, current)
+			if f == nil {
+				node.Error = source
+				continue
+			}
+			node.Path = p
+			node.Source = source
+			if existing := r.loaded[p]; existing != nil {
+				node.AlreadyLoaded = true
+				r.loaded[name] = existing
+				continue
+			}
+			loaded, e := r.newLoadedObject(f, node, current)
+			if e != nil {
+				return fmt.Errorf("Failed reading %s: %w", p, e)
+			}
+			r.loaded[name] = loaded
+			r.loaded[p] = loaded
+			if loaded.soname != "" {
+				r.loaded[loaded.soname] = loaded
+			}
+			queue = append(queue, loaded)
+		}
+	}
+	return nil
+}
+
+// Resolves the tree of shared libraries needed by the ELF file at the given
+// path, without running it. The path is within the sysroot, if one is given
+// in the options. Libraries are searched for in the same order as the GNU
+// dynamic linker: DT_RPATH, LD_LIBRARY_PATH, DT_RUNPATH, ld.so.cache, and
+// finally the default directories. Libraries that don't match the file's
+// class, machine and byte order are skipped. Returns an error only if the
+// root file can't be read; libraries that can't be found are reported in the
+// returned tree.
+func ResolveDependencies(filePath string,
+	options *DependencyOptions) (*DependencyNode, error) {
+	var opts DependencyOptions
+	if options != nil {
+		opts = *options
+	}
+	hostPath, e := sysrootPath(opts.Sysroot, filePath)
+	if e != nil {
+		return nil, e
+	}
+	raw, e := os.ReadFile(hostPath)
+	if e != nil {
+		return nil, e
+	}
+	f, e := ParseELFFile(raw)
+	if e != nil {
+		return nil, fmt.Errorf("Failed parsing %s: %w", filePath, e)
+	}
+	r := &dependencyResolver{
+		options: &opts,
+		is64:    is64Bit(f),
+		machine: f.GetMachineType(),
+		order:   fileEndianness(f),
+		loaded:  make(map[string]*loadedObject),
+	}
+	if opts.Platform == "" {
+		opts.Platform = defaultPlatform(r.machine)
+	}
+	if opts.LibDir == "" {
+		opts.LibDir = "lib"
+		if r.is64 {
+			opts.LibDir = "lib64"
+		}
+	}
+	r.defaultDirs = opts.DefaultPaths
+	if r.defaultDirs == nil {
+		r.defaultDirs = []string{"/lib", "/usr/lib"}
+		if r.is64 {
+			r.defaultDirs = []string{"/lib64", "/usr/lib64", "/lib",
+				"/usr/lib"}
+		}
+	}
+	if !opts.IgnoreCache {
+		// A missing or unsupported cache is the same as an empty one.
+		cachePath, e := sysrootPath(opts.Sysroot, "/etc/ld.so.cache")
+		if e == nil {
+			content, e := os.ReadFile(cachePath)
+			if e == nil {
+				r.cache, _ = ParseLDCache(content, r.order)
+			}
+		}
+	}
+	if !opts.IgnoreConf {
+		r.confDirs, _ = ParseLDSOConf(opts.Sysroot, "/etc/ld.so.conf")
+	}
+
+	// Relative paths are treated as relative to the sysroot, since $ORIGIN
+	// must be an absolute path within it.
+	rootPath := filePath
+	if !path.IsAbs(rootPath) && (opts.Sysroot != "") {
+		rootPath = "/" + rootPath
+	}
+	root := &DependencyNode{
+		Name:   filePath,
+		Path:   rootPath,
+		Source: "root",
+	}
+	rootObject, e := r.newLoadedObject(f, root, nil)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading %s: %w", filePath, e)
+	}
+	r.loaded[rootPath] = rootObject
+	if rootObject.soname != "" {
+		r.loaded[rootObject.soname] = rootObject
+	}
+	e = r.resolve(rootObject)
+	if e != nil {
+		return nil, e
+	}
+	return root, nil
+}
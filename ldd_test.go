@@ -0,0 +1,248 @@
+package elf_reader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Copies the given test file to the path within the sysroot, creating any
+// directories needed.
+func copyToSysroot(sysroot, source, destination string, t *testing.T) {
+	p := filepath.Join(sysroot, filepath.FromSlash(destination))
+	e := os.MkdirAll(filepath.Dir(p), 0755)
+	if e != nil {
+		t.Fatalf("Failed creating directory for %s: %s\n", destination, e)
+	}
+	e = os.WriteFile(p, fileBytes(source, t), 0755)
+	if e != nil {
+		t.Fatalf("Failed writing %s: %s\n", destination, e)
+	}
+}
+
+func writeSysrootFile(sysroot, destination, content string, t *testing.T) {
+	p := filepath.Join(sysroot, filepath.FromSlash(destination))
+	e := os.MkdirAll(filepath.Dir(p), 0755)
+	if e != nil {
+		t.Fatalf("Failed creating directory for %s: %s\n", destination, e)
+	}
+	e = os.WriteFile(p, []byte(content), 0644)
+	if e != nil {
+		t.Fatalf("Failed writing %s: %s\n", destination, e)
+	}
+}
+
+func TestResolveDependencies(t *testing.T) {
+	sysroot := t.TempDir()
+	// hardened_amd64 needs libc.so.6, and has a RUNPATH of /opt/test/lib.
+	copyToSysroot(sysroot, "test_data/hardened_amd64", "/bin/app", t)
+	// A 32-bit ARM file in the RUNPATH must be skipped.
+	copyToSysroot(sysroot, "test_data/sleep_arm32",
+		"/opt/test/lib/libc.so.6", t)
+	// Any 64-bit AMD64 shared file can stand in for libc. sleep_amd64 itself
+	// needs libc.so.6, which should be found as already loaded.
+	copyToSysroot(sysroot, "test_data/sleep_amd64",
+		"/usr/lib/custom/libc.so.6", t)
+	writeSysrootFile(sysroot, "/etc/ld.so.conf",
+		"# Test config\ninclude ld.so.conf.d/*.conf\n", t)
+	writeSysrootFile(sysroot, "/etc/ld.so.conf.d/custom.conf",
+		"/usr/lib/custom\n", t)
+
+	tree, e := ResolveDependencies("/bin/app", &DependencyOptions{
+		Sysroot: sysroot,
+	})
+	if e != nil {
+		t.Fatalf("Failed resolving dependencies: %s\n", e)
+	}
+	t.Logf("Dependencies:\n%s", tree)
+	if !tree.Resolved() || (len(tree.Dependencies) != 1) {
+		t.Fatalf("Expected libc.so.6 to be resolved\n")
+	}
+	libc := tree.Dependencies[0]
+	if (libc.Path != "/usr/lib/custom/libc.so.6") ||
+		(libc.Source != "ld.so.conf") {
+		t.Errorf("libc.so.6 was resolved incorrectly: %s via %s\n",
+			libc.Path, libc.Source)
+	}
+	if (len(libc.Dependencies) != 1) || !libc.Dependencies[0].AlreadyLoaded {
+		t.Errorf("libc.so.6's dependency on itself wasn't already loaded\n")
+	}
+
+	// Library paths take precedence over the config, and expand $PLATFORM.
+	copyToSysroot(sysroot, "test_data/sleep_amd64",
+		"/platform/x86_64/libc.so.6", t)
+	tree, e = ResolveDependencies("/bin/app", &DependencyOptions{
+		Sysroot:     sysroot,
+		LibraryPath: []string{"/platform/$PLATFORM"},
+	})
+	if e != nil {
+		t.Fatalf("Failed resolving dependencies: %s\n", e)
+	}
+	libc = tree.Dependencies[0]
+	if (libc.Path != "/platform/x86_64/libc.so.6") ||
+		(libc.Source != "LD_LIBRARY_PATH") {
+		t.Errorf("libc.so.6 wasn't found using the library path: %s via "+
+			"%s\n", libc.Path, libc.Source)
+	}
+
+	// Without the config, the only candidate is the incompatible one.
+	tree, e = ResolveDependencies("/bin/app", &DependencyOptions{
+		Sysroot:    sysroot,
+		IgnoreConf: true,
+	})
+	if e != nil {
+		t.Fatalf("Failed resolving dependencies: %s\n", e)
+	}
+	t.Logf("Dependencies without ld.so.conf:\n%s", tree)
+	if tree.Resolved() {
+		t.Errorf("Resolved libc.so.6 to an incompatible file\n")
+	}
+}
+
+func TestResolveDependenciesOutsideSysroot(t *testing.T) {
+	base := t.TempDir()
+	sysroot := filepath.Join(base, "sysroot")
+	outside := filepath.Join(base, "outside")
+	// Change hardened_amd64's DT_NEEDED entry from libc.so.6 to a relative
+	// path of the same length, which is /l/x.so within the sysroot.
+	app := bytes.Replace(fileBytes("test_data/hardened_amd64", t),
+		[]byte("libc.so.6\x00"), []byte("../l/x.so\x00"), -1)
+	writeSysrootFile(sysroot, "/bin/app", string(app), t)
+	copyToSysroot(outside, "test_data/sleep_amd64", "/x.so", t)
+	resolve := func() *DependencyNode {
+		tree, e := ResolveDependencies("/bin/app", &DependencyOptions{
+			Sysroot:     sysroot,
+			IgnoreCache: true,
+			IgnoreConf:  true,
+		})
+		if e != nil {
+			t.Fatalf("Failed resolving dependencies: %s\n", e)
+		}
+		t.Logf("Dependencies:\n%s", tree)
+		if len(tree.Dependencies) != 1 {
+			t.Fatalf("Expected exactly one dependency\n")
+		}
+		return tree.Dependencies[0]
+	}
+
+	// An absolute symlink must be resolved within the sysroot, not the host.
+	e := os.Symlink(outside, filepath.Join(sysroot, "l"))
+	if e != nil {
+		t.Fatalf("Failed creating symlink: %s\n", e)
+	}
+	if resolve().Path != "" {
+		t.Errorf("Resolved a library outside of the sysroot\n")
+	}
+	copyToSysroot(sysroot, "test_data/sleep_amd64",
+		filepath.ToSlash(outside)+"/x.so", t)
+	if resolve().Path != "/l/x.so" {
+		t.Errorf("Didn't resolve the symlink within the sysroot\n")
+	}
+
+	// A relative symlink that leaves the sysroot must be rejected.
+	e = os.Remove(filepath.Join(sysroot, "l"))
+	if e != nil {
+		t.Fatalf("Failed removing symlink: %s\n", e)
+	}
+	e = os.Symlink("../outside", filepath.Join(sysroot, "l"))
+	if e != nil {
+		t.Fatalf("Failed creating symlink: %s\n", e)
+	}
+	if resolve().Path != "" {
+		t.Errorf("Followed a relative symlink out of the sysroot\n")
+	}
+}
+
+func TestResolveDependenciesRelativePath(t *testing.T) {
+	sysroot := t.TempDir()
+	// Change hardened_amd64's DT_NEEDED entry from libc.so.6 to a relative
+	// path of the same length. The dynamic linker interprets it relative to
+	// the working directory, not the directory containing the application.
+	app := bytes.Replace(fileBytes("test_data/hardened_amd64", t),
+		[]byte("libc.so.6\x00"), []byte("l/xx.so.6\x00"), -1)
+	writeSysrootFile(sysroot, "/bin/app", string(app), t)
+	copyToSysroot(sysroot, "test_data/sleep_amd64", "/l/xx.so.6", t)
+	copyToSysroot(sysroot, "test_data/sleep_amd64", "/bin/l/xx.so.6", t)
+	copyToSysroot(sysroot, "test_data/sleep_amd64", "/w/l/xx.so.6", t)
+	resolve := func(workingDir string) string {
+		tree, e := ResolveDependencies("/bin/app", &DependencyOptions{
+			Sysroot:          sysroot,
+			IgnoreCache:      true,
+			IgnoreConf:       true,
+			WorkingDirectory: workingDir,
+		})
+		if e != nil {
+			t.Fatalf("Failed resolving dependencies: %s\n", e)
+		}
+		t.Logf("Dependencies:\n%s", tree)
+		if len(tree.Dependencies) != 1 {
+			t.Fatalf("Expected exactly one dependency\n")
+		}
+		return tree.Dependencies[0].Path
+	}
+	if p := resolve(""); p != "/l/xx.so.6" {
+		t.Errorf("Expected /l/xx.so.6 without a working directory, got %s\n",
+			p)
+	}
+	if p := resolve("/w"); p != "/w/l/xx.so.6" {
+		t.Errorf("Expected /w/l/xx.so.6 in working directory /w, got %s\n",
+			p)
+	}
+}
+
+func TestSysrootPath(t *testing.T) {
+	sysroot := t.TempDir()
+	p, e := sysrootPath(sysroot, "/usr/../lib/./libc.so.6")
+	if e != nil {
+		t.Fatalf("Failed getting path within sysroot: %s\n", e)
+	}
+	if p != filepath.Join(sysroot, "lib", "libc.so.6") {
+		t.Errorf("Got incorrect path within sysroot: %s\n", p)
+	}
+	_, e = sysrootPath(sysroot, "../../etc/passwd")
+	if e == nil {
+		t.Errorf("Didn't get an error for a path outside the sysroot\n")
+	} else {
+		t.Logf("Got expected error for a path outside the sysroot: %s\n", e)
+	}
+	p, e = sysrootPath("", "../lib/libc.so.6")
+	if (e != nil) || (p != "../lib/libc.so.6") {
+		t.Errorf("The path changed without a sysroot: %s, %v\n", p, e)
+	}
+}
+
+func TestParseLDCache(t *testing.T) {
+	var header ldCacheHeader
+	copy(header.Magic[:], ldCacheMagic)
+	header.LibraryCount = 1
+	content, e := encodeBinary(binary.LittleEndian, &header)
+	if e != nil {
+		t.Fatalf("Failed encoding cache header: %s\n", e)
+	}
+	stringsStart := uint32(len(content) + 24)
+	entry := ldCacheEntry{
+		Flags: 0x303,
+		Key:   stringsStart,
+		Value: stringsStart + uint32(len("libz.so.1\x00")),
+	}
+	encodedEntry, e := encodeBinary(binary.LittleEndian, &entry)
+	if e != nil {
+		t.Fatalf("Failed encoding cache entry: %s\n", e)
+	}
+	content = append(content, encodedEntry...)
+	content = append(content, []byte("libz.so.1\x00/lib/libz.so.1\x00")...)
+	entries, e := ParseLDCache(content, binary.LittleEndian)
+	if e != nil {
+		t.Fatalf("Failed parsing the cache: %s\n", e)
+	}
+	if (len(entries) != 1) || (entries[0].Name != "libz.so.1") ||
+		(entries[0].Path != "/lib/libz.so.1") {
+		t.Errorf("Incorrect cache entries: %v\n", entries)
+	}
+	_, e = ParseLDCache(content[:60], binary.LittleEndian)
+	if e == nil {
+		t.Errorf("Didn't get an error for a truncated cache\n")
+	}
+}
@@ -0,0 +1,321 @@
+package elf_reader
+
+// This file contains code for looking up the source file, line and function
+// for an address, in the same manner as addr2line -f -i, using the DWARF
+// debugging information.
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+)
+
+// The maximum depth of nested DWARF entries searched when looking for the
+// functions containing an address.
+const maxScopeDepth = 256
+
+// The maximum number of abstract origin or specification references followed
+// when looking up a function's name.
+const maxNameReferences = 8
+
+// Holds the source location of an address within a single function. If the
+// function was inlined, there will be a separate frame for each function it
+// was inlined into.
+type SourceFrame struct {
+	// The name of the function, or an empty string if it's unknown.
+	Function string
+	// The path to the source file, or an empty string if it's unknown.
+	File string
+	// The line and column numbers, or 0 if they're unknown.
+	Line   int
+	Column int
+}
+
+func (f *SourceFrame) String() string {
+	function := f.Function
+	if function == "" {
+		function = "??"
+	}
+	if f.File == "" {
+		return function + " at ??:?"
+	}
+	if f.Column == 0 {
+		return fmt.Sprintf("%s at %s:%d", function, f.File, f.Line)
+	}
+	return fmt.Sprintf("%s at %s:%d:%d", function, f.File, f.Line, f.Column)
+}
+
+// Holds the address range of a single compilation unit.
+type unitRange struct {
+	start, end uint64
+	unit       *dwarf.Entry
+}
+
+// Used to look up the source locations of addresses. Its methods may not be
+// called concurrently.
+type LineResolver struct {
+	data *dwarf.Data
+	// The address ranges of every compilation unit, sorted by start address.
+	ranges []unitRange
+	// Holds the line table reader for each compilation unit that has been
+	// looked up so far, keyed by the unit's offset.
+	lineReaders map[dwarf.Offset]*dwarf.LineReader
+}
+
+// Returns a LineResolver for the given DWARF information, e.g. as returned by
+// LoadSplitDWARF.
+func NewDWARFLineResolver(d *dwarf.Data) (*LineResolver, error) {
+	toReturn := &LineResolver{
+		data:        d,
+		lineReaders: make(map[dwarf.Offset]*dwarf.LineReader),
+	}
+	reader := d.Reader()
+	for {
+		entry, e := reader.Next()
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading compilation units: %w", e)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Children {
+			reader.SkipChildren()
+		}
+		if (entry.Tag != dwarf.TagCompileUnit) &&
+			(entry.Tag != dwarf.TagSkeletonUnit) {
+			continue
+		}
+		ranges, e := d.Ranges(entry)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading compilation unit ranges: "+
+				"%w", e)
+		}
+		for _, r := range ranges {
+			if r[1] <= r[0] {
+				continue
+			}
+			toReturn.ranges = append(toReturn.ranges, unitRange{
+				start: r[0],
+				end:   r[1],
+				unit:  entry,
+			})
+		}
+	}
+	sort.SliceStable(toReturn.ranges, func(a, b int) bool {
+		return toReturn.ranges[a].start < toReturn.ranges[b].start
+	})
+	return toReturn, nil
+}
+
+// Returns a LineResolver for the file's DWARF information.
+func NewLineResolver(f ELFFile) (*LineResolver, error) {
+	d, e := loadDWARF(f)
+	if e != nil {
+		return nil, e
+	}
+	return NewDWARFLineResolver(d)
+}
+
+// Returns the compilation unit containing the address, or nil if there isn't
+// one.
+func (r *LineResolver) findUnit(address uint64) *dwarf.Entry {
+	// Find the first range starting after the address, then search backwards
+	// in case any ranges overlap.
+	i := sort.Search(len(r.ranges), func(i int) bool {
+		return r.ranges[i].start > address
+	})
+	for i--; i >= 0; i-- {
+		if address < r.ranges[i].end {
+			return r.ranges[i].unit
+		}
+	}
+	return nil
+}
+
+// Returns the line table reader for the compilation unit, or nil if it
+// doesn't have a line table.
+func (r *LineResolver) lineReader(unit *dwarf.Entry) (*dwarf.LineReader,
+	error) {
+	toReturn, ok := r.lineReaders[unit.Offset]
+	if ok {
+		return toReturn, nil
+	}
+	toReturn, e := r.data.LineReader(unit)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading line table: %w", e)
+	}
+	r.lineReaders[unit.Offset] = toReturn
+	return toReturn, nil
+}
+
+// Returns true if any of the given ranges contain the address.
+func rangesContain(ranges [][2]uint64, address uint64) bool {
+	for _, r := range ranges {
+		if (address >= r[0]) && (address < r[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads the children of the current DWARF entry, appending the subprogram and
+// inlined subroutine entries containing the address to scopes, from the
+// outermost to the innermost. Returns true if an entry containing the address
+// was found.
+func (r *LineResolver) findScopes(reader *dwarf.Reader, address uint64,
+	scopes []*dwarf.Entry, depth int) ([]*dwarf.Entry, bool, error) {
+	if depth > maxScopeDepth {
+		return scopes, false, fmt.Errorf("DWARF entries are nested more "+
+			"than %d levels deep", maxScopeDepth)
+	}
+	for {
+		entry, e := reader.Next()
+		if e != nil {
+			return scopes, false, e
+		}
+		if (entry == nil) || (entry.Tag == 0) {
+			return scopes, false, nil
+		}
+		// Entries that don't have addresses themselves, such as namespaces
+		// or lexical blocks without code, may still contain functions.
+		container := false
+		switch entry.Tag {
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine,
+			dwarf.TagLexDwarfBlock:
+			ranges, e := r.data.Ranges(entry)
+			if (e == nil) && rangesContain(ranges, address) {
+				if entry.Tag != dwarf.TagLexDwarfBlock {
+					scopes = append(scopes, entry)
+				}
+				if entry.Children {
+					scopes, _, e = r.findScopes(reader, address, scopes,
+						depth+1)
+				}
+				return scopes, true, e
+			}
+			container = (entry.Tag == dwarf.TagLexDwarfBlock) &&
+				(len(ranges) == 0)
+		case dwarf.TagNamespace, dwarf.TagModule, dwarf.TagClassType,
+			dwarf.TagStructType, dwarf.TagUnionType:
+			container = true
+		}
+		if !entry.Children {
+			continue
+		}
+		if !container {
+			reader.SkipChildren()
+			continue
+		}
+		var found bool
+		scopes, found, e = r.findScopes(reader, address, scopes, depth+1)
+		if found || (e != nil) {
+			return scopes, found, e
+		}
+	}
+}
+
+// Returns the name of the function described by the entry, following its
+// abstract origin or specification if needed. Returns an empty string if the
+// name can't be found.
+func (r *LineResolver) functionName(entry *dwarf.Entry) string {
+	for i := 0; i < maxNameReferences; i++ {
+		name, ok := entry.Val(dwarf.AttrName).(string)
+		if ok {
+			return name
+		}
+		offset, ok := entry.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			offset, ok = entry.Val(dwarf.AttrSpecification).(dwarf.Offset)
+		}
+		if !ok {
+			break
+		}
+		reader := r.data.Reader()
+		reader.Seek(offset)
+		entry, _ = reader.Next()
+		if entry == nil {
+			break
+		}
+	}
+	return ""
+}
+
+// Returns the name of the given file in the line table, or an empty string if
+// the index is invalid.
+func lineTableFile(lines *dwarf.LineReader, index int64) string {
+	if lines == nil {
+		return ""
+	}
+	files := lines.Files()
+	if (index < 0) || (index >= int64(len(files))) || (files[index] == nil) {
+		return ""
+	}
+	return files[index].Name
+}
+
+// Returns the source location of the given address. If the address is in a
+// function that was inlined, the frame for the inlined function comes first,
+// followed by the frame for each function it was inlined into, in the same
+// order as addr2line -i. The address must be a virtual address in the file,
+// so the load address of a position-independent executable or shared library
+// must be subtracted first.
+func (r *LineResolver) LineFor(address uint64) ([]SourceFrame, error) {
+	unit := r.findUnit(address)
+	if unit == nil {
+		return nil, fmt.Errorf("Address 0x%x isn't in any compilation "+
+			"unit: %w", address, dwarf.ErrUnknownPC)
+	}
+	lines, e := r.lineReader(unit)
+	if e != nil {
+		return nil, e
+	}
+	var location SourceFrame
+	if lines != nil {
+		var entry dwarf.LineEntry
+		e = lines.SeekPC(address, &entry)
+		if e == nil {
+			if entry.File != nil {
+				location.File = entry.File.Name
+			}
+			location.Line = entry.Line
+			location.Column = entry.Column
+		} else if e != dwarf.ErrUnknownPC {
+			return nil, fmt.Errorf("Failed reading line table: %w", e)
+		}
+	}
+	reader := r.data.Reader()
+	reader.Seek(unit.Offset)
+	_, e = reader.Next()
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading compilation unit: %w", e)
+	}
+	var scopes []*dwarf.Entry
+	if unit.Children {
+		scopes, _, e = r.findScopes(reader, address, nil, 0)
+		if e != nil {
+			return nil, fmt.Errorf("Failed finding the function containing "+
+				"0x%x: %w", address, e)
+		}
+	}
+	if len(scopes) == 0 {
+		return []SourceFrame{location}, nil
+	}
+	toReturn := make([]SourceFrame, 0, len(scopes))
+	for i := len(scopes) - 1; i >= 0; i-- {
+		location.Function = r.functionName(scopes[i])
+		toReturn = append(toReturn, location)
+		if scopes[i].Tag != dwarf.TagInlinedSubroutine {
+			continue
+		}
+		// The next frame's location is where this function was inlined.
+		file, _ := scopes[i].Val(dwarf.AttrCallFile).(int64)
+		line, _ := scopes[i].Val(dwarf.AttrCallLine).(int64)
+		column, _ := scopes[i].Val(dwarf.AttrCallColumn).(int64)
+		location = SourceFrame{
+			File:   lineTableFile(lines, file),
+			Line:   int(line),
+			Column: int(column),
+		}
+	}
+	return toReturn, nil
+}
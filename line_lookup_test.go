@@ -0,0 +1,63 @@
+package elf_reader
+
+import (
+	"debug/dwarf"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineFor(t *testing.T) {
+	f := parseTestELF64("test_data/hello_debug_amd64", t)
+	resolver, e := NewLineResolver(f)
+	if e != nil {
+		t.Fatalf("Failed creating line resolver: %s\n", e)
+	}
+	// These match the output of addr2line -f -i.
+	tests := []struct {
+		address   uint64
+		functions []string
+		lines     []int
+	}{
+		{0x1149, []string{"checksum"}, []int{21}},
+		{0x115c, []string{"scale", "checksum"}, []int{16, 22}},
+		{0x1161, []string{"checksum"}, []int{22}},
+		{0x1168, []string{"checksum"}, []int{23}},
+		{0x1184, []string{"main"}, []int{30}},
+		{0x11af, []string{"main"}, []int{33}},
+	}
+	for _, test := range tests {
+		frames, e := resolver.LineFor(test.address)
+		if e != nil {
+			t.Errorf("Failed looking up 0x%x: %s\n", test.address, e)
+			continue
+		}
+		t.Logf("0x%x: %v\n", test.address, frames)
+		if len(frames) != len(test.functions) {
+			t.Errorf("Expected %d frames for 0x%x, got %d\n",
+				len(test.functions), test.address, len(frames))
+			continue
+		}
+		for i := range frames {
+			if (frames[i].Function != test.functions[i]) ||
+				(frames[i].Line != test.lines[i]) ||
+				(filepath.Base(frames[i].File) != "hello.c") {
+				t.Errorf("Expected %s at hello.c:%d for 0x%x, got %s\n",
+					test.functions[i], test.lines[i], test.address,
+					&(frames[i]))
+			}
+		}
+	}
+	// The inlined call to scale is at column 12 of line 22.
+	frames, _ := resolver.LineFor(0x115c)
+	if (len(frames) == 2) && (frames[1].Column != 12) {
+		t.Errorf("Expected the call to scale at column 12, got %d\n",
+			frames[1].Column)
+	}
+
+	// _init isn't in any compilation unit.
+	_, e = resolver.LineFor(0x1000)
+	if !errors.Is(e, dwarf.ErrUnknownPC) {
+		t.Errorf("Expected an unknown PC error, got %v\n", e)
+	}
+}
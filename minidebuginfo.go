@@ -0,0 +1,49 @@
+package elf_reader
+
+// This file contains code for reading MiniDebugInfo: a small ELF file
+// containing a symbol table, compressed using xz and embedded in the
+// .gnu_debugdata section of a stripped file.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// The largest decompressed MiniDebugInfo file that will be read, in bytes.
+const maxMiniDebugInfoSize = 256 * 1024 * 1024
+
+// Returns true if the file contains a .gnu_debugdata section.
+func HasMiniDebugInfo(f ELFFile) bool {
+	_, e := FindSectionByName(f, ".gnu_debugdata")
+	return e == nil
+}
+
+// Decompresses and parses the ELF file in the .gnu_debugdata section. Its
+// allocated sections have the same indices and addresses as those in f, but
+// most of them are NOBITS sections, so it's mainly useful for its .symtab
+// section. Returns an error if f doesn't have a .gnu_debugdata section.
+func GetMiniDebugInfo(f ELFFile) (ELFFile, error) {
+	content, e := namedSectionContent(f, ".gnu_debugdata")
+	if e != nil {
+		return nil, e
+	}
+	r, e := NewXZReader(bytes.NewReader(content))
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading .gnu_debugdata: %w", e)
+	}
+	raw, e := io.ReadAll(io.LimitReader(r, maxMiniDebugInfoSize+1))
+	if e != nil {
+		return nil, fmt.Errorf("Failed decompressing .gnu_debugdata: %w", e)
+	}
+	if len(raw) > maxMiniDebugInfoSize {
+		return nil, fmt.Errorf("The decompressed .gnu_debugdata is larger "+
+			"than %d bytes: %w", maxMiniDebugInfoSize, ErrLimitExceeded)
+	}
+	toReturn, e := ParseELFFile(raw)
+	if e != nil {
+		return nil, fmt.Errorf("Failed parsing the ELF file in "+
+			".gnu_debugdata: %w", e)
+	}
+	return toReturn, nil
+}
@@ -0,0 +1,67 @@
+package elf_reader
+
+import (
+	"testing"
+)
+
+func TestMiniDebugInfo(t *testing.T) {
+	f := parseTestELF64("test_data/hello_minidebug_amd64", t)
+	if !HasMiniDebugInfo(f) {
+		t.Fatalf("Didn't detect the MiniDebugInfo\n")
+	}
+	_, e := FindSectionByName(f, ".symtab")
+	if e == nil {
+		t.Errorf("The test file should be stripped\n")
+	}
+	mini, e := GetMiniDebugInfo(f)
+	if e != nil {
+		t.Fatalf("Failed reading MiniDebugInfo: %s\n", e)
+	}
+	// The symbols' section indices should refer to the outer file's
+	// sections.
+	index := testSectionIndex(mini, ".text", t)
+	if testSectionIndex(f, ".text", t) != index {
+		t.Errorf("The MiniDebugInfo's .text section is at a different " +
+			"index\n")
+	}
+	// The MiniDebugInfo contains the functions that aren't in .dynsym,
+	// including local functions.
+	if testSymbolValue(mini, "frame_dummy", t) != 0x1140 {
+		t.Errorf("Incorrect address for frame_dummy\n")
+	}
+	if testSymbolValue(mini, "checksum", t) != 0x1149 {
+		t.Errorf("Incorrect address for checksum\n")
+	}
+
+	f = parseTestELF64("test_data/sleep_amd64", t)
+	if HasMiniDebugInfo(f) {
+		t.Errorf("Incorrectly detected MiniDebugInfo in sleep_amd64\n")
+	}
+	_, e = GetMiniDebugInfo(f)
+	if e == nil {
+		t.Errorf("Didn't get an error for a file without MiniDebugInfo\n")
+	}
+
+	raw := fileBytes("test_data/hello_minidebug_amd64", t)
+	f2 := replaceSectionContent(raw, ".gnu_debugdata", []byte("not xz"))
+	_, e = GetMiniDebugInfo(f2)
+	if e == nil {
+		t.Errorf("Didn't get an error for invalid MiniDebugInfo\n")
+	}
+	// The lookup must still be created from the other tables, with the
+	// invalid MiniDebugInfo reported as a warning.
+	lookup, e := NewSymbolLookup(f2)
+	if e != nil {
+		t.Fatalf("Failed creating symbol lookup with invalid "+
+			"MiniDebugInfo: %s\n", e)
+	}
+	if len(lookup.Warnings()) != 1 {
+		t.Errorf("Expected 1 warning for invalid MiniDebugInfo, got %d\n",
+			len(lookup.Warnings()))
+	} else {
+		t.Logf("Got expected warning: %s\n", lookup.Warnings()[0])
+	}
+	if len(lookup.Find("checksum")) != 0 {
+		t.Errorf("Found a MiniDebugInfo symbol in invalid MiniDebugInfo\n")
+	}
+}
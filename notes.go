@@ -0,0 +1,336 @@
+package elf_reader
+
+// This file contains code for parsing the content of note sections and
+// segments.
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Note types used in notes with the name "GNU".
+const (
+	GNUNoteABITag        = 1
+	GNUNoteHardwareCaps  = 2
+	GNUNoteBuildID       = 3
+	GNUNoteGoldVersion   = 4
+	GNUNotePropertyType0 = 5
+)
+
+// Holds a single entry from a note section or segment.
+type ELFNote struct {
+	// The name of the note's owner, without the terminating null byte.
+	Name string
+	// The note type. The meaning of this depends on the owner's name.
+	Type uint32
+	// The content of the note.
+	Description []byte
+}
+
+func (n *ELFNote) String() string {
+	return fmt.Sprintf("%s note, type %d, %d bytes of data", n.Name, n.Type,
+		len(n.Description))
+}
+
+// Returns the given value rounded up to the given alignment.
+func alignUp(value, alignment uint64) uint64 {
+	if alignment <= 1 {
+		return value
+	}
+	remainder := value % alignment
+	if remainder == 0 {
+		return value
+	}
+	return value + (alignment - remainder)
+}
+
+// Returns the alignment used for note entries in a note section or segment
+// with the given alignment. Notes are 4-byte aligned unless the section or
+// segment is 8-byte aligned, e.g. for GNU property notes in 64-bit files.
+func noteAlignment(alignment uint64) uint64 {
+	if alignment == 8 {
+		return 8
+	}
+	return 4
+}
+
+// Parses the notes in the given content of a note section or segment. The
+// alignment should be the alignment of the section or segment.
+func ParseNotes(content []byte, endianness binary.ByteOrder,
+	alignment uint64) ([]ELFNote, error) {
+	alignment = noteAlignment(alignment)
+	var toReturn []ELFNote
+	offset := uint64(0)
+	size := uint64(len(content))
+	for offset < size {
+		if (size - offset) < 12 {
+			return nil, fmt.Errorf("%w: note header at offset %d",
+				ErrTruncated, offset)
+		}
+		nameSize := uint64(endianness.Uint32(content[offset:]))
+		descriptionSize := uint64(endianness.Uint32(content[offset+4:]))
+		noteType := endianness.Uint32(content[offset+8:])
+		offset += 12
+		if nameSize > (size - offset) {
+			return nil, fmt.Errorf("%w: note name at offset %d extends past "+
+				"the end of the notes", ErrTruncated, offset)
+		}
+		name := content[offset : offset+nameSize]
+		// The name size includes the null terminator.
+		if (len(name) != 0) && (name[len(name)-1] == 0) {
+			name = name[:len(name)-1]
+		}
+		offset = alignUp(offset+nameSize, alignment)
+		if (offset > size) || (descriptionSize > (size - offset)) {
+			return nil, fmt.Errorf("%w: note description extends past the "+
+				"end of the notes (note %d)", ErrTruncated, len(toReturn))
+		}
+		description := content[offset : offset+descriptionSize]
+		offset = alignUp(offset+descriptionSize, alignment)
+		toReturn = append(toReturn, ELFNote{
+			Name:        string(name),
+			Type:        noteType,
+			Description: description,
+		})
+	}
+	return toReturn, nil
+}
+
+// Returns the binary representation of the given notes, using the given
+// alignment, which should match the alignment of the section or segment that
+// will contain them.
+func EncodeNotes(notes []ELFNote, endianness binary.ByteOrder,
+	alignment uint64) []byte {
+	alignment = noteAlignment(alignment)
+	var toReturn []byte
+	var header [12]byte
+	for _, n := range notes {
+		nameSize := uint32(len(n.Name) + 1)
+		endianness.PutUint32(header[0:], nameSize)
+		endianness.PutUint32(header[4:], uint32(len(n.Description)))
+		endianness.PutUint32(header[8:], n.Type)
+		toReturn = append(toReturn, header[:]...)
+		toReturn = append(toReturn, []byte(n.Name)...)
+		toReturn = append(toReturn, 0)
+		for uint64(len(toReturn)) != alignUp(uint64(len(toReturn)),
+			alignment) {
+			toReturn = append(toReturn, 0)
+		}
+		toReturn = append(toReturn, n.Description...)
+		for uint64(len(toReturn)) != alignUp(uint64(len(toReturn)),
+			alignment) {
+			toReturn = append(toReturn, 0)
+		}
+	}
+	return toReturn
+}
+
+// Returns true if the section at the given index is a note section.
+func (f *ELF64File) IsNoteSection(sectionIndex uint16) bool {
+	if int(sectionIndex) >= len(f.Sections) {
+		return false
+	}
+	return f.Sections[sectionIndex].Type == NoteSection
+}
+
+// Returns true if the section at the given index is a note section.
+func (f *ELF32File) IsNoteSection(sectionIndex uint16) bool {
+	if int(sectionIndex) >= len(f.Sections) {
+		return false
+	}
+	return f.Sections[sectionIndex].Type == NoteSection
+}
+
+// Parses and returns the notes in the note section at the given index.
+func (f *ELF64File) GetNotes(sectionIndex uint16) ([]ELFNote, error) {
+	if !f.IsNoteSection(sectionIndex) {
+		return nil, fmt.Errorf("Section %d is not a note section",
+			sectionIndex)
+	}
+	content, e := f.GetSectionContent(sectionIndex)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading note section: %w", e)
+	}
+	notes, e := ParseNotes(content, f.Endianness,
+		f.Sections[sectionIndex].Align)
+	if e != nil {
+		return nil, sectionError(f, sectionIndex, "note section", 0, e)
+	}
+	return notes, nil
+}
+
+// Parses and returns the notes in the note section at the given index.
+func (f *ELF32File) GetNotes(sectionIndex uint16) ([]ELFNote, error) {
+	if !f.IsNoteSection(sectionIndex) {
+		return nil, fmt.Errorf("Section %d is not a note section",
+			sectionIndex)
+	}
+	content, e := f.GetSectionContent(sectionIndex)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading note section: %w", e)
+	}
+	notes, e := ParseNotes(content, f.Endianness,
+		uint64(f.Sections[sectionIndex].Align))
+	if e != nil {
+		return nil, sectionError(f, sectionIndex, "note section", 0, e)
+	}
+	return notes, nil
+}
+
+// Returns true if the section at the given index in the file is a note
+// section.
+func isNoteSection(f ELFFile, sectionIndex uint16) bool {
+	header, e := f.GetSectionHeader(sectionIndex)
+	if e != nil {
+		return false
+	}
+	return header.GetType() == NoteSection
+}
+
+// Parses and returns the notes in the note section at the given index in
+// either an *ELF32File or *ELF64File.
+func getNotes(f ELFFile, sectionIndex uint16) ([]ELFNote, error) {
+	switch v := f.(type) {
+	case *ELF64File:
+		return v.GetNotes(sectionIndex)
+	case *ELF32File:
+		return v.GetNotes(sectionIndex)
+	}
+	return nil, fmt.Errorf("Unsupported ELF file type: %T", f)
+}
+
+// Returns all notes in the given file. Notes are read from note sections if
+// the file has any, otherwise they're read from note segments, so this works
+// for files without section headers.
+func getAllNotes(f ELFFile) []ELFNote {
+	var toReturn []ELFNote
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		if !isNoteSection(f, i) {
+			continue
+		}
+		notes, e := getNotes(f, i)
+		if e != nil {
+			continue
+		}
+		toReturn = append(toReturn, notes...)
+	}
+	if len(toReturn) != 0 {
+		return toReturn
+	}
+	for i := uint16(0); i < f.GetSegmentCount(); i++ {
+		header, e := f.GetProgramHeader(i)
+		if (e != nil) || (header.GetType() != NoteSegment) {
+			continue
+		}
+		content, e := f.GetSegmentContent(i)
+		if e != nil {
+			continue
+		}
+		notes, e := ParseNotes(content, fileEndianness(f),
+			header.GetAlignment())
+		if e != nil {
+			continue
+		}
+		toReturn = append(toReturn, notes...)
+	}
+	return toReturn
+}
+
+// Returns the build ID from the GNU build ID note in the given file. Returns
+// an error if no build ID is found.
+func GetBuildID(f ELFFile) ([]byte, error) {
+	for _, n := range getAllNotes(f) {
+		if (n.Name == "GNU") && (n.Type == GNUNoteBuildID) {
+			return n.Description, nil
+		}
+	}
+	return nil, fmt.Errorf("The file doesn't contain a build ID")
+}
+
+// Property types found in GNU property notes.
+const (
+	GNUPropertyStackSize         = 1
+	GNUPropertyNoCopyOnProtected = 2
+	GNUPropertyAArch64Feature1   = 0xc0000000
+	GNUPropertyX86Feature1       = 0xc0000002
+	GNUPropertyX86ISA1Needed     = 0xc0008002
+	GNUPropertyX86ISA1Used       = 0xc0010002
+)
+
+// Bits in the GNUPropertyX86Feature1 property.
+const (
+	GNUPropertyX86FeatureIBT   = 1
+	GNUPropertyX86FeatureSHSTK = 2
+)
+
+// Bits in the GNUPropertyAArch64Feature1 property.
+const (
+	GNUPropertyAArch64FeatureBTI = 1
+	GNUPropertyAArch64FeaturePAC = 2
+	GNUPropertyAArch64FeatureGCS = 4
+)
+
+// Bits in the GNUPropertyX86ISA1Needed and GNUPropertyX86ISA1Used
+// properties, one for each x86-64 microarchitecture level.
+const (
+	GNUPropertyX86ISA1Baseline = 1
+	GNUPropertyX86ISA1V2       = 2
+	GNUPropertyX86ISA1V3       = 4
+	GNUPropertyX86ISA1V4       = 8
+)
+
+// Holds a single property from a GNU property note.
+type GNUProperty struct {
+	Type uint32
+	Data []byte
+}
+
+// Parses the description of a GNU property note (a "GNU" note with type
+// GNUNotePropertyType0). Properties are padded to 8 bytes in 64-bit files
+// and 4 bytes in 32-bit files.
+func ParseGNUProperties(description []byte, endianness binary.ByteOrder,
+	is64 bool) ([]GNUProperty, error) {
+	alignment := uint64(4)
+	if is64 {
+		alignment = 8
+	}
+	var toReturn []GNUProperty
+	offset := uint64(0)
+	size := uint64(len(description))
+	for offset < size {
+		if (size - offset) < 8 {
+			return nil, fmt.Errorf("%w: GNU property at offset %d",
+				ErrTruncated, offset)
+		}
+		propertyType := endianness.Uint32(description[offset:])
+		dataSize := uint64(endianness.Uint32(description[offset+4:]))
+		offset += 8
+		if dataSize > (size - offset) {
+			return nil, fmt.Errorf("%w: GNU property %d's data extends past "+
+				"the end of the note", ErrTruncated, len(toReturn))
+		}
+		toReturn = append(toReturn, GNUProperty{
+			Type: propertyType,
+			Data: description[offset : offset+dataSize],
+		})
+		offset = alignUp(offset+dataSize, alignment)
+	}
+	return toReturn, nil
+}
+
+// Returns all GNU properties in the file's notes.
+func GetGNUProperties(f ELFFile) ([]GNUProperty, error) {
+	var toReturn []GNUProperty
+	for _, n := range getAllNotes(f) {
+		if (n.Name != "GNU") || (n.Type != GNUNotePropertyType0) {
+			continue
+		}
+		properties, e := ParseGNUProperties(n.Description, fileEndianness(f),
+			is64Bit(f))
+		if e != nil {
+			return nil, e
+		}
+		toReturn = append(toReturn, properties...)
+	}
+	return toReturn, nil
+}
@@ -0,0 +1,68 @@
+package elf_reader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestGetNotes(t *testing.T) {
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	index, e := FindSectionByName(f, ".note.gnu.build-id")
+	if e != nil {
+		t.Fatalf("Couldn't find the build ID section: %s\n", e)
+	}
+	if !f.IsNoteSection(index) {
+		t.Fatalf("The build ID section wasn't a note section\n")
+	}
+	notes, e := f.GetNotes(index)
+	if e != nil {
+		t.Fatalf("Failed parsing build ID notes: %s\n", e)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("Expected 1 build ID note, got %d\n", len(notes))
+	}
+	n := &(notes[0])
+	t.Logf("Got note: %s\n", n)
+	if (n.Name != "GNU") || (n.Type != GNUNoteBuildID) {
+		t.Errorf("Incorrect build ID note name or type\n")
+	}
+	if len(n.Description) != 20 {
+		t.Errorf("Expected a 20-byte build ID, got %d bytes\n",
+			len(n.Description))
+	}
+	_, e = f.GetNotes(0)
+	if e == nil {
+		t.Errorf("Didn't get an error parsing notes in section 0\n")
+	}
+}
+
+func TestEncodeNotes(t *testing.T) {
+	notes := []ELFNote{
+		ELFNote{Name: "GNU", Type: GNUNoteABITag,
+			Description: []byte{0, 0, 0, 0, 3, 0, 0, 0}},
+		ELFNote{Name: "Go", Type: 4, Description: []byte{1, 2, 3}},
+	}
+	encoded := EncodeNotes(notes, binary.BigEndian, 4)
+	if (len(encoded) % 4) != 0 {
+		t.Errorf("Encoded notes weren't 4-byte aligned\n")
+	}
+	decoded, e := ParseNotes(encoded, binary.BigEndian, 4)
+	if e != nil {
+		t.Fatalf("Failed parsing encoded notes: %s\n", e)
+	}
+	if len(decoded) != len(notes) {
+		t.Fatalf("Expected %d notes, got %d\n", len(notes), len(decoded))
+	}
+	for i := range notes {
+		if (decoded[i].Name != notes[i].Name) ||
+			(decoded[i].Type != notes[i].Type) ||
+			!bytes.Equal(decoded[i].Description, notes[i].Description) {
+			t.Errorf("Note %d changed after encoding\n", i)
+		}
+	}
+	_, e = ParseNotes(encoded[:len(encoded)-4], binary.BigEndian, 4)
+	if e == nil {
+		t.Errorf("Didn't get an error for truncated notes\n")
+	}
+}
@@ -0,0 +1,184 @@
+package elf_reader
+
+// This file contains the options that control how ELF files are parsed,
+// including a lenient mode for salvaging what can be read from damaged
+// files.
+
+import (
+	"fmt"
+)
+
+// Controls how ParseELFFileWithOptions parses a file. A nil *ParseOptions, or
+// the zero value, parses files strictly and without resource limits other
+// than those implied by the file's size.
+type ParseOptions struct {
+	// If true, recoverable problems are recorded as warnings, available from
+	// the file's GetWarnings method, rather than causing parsing to fail. For
+	// example, if the section header table is truncated, only the section
+	// headers that fit in the file are kept, and if the section names table
+	// can't be read, GetSectionName returns placeholder names. When header
+	// tables are truncated, the entry counts in the file's Header are reduced
+	// to the number of entries that were kept.
+	Lenient bool
+	// The maximum number of section headers to parse. 0 means no limit. In
+	// lenient mode, the remaining sections are ignored.
+	MaxSections int
+	// The maximum number of program headers to parse. 0 means no limit. In
+	// lenient mode, the remaining segments are ignored.
+	MaxSegments int
+	// The maximum number of symbols GetSymbols will return from a single
+	// symbol table. 0 means no limit.
+	MaxSymbols int
+	// The maximum number of bytes to allocate for the entries of a single
+	// header table, symbol table, relocation table or dynamic table. 0 means
+	// no limit.
+	MaxAllocation uint64
+}
+
+func (o *ParseOptions) isLenient() bool {
+	return (o != nil) && o.Lenient
+}
+
+func (o *ParseOptions) maxSections() int {
+	if o == nil {
+		return 0
+	}
+	return o.MaxSections
+}
+
+func (o *ParseOptions) maxSegments() int {
+	if o == nil {
+		return 0
+	}
+	return o.MaxSegments
+}
+
+// In lenient mode, appends the problem to the warnings and returns nil.
+// Otherwise, returns the problem unchanged.
+func (o *ParseOptions) tolerate(warnings *[]error, problem error) error {
+	if !o.isLenient() {
+		return problem
+	}
+	*warnings = append(*warnings, problem)
+	return nil
+}
+
+// Returns an error if a table of count entries of the given size is larger
+// than the allocation limit.
+func (o *ParseOptions) checkAllocation(count, entrySize uint64) error {
+	if (o == nil) || (o.MaxAllocation == 0) || (entrySize == 0) {
+		return nil
+	}
+	if count > (o.MaxAllocation / entrySize) {
+		return fmt.Errorf("%w: %d %d-byte entries exceed the %d-byte "+
+			"allocation limit", ErrLimitExceeded, count, entrySize,
+			o.MaxAllocation)
+	}
+	return nil
+}
+
+// Returns an error if a symbol table with the given number of entries
+// exceeds the limits.
+func (o *ParseOptions) checkSymbolCount(count, entrySize uint64) error {
+	if (o != nil) && (o.MaxSymbols > 0) && (count > uint64(o.MaxSymbols)) {
+		return fmt.Errorf("%w: %d symbols is more than the limit of %d",
+			ErrLimitExceeded, count, o.MaxSymbols)
+	}
+	return o.checkAllocation(count, entrySize)
+}
+
+// Returns the number of entries to parse from a header table with the given
+// offset and number of entries, checking that they fit in the file and are
+// within the limits. The limit is the maximum number of entries, or 0 for no
+// limit. In lenient mode, problems are appended to the warnings and a
+// smaller number of entries is returned.
+func (o *ParseOptions) getHeaderTableCount(warnings *[]error,
+	structure string, offset, count, entrySize, fileSize uint64,
+	limit int) (uint64, error) {
+	if count == 0 {
+		return 0, nil
+	}
+	if (limit > 0) && (count > uint64(limit)) {
+		e := o.tolerate(warnings, headerError(structure, offset,
+			fmt.Errorf("%w: %d entries is more than the limit of %d",
+				ErrLimitExceeded, count, limit)))
+		if e != nil {
+			return 0, e
+		}
+		count = uint64(limit)
+	}
+	e := o.checkAllocation(count, entrySize)
+	if e != nil {
+		e = o.tolerate(warnings, headerError(structure, offset, e))
+		if e != nil {
+			return 0, e
+		}
+		count = o.MaxAllocation / entrySize
+	}
+	e = checkTableBounds(offset, count, entrySize, fileSize)
+	if e != nil {
+		e = o.tolerate(warnings, headerError(structure, offset, e))
+		if e != nil {
+			return 0, e
+		}
+		// Keep the entries that fit in the file.
+		count = 0
+		if offset < fileSize {
+			count = (fileSize - offset) / entrySize
+		}
+	}
+	return count, nil
+}
+
+// Checks that the section names table and the content of each section can
+// be read, recording warnings for any that can't. Only used in lenient mode,
+// since these problems don't prevent the rest of the file from being used.
+func checkLenientSections(f ELFFile, warnings *[]error) {
+	namesTable := getFileLayout(f).SectionNamesTable
+	if (f.GetSectionCount() != 0) && (namesTable >= f.GetSectionCount()) {
+		*warnings = append(*warnings, &InvalidIndexError{
+			"section names table", uint64(namesTable)})
+	}
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		header, e := f.GetSectionHeader(i)
+		if e != nil {
+			continue
+		}
+		if (header.GetType() == UninitializedSection) ||
+			(header.GetType() == NullSection) {
+			continue
+		}
+		_, e = f.GetSectionContent(i)
+		if e != nil {
+			*warnings = append(*warnings, e)
+		}
+	}
+}
+
+// Returns the placeholder name used for sections whose names can't be read
+// in lenient mode.
+func placeholderSectionName(index uint16) string {
+	return fmt.Sprintf("<section %d>", index)
+}
+
+// Parses an ELF file using the given options, which may be nil. See the
+// ParseOptions documentation for details.
+func ParseELFFileWithOptions(raw []byte, options *ParseOptions) (ELFFile,
+	error) {
+	e := checkELFIdentity(raw)
+	if e != nil {
+		return nil, e
+	}
+	if raw[4] == 2 {
+		f, e := parseELF64File(raw, options)
+		if e != nil {
+			return nil, e
+		}
+		return f, nil
+	}
+	f, e := parseELF32File(raw, options)
+	if e != nil {
+		return nil, e
+	}
+	return f, nil
+}
@@ -0,0 +1,111 @@
+package elf_reader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLenientParsing(t *testing.T) {
+	raw := fileBytes("test_data/sleep_amd64", t)
+	original := parseTestELF64("test_data/sleep_amd64", t)
+	options := &ParseOptions{
+		Lenient: true,
+	}
+
+	// Truncate the file partway through the section header table. Strict
+	// parsing should fail, but lenient parsing should keep the program
+	// headers and the section headers that fit.
+	truncated := raw[:original.Header.SectionHeaderOffset+64*10+20]
+	_, e := ParseELFFile(truncated)
+	if !errors.Is(e, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated from strict parsing, got %v\n", e)
+	}
+	f, e := ParseELFFileWithOptions(truncated, options)
+	if e != nil {
+		t.Fatalf("Lenient parsing failed: %s\n", e)
+	}
+	if f.GetSegmentCount() != original.GetSegmentCount() {
+		t.Errorf("Expected %d segments, got %d\n", original.GetSegmentCount(),
+			f.GetSegmentCount())
+	}
+	if f.GetSectionCount() != 10 {
+		t.Errorf("Expected 10 sections, got %d\n", f.GetSectionCount())
+	}
+	warnings := GetWarnings(f)
+	if len(warnings) == 0 {
+		t.Errorf("Didn't get any warnings for a truncated file\n")
+	}
+	for _, w := range warnings {
+		t.Logf("Got warning: %s\n", w)
+	}
+	// The .shstrtab section is past the truncated table, so the section
+	// names should be placeholders.
+	name, e := f.GetSectionName(1)
+	if e != nil {
+		t.Errorf("Failed getting placeholder section name: %s\n", e)
+	} else if name != "<section 1>" {
+		t.Errorf("Got incorrect placeholder section name: %s\n", name)
+	}
+	segment, e := f.GetSegmentContent(1)
+	if (e != nil) || (string(segment) != "/lib64/ld-linux-x86-64.so.2\x00") {
+		t.Errorf("Didn't get the interpreter segment: %q, %v\n", segment, e)
+	}
+
+	// Files without problems shouldn't have any warnings.
+	f, e = ParseELFFileWithOptions(raw, options)
+	if e != nil {
+		t.Fatalf("Lenient parsing of a valid file failed: %s\n", e)
+	}
+	if len(GetWarnings(f)) != 0 {
+		t.Errorf("Got unexpected warnings: %v\n", GetWarnings(f))
+	}
+	name, e = f.GetSectionName(1)
+	if (e != nil) || (name != ".interp") {
+		t.Errorf("Got incorrect section name %s, error %v\n", name, e)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	raw := fileBytes("test_data/sleep_amd64", t)
+	_, e := ParseELFFileWithOptions(raw, &ParseOptions{
+		MaxSections: 5,
+	})
+	if !errors.Is(e, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded for too many sections, got %v\n",
+			e)
+	}
+	f, e := ParseELFFileWithOptions(raw, &ParseOptions{
+		Lenient:     true,
+		MaxSections: 5,
+	})
+	if e != nil {
+		t.Fatalf("Lenient parsing with a section limit failed: %s\n", e)
+	}
+	if (f.GetSectionCount() != 5) || (len(GetWarnings(f)) == 0) {
+		t.Errorf("Expected 5 sections and a warning, got %d sections and "+
+			"warnings %v\n", f.GetSectionCount(), GetWarnings(f))
+	}
+	_, e = ParseELFFileWithOptions(raw, &ParseOptions{
+		MaxAllocation: 64,
+	})
+	if !errors.Is(e, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded for a large allocation, got %v\n",
+			e)
+	}
+
+	f, e = ParseELFFileWithOptions(raw, &ParseOptions{
+		MaxSymbols: 5,
+	})
+	if e != nil {
+		t.Fatalf("Failed parsing with a symbol limit: %s\n", e)
+	}
+	index := testSectionIndex(f, ".dynsym", t)
+	_, _, e = f.GetSymbols(index)
+	var malformed *MalformedTableError
+	if !errors.Is(e, ErrLimitExceeded) || !errors.As(e, &malformed) {
+		t.Errorf("Expected ErrLimitExceeded for too many symbols, got %v\n",
+			e)
+	} else {
+		t.Logf("Got expected error: %s\n", e)
+	}
+}
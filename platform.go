@@ -0,0 +1,242 @@
+package elf_reader
+
+// This file contains code for determining the oldest platform an ELF file can
+// run on, based on its symbol versions, notes and interpreter.
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// The prefixes of the symbol versions reported by GetPlatformRequirements.
+var platformVersionPrefixes = []string{"GLIBC_", "GLIBCXX_", "CXXABI_"}
+
+// Holds the highest version of a versioned library required by a file.
+type RequiredSymbolVersion struct {
+	// The full version name, e.g. "GLIBC_2.34".
+	Version string
+	// The library the version is required from, e.g. "libc.so.6".
+	File string
+}
+
+// Holds the minimum platform an ELF file requires.
+type PlatformRequirements struct {
+	// The path to the program interpreter (dynamic linker), if any.
+	Interpreter string `json:",omitempty"`
+	// The highest GLIBC_, GLIBCXX_ and CXXABI_ versions required, if any,
+	// in that order.
+	SymbolVersions []RequiredSymbolVersion `json:",omitempty"`
+	// The OS and minimum kernel version from the GNU ABI tag note, if the
+	// file has one, e.g. "Linux" and "3.2.0".
+	KernelOS      string `json:",omitempty"`
+	KernelVersion string `json:",omitempty"`
+	// The x86-64 microarchitecture level required, from 1 (the baseline) to
+	// 4, or 0 if the file doesn't say. This comes from the "ISA needed" GNU
+	// property, or the "ISA used" property if that's missing.
+	X86ISALevel int `json:",omitempty"`
+	// The AArch64 features marked in the GNU property notes, e.g. "BTI".
+	AArch64Features []string `json:",omitempty"`
+}
+
+// Returns the name of the x86-64 microarchitecture level, e.g.
+// "x86-64-v3", or an empty string if it's unknown.
+func (r *PlatformRequirements) X86ISALevelName() string {
+	switch r.X86ISALevel {
+	case 0:
+		return ""
+	case 1:
+		return "x86-64 baseline"
+	}
+	return fmt.Sprintf("x86-64-v%d", r.X86ISALevel)
+}
+
+func (r *PlatformRequirements) String() string {
+	var b strings.Builder
+	if r.Interpreter != "" {
+		fmt.Fprintf(&b, "Interpreter: %s\n", r.Interpreter)
+	}
+	for _, v := range r.SymbolVersions {
+		prefix, _, _ := parseSymbolVersion(v.Version)
+		fmt.Fprintf(&b, "Minimum %s: %s (from %s)\n",
+			strings.TrimSuffix(prefix, "_"), v.Version, v.File)
+	}
+	if r.KernelOS != "" {
+		fmt.Fprintf(&b, "Minimum kernel: %s %s\n", r.KernelOS,
+			r.KernelVersion)
+	}
+	if r.X86ISALevel != 0 {
+		fmt.Fprintf(&b, "x86 ISA level: %s\n", r.X86ISALevelName())
+	}
+	if len(r.AArch64Features) != 0 {
+		fmt.Fprintf(&b, "AArch64 features: %s\n",
+			strings.Join(r.AArch64Features, ", "))
+	}
+	if b.Len() == 0 {
+		return "No platform requirements found.\n"
+	}
+	return b.String()
+}
+
+// Returns the name of the OS in a GNU ABI tag note.
+func abiTagOSName(osType uint32) string {
+	switch osType {
+	case 0:
+		return "Linux"
+	case 1:
+		return "GNU/Hurd"
+	case 2:
+		return "Solaris"
+	case 3:
+		return "FreeBSD"
+	}
+	return fmt.Sprintf("unknown OS %d", osType)
+}
+
+// Sets the highest symbol versions required by the file.
+func (r *PlatformRequirements) readSymbolVersions(f ELFFile) error {
+	requirements, e := GetVersionRequirements(f)
+	if e != nil {
+		return fmt.Errorf("Failed reading version requirements: %w", e)
+	}
+	highest := make(map[string]RequiredSymbolVersion)
+	highestNumbers := make(map[string][]int)
+	for _, requirement := range requirements {
+		for _, v := range requirement.Versions {
+			// Versions without a number, like GLIBC_PRIVATE, are ignored.
+			prefix, numbers, e := parseSymbolVersion(v.Name)
+			if e != nil {
+				continue
+			}
+			current, ok := highestNumbers[prefix]
+			if ok && (compareVersionNumbers(numbers, current) <= 0) {
+				continue
+			}
+			highestNumbers[prefix] = numbers
+			highest[prefix] = RequiredSymbolVersion{
+				Version: v.Name,
+				File:    requirement.File,
+			}
+		}
+	}
+	for _, prefix := range platformVersionPrefixes {
+		if v, ok := highest[prefix]; ok {
+			r.SymbolVersions = append(r.SymbolVersions, v)
+		}
+	}
+	return nil
+}
+
+// Sets the kernel version from the file's GNU ABI tag note, if it has one.
+func (r *PlatformRequirements) readABITag(f ELFFile) {
+	order := fileEndianness(f)
+	for _, n := range getAllNotes(f) {
+		if (n.Name != "GNU") || (n.Type != GNUNoteABITag) ||
+			(len(n.Description) < 16) {
+			continue
+		}
+		d := n.Description
+		r.KernelOS = abiTagOSName(order.Uint32(d))
+		r.KernelVersion = fmt.Sprintf("%d.%d.%d", order.Uint32(d[4:]),
+			order.Uint32(d[8:]), order.Uint32(d[12:]))
+		return
+	}
+}
+
+// Sets the x86 ISA level and AArch64 features from the file's GNU property
+// notes.
+func (r *PlatformRequirements) readProperties(f ELFFile) error {
+	properties, e := GetGNUProperties(f)
+	if e != nil {
+		return fmt.Errorf("Failed reading GNU properties: %w", e)
+	}
+	order := fileEndianness(f)
+	machine := f.GetMachineType()
+	var needed, used uint32
+	var hasNeeded bool
+	for _, p := range properties {
+		if len(p.Data) < 4 {
+			continue
+		}
+		value := order.Uint32(p.Data)
+		switch {
+		case (machine == MachineTypeAMD64) || (machine == MachineTypeX86):
+			if p.Type == GNUPropertyX86ISA1Needed {
+				needed |= value
+				hasNeeded = true
+			} else if p.Type == GNUPropertyX86ISA1Used {
+				used |= value
+			}
+		case machine == MachineTypeARM64:
+			if p.Type != GNUPropertyAArch64Feature1 {
+				continue
+			}
+			if (value & GNUPropertyAArch64FeatureBTI) != 0 {
+				r.AArch64Features = append(r.AArch64Features, "BTI")
+			}
+			if (value & GNUPropertyAArch64FeaturePAC) != 0 {
+				r.AArch64Features = append(r.AArch64Features, "PAC")
+			}
+			if (value & GNUPropertyAArch64FeatureGCS) != 0 {
+				r.AArch64Features = append(r.AArch64Features, "GCS")
+			}
+		}
+	}
+	levels := used
+	if hasNeeded {
+		levels = needed
+	}
+	for level := 4; level >= 1; level-- {
+		if (levels & (1 << (level - 1))) != 0 {
+			r.X86ISALevel = level
+			break
+		}
+	}
+	return nil
+}
+
+// Returns the interpreter path from the file's PT_INTERP segment, or an
+// empty string if it doesn't have one.
+func getInterpreter(f ELFFile) (string, error) {
+	for i := uint16(0); i < f.GetSegmentCount(); i++ {
+		header, e := f.GetProgramHeader(i)
+		if e != nil {
+			return "", e
+		}
+		if header.GetType() != InterpreterSegment {
+			continue
+		}
+		content, e := f.GetSegmentContent(i)
+		if e != nil {
+			return "", fmt.Errorf("Failed reading the interpreter: %w", e)
+		}
+		if end := bytes.IndexByte(content, 0); end >= 0 {
+			content = content[:end]
+		}
+		return string(content), nil
+	}
+	return "", nil
+}
+
+// Returns the minimum platform the given ELF file requires: the newest
+// GLIBC_, GLIBCXX_ and CXXABI_ symbol versions it needs, the minimum kernel
+// version from its ABI tag note, the x86-64 ISA level or AArch64 features
+// from its GNU property notes, and its interpreter.
+func GetPlatformRequirements(f ELFFile) (*PlatformRequirements, error) {
+	toReturn := &PlatformRequirements{}
+	var e error
+	toReturn.Interpreter, e = getInterpreter(f)
+	if e != nil {
+		return nil, e
+	}
+	e = toReturn.readSymbolVersions(f)
+	if e != nil {
+		return nil, e
+	}
+	toReturn.readABITag(f)
+	e = toReturn.readProperties(f)
+	if e != nil {
+		return nil, e
+	}
+	return toReturn, nil
+}
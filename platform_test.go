@@ -0,0 +1,54 @@
+package elf_reader
+
+import (
+	"testing"
+)
+
+func TestPlatformRequirements(t *testing.T) {
+	f := parseTestELF64("test_data/hardened_amd64", t)
+	r, e := GetPlatformRequirements(f)
+	if e != nil {
+		t.Fatalf("Failed getting platform requirements: %s\n", e)
+	}
+	t.Logf("hardened_amd64 requirements:\n%s", r)
+	if r.Interpreter != "/lib64/ld-linux-x86-64.so.2" {
+		t.Errorf("Incorrect interpreter: %s\n", r.Interpreter)
+	}
+	if (len(r.SymbolVersions) != 1) ||
+		(r.SymbolVersions[0].Version != "GLIBC_2.34") ||
+		(r.SymbolVersions[0].File != "libc.so.6") {
+		t.Errorf("Incorrect symbol versions: %v\n", r.SymbolVersions)
+	}
+	if (r.KernelOS != "Linux") || (r.KernelVersion != "3.2.0") {
+		t.Errorf("Incorrect kernel version: %s %s\n", r.KernelOS,
+			r.KernelVersion)
+	}
+	if r.X86ISALevelName() != "x86-64 baseline" {
+		t.Errorf("Incorrect ISA level: %d\n", r.X86ISALevel)
+	}
+
+	f32 := parseTestELF32("test_data/sleep_arm32", t)
+	r, e = GetPlatformRequirements(f32)
+	if e != nil {
+		t.Fatalf("Failed getting 32-bit platform requirements: %s\n", e)
+	}
+	t.Logf("sleep_arm32 requirements:\n%s", r)
+	if (r.Interpreter != "/lib/ld-linux-armhf.so.3") ||
+		(r.KernelVersion != "2.6.32") || (r.X86ISALevel != 0) {
+		t.Errorf("Incorrect 32-bit platform requirements\n")
+	}
+	if (len(r.SymbolVersions) != 1) ||
+		(r.SymbolVersions[0].Version != "GLIBC_2.4") {
+		t.Errorf("Incorrect 32-bit symbol versions: %v\n", r.SymbolVersions)
+	}
+
+	// The test library has no interpreter, notes or GLIBC versions.
+	r, e = GetPlatformRequirements(parseTestELF64(
+		"test_data/libbind_b_amd64.so", t))
+	if e != nil {
+		t.Fatalf("Failed getting library platform requirements: %s\n", e)
+	}
+	if r.String() != "No platform requirements found.\n" {
+		t.Errorf("Unexpected requirements for library:\n%s", r)
+	}
+}
@@ -0,0 +1,427 @@
+package elf_reader
+
+// This file contains a simple rule-based policy engine, used to enforce
+// requirements such as hardening features or banned functions across many
+// ELF files. Policies are written in JSON, and results can be reported as
+// text, JSON or SARIF.
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The types of rules supported in a policy.
+const (
+	// Fails if the file's stack is executable, according to its
+	// PT_GNU_STACK segment.
+	PolicyNoExecutableStack = "no_executable_stack"
+	// Fails if the file imports any of the symbols listed in the rule's
+	// Symbols field.
+	PolicyForbiddenImports = "forbidden_imports"
+	// Fails if DT_RPATH or DT_RUNPATH contain any absolute paths. Paths
+	// relative to $ORIGIN are allowed.
+	PolicyNoAbsoluteRunPath = "no_absolute_runpath"
+	// Fails if the file requires a symbol version newer than the rule's
+	// MaxVersion, e.g. "GLIBC_2.28". Only versions with the same prefix are
+	// compared.
+	PolicyMaxSymbolVersion = "max_symbol_version"
+	// Fails if the hardening feature named in the rule's Feature field
+	// doesn't pass. Features are named as in HardeningReport, e.g. "RELRO",
+	// and unknown names are rejected. If AllowPartial is set, partially
+	// enabled features are accepted.
+	PolicyRequireHardening = "require_hardening"
+)
+
+// Holds a single rule in a policy.
+type PolicyRule struct {
+	// A unique identifier for the rule, e.g. "no-gets".
+	ID string
+	// One of the policy rule types, e.g. PolicyForbiddenImports.
+	Type        string
+	Description string `json:",omitempty"`
+	// Either "error", "warning" or "note". Defaults to "error".
+	Level string `json:",omitempty"`
+	// Used by PolicyForbiddenImports rules.
+	Symbols []string `json:",omitempty"`
+	// Used by PolicyMaxSymbolVersion rules.
+	MaxVersion string `json:",omitempty"`
+	// Used by PolicyRequireHardening rules.
+	Feature      string `json:",omitempty"`
+	AllowPartial bool   `json:",omitempty"`
+}
+
+// Holds a list of rules to check ELF files against.
+type Policy struct {
+	Rules []PolicyRule
+}
+
+// Holds a single policy violation.
+type PolicyResult struct {
+	RuleID string
+	// Either "error", "warning" or "note".
+	Level string
+	// The path to the file that violated the rule.
+	File    string
+	Message string
+}
+
+func (r *PolicyResult) String() string {
+	return fmt.Sprintf("%s: %s: [%s] %s", r.File, r.Level, r.RuleID,
+		r.Message)
+}
+
+// Parses a JSON policy, and returns an error if any rules are invalid.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var toReturn Policy
+	e := json.Unmarshal(data, &toReturn)
+	if e != nil {
+		return nil, fmt.Errorf("Failed parsing the policy: %w", e)
+	}
+	e = toReturn.Validate()
+	if e != nil {
+		return nil, e
+	}
+	return &toReturn, nil
+}
+
+// Returns an error if any of the policy's rules are invalid.
+func (p *Policy) Validate() error {
+	seen := make(map[string]bool)
+	for i := range p.Rules {
+		r := &(p.Rules[i])
+		if r.ID == "" {
+			return fmt.Errorf("Rule %d doesn't have an ID", i)
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("Duplicate rule ID: %s", r.ID)
+		}
+		seen[r.ID] = true
+		switch r.Level {
+		case "", "error", "warning", "note":
+		default:
+			return fmt.Errorf("Rule %s has an invalid level: %s", r.ID,
+				r.Level)
+		}
+		switch r.Type {
+		case PolicyNoExecutableStack, PolicyNoAbsoluteRunPath:
+		case PolicyForbiddenImports:
+			if len(r.Symbols) == 0 {
+				return fmt.Errorf("Rule %s doesn't list any symbols", r.ID)
+			}
+		case PolicyMaxSymbolVersion:
+			_, _, e := parseSymbolVersion(r.MaxVersion)
+			if e != nil {
+				return fmt.Errorf("Rule %s has an invalid max version: %w",
+					r.ID, e)
+			}
+		case PolicyRequireHardening:
+			if r.Feature == "" {
+				return fmt.Errorf("Rule %s doesn't specify a feature", r.ID)
+			}
+			if !hardeningFeatures[r.Feature] {
+				return fmt.Errorf("Rule %s has an unknown feature: %s", r.ID,
+					r.Feature)
+			}
+		default:
+			return fmt.Errorf("Rule %s has an unknown type: %s", r.ID, r.Type)
+		}
+	}
+	return nil
+}
+
+// Splits a symbol version such as "GLIBC_2.28" into its prefix ("GLIBC_")
+// and its numeric components.
+func parseSymbolVersion(version string) (string, []int, error) {
+	i := strings.IndexAny(version, "0123456789")
+	if i <= 0 {
+		return "", nil, fmt.Errorf("No prefix or number in version %q",
+			version)
+	}
+	prefix := version[:i]
+	parts := strings.Split(version[i:], ".")
+	numbers := make([]int, len(parts))
+	for j, part := range parts {
+		n, e := strconv.Atoi(part)
+		if e != nil {
+			return "", nil, fmt.Errorf("Invalid version %q", version)
+		}
+		numbers[j] = n
+	}
+	return prefix, numbers, nil
+}
+
+// Returns a negative number if a < b, 0 if they're equal, or a positive
+// number if a > b. Missing components are treated as 0.
+func compareVersionNumbers(a, b []int) int {
+	for i := 0; (i < len(a)) || (i < len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// Returns the names of the undefined symbols in the file's dynamic symbol
+// table, i.e. the symbols imported from other libraries.
+func getImportedSymbols(f ELFFile) ([]string, error) {
+	index := findSectionByType(f, DynamicLoaderSymbolSection)
+	if index == 0 {
+		return nil, nil
+	}
+	symbols, names, e := f.GetSymbols(index)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading dynamic symbols: %w", e)
+	}
+	var toReturn []string
+	for i, s := range symbols {
+		if (s.GetSectionIndex() != 0) || (names[i] == "") {
+			continue
+		}
+		toReturn = append(toReturn, names[i])
+	}
+	return toReturn, nil
+}
+
+// Evaluates a single rule against the file, and returns a message for each
+// violation.
+func (r *PolicyRule) evaluate(f ELFFile) ([]string, error) {
+	var toReturn []string
+	switch r.Type {
+	case PolicyNoExecutableStack:
+		s := &hardeningState{f: f, segments: programHeaders64(f)}
+		finding := s.checkNX()
+		if finding.Status != HardeningPass {
+			toReturn = append(toReturn, fmt.Sprintf("%s: %s",
+				finding.Summary, strings.Join(finding.Evidence, "; ")))
+		}
+	case PolicyForbiddenImports:
+		imports, e := getImportedSymbols(f)
+		if e != nil {
+			return nil, e
+		}
+		forbidden := make(map[string]bool)
+		for _, name := range r.Symbols {
+			forbidden[name] = true
+		}
+		for _, name := range imports {
+			if forbidden[name] {
+				toReturn = append(toReturn, fmt.Sprintf("Imports forbidden "+
+					"symbol %s", name))
+			}
+		}
+	case PolicyNoAbsoluteRunPath:
+		dynamic, e := GetDynamicTable(f)
+		if (e != nil) || (dynamic == nil) {
+			return nil, e
+		}
+		for _, tag := range []int64{DynamicTagRPath, DynamicTagRunPath} {
+			paths, e := dynamic.Strings(tag)
+			if e != nil {
+				return nil, e
+			}
+			for _, list := range paths {
+				for _, p := range strings.Split(list, ":") {
+					if strings.HasPrefix(p, "/") {
+						toReturn = append(toReturn, fmt.Sprintf("Library "+
+							"search path contains absolute path %s", p))
+					}
+				}
+			}
+		}
+	case PolicyMaxSymbolVersion:
+		prefix, maxVersion, e := parseSymbolVersion(r.MaxVersion)
+		if e != nil {
+			return nil, e
+		}
+		requirements, e := GetVersionRequirements(f)
+		if e != nil {
+			return nil, e
+		}
+		for _, requirement := range requirements {
+			for _, v := range requirement.Versions {
+				p, numbers, e := parseSymbolVersion(v.Name)
+				if (e != nil) || (p != prefix) {
+					continue
+				}
+				if compareVersionNumbers(numbers, maxVersion) > 0 {
+					toReturn = append(toReturn, fmt.Sprintf("Requires %s "+
+						"from %s, newer than %s", v.Name, requirement.File,
+						r.MaxVersion))
+				}
+			}
+		}
+	case PolicyRequireHardening:
+		report, e := GetHardeningReport(f)
+		if e != nil {
+			return nil, e
+		}
+		finding := report.Finding(r.Feature)
+		if finding == nil {
+			// The feature doesn't apply to the file's architecture, e.g.
+			// CET on ARM.
+			break
+		}
+		if (finding.Status == HardeningFail) ||
+			((finding.Status == HardeningPartial) && !r.AllowPartial) {
+			toReturn = append(toReturn, fmt.Sprintf("%s: %s (%s)",
+				r.Feature, finding.Summary,
+				strings.Join(finding.Evidence, "; ")))
+		}
+	default:
+		return nil, fmt.Errorf("Unknown rule type: %s", r.Type)
+	}
+	return toReturn, nil
+}
+
+// Checks the given file against all of the policy's rules, and returns the
+// violations. The path is only used to fill in the File field of each
+// result.
+func (p *Policy) Evaluate(path string, f ELFFile) ([]PolicyResult, error) {
+	var toReturn []PolicyResult
+	for i := range p.Rules {
+		r := &(p.Rules[i])
+		messages, e := r.evaluate(f)
+		if e != nil {
+			return nil, fmt.Errorf("Failed evaluating rule %s: %w", r.ID, e)
+		}
+		level := r.Level
+		if level == "" {
+			level = "error"
+		}
+		for _, m := range messages {
+			toReturn = append(toReturn, PolicyResult{
+				RuleID:  r.ID,
+				Level:   level,
+				File:    path,
+				Message: m,
+			})
+		}
+	}
+	return toReturn, nil
+}
+
+// Returns the results formatted as plain text, with one line per result.
+func FormatPolicyResultsText(results []PolicyResult) string {
+	var b strings.Builder
+	for i := range results {
+		fmt.Fprintf(&b, "%s\n", &(results[i]))
+	}
+	return b.String()
+}
+
+// Returns the results as a JSON array.
+func FormatPolicyResultsJSON(results []PolicyResult) ([]byte, error) {
+	if results == nil {
+		results = []PolicyResult{}
+	}
+	return json.MarshalIndent(results, "", "  ")
+}
+
+// The following types hold the subset of the SARIF 2.1.0 format needed to
+// report policy results.
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// Returns the results as a SARIF 2.1.0 log, suitable for uploading to code
+// scanning tools. The policy is used to describe the rules.
+func FormatPolicyResultsSARIF(p *Policy, toolName string,
+	results []PolicyResult) ([]byte, error) {
+	driver := sarifDriver{
+		Name:  toolName,
+		Rules: make([]sarifRule, 0, len(p.Rules)),
+	}
+	for _, r := range p.Rules {
+		description := r.Description
+		if description == "" {
+			description = r.Type
+		}
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:               r.ID,
+			ShortDescription: sarifMessage{Text: description},
+		})
+	}
+	sort.SliceStable(driver.Rules, func(a, b int) bool {
+		return driver.Rules[a].ID < driver.Rules[b].ID
+	})
+	run := sarifRun{
+		Tool:    sarifTool{Driver: driver},
+		Results: make([]sarifResult, 0, len(results)),
+	}
+	for _, r := range results {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  r.RuleID,
+			Level:   r.Level,
+			Message: sarifMessage{Text: r.Message},
+			Locations: []sarifLocation{
+				sarifLocation{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{
+							URI: r.File,
+						},
+					},
+				},
+			},
+		})
+	}
+	return json.MarshalIndent(&sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+}
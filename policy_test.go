@@ -0,0 +1,122 @@
+package elf_reader
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testPolicy = `{"Rules": [
+	{"ID": "nx", "Type": "no_executable_stack"},
+	{"ID": "banned", "Type": "forbidden_imports",
+	 "Symbols": ["gets", "__strcpy_chk"]},
+	{"ID": "runpath", "Type": "no_absolute_runpath", "Level": "warning"},
+	{"ID": "glibc", "Type": "max_symbol_version", "MaxVersion": "GLIBC_2.28"},
+	{"ID": "relro", "Type": "require_hardening", "Feature": "RELRO"}
+]}`
+
+func TestPolicy(t *testing.T) {
+	policy, e := ParsePolicy([]byte(testPolicy))
+	if e != nil {
+		t.Fatalf("Failed parsing the test policy: %s\n", e)
+	}
+	f := parseTestELF64("test_data/hardened_amd64", t)
+	results, e := policy.Evaluate("hardened_amd64", f)
+	if e != nil {
+		t.Fatalf("Failed evaluating the policy: %s\n", e)
+	}
+	t.Logf("Results for hardened_amd64:\n%s",
+		FormatPolicyResultsText(results))
+	violated := make(map[string]string)
+	for _, r := range results {
+		violated[r.RuleID] = r.Level
+	}
+	expected := map[string]string{
+		"banned":  "error",
+		"runpath": "warning",
+		"glibc":   "error",
+	}
+	for id, level := range expected {
+		if violated[id] != level {
+			t.Errorf("Expected a %s violation of rule %s\n", level, id)
+		}
+	}
+	if (violated["nx"] != "") || (violated["relro"] != "") {
+		t.Errorf("Got unexpected violations: %v\n", violated)
+	}
+
+	g := parseTestELF32("test_data/sleep_arm32", t)
+	results, e = policy.Evaluate("sleep_arm32", g)
+	if e != nil {
+		t.Fatalf("Failed evaluating the policy: %s\n", e)
+	}
+	if (len(results) != 1) || (results[0].RuleID != "relro") {
+		t.Errorf("Expected only a RELRO violation for sleep_arm32, got:\n%s",
+			FormatPolicyResultsText(results))
+	}
+
+	// Make sure the SARIF output is valid JSON with the expected structure.
+	sarif, e := FormatPolicyResultsSARIF(policy, "test", results)
+	if e != nil {
+		t.Fatalf("Failed formatting SARIF: %s\n", e)
+	}
+	var decoded sarifLog
+	e = json.Unmarshal(sarif, &decoded)
+	if e != nil {
+		t.Fatalf("Failed decoding SARIF output: %s\n", e)
+	}
+	if (decoded.Version != "2.1.0") || (len(decoded.Runs) != 1) ||
+		(len(decoded.Runs[0].Results) != 1) ||
+		(len(decoded.Runs[0].Tool.Driver.Rules) != len(policy.Rules)) {
+		t.Errorf("Incorrect SARIF output:\n%s\n", sarif)
+	}
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	invalid := []string{
+		`{"Rules": [{"Type": "no_executable_stack"}]}`,
+		`{"Rules": [{"ID": "x", "Type": "not_a_rule"}]}`,
+		`{"Rules": [{"ID": "x", "Type": "forbidden_imports"}]}`,
+		`{"Rules": [{"ID": "x", "Type": "max_symbol_version",
+			"MaxVersion": "2.28"}]}`,
+		`{"Rules": [{"ID": "x", "Type": "no_executable_stack"},
+			{"ID": "x", "Type": "no_executable_stack"}]}`,
+		`{"Rules": [{"ID": "x", "Type": "require_hardening"}]}`,
+		`{"Rules": [{"ID": "x", "Type": "require_hardening",
+			"Feature": "Relro"}]}`,
+	}
+	for _, p := range invalid {
+		_, e := ParsePolicy([]byte(p))
+		if e == nil {
+			t.Errorf("Didn't get an error for invalid policy %s\n", p)
+		} else {
+			t.Logf("Got expected error for invalid policy: %s\n", e)
+		}
+	}
+}
+
+func TestPolicyHardeningFeatures(t *testing.T) {
+	// Every feature in a hardening report must be usable in a policy.
+	report, e := GetHardeningReport(parseTestELF64("test_data/hardened_amd64",
+		t))
+	if e != nil {
+		t.Fatalf("Failed getting hardening report: %s\n", e)
+	}
+	for _, finding := range report.Findings {
+		if !hardeningFeatures[finding.Feature] {
+			t.Errorf("Feature %s can't be used in a policy\n",
+				finding.Feature)
+		}
+	}
+}
+
+func TestCompareVersionNumbers(t *testing.T) {
+	_, a, _ := parseSymbolVersion("GLIBC_2.3.4")
+	_, b, _ := parseSymbolVersion("GLIBC_2.28")
+	if compareVersionNumbers(a, b) >= 0 {
+		t.Errorf("GLIBC_2.3.4 wasn't older than GLIBC_2.28\n")
+	}
+	_, c, _ := parseSymbolVersion("GLIBC_2.28.0")
+	if compareVersionNumbers(b, c) != 0 {
+		t.Errorf("GLIBC_2.28 wasn't equal to GLIBC_2.28.0\n")
+	}
+}
@@ -0,0 +1,806 @@
+package elf_reader
+
+// This file contains code for synthesizing a section header table for an ELF
+// file that lacks one, e.g. after being processed by sstrip, using only the
+// program headers and the dynamic linking table.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Section header flag bits used by reconstructed sections.
+const (
+	reconstructedWrite = 1
+	reconstructedAlloc = 2
+	reconstructedExec  = 4
+)
+
+// Holds a section being added to the reconstructed section header table.
+type reconstructedSection struct {
+	name   string
+	header ELF64SectionHeader
+	// The name of the section that the header's link field refers to, if
+	// any. This is converted to an index once the sections are sorted.
+	link string
+}
+
+// Tracks the state needed while reconstructing a file's sections.
+type reconstructState struct {
+	is64     bool
+	order    binary.ByteOrder
+	raw      []byte
+	layout   fileLayout
+	wordSize uint64
+	segments []ELF64ProgramHeader
+	// The first value of each tag in the dynamic table.
+	dynamic  map[int64]uint64
+	sections []reconstructedSection
+}
+
+// Returns the offset in the file of the given range of virtual addresses,
+// which must be entirely backed by the file content of a loadable segment.
+func (s *reconstructState) addressToOffset(address, size uint64) (uint64,
+	bool) {
+	end, e := rangeEnd(address, size)
+	if e != nil {
+		return 0, false
+	}
+	for i := range s.segments {
+		h := &(s.segments[i])
+		if (h.Type != LoadableSegment) || (address < h.VirtualAddress) {
+			continue
+		}
+		segmentEnd, e := rangeEnd(h.VirtualAddress, h.FileSize)
+		if (e != nil) || (end > segmentEnd) {
+			continue
+		}
+		offset, e := rangeEnd(h.FileOffset, address-h.VirtualAddress)
+		if e != nil {
+			return 0, false
+		}
+		offsetEnd, e := rangeEnd(offset, size)
+		if (e != nil) || (offsetEnd > uint64(len(s.raw))) {
+			return 0, false
+		}
+		return offset, true
+	}
+	return 0, false
+}
+
+// Returns the file content at the given virtual address, or nil if the range
+// isn't backed by the file.
+func (s *reconstructState) contentAt(address, size uint64) []byte {
+	offset, ok := s.addressToOffset(address, size)
+	if !ok {
+		return nil
+	}
+	return s.raw[offset : offset+size]
+}
+
+// Reads the dynamic table from the dynamic linking segment, if there is one.
+func (s *reconstructState) readDynamicTable() {
+	s.dynamic = make(map[int64]uint64)
+	for i := range s.segments {
+		h := &(s.segments[i])
+		if (h.Type != DynamicLinkingSegment) || (h.FileOffset >
+			uint64(len(s.raw))) {
+			continue
+		}
+		content := s.raw[h.FileOffset:]
+		if h.FileSize < uint64(len(content)) {
+			content = content[:h.FileSize]
+		}
+		entrySize := 2 * s.wordSize
+		for len(content) >= int(entrySize) {
+			var tag int64
+			var value uint64
+			if s.is64 {
+				tag = int64(s.order.Uint64(content))
+				value = s.order.Uint64(content[8:])
+			} else {
+				tag = int64(int32(s.order.Uint32(content)))
+				value = uint64(s.order.Uint32(content[4:]))
+			}
+			if tag == DynamicTagNull {
+				break
+			}
+			if _, ok := s.dynamic[tag]; !ok {
+				s.dynamic[tag] = value
+			}
+			content = content[entrySize:]
+		}
+		return
+	}
+}
+
+// Returns true if the section's address range overlaps any section that has
+// already been added.
+func (s *reconstructState) overlaps(h *ELF64SectionHeader) bool {
+	for i := range s.sections {
+		other := &(s.sections[i].header)
+		if (other.Type == UninitializedSection) !=
+			(h.Type == UninitializedSection) {
+			continue
+		}
+		if (h.VirtualAddress < (other.VirtualAddress + other.Size)) &&
+			(other.VirtualAddress < (h.VirtualAddress + h.Size)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds a section occupying the given range of virtual addresses, if the range
+// is backed by the file and doesn't overlap a section that was added earlier.
+// Returns true if the section was added.
+func (s *reconstructState) addSection(name string, sectionType uint32,
+	flags, address, size, align, entrySize uint64, link string,
+	info uint32) bool {
+	if size == 0 {
+		return false
+	}
+	offset, ok := s.addressToOffset(address, size)
+	if !ok {
+		return false
+	}
+	h := ELF64SectionHeader{
+		Type:           SectionHeaderType(sectionType),
+		Flags:          SectionHeaderFlags64(flags | reconstructedAlloc),
+		VirtualAddress: address,
+		FileOffset:     offset,
+		Size:           size,
+		Info:           info,
+		Align:          align,
+		EntrySize:      entrySize,
+	}
+	if s.overlaps(&h) {
+		return false
+	}
+	s.sections = append(s.sections, reconstructedSection{
+		name:   name,
+		header: h,
+		link:   link,
+	})
+	return true
+}
+
+// Adds a section for the dynamic table entry with the given tag, if the file
+// has one.
+func (s *reconstructState) addDynamicSection(name string, sectionType uint32,
+	flags uint64, addressTag int64, size, align, entrySize uint64,
+	link string, info uint32) bool {
+	address, ok := s.dynamic[addressTag]
+	if !ok {
+		return false
+	}
+	return s.addSection(name, sectionType, flags, address, size, align,
+		entrySize, link, info)
+}
+
+// Returns the number of symbols in the dynamic symbol table, using the hash
+// tables if possible. Returns 0 if the count can't be determined.
+func (s *reconstructState) dynamicSymbolCount() uint64 {
+	if address, ok := s.dynamic[DynamicTagHash]; ok {
+		content := s.contentAt(address, 8)
+		if content != nil {
+			return uint64(s.order.Uint32(content[4:]))
+		}
+	}
+	// The GNU hash table doesn't cover the symbols before its symbol offset,
+	// so it only gives a lower bound if none of the symbols are hashed. In
+	// that case, assume the symbol table fills the space before the next
+	// table referred to by the dynamic table.
+	toReturn := uint64(0)
+	if address, ok := s.dynamic[DynamicTagGNUHash]; ok {
+		toReturn, _ = s.gnuHashSymbolCount(address)
+	}
+	symbols, ok := s.dynamic[DynamicTagSymbolTable]
+	if !ok {
+		return toReturn
+	}
+	next := uint64(0)
+	for _, tag := range []int64{DynamicTagHash, DynamicTagStringTable,
+		DynamicTagRela, DynamicTagRel, DynamicTagJumpRel,
+		DynamicTagGNUHash, DynamicTagVersionSymbols, DynamicTagVersionDef,
+		DynamicTagVersionNeed} {
+		address, ok := s.dynamic[tag]
+		if ok && (address > symbols) && ((next == 0) || (address < next)) {
+			next = address
+		}
+	}
+	if next == 0 {
+		return toReturn
+	}
+	estimate := (next - symbols) / s.symbolEntrySize()
+	if estimate > toReturn {
+		toReturn = estimate
+	}
+	return toReturn
+}
+
+// Returns the size of a dynamic symbol table entry.
+func (s *reconstructState) symbolEntrySize() uint64 {
+	if v, ok := s.dynamic[DynamicTagSymbolSize]; ok && (v != 0) {
+		return v
+	}
+	if s.is64 {
+		return 24
+	}
+	return 16
+}
+
+// Returns the number of symbols covered by the GNU hash table at the given
+// address, by following the hash chain of the highest-numbered symbol. Also
+// returns false if the table can't be read.
+func (s *reconstructState) gnuHashSymbolCount(address uint64) (uint64, bool) {
+	header := s.contentAt(address, 16)
+	if header == nil {
+		return 0, false
+	}
+	bucketCount := uint64(s.order.Uint32(header))
+	symbolOffset := uint64(s.order.Uint32(header[4:]))
+	bloomSize := uint64(s.order.Uint32(header[8:]))
+	bucketsAddress := address + 16 + bloomSize*s.wordSize
+	buckets := s.contentAt(bucketsAddress, bucketCount*4)
+	if buckets == nil {
+		return 0, false
+	}
+	lastSymbol := uint64(0)
+	for i := uint64(0); i < bucketCount; i++ {
+		v := uint64(s.order.Uint32(buckets[i*4:]))
+		if v > lastSymbol {
+			lastSymbol = v
+		}
+	}
+	if lastSymbol < symbolOffset {
+		return symbolOffset, true
+	}
+	chainsAddress := bucketsAddress + bucketCount*4
+	for {
+		chain := s.contentAt(chainsAddress+(lastSymbol-symbolOffset)*4, 4)
+		if chain == nil {
+			return 0, false
+		}
+		// The lowest bit marks the end of a chain.
+		if (s.order.Uint32(chain) & 1) != 0 {
+			return lastSymbol + 1, true
+		}
+		lastSymbol++
+	}
+}
+
+// Returns the size of the GNU hash table at the given address. The table
+// contains a chain entry for each hashed symbol.
+func (s *reconstructState) gnuHashSize(address uint64) uint64 {
+	header := s.contentAt(address, 16)
+	if header == nil {
+		return 0
+	}
+	bucketCount := uint64(s.order.Uint32(header))
+	symbolOffset := uint64(s.order.Uint32(header[4:]))
+	bloomSize := uint64(s.order.Uint32(header[8:]))
+	toReturn := 16 + bloomSize*s.wordSize + bucketCount*4
+	symbolCount, ok := s.gnuHashSymbolCount(address)
+	if !ok {
+		return 0
+	}
+	if symbolCount > symbolOffset {
+		toReturn += (symbolCount - symbolOffset) * 4
+	}
+	return toReturn
+}
+
+// Returns the index of the first non-local symbol in the dynamic symbol table
+// at the given address.
+func (s *reconstructState) firstGlobalSymbol(address, count,
+	entrySize uint64) uint32 {
+	// The info byte follows the name, or the name, value and size in 32-bit
+	// files.
+	infoOffset := uint64(12)
+	if s.is64 {
+		infoOffset = 4
+	}
+	for i := uint64(1); i < count; i++ {
+		symbol := s.contentAt(address+i*entrySize, entrySize)
+		if (symbol == nil) || (entrySize <= infoOffset) {
+			return uint32(i)
+		}
+		if (symbol[infoOffset] >> 4) != 0 {
+			return uint32(i)
+		}
+	}
+	return uint32(count)
+}
+
+// Returns the size of a chain of GNU version requirements or definitions at
+// the given address, containing the given number of entries. The entry and
+// auxiliary entry sizes, and the offsets of the auxiliary count, first
+// auxiliary offset and auxiliary next fields, depend on the type of chain. The
+// next field is always the last field in an entry. Returns 0 if the chain is
+// invalid.
+func (s *reconstructState) versionChainSize(address, count, entrySize,
+	countOffset, auxOffset, auxSize, auxNextOffset uint64) uint64 {
+	if checkTableBounds(0, count, entrySize, uint64(len(s.raw))) != nil {
+		return 0
+	}
+	// Corrupt chains may refer to the same entries more than once. Entries
+	// are never shared in valid chains, so this stops at the first revisited
+	// entry, limiting the work done to the size of the file.
+	visited := make(map[uint64]bool)
+	end := uint64(0)
+	offset := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		entry := s.contentAt(address+offset, entrySize)
+		if (entry == nil) || visited[offset] {
+			return 0
+		}
+		visited[offset] = true
+		if (offset + entrySize) > end {
+			end = offset + entrySize
+		}
+		auxCount := uint64(s.order.Uint16(entry[countOffset:]))
+		aux := offset + uint64(s.order.Uint32(entry[auxOffset:]))
+		for j := uint64(0); j < auxCount; j++ {
+			auxEntry := s.contentAt(address+aux, auxSize)
+			if (auxEntry == nil) || visited[aux] {
+				return 0
+			}
+			visited[aux] = true
+			if (aux + auxSize) > end {
+				end = aux + auxSize
+			}
+			next := uint64(s.order.Uint32(auxEntry[auxNextOffset:]))
+			if next == 0 {
+				break
+			}
+			aux += next
+		}
+		next := uint64(s.order.Uint32(entry[entrySize-4:]))
+		if next == 0 {
+			break
+		}
+		offset += next
+	}
+	return end
+}
+
+// Adds a section for each note in each note segment, naming the well-known
+// GNU notes.
+func (s *reconstructState) addNoteSections() {
+	for i := range s.segments {
+		h := &(s.segments[i])
+		if h.Type != NoteSegment {
+			continue
+		}
+		content := s.contentAt(h.VirtualAddress, h.FileSize)
+		notes, e := ParseNotes(content, s.order, h.Align)
+		if (content == nil) || (e != nil) {
+			s.addSection(".note", NoteSection, 0, h.VirtualAddress,
+				h.FileSize, noteAlignment(h.Align), 0, "", 0)
+			continue
+		}
+		alignment := noteAlignment(h.Align)
+		address := h.VirtualAddress
+		for _, n := range notes {
+			size := 12 + alignUp(uint64(len(n.Name))+1, alignment) +
+				alignUp(uint64(len(n.Description)), alignment)
+			name := ".note"
+			if n.Name == "GNU" {
+				switch n.Type {
+				case GNUNoteABITag:
+					name = ".note.ABI-tag"
+				case GNUNoteBuildID:
+					name = ".note.gnu.build-id"
+				case GNUNotePropertyType0:
+					name = ".note.gnu.property"
+				}
+			}
+			s.addSection(name, NoteSection, 0, address, size, alignment, 0,
+				"", 0)
+			address += size
+		}
+	}
+}
+
+// Adds the sections described by the dynamic table.
+func (s *reconstructState) addDynamicSections() {
+	word := s.wordSize
+	symbolCount := s.dynamicSymbolCount()
+	symbolSize := s.symbolEntrySize()
+	if symbolAddress, ok := s.dynamic[DynamicTagSymbolTable]; ok {
+		s.addDynamicSection(".dynsym", DynamicLoaderSymbolSection, 0,
+			DynamicTagSymbolTable, symbolCount*symbolSize, word, symbolSize,
+			".dynstr", s.firstGlobalSymbol(symbolAddress, symbolCount,
+				symbolSize))
+	}
+	s.addDynamicSection(".dynstr", StringTableSection, 0,
+		DynamicTagStringTable, s.dynamic[DynamicTagStringSize], 1, 0, "", 0)
+	s.addDynamicSection(".hash", HashSection, 0, DynamicTagHash,
+		(2+s.hashBucketCount()+symbolCount)*4, word, 4, ".dynsym", 0)
+	s.addDynamicSection(".gnu.hash", GNUHashSection, 0, DynamicTagGNUHash,
+		s.gnuHashSize(s.dynamic[DynamicTagGNUHash]), word, 0,
+		".dynsym", 0)
+	s.addDynamicSection(".gnu.version", GNUVersionSymbolSection, 0,
+		DynamicTagVersionSymbols, symbolCount*2, 2, 2, ".dynsym", 0)
+	count := s.dynamic[DynamicTagVersionNeedNum]
+	s.addDynamicSection(".gnu.version_r", GNUVersionRequirementSection, 0,
+		DynamicTagVersionNeed, s.versionChainSize(
+			s.dynamic[DynamicTagVersionNeed], count, 16, 2, 8, 16, 12), word,
+		0, ".dynstr", uint32(count))
+	count = s.dynamic[DynamicTagVersionDefNum]
+	s.addDynamicSection(".gnu.version_d", GNUVersionDefinitionSection, 0,
+		DynamicTagVersionDef, s.versionChainSize(
+			s.dynamic[DynamicTagVersionDef], count, 20, 6, 12, 8, 4), word, 0,
+		".dynstr", uint32(count))
+
+	relaSize := uint64(24)
+	relSize := uint64(16)
+	if !s.is64 {
+		relaSize = 12
+		relSize = 8
+	}
+	s.addDynamicSection(".rela.dyn", RelaSection, 0, DynamicTagRela,
+		s.dynamic[DynamicTagRelaSize], word, relaSize, ".dynsym", 0)
+	s.addDynamicSection(".rel.dyn", RelSection, 0, DynamicTagRel,
+		s.dynamic[DynamicTagRelSize], word, relSize, ".dynsym", 0)
+	if s.dynamic[DynamicTagPLTRel] == DynamicTagRela {
+		s.addDynamicSection(".rela.plt", RelaSection, 0, DynamicTagJumpRel,
+			s.dynamic[DynamicTagPLTRelSize], word, relaSize, ".dynsym", 0)
+	} else {
+		s.addDynamicSection(".rel.plt", RelSection, 0, DynamicTagJumpRel,
+			s.dynamic[DynamicTagPLTRelSize], word, relSize, ".dynsym", 0)
+	}
+}
+
+// Returns the number of buckets in the SysV hash table, or 0 if there isn't
+// one.
+func (s *reconstructState) hashBucketCount() uint64 {
+	address, ok := s.dynamic[DynamicTagHash]
+	if !ok {
+		return 0
+	}
+	content := s.contentAt(address, 4)
+	if content == nil {
+		return 0
+	}
+	return uint64(s.order.Uint32(content))
+}
+
+// Adds the writable sections described by the dynamic table.
+func (s *reconstructState) addWritableSections() {
+	word := s.wordSize
+	s.addDynamicSection(".init_array", InitArraySection, reconstructedWrite,
+		DynamicTagInitArray, s.dynamic[DynamicTagInitArraySize], word, word,
+		"", 0)
+	s.addDynamicSection(".fini_array", FiniArraySection, reconstructedWrite,
+		DynamicTagFiniArray, s.dynamic[DynamicTagFiniArraySize], word, word,
+		"", 0)
+	for i := range s.segments {
+		h := &(s.segments[i])
+		if h.Type == DynamicLinkingSegment {
+			s.addSection(".dynamic", DynamicLinkingTableSection,
+				reconstructedWrite, h.VirtualAddress, h.FileSize, word,
+				2*word, ".dynstr", 0)
+		}
+	}
+}
+
+// Reads a pointer encoded using the given DWARF exception header encoding
+// from the content at the given address. Only the absolute and PC-relative
+// 4- and 8-byte encodings are supported.
+func (s *reconstructState) readEncodedPointer(address uint64,
+	encoding uint8) (uint64, bool) {
+	var value uint64
+	switch encoding & 0x0f {
+	case 0x03, 0x0b:
+		content := s.contentAt(address, 4)
+		if content == nil {
+			return 0, false
+		}
+		value = uint64(s.order.Uint32(content))
+		if (encoding & 0x0f) == 0x0b {
+			value = uint64(int64(int32(value)))
+		}
+	case 0x04, 0x0c:
+		content := s.contentAt(address, 8)
+		if content == nil {
+			return 0, false
+		}
+		value = s.order.Uint64(content)
+	default:
+		return 0, false
+	}
+	switch encoding & 0x70 {
+	case 0x00:
+		return value, true
+	case 0x10:
+		return address + value, true
+	}
+	return 0, false
+}
+
+// Adds the .eh_frame_hdr section from the GNU exception frame segment, along
+// with the .eh_frame section that it refers to.
+func (s *reconstructState) addExceptionFrameSections() {
+	for i := range s.segments {
+		h := &(s.segments[i])
+		if h.Type != GNUEHFrameSegment {
+			continue
+		}
+		if !s.addSection(".eh_frame_hdr", BitsSection, 0, h.VirtualAddress,
+			h.FileSize, 4, 0, "", 0) {
+			continue
+		}
+		header := s.contentAt(h.VirtualAddress, 4)
+		if (header == nil) || (header[0] != 1) || (header[1] == 0xff) {
+			continue
+		}
+		start, ok := s.readEncodedPointer(h.VirtualAddress+4, header[1])
+		if !ok {
+			continue
+		}
+		// Walk the CIEs and FDEs until reaching the zero terminator or the
+		// end of the segment content.
+		size := uint64(0)
+		for {
+			length := s.contentAt(start+size, 4)
+			if length == nil {
+				break
+			}
+			entrySize := uint64(s.order.Uint32(length))
+			if entrySize == 0xffffffff {
+				extended := s.contentAt(start+size+4, 8)
+				if extended == nil {
+					break
+				}
+				entrySize = s.order.Uint64(extended) + 8
+			}
+			if entrySize == 0 {
+				size += 4
+				break
+			}
+			if entrySize > uint64(len(s.raw)) {
+				break
+			}
+			if s.contentAt(start+size, entrySize+4) == nil {
+				break
+			}
+			size += entrySize + 4
+		}
+		s.addSection(".eh_frame", BitsSection, 0, start, size, s.wordSize, 0,
+			"", 0)
+	}
+}
+
+// Returns the uncovered ranges of file offsets in the given loadable segment,
+// after excluding the ELF header, program header table and any sections
+// added so far.
+func (s *reconstructState) segmentGaps(h *ELF64ProgramHeader) [][2]uint64 {
+	var covered [][2]uint64
+	headersEnd := uint64(s.layout.HeaderSize)
+	tableEnd := s.layout.ProgramHeaderOffset +
+		uint64(s.layout.ProgramHeaderEntrySize)*uint64(len(s.segments))
+	if tableEnd > headersEnd {
+		headersEnd = tableEnd
+	}
+	covered = append(covered, [2]uint64{0, headersEnd})
+	for i := range s.sections {
+		current := &(s.sections[i].header)
+		if current.Type == UninitializedSection {
+			continue
+		}
+		covered = append(covered, [2]uint64{current.FileOffset,
+			current.FileOffset + current.Size})
+	}
+	sort.Slice(covered, func(a, b int) bool {
+		return covered[a][0] < covered[b][0]
+	})
+	var toReturn [][2]uint64
+	position := h.FileOffset
+	end := h.FileOffset + h.FileSize
+	for _, c := range covered {
+		if c[0] > position {
+			gapEnd := c[0]
+			if gapEnd > end {
+				gapEnd = end
+			}
+			if gapEnd > position {
+				toReturn = append(toReturn, [2]uint64{position, gapEnd})
+			}
+		}
+		if c[1] > position {
+			position = c[1]
+		}
+	}
+	if position < end {
+		toReturn = append(toReturn, [2]uint64{position, end})
+	}
+	return toReturn
+}
+
+// Adds a section covering an uncovered range of each loadable segment with
+// the given flags. The range containing the given address is used if there is
+// one, otherwise the largest range is used.
+func (s *reconstructState) addGapSections(name string, segmentFlags uint32,
+	sectionFlags, align, preferred uint64) {
+	for i := range s.segments {
+		h := &(s.segments[i])
+		if (h.Type != LoadableSegment) ||
+			((uint32(h.Flags) & segmentFlags) != segmentFlags) {
+			continue
+		}
+		gaps := s.segmentGaps(h)
+		if len(gaps) == 0 {
+			continue
+		}
+		best := gaps[0]
+		for _, g := range gaps {
+			address := h.VirtualAddress + (g[0] - h.FileOffset)
+			if (preferred >= address) &&
+				(preferred < (address + (g[1] - g[0]))) {
+				best = g
+				break
+			}
+			if (g[1] - g[0]) > (best[1] - best[0]) {
+				best = g
+			}
+		}
+		address := h.VirtualAddress + (best[0] - h.FileOffset)
+		// The gap may start at an address that doesn't satisfy the usual
+		// alignment, so reduce the alignment to match.
+		sectionAlign := align
+		for (sectionAlign > 1) && ((address % sectionAlign) != 0) {
+			sectionAlign /= 2
+		}
+		s.addSection(name, BitsSection, sectionFlags, address,
+			best[1]-best[0], sectionAlign, 0, "", 0)
+	}
+}
+
+// Adds a .bss section for the part of each writable loadable segment that
+// isn't backed by the file.
+func (s *reconstructState) addBSSSections() {
+	for i := range s.segments {
+		h := &(s.segments[i])
+		if (h.Type != LoadableSegment) || ((h.Flags & 2) == 0) ||
+			(h.MemorySize <= h.FileSize) {
+			continue
+		}
+		header := ELF64SectionHeader{
+			Type:           UninitializedSection,
+			Flags:          reconstructedWrite | reconstructedAlloc,
+			VirtualAddress: h.VirtualAddress + h.FileSize,
+			FileOffset:     h.FileOffset + h.FileSize,
+			Size:           h.MemorySize - h.FileSize,
+			Align:          s.wordSize,
+		}
+		if s.overlaps(&header) {
+			continue
+		}
+		s.sections = append(s.sections, reconstructedSection{
+			name:   ".bss",
+			header: header,
+		})
+	}
+}
+
+// Sorts the sections by address, resolves the links between them, and
+// returns the encoded section header table, including the null section and
+// a new section names table, which is placed at the given file offset.
+func (s *reconstructState) buildSectionTable(namesOffset uint64) ([]byte,
+	[]byte, error) {
+	sort.SliceStable(s.sections, func(a, b int) bool {
+		return s.sections[a].header.VirtualAddress <
+			s.sections[b].header.VirtualAddress
+	})
+	indices := make(map[string]uint32)
+	for i := range s.sections {
+		if _, ok := indices[s.sections[i].name]; !ok {
+			indices[s.sections[i].name] = uint32(i + 1)
+		}
+	}
+	names := []byte{0}
+	nameOffsets := make(map[string]uint32)
+	addName := func(name string) uint32 {
+		if offset, ok := nameOffsets[name]; ok {
+			return offset
+		}
+		offset := uint32(len(names))
+		names = append(append(names, []byte(name)...), 0)
+		nameOffsets[name] = offset
+		return offset
+	}
+	headers := make([]ELF64SectionHeader, 1, len(s.sections)+2)
+	for i := range s.sections {
+		current := &(s.sections[i])
+		current.header.Name = addName(current.name)
+		if current.link != "" {
+			current.header.LinkedIndex = indices[current.link]
+		}
+		headers = append(headers, current.header)
+	}
+	namesHeader := ELF64SectionHeader{
+		Name:       addName(".shstrtab"),
+		Type:       StringTableSection,
+		FileOffset: namesOffset,
+		Align:      1,
+	}
+	namesHeader.Size = uint64(len(names))
+	headers = append(headers, namesHeader)
+	table, e := encodeSectionHeaders(s.is64, s.order, headers)
+	if e != nil {
+		return nil, nil, e
+	}
+	return table, names, nil
+}
+
+// Synthesizes a section header table for the given ELF file using its
+// program headers and dynamic linking table, ignoring any existing section
+// headers. This is intended for files whose section headers were removed,
+// e.g. by sstrip, or are corrupt; such files can be parsed by passing
+// ParseOptions with Lenient set to ParseELFFileWithOptions. The synthesized
+// sections include .interp, notes, .dynamic, the dynamic symbol and string
+// tables, the hash and version tables, dynamic relocations, .init_array,
+// .fini_array, .eh_frame_hdr and .eh_frame, with .text, .data and .bss
+// sections covering the remaining content of the loadable segments. Returns
+// the repaired file's content, with the new section names table and section
+// header table appended, which can be written to disk or parsed using
+// ParseELFFile.
+func ReconstructSections(f ELFFile) ([]byte, error) {
+	s := reconstructState{
+		is64:     is64Bit(f),
+		order:    fileEndianness(f),
+		raw:      fileRaw(f),
+		layout:   getFileLayout(f),
+		wordSize: 4,
+		segments: programHeaders64(f),
+	}
+	if s.is64 {
+		s.wordSize = 8
+	}
+	if len(s.segments) == 0 {
+		return nil, fmt.Errorf("The file has no program headers")
+	}
+	s.readDynamicTable()
+	for i := range s.segments {
+		h := &(s.segments[i])
+		if h.Type == InterpreterSegment {
+			s.addSection(".interp", BitsSection, 0, h.VirtualAddress,
+				h.FileSize, 1, 0, "", 0)
+		}
+	}
+	s.addNoteSections()
+	s.addDynamicSections()
+	s.addWritableSections()
+	s.addExceptionFrameSections()
+	// Code goes in the executable segments, and the rest of the writable
+	// segments' file content is assumed to be data.
+	s.addGapSections(".text", 1, reconstructedExec, 16, entryPoint(f))
+	s.addGapSections(".data", 2, reconstructedWrite, s.wordSize, 0)
+	s.addBSSSections()
+	if len(s.sections) == 0 {
+		return nil, fmt.Errorf("No sections could be reconstructed")
+	}
+
+	// Keep all of the original content, including any trailing data, and
+	// append the names table and section header table.
+	toReturn := make([]byte, len(s.raw))
+	copy(toReturn, s.raw)
+	namesOffset := uint64(len(toReturn))
+	table, names, e := s.buildSectionTable(namesOffset)
+	if e != nil {
+		return nil, fmt.Errorf("Failed encoding section headers: %w", e)
+	}
+	toReturn = append(toReturn, names...)
+	toReturn, tableOffset := appendAligned(toReturn, table, s.wordSize)
+	sectionCount := uint16(len(s.sections) + 2)
+	header, e := encodeFileHeader(f, s.layout.ProgramHeaderOffset,
+		tableOffset, sectionCount, sectionCount-1)
+	if e != nil {
+		return nil, fmt.Errorf("Failed encoding ELF header: %w", e)
+	}
+	copy(toReturn, header)
+	return toReturn, nil
+}
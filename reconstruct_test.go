@@ -0,0 +1,241 @@
+package elf_reader
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// Returns a copy of the given ELF file with the section header table fields
+// in its header cleared, in the same way as sstrip.
+func removeSectionHeaders(raw []byte, is64 bool) []byte {
+	toReturn := make([]byte, len(raw))
+	copy(toReturn, raw)
+	if is64 {
+		binary.LittleEndian.PutUint64(toReturn[0x28:], 0)
+		copy(toReturn[0x3a:0x40], make([]byte, 6))
+	} else {
+		binary.LittleEndian.PutUint32(toReturn[0x20:], 0)
+		copy(toReturn[0x2e:0x34], make([]byte, 6))
+	}
+	return toReturn
+}
+
+// Returns the name of the section linked to by the section at the given index,
+// or an empty string if it isn't linked to another section.
+func linkedSectionName(f ELFFile, index uint16, t *testing.T) string {
+	header, e := f.GetSectionHeader(index)
+	if e != nil {
+		t.Fatalf("Failed getting section %d header: %s\n", index, e)
+	}
+	if header.GetLinkedIndex() == 0 {
+		return ""
+	}
+	name, e := f.GetSectionName(uint16(header.GetLinkedIndex()))
+	if e != nil {
+		t.Fatalf("Failed getting linked section name: %s\n", e)
+	}
+	return name
+}
+
+// Strips the section headers from the given file, reconstructs them, and
+// checks that the sections with the given names match the original ones.
+func testReconstruction(original ELFFile, expected []string, t *testing.T) {
+	raw := removeSectionHeaders(fileRaw(original), is64Bit(original))
+	stripped, e := ParseELFFile(raw)
+	if e != nil {
+		t.Fatalf("Failed parsing file without section headers: %s\n", e)
+	}
+	if stripped.GetSectionCount() != 0 {
+		t.Fatalf("The section headers weren't removed\n")
+	}
+	repaired, e := ReconstructSections(stripped)
+	if e != nil {
+		t.Fatalf("Failed reconstructing sections: %s\n", e)
+	}
+	f, e := ParseELFFile(repaired)
+	if e != nil {
+		t.Fatalf("Failed parsing reconstructed file: %s\n", e)
+	}
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		name, e := f.GetSectionName(i)
+		if e != nil {
+			t.Fatalf("Failed getting section %d name: %s\n", i, e)
+		}
+		h, _ := f.GetSectionHeader(i)
+		t.Logf("Reconstructed %s: %s\n", name, h)
+	}
+	for _, name := range expected {
+		a, e := FindSectionByName(original, name)
+		if e != nil {
+			t.Fatalf("Original file is missing %s: %s\n", name, e)
+		}
+		b, e := FindSectionByName(f, name)
+		if e != nil {
+			t.Errorf("Section %s wasn't reconstructed\n", name)
+			continue
+		}
+		x, _ := original.GetSectionHeader(a)
+		y, _ := f.GetSectionHeader(b)
+		if (x.GetVirtualAddress() != y.GetVirtualAddress()) ||
+			(x.GetSize() != y.GetSize()) || (x.GetType() != y.GetType()) {
+			t.Errorf("Reconstructed %s doesn't match the original. Got %s, "+
+				"expected %s\n", name, y, x)
+		}
+		linkA := linkedSectionName(original, a, t)
+		linkB := linkedSectionName(f, b, t)
+		if linkA != linkB {
+			t.Errorf("Reconstructed %s is linked to %q, expected %q\n", name,
+				linkB, linkA)
+		}
+	}
+
+	index, e := FindSectionByName(f, ".dynsym")
+	if e != nil {
+		t.Fatalf("Reconstructed file is missing .dynsym: %s\n", e)
+	}
+	_, names, e := f.GetSymbols(index)
+	if e != nil {
+		t.Fatalf("Failed reading reconstructed symbols: %s\n", e)
+	}
+	index, _ = FindSectionByName(original, ".dynsym")
+	_, originalNames, _ := original.GetSymbols(index)
+	if len(names) != len(originalNames) {
+		t.Fatalf("Expected %d dynamic symbols, got %d\n",
+			len(originalNames), len(names))
+	}
+	for i := range names {
+		if names[i] != originalNames[i] {
+			t.Errorf("Symbol %d is named %s, expected %s\n", i, names[i],
+				originalNames[i])
+		}
+	}
+	requirements, e := GetVersionRequirements(f)
+	if (e != nil) || (len(requirements) == 0) {
+		t.Errorf("Failed reading reconstructed version requirements: %v\n",
+			e)
+	}
+}
+
+func TestReconstructSections(t *testing.T) {
+	testReconstruction(parseTestELF64("test_data/sleep_amd64", t), []string{
+		".interp", ".note.ABI-tag", ".note.gnu.build-id", ".gnu.hash",
+		".dynsym", ".dynstr", ".gnu.version", ".gnu.version_r", ".rela.dyn",
+		".rela.plt", ".eh_frame_hdr", ".eh_frame", ".init_array",
+		".fini_array", ".dynamic", ".bss",
+	}, t)
+	testReconstruction(parseTestELF32("test_data/sleep_arm32", t), []string{
+		".interp", ".note.ABI-tag", ".note.gnu.build-id", ".gnu.hash",
+		".dynsym", ".dynstr", ".gnu.version", ".gnu.version_r", ".rel.dyn",
+		".rel.plt", ".init_array", ".fini_array", ".dynamic", ".bss",
+	}, t)
+}
+
+func TestReconstructWithoutSegments(t *testing.T) {
+	f := parseTestELF64("test_data/hello_debug_amd64.o", t)
+	_, e := ReconstructSections(f)
+	if e == nil {
+		t.Errorf("Didn't get an error for a file without segments\n")
+	}
+}
+
+func TestReconstructCorruptHeaders(t *testing.T) {
+	raw := fileBytes("test_data/sleep_amd64", t)
+	corrupt := make([]byte, len(raw))
+	copy(corrupt, raw)
+	binary.LittleEndian.PutUint64(corrupt[0x28:], 0xffffff00)
+	_, e := ParseELFFile(corrupt)
+	if e == nil {
+		t.Fatalf("Didn't get an error for a corrupt section header offset\n")
+	}
+	f, e := ParseELFFileWithOptions(corrupt, &ParseOptions{Lenient: true})
+	if e != nil {
+		t.Fatalf("Failed parsing corrupt file leniently: %s\n", e)
+	}
+	repaired, e := ReconstructSections(f)
+	if e != nil {
+		t.Fatalf("Failed reconstructing sections: %s\n", e)
+	}
+	f, e = ParseELFFile(repaired)
+	if e != nil {
+		t.Fatalf("Failed parsing repaired file: %s\n", e)
+	}
+	_, e = FindSectionByName(f, ".dynamic")
+	if e != nil {
+		t.Errorf("Repaired file is missing .dynamic: %s\n", e)
+	}
+}
+
+func TestReconstructOverflowingSegments(t *testing.T) {
+	original := parseTestELF64("test_data/sleep_amd64", t)
+	raw := removeSectionHeaders(original.Raw, true)
+	// Each change is applied to every loadable segment in turn: a file
+	// offset or virtual address that overflows when the size is added.
+	changes := []struct {
+		fieldOffset uint64
+		value       uint64
+	}{
+		{8, 0xfffffffffffffda5},
+		{16, 0xfffffffffffffff0},
+	}
+	for i, h := range original.Segments {
+		if h.Type != LoadableSegment {
+			continue
+		}
+		for _, c := range changes {
+			corrupt := make([]byte, len(raw))
+			copy(corrupt, raw)
+			offset := original.Header.ProgramHeaderOffset + uint64(i)*56 +
+				c.fieldOffset
+			binary.LittleEndian.PutUint64(corrupt[offset:], c.value)
+			f, e := ParseELFFileWithOptions(corrupt,
+				&ParseOptions{Lenient: true})
+			if e != nil {
+				t.Logf("Failed parsing corrupt file: %s\n", e)
+				continue
+			}
+			// This only needs to return without panicking.
+			_, e = ReconstructSections(f)
+			if e != nil {
+				t.Logf("Failed reconstructing sections: %s\n", e)
+			}
+		}
+	}
+}
+
+func TestReconstructVersionChainSize(t *testing.T) {
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	index, e := FindSectionByName(f, ".gnu.version_r")
+	if e != nil {
+		t.Fatalf("Failed finding .gnu.version_r: %s\n", e)
+	}
+	h := f.Sections[index]
+	raw := make([]byte, len(f.Raw))
+	copy(raw, f.Raw)
+	s := &reconstructState{
+		is64:     true,
+		order:    binary.LittleEndian,
+		raw:      raw,
+		wordSize: 8,
+		segments: f.Segments,
+	}
+	size := func(count uint64) uint64 {
+		return s.versionChainSize(h.VirtualAddress, count, 16, 2, 8, 16, 12)
+	}
+	if size(uint64(h.Info)) != h.Size {
+		t.Errorf("Expected a chain size of %d, got %d\n", h.Size,
+			size(uint64(h.Info)))
+	}
+	// A count that can't fit in the file must be rejected without walking
+	// the chain.
+	if size(1<<40) != 0 {
+		t.Errorf("Didn't reject a version requirement count of 2^40\n")
+	}
+	// Make the first entry's next field refer to its own first auxiliary
+	// entry.
+	entry := raw[h.FileOffset:]
+	binary.LittleEndian.PutUint32(entry[12:],
+		binary.LittleEndian.Uint32(entry[8:]))
+	if size(0xffff) != 0 {
+		t.Errorf("Didn't reject a chain with a revisited entry\n")
+	}
+}
@@ -0,0 +1,452 @@
+package elf_reader
+
+// This file contains code for finding and parsing the ELF files inside
+// packages and other containers, such as .deb and .rpm packages, tar and zip
+// archives, and OCI image layers.
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// Separates the names of nested containers in the paths of scanned files,
+// e.g. "package.deb!data.tar.xz!./usr/bin/ls".
+const ScanPathSeparator = "!"
+
+// The default limits used if they aren't set in ScanOptions.
+const (
+	defaultScanMaxDepth    = 16
+	defaultScanMaxFileSize = 1 << 30
+)
+
+// The number of bytes read from the start of each file to determine its
+// format.
+const scanSniffSize = 512
+
+// Options for ScanContainer. The zero value uses the defaults.
+type ScanOptions struct {
+	// The number of ELF files to parse at once. Defaults to the number of
+	// CPUs.
+	Concurrency int
+	// The maximum number of nested containers to open, where each layer of
+	// compression counts as a container. Defaults to 16.
+	MaxDepth int
+	// The largest file that will be read into memory, in bytes. This
+	// applies to ELF files, and to zip and ar archives that are nested in
+	// other containers. Defaults to 1 GB.
+	MaxFileSize int64
+}
+
+// Holds the result of parsing a single ELF file found by ScanContainer.
+type ScanResult struct {
+	// The path to the file, starting with the path to the container and
+	// followed by the path within each nested container, separated by
+	// ScanPathSeparator. Compression layers don't add to the path.
+	Path string
+	// The parsed file. This is nil if Error is set.
+	File ELFFile
+	// Set if the file couldn't be read or parsed. This is also set, with a
+	// nil File, if a nested container couldn't be read. In that case, Path
+	// is the path to the container.
+	Error error
+}
+
+// The formats recognized by ScanContainer.
+type containerFormat int
+
+const (
+	unknownFormat containerFormat = iota
+	elfFormat
+	gzipFormat
+	bzip2Format
+	xzFormat
+	zstdFormat
+	zipFormat
+	arFormat
+	rpmFormat
+	tarFormat
+	cpioFormat
+)
+
+// Returned when scanning a file that isn't an ELF file or a recognized
+// container.
+var errUnknownFormat = fmt.Errorf("Unrecognized file format")
+
+// The magic bytes at the start of an RPM package and its headers.
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// The size of the "lead" at the start of an RPM package.
+const rpmLeadSize = 96
+
+// Returns the format of a file, given up to scanSniffSize bytes from its
+// start.
+func sniffFormat(header []byte) containerFormat {
+	switch {
+	case bytes.HasPrefix(header, []byte("\x7fELF")):
+		return elfFormat
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b, 0x08}):
+		return gzipFormat
+	case bytes.HasPrefix(header, []byte(XZMagic)):
+		return xzFormat
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return zstdFormat
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")),
+		bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return zipFormat
+	case bytes.HasPrefix(header, []byte(ArchiveMagic)):
+		return arFormat
+	case bytes.HasPrefix(header, rpmLeadMagic):
+		return rpmFormat
+	case IsCPIOArchive(header):
+		return cpioFormat
+	case (len(header) >= 262) && (string(header[257:262]) == "ustar"):
+		return tarFormat
+	}
+	// Check that a bzip2 block or the end of the stream follows the bzip2
+	// header, since "BZh" could easily be the start of a text file.
+	if (len(header) >= 10) && bytes.HasPrefix(header, []byte("BZh")) &&
+		(header[3] >= '1') && (header[3] <= '9') {
+		magic := header[4:10]
+		if bytes.Equal(magic, []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}) ||
+			bytes.Equal(magic, []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}) {
+			return bzip2Format
+		}
+	}
+	return unknownFormat
+}
+
+// An ELF file, or an error, to be handled by a scanner's workers.
+type scanJob struct {
+	path    string
+	content []byte
+	e       error
+}
+
+// Holds the state of a single call to ScanContainer.
+type containerScanner struct {
+	options ScanOptions
+	jobs    chan scanJob
+}
+
+// Reads all of the given reader's content, or returns an error if it's larger
+// than the maximum file size.
+func (s *containerScanner) readAll(r io.Reader) ([]byte, error) {
+	limit := s.options.MaxFileSize
+	content, e := io.ReadAll(io.LimitReader(r, limit+1))
+	if e != nil {
+		return nil, e
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("The file is larger than the %d-byte limit",
+			limit)
+	}
+	return content, nil
+}
+
+// Scans a file in a container. Unlike scan, this reports errors as results
+// rather than returning them, and ignores files in unrecognized formats.
+func (s *containerScanner) scanMember(path string, r io.Reader, depth int) {
+	e := s.scan(path, r, depth, nil, 0)
+	if (e != nil) && (e != errUnknownFormat) {
+		s.jobs <- scanJob{path: path, e: e}
+	}
+}
+
+// Scans the given file, which has the given path, sending each ELF file it
+// contains to the workers. If the file is available as an io.ReaderAt, it
+// can be passed as at, along with its size, to avoid reading zip archives
+// into memory. Returns errUnknownFormat if the file isn't an ELF file or a
+// recognized container.
+func (s *containerScanner) scan(path string, r io.Reader, depth int,
+	at io.ReaderAt, size int64) error {
+	if depth > s.options.MaxDepth {
+		return fmt.Errorf("Containers are nested more than %d levels deep",
+			s.options.MaxDepth)
+	}
+	input := bufio.NewReaderSize(r, 4096)
+	header, e := input.Peek(scanSniffSize)
+	if (e != nil) && (e != io.EOF) {
+		return e
+	}
+	switch sniffFormat(header) {
+	case elfFormat:
+		content, e := s.readAll(input)
+		if e != nil {
+			return e
+		}
+		s.jobs <- scanJob{path: path, content: content}
+		return nil
+	case gzipFormat:
+		decompressed, e := gzip.NewReader(input)
+		if e != nil {
+			return fmt.Errorf("Failed reading gzip data: %w", e)
+		}
+		defer decompressed.Close()
+		return s.scan(path, decompressed, depth+1, nil, 0)
+	case bzip2Format:
+		return s.scan(path, bzip2.NewReader(input), depth+1, nil, 0)
+	case xzFormat:
+		decompressed, e := NewXZReader(input)
+		if e != nil {
+			return fmt.Errorf("Failed reading xz data: %w", e)
+		}
+		return s.scan(path, decompressed, depth+1, nil, 0)
+	case zstdFormat:
+		return fmt.Errorf("zstd compression isn't supported")
+	case zipFormat:
+		return s.scanZip(path, input, depth, at, size)
+	case arFormat:
+		return s.scanAr(path, input, depth)
+	case rpmFormat:
+		return s.scanRPM(path, input, depth)
+	case tarFormat:
+		return s.scanTar(path, input, depth)
+	case cpioFormat:
+		return s.scanCPIO(path, input, depth)
+	}
+	return errUnknownFormat
+}
+
+// Scans the members of a zip archive.
+func (s *containerScanner) scanZip(path string, r io.Reader, depth int,
+	at io.ReaderAt, size int64) error {
+	if at == nil {
+		content, e := s.readAll(r)
+		if e != nil {
+			return e
+		}
+		at = bytes.NewReader(content)
+		size = int64(len(content))
+	}
+	archive, e := zip.NewReader(at, size)
+	if e != nil {
+		return fmt.Errorf("Failed reading zip archive: %w", e)
+	}
+	for _, f := range archive.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		memberPath := path + ScanPathSeparator + f.Name
+		content, e := f.Open()
+		if e != nil {
+			s.jobs <- scanJob{path: memberPath, e: e}
+			continue
+		}
+		s.scanMember(memberPath, content, depth+1)
+		content.Close()
+	}
+	return nil
+}
+
+// Scans the members of an ar archive, such as a .deb package.
+func (s *containerScanner) scanAr(path string, r io.Reader, depth int) error {
+	content, e := s.readAll(r)
+	if e != nil {
+		return e
+	}
+	archive, e := ParseArchive(content)
+	if e != nil {
+		return e
+	}
+	for i := range archive.Members {
+		m := &(archive.Members[i])
+		if m.Content == nil {
+			continue
+		}
+		s.scanMember(path+ScanPathSeparator+m.Name,
+			bytes.NewReader(m.Content), depth+1)
+	}
+	return nil
+}
+
+// Skips an RPM header structure, returning an error if it's invalid. If
+// aligned is true, the header is followed by padding to a multiple of 8
+// bytes, as is the case for the signature header.
+func skipRPMHeader(r io.Reader, aligned bool) error {
+	var header [16]byte
+	_, e := io.ReadFull(r, header[:])
+	if e != nil {
+		return fmt.Errorf("Failed reading RPM header: %w", e)
+	}
+	if !bytes.Equal(header[:4], rpmHeaderMagic) {
+		return fmt.Errorf("Invalid RPM header magic")
+	}
+	entryCount := binary.BigEndian.Uint32(header[8:])
+	dataSize := binary.BigEndian.Uint32(header[12:])
+	toSkip := int64(entryCount)*16 + int64(dataSize)
+	if aligned {
+		toSkip = (toSkip + 7) &^ 7
+	}
+	_, e = io.CopyN(io.Discard, r, toSkip)
+	if e != nil {
+		return fmt.Errorf("Failed reading RPM header: %w", e)
+	}
+	return nil
+}
+
+// Scans the payload of an RPM package, which is usually a compressed cpio
+// archive. The payload doesn't add to the path.
+func (s *containerScanner) scanRPM(path string, r io.Reader, depth int) error {
+	_, e := io.CopyN(io.Discard, r, rpmLeadSize)
+	if e != nil {
+		return fmt.Errorf("Failed reading RPM lead: %w", e)
+	}
+	// The lead is followed by the signature header, then the main header.
+	e = skipRPMHeader(r, true)
+	if e != nil {
+		return e
+	}
+	e = skipRPMHeader(r, false)
+	if e != nil {
+		return e
+	}
+	e = s.scan(path, r, depth+1, nil, 0)
+	if e == errUnknownFormat {
+		return fmt.Errorf("Unrecognized RPM payload format")
+	}
+	return e
+}
+
+// Scans the regular files in a tar archive, such as an OCI image layer.
+func (s *containerScanner) scanTar(path string, r io.Reader, depth int) error {
+	archive := tar.NewReader(r)
+	for {
+		header, e := archive.Next()
+		if e == io.EOF {
+			return nil
+		}
+		if e != nil {
+			return fmt.Errorf("Failed reading tar archive: %w", e)
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		s.scanMember(path+ScanPathSeparator+header.Name, archive, depth+1)
+	}
+}
+
+// Scans the regular files in a cpio archive.
+func (s *containerScanner) scanCPIO(path string, r io.Reader,
+	depth int) error {
+	archive := NewCPIOReader(r)
+	for {
+		header, e := archive.Next()
+		if e == io.EOF {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		if !header.IsRegular() || (header.Size == 0) {
+			continue
+		}
+		s.scanMember(path+ScanPathSeparator+header.Name, archive, depth+1)
+	}
+}
+
+// Parses an ELF file, converting a panic to an error so that a single bad
+// file doesn't stop the scan.
+func parseScannedELF(content []byte) (f ELFFile, e error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f = nil
+			e = fmt.Errorf("Panic while parsing the ELF file: %v", r)
+		}
+	}()
+	return ParseELFFile(content)
+}
+
+// Parses the ELF files sent to the scanner, passing the results to the
+// handler.
+func (s *containerScanner) work(handler func(*ScanResult)) {
+	for job := range s.jobs {
+		result := &ScanResult{
+			Path:  job.path,
+			Error: job.e,
+		}
+		if job.e == nil {
+			result.File, result.Error = parseScannedELF(job.content)
+		}
+		handler(result)
+	}
+}
+
+// Scans the container read from the given reader, calling the handler for
+// each ELF file it contains. The name is used as the start of each result's
+// path. See ScanContainer for more information.
+func ScanContainerReader(name string, r io.Reader, options *ScanOptions,
+	handler func(*ScanResult)) error {
+	return scanContainer(name, r, nil, 0, options, handler)
+}
+
+// Finds and parses the ELF files in the package or container at the given
+// path, including any nested containers, calling the handler with the result
+// for each one. Supported formats are .deb and .rpm packages, tar, zip, ar
+// and cpio archives, including OCI image layers, compressed with gzip, bzip2
+// or xz. The file may also be a single ELF file. ELF files are recognized by
+// their content rather than their names.
+//
+// The handler may be called concurrently from multiple goroutines. A file
+// that can't be parsed, or a nested container that can't be read, is passed
+// to the handler with its Error set and doesn't stop the scan. Returns an
+// error only if the container itself can't be read.
+func ScanContainer(containerPath string, options *ScanOptions,
+	handler func(*ScanResult)) error {
+	f, e := os.Open(containerPath)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+	info, e := f.Stat()
+	if e != nil {
+		return e
+	}
+	return scanContainer(containerPath, f, f, info.Size(), options, handler)
+}
+
+func scanContainer(name string, r io.Reader, at io.ReaderAt, size int64,
+	options *ScanOptions, handler func(*ScanResult)) error {
+	s := &containerScanner{}
+	if options != nil {
+		s.options = *options
+	}
+	if s.options.Concurrency <= 0 {
+		s.options.Concurrency = runtime.NumCPU()
+	}
+	if s.options.MaxDepth <= 0 {
+		s.options.MaxDepth = defaultScanMaxDepth
+	}
+	if s.options.MaxFileSize <= 0 {
+		s.options.MaxFileSize = defaultScanMaxFileSize
+	}
+	s.jobs = make(chan scanJob, s.options.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < s.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(handler)
+		}()
+	}
+	e := s.scan(name, r, 0, at, size)
+	close(s.jobs)
+	wg.Wait()
+	if e == errUnknownFormat {
+		return fmt.Errorf("%s isn't an ELF file or a supported container",
+			name)
+	}
+	return e
+}
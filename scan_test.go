@@ -0,0 +1,312 @@
+package elf_reader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// A file to be written to one of the test containers.
+type testContainerFile struct {
+	name    string
+	content []byte
+}
+
+func makeTestTar(files []testContainerFile, t *testing.T) []byte {
+	var b bytes.Buffer
+	w := tar.NewWriter(&b)
+	e := w.WriteHeader(&tar.Header{
+		Name:     "./usr/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+	})
+	if e != nil {
+		t.Fatalf("Failed writing tar header: %s\n", e)
+	}
+	for _, f := range files {
+		e = w.WriteHeader(&tar.Header{
+			Name:     f.name,
+			Typeflag: tar.TypeReg,
+			Mode:     0755,
+			Size:     int64(len(f.content)),
+		})
+		if e != nil {
+			t.Fatalf("Failed writing tar header: %s\n", e)
+		}
+		_, e = w.Write(f.content)
+		if e != nil {
+			t.Fatalf("Failed writing tar content: %s\n", e)
+		}
+	}
+	e = w.Close()
+	if e != nil {
+		t.Fatalf("Failed finishing tar archive: %s\n", e)
+	}
+	return b.Bytes()
+}
+
+func gzipTestData(data []byte, t *testing.T) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, e := w.Write(data)
+	if e == nil {
+		e = w.Close()
+	}
+	if e != nil {
+		t.Fatalf("Failed compressing data: %s\n", e)
+	}
+	return b.Bytes()
+}
+
+func makeTestZip(files []testContainerFile, t *testing.T) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, f := range files {
+		fw, e := w.Create(f.name)
+		if e != nil {
+			t.Fatalf("Failed creating zip member: %s\n", e)
+		}
+		_, e = fw.Write(f.content)
+		if e != nil {
+			t.Fatalf("Failed writing zip member: %s\n", e)
+		}
+	}
+	e := w.Close()
+	if e != nil {
+		t.Fatalf("Failed finishing zip archive: %s\n", e)
+	}
+	return b.Bytes()
+}
+
+// Returns a newc-format cpio archive containing the files, or an odc-format
+// archive if portable is true.
+func makeTestCPIO(files []testContainerFile, portable bool) []byte {
+	var b bytes.Buffer
+	pad := func() {
+		for (b.Len() % 4) != 0 {
+			b.WriteByte(0)
+		}
+	}
+	writeEntry := func(name string, mode int, content []byte) {
+		if portable {
+			fmt.Fprintf(&b, "%s%06o%06o%06o%06o%06o%06o%06o%011o%06o"+
+				"%011o%s\x00", CPIOPortableMagic, 0, 0, mode, 0, 0, 1, 0, 0, len(name)+1,
+				len(content), name)
+			b.Write(content)
+			return
+		}
+		fmt.Fprintf(&b, "%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x"+
+			"%08x%08x%s\x00", CPIONewMagic, 0, mode, 0, 0, 1, 0,
+			len(content), 0, 0, 0, 0, len(name)+1, 0, name)
+		pad()
+		b.Write(content)
+		pad()
+	}
+	writeEntry("./usr", 040755, nil)
+	for _, f := range files {
+		writeEntry(f.name, 0100755, f.content)
+	}
+	writeEntry(cpioTrailerName, 0, nil)
+	return b.Bytes()
+}
+
+// Returns an RPM package with the given payload and empty headers.
+func makeTestRPM(payload []byte) []byte {
+	var b bytes.Buffer
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	b.Write(lead)
+	writeHeader := func(entryCount, dataSize int, aligned bool) {
+		b.Write(rpmHeaderMagic)
+		b.Write(make([]byte, 4))
+		binary.Write(&b, binary.BigEndian, uint32(entryCount))
+		binary.Write(&b, binary.BigEndian, uint32(dataSize))
+		size := entryCount*16 + dataSize
+		if aligned {
+			size = (size + 7) &^ 7
+		}
+		b.Write(make([]byte, size))
+	}
+	writeHeader(1, 5, true)
+	writeHeader(2, 3, false)
+	b.Write(payload)
+	return b.Bytes()
+}
+
+// Returns a .deb package with the given data.tar.gz content.
+func makeTestDeb(data []byte, t *testing.T) []byte {
+	control := gzipTestData(makeTestTar([]testContainerFile{
+		{"./control", []byte("Package: test\n")},
+	}, t), t)
+	var b bytes.Buffer
+	b.WriteString(ArchiveMagic)
+	members := []testContainerFile{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", control},
+		{"data.tar.gz", data},
+	}
+	for _, m := range members {
+		b.WriteString(archiveHeader(m.name, len(m.content)))
+		b.Write(m.content)
+		if (len(m.content) % 2) != 0 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+// Scans the container at the given path, returning the results by path.
+func scanTestContainer(path string, options *ScanOptions,
+	t *testing.T) map[string]*ScanResult {
+	toReturn := make(map[string]*ScanResult)
+	var lock sync.Mutex
+	e := ScanContainer(path, options, func(r *ScanResult) {
+		lock.Lock()
+		defer lock.Unlock()
+		toReturn[r.Path] = r
+	})
+	if e != nil {
+		t.Fatalf("Failed scanning %s: %s\n", path, e)
+	}
+	return toReturn
+}
+
+// Checks that the scan results contain exactly the expected paths, mapped to
+// the expected machine types, or 0 if the path should have an error.
+func checkScanResults(results map[string]*ScanResult,
+	expected map[string]MachineType, t *testing.T) {
+	paths := make([]string, 0, len(results))
+	for path := range results {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		r := results[path]
+		machine, ok := expected[path]
+		if !ok {
+			t.Errorf("Got unexpected result for %s: %v\n", path, r.Error)
+			continue
+		}
+		if machine == 0 {
+			if r.Error == nil {
+				t.Errorf("Didn't get an error for %s\n", path)
+			} else {
+				t.Logf("Got expected error for %s: %s\n", path, r.Error)
+			}
+			continue
+		}
+		if r.Error != nil {
+			t.Errorf("Failed parsing %s: %s\n", path, r.Error)
+			continue
+		}
+		if r.File.GetMachineType() != machine {
+			t.Errorf("Got wrong machine type for %s: %s\n", path,
+				r.File.GetMachineType())
+			continue
+		}
+		t.Logf("Found %s: %s\n", path, machine)
+	}
+	for path := range expected {
+		if results[path] == nil {
+			t.Errorf("Didn't get a result for %s\n", path)
+		}
+	}
+}
+
+func TestScanContainer(t *testing.T) {
+	sleep64 := fileBytes("test_data/sleep_amd64", t)
+	sleep32 := fileBytes("test_data/sleep_arm32", t)
+	sleepXZ := fileBytes("test_data/sleep_amd64.xz", t)
+	// A truncated file, missing its section headers.
+	broken := sleep64[:200]
+	dir := t.TempDir()
+	writeFile := func(name string, content []byte) string {
+		path := filepath.Join(dir, name)
+		e := os.WriteFile(path, content, 0644)
+		if e != nil {
+			t.Fatalf("Failed writing %s: %s\n", path, e)
+		}
+		return path
+	}
+
+	// A .deb package, containing an ELF file, an xz-compressed ELF file, a
+	// text file and an invalid ELF file.
+	data := gzipTestData(makeTestTar([]testContainerFile{
+		{"./usr/bin/sleep", sleep64},
+		{"./usr/lib/sleep.xz", sleepXZ},
+		{"./usr/share/doc/README", []byte("Not an ELF file.\n")},
+		{"./usr/bin/broken", broken},
+	}, t), t)
+	path := writeFile("test.deb", makeTestDeb(data, t))
+	results := scanTestContainer(path, nil, t)
+	checkScanResults(results, map[string]MachineType{
+		path + "!data.tar.gz!./usr/bin/sleep":    MachineTypeAMD64,
+		path + "!data.tar.gz!./usr/lib/sleep.xz": MachineTypeAMD64,
+		path + "!data.tar.gz!./usr/bin/broken":   0,
+	}, t)
+
+	// An RPM package with a gzip-compressed newc cpio payload.
+	payload := gzipTestData(makeTestCPIO([]testContainerFile{
+		{"./usr/bin/sleep", sleep32},
+		{"./usr/share/doc/README", []byte("Not an ELF file.\n")},
+	}, false), t)
+	path = writeFile("test.rpm", makeTestRPM(payload))
+	results = scanTestContainer(path, &ScanOptions{Concurrency: 1}, t)
+	checkScanResults(results, map[string]MachineType{
+		path + "!./usr/bin/sleep": MachineTypeARM,
+	}, t)
+
+	// An OCI image layout tarball, with a layer in its blobs, and a zip
+	// file containing an odc cpio archive.
+	layer := gzipTestData(makeTestTar([]testContainerFile{
+		{"bin/sleep", sleep32},
+		{"lib/broken.so", broken},
+	}, t), t)
+	oci := makeTestTar([]testContainerFile{
+		{"oci-layout", []byte("{\"imageLayoutVersion\": \"1.0.0\"}")},
+		{"blobs/sha256/0123", layer},
+	}, t)
+	cpio := makeTestCPIO([]testContainerFile{
+		{"sleep", sleep64},
+	}, true)
+	path = writeFile("test.zip", makeTestZip([]testContainerFile{
+		{"image.tar", oci},
+		{"files.cpio", cpio},
+	}, t))
+	results = scanTestContainer(path, &ScanOptions{Concurrency: 3}, t)
+	checkScanResults(results, map[string]MachineType{
+		path + "!image.tar!blobs/sha256/0123!bin/sleep":     MachineTypeARM,
+		path + "!image.tar!blobs/sha256/0123!lib/broken.so": 0,
+		path + "!files.cpio!sleep":                          MachineTypeAMD64,
+	}, t)
+
+	// Containers nested too deeply should be reported as errors, without
+	// stopping the scan.
+	results = scanTestContainer(path, &ScanOptions{MaxDepth: 2}, t)
+	checkScanResults(results, map[string]MachineType{
+		path + "!image.tar!blobs/sha256/0123": 0,
+		path + "!files.cpio!sleep":            MachineTypeAMD64,
+	}, t)
+
+	// A single ELF file should be scanned as-is, but other files should
+	// be rejected.
+	path = "test_data/sleep_amd64"
+	results = scanTestContainer(path, nil, t)
+	checkScanResults(results, map[string]MachineType{
+		path: MachineTypeAMD64,
+	}, t)
+	e := ScanContainer("README.md", nil, func(r *ScanResult) {})
+	if e == nil {
+		t.Errorf("Didn't get an error scanning a text file\n")
+	} else {
+		t.Logf("Got expected error scanning a text file: %s\n", e)
+	}
+}
@@ -0,0 +1,132 @@
+package elf_reader
+
+// This file contains code for determining which sections are contained in
+// each segment, using the same rules as readelf -l.
+
+// The section flag bit indicating that a section holds thread-local storage.
+const sectionFlagTLS = 0x400
+
+// Returns the size that the section occupies in the segment. A .tbss section
+// takes up no space in any segment other than the TLS segment, since each
+// thread gets its own copy.
+func sizeInSegment(s *ELF64SectionHeader, p *ELF64ProgramHeader) uint64 {
+	if ((s.Flags & sectionFlagTLS) != 0) && (s.Type == UninitializedSection) &&
+		(p.Type != TLSSegment) {
+		return 0
+	}
+	return s.Size
+}
+
+// Returns true if the section is contained in the segment. This follows the
+// same rules as readelf: TLS sections may only be in TLS, loadable or RELRO
+// segments, the TLS segment may only contain TLS sections, and .tbss is only
+// considered to be in the TLS segment. Sections other than NOBITS sections
+// must lie within the segment's file content, and allocated sections must
+// also lie within its memory. Empty sections at the boundaries of dynamic or
+// note segments aren't counted.
+func sectionInSegment(s *ELF64SectionHeader, p *ELF64ProgramHeader) bool {
+	isTLS := (s.Flags & sectionFlagTLS) != 0
+	isNoBits := s.Type == UninitializedSection
+	allocated := s.Flags.Allocated()
+	if isTLS {
+		if (p.Type != TLSSegment) && (p.Type != LoadableSegment) &&
+			(p.Type != GNURelroSegment) {
+			return false
+		}
+		if isNoBits && (p.Type != TLSSegment) {
+			return false
+		}
+	} else if (p.Type == TLSSegment) || (p.Type == ProgramHeaderSegment) {
+		return false
+	}
+	if !allocated {
+		switch p.Type {
+		case LoadableSegment, DynamicLinkingSegment, GNUEHFrameSegment,
+			GNUStackSegment, GNURelroSegment:
+			return false
+		}
+	}
+	size := sizeInSegment(s, p)
+	if !isNoBits {
+		if s.FileOffset < p.FileOffset {
+			return false
+		}
+		offset := s.FileOffset - p.FileOffset
+		// As in readelf, this wraps around if the segment's file size is 0,
+		// so only the check below applies.
+		if offset > (p.FileSize - 1) {
+			return false
+		}
+		if (size > p.FileSize) || (offset > (p.FileSize - size)) {
+			return false
+		}
+	}
+	if allocated {
+		if s.VirtualAddress < p.VirtualAddress {
+			return false
+		}
+		offset := s.VirtualAddress - p.VirtualAddress
+		if offset > (p.MemorySize - 1) {
+			return false
+		}
+		if (size > p.MemorySize) || (offset > (p.MemorySize - size)) {
+			return false
+		}
+	}
+	if ((p.Type != DynamicLinkingSegment) && (p.Type != NoteSegment)) ||
+		(s.Size != 0) || (p.MemorySize == 0) {
+		return true
+	}
+	// The section is empty and in a dynamic or note segment, so it must be
+	// strictly inside the segment.
+	if !isNoBits && ((s.FileOffset <= p.FileOffset) ||
+		((s.FileOffset - p.FileOffset) >= p.FileSize)) {
+		return false
+	}
+	if allocated && ((s.VirtualAddress <= p.VirtualAddress) ||
+		((s.VirtualAddress - p.VirtualAddress) >= p.MemorySize)) {
+		return false
+	}
+	return true
+}
+
+// Returns the indices of the sections contained in the segment at the given
+// index, in the same way as the section to segment mapping printed by
+// readelf -l.
+func GetSegmentSections(f ELFFile, segmentIndex uint16) ([]uint16, error) {
+	segments := programHeaders64(f)
+	if int(segmentIndex) >= len(segments) {
+		return nil, &InvalidIndexError{"segment", uint64(segmentIndex)}
+	}
+	segment := &(segments[segmentIndex])
+	sections := sectionHeaders64(f)
+	var toReturn []uint16
+	// The null section is never in a segment.
+	for i := 1; i < len(sections); i++ {
+		if sectionInSegment(&(sections[i]), segment) {
+			toReturn = append(toReturn, uint16(i))
+		}
+	}
+	return toReturn, nil
+}
+
+// Returns the indices of the segments containing the section at the given
+// index.
+func GetSectionSegments(f ELFFile, sectionIndex uint16) ([]uint16, error) {
+	sections := sectionHeaders64(f)
+	if int(sectionIndex) >= len(sections) {
+		return nil, &InvalidIndexError{"section", uint64(sectionIndex)}
+	}
+	if sectionIndex == 0 {
+		return nil, nil
+	}
+	section := &(sections[sectionIndex])
+	segments := programHeaders64(f)
+	var toReturn []uint16
+	for i := range segments {
+		if sectionInSegment(section, &(segments[i])) {
+			toReturn = append(toReturn, uint16(i))
+		}
+	}
+	return toReturn, nil
+}
@@ -0,0 +1,176 @@
+package elf_reader
+
+import (
+	"errors"
+	"testing"
+)
+
+// Returns the names of the sections with the given indices.
+func sectionNames(f ELFFile, indices []uint16, t *testing.T) []string {
+	toReturn := make([]string, len(indices))
+	for i, index := range indices {
+		name, e := f.GetSectionName(index)
+		if e != nil {
+			t.Fatalf("Failed getting section %d name: %s\n", index, e)
+		}
+		toReturn[i] = name
+	}
+	return toReturn
+}
+
+func TestSegmentSections(t *testing.T) {
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	// These match the section to segment mapping printed by readelf -l.
+	expected := [][]string{
+		nil,
+		[]string{".interp"},
+		[]string{".interp", ".note.ABI-tag", ".note.gnu.build-id",
+			".gnu.hash", ".dynsym", ".dynstr", ".gnu.version",
+			".gnu.version_r", ".rela.dyn", ".rela.plt", ".init", ".plt",
+			".plt.got", ".text", ".fini", ".rodata", ".eh_frame_hdr",
+			".eh_frame"},
+		[]string{".init_array", ".fini_array", ".dynamic", ".got", ".data",
+			".bss"},
+		[]string{".dynamic"},
+		[]string{".note.ABI-tag", ".note.gnu.build-id"},
+		[]string{".eh_frame_hdr"},
+		nil,
+		[]string{".init_array", ".fini_array", ".dynamic", ".got"},
+	}
+	if int(f.GetSegmentCount()) != len(expected) {
+		t.Fatalf("Expected %d segments, got %d\n", len(expected),
+			f.GetSegmentCount())
+	}
+	for i := range expected {
+		sections, e := GetSegmentSections(f, uint16(i))
+		if e != nil {
+			t.Fatalf("Failed getting segment %d sections: %s\n", i, e)
+		}
+		names := sectionNames(f, sections, t)
+		t.Logf("Segment %d: %v\n", i, names)
+		if len(names) != len(expected[i]) {
+			t.Errorf("Expected %d sections in segment %d, got %d\n",
+				len(expected[i]), i, len(names))
+			continue
+		}
+		for j := range names {
+			if names[j] != expected[i][j] {
+				t.Errorf("Expected %s in segment %d, got %s\n",
+					expected[i][j], i, names[j])
+			}
+		}
+	}
+
+	index := testSectionIndex(f, ".dynamic", t)
+	segments, e := GetSectionSegments(f, index)
+	if e != nil {
+		t.Fatalf("Failed getting .dynamic segments: %s\n", e)
+	}
+	if (len(segments) != 3) || (segments[0] != 3) || (segments[1] != 4) ||
+		(segments[2] != 8) {
+		t.Errorf("Incorrect segments for .dynamic: %v\n", segments)
+	}
+	index = testSectionIndex(f, ".symtab", t)
+	segments, e = GetSectionSegments(f, index)
+	if (e != nil) || (len(segments) != 0) {
+		t.Errorf("Expected .symtab to be in no segments, got %v (%v)\n",
+			segments, e)
+	}
+	var invalidIndex *InvalidIndexError
+	_, e = GetSegmentSections(f, 100)
+	if !errors.As(e, &invalidIndex) {
+		t.Errorf("Expected an InvalidIndexError, got %v\n", e)
+	}
+	_, e = GetSectionSegments(f, 1000)
+	if !errors.As(e, &invalidIndex) {
+		t.Errorf("Expected an InvalidIndexError, got %v\n", e)
+	}
+}
+
+func TestSectionInSegmentSpecialCases(t *testing.T) {
+	load := ELF64ProgramHeader{
+		Type:           LoadableSegment,
+		FileOffset:     0x1000,
+		VirtualAddress: 0x401000,
+		FileSize:       0x100,
+		MemorySize:     0x200,
+	}
+	tls := load
+	tls.Type = TLSSegment
+	tls.FileSize = 0x10
+	tls.MemorySize = 0x20
+	tdata := ELF64SectionHeader{
+		Type:           BitsSection,
+		Flags:          2 | sectionFlagTLS,
+		VirtualAddress: 0x401000,
+		FileOffset:     0x1000,
+		Size:           0x10,
+	}
+	tbss := ELF64SectionHeader{
+		Type:           UninitializedSection,
+		Flags:          2 | sectionFlagTLS,
+		VirtualAddress: 0x401010,
+		FileOffset:     0x1010,
+		Size:           0x10,
+	}
+	data := ELF64SectionHeader{
+		Type:           BitsSection,
+		Flags:          3,
+		VirtualAddress: 0x401010,
+		FileOffset:     0x1010,
+		Size:           0xf0,
+	}
+	bss := ELF64SectionHeader{
+		Type:           UninitializedSection,
+		Flags:          3,
+		VirtualAddress: 0x401100,
+		FileOffset:     0x1100,
+		Size:           0x100,
+	}
+	comment := ELF64SectionHeader{
+		Type:       BitsSection,
+		FileOffset: 0x1020,
+		Size:       0x10,
+	}
+	tests := []struct {
+		name     string
+		section  *ELF64SectionHeader
+		segment  *ELF64ProgramHeader
+		expected bool
+	}{
+		{".tdata in LOAD", &tdata, &load, true},
+		{".tdata in TLS", &tdata, &tls, true},
+		{".tbss in LOAD", &tbss, &load, false},
+		{".tbss in TLS", &tbss, &tls, true},
+		{".data in TLS", &data, &tls, false},
+		{".data in LOAD", &data, &load, true},
+		{".bss in LOAD", &bss, &load, true},
+		{"non-allocated section in LOAD", &comment, &load, false},
+	}
+	for _, test := range tests {
+		result := sectionInSegment(test.section, test.segment)
+		if result != test.expected {
+			t.Errorf("%s: expected %v, got %v\n", test.name, test.expected,
+				result)
+		}
+	}
+
+	// An empty section at the start of a note segment isn't counted, but it
+	// is in a loadable segment.
+	note := load
+	note.Type = NoteSegment
+	empty := ELF64SectionHeader{
+		Type:           NoteSection,
+		Flags:          2,
+		VirtualAddress: 0x401000,
+		FileOffset:     0x1000,
+	}
+	if sectionInSegment(&empty, &note) {
+		t.Errorf("An empty section at the start of a note segment was " +
+			"counted\n")
+	}
+	if !sectionInSegment(&empty, &load) {
+		t.Errorf("An empty section at the start of a loadable segment " +
+			"wasn't counted\n")
+	}
+}
@@ -0,0 +1,299 @@
+package elf_reader
+
+// This file contains code for converting parsed ELF files, including any
+// changes made to their headers, back into bytes.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Describes a range of bytes in an ELF file that is occupied by a single
+// structure, such as a header table or a section's content.
+type fileRegion struct {
+	name  string
+	start uint64
+	end   uint64
+}
+
+// Returns an error if any of the given regions overlap. Empty regions are
+// ignored.
+func checkOverlaps(regions []fileRegion) error {
+	nonEmpty := make([]fileRegion, 0, len(regions))
+	for _, r := range regions {
+		if r.end < r.start {
+			return fmt.Errorf("The %s has an invalid size", r.name)
+		}
+		if r.end == r.start {
+			continue
+		}
+		nonEmpty = append(nonEmpty, r)
+	}
+	sort.SliceStable(nonEmpty, func(a, b int) bool {
+		return nonEmpty[a].start < nonEmpty[b].start
+	})
+	for i := 1; i < len(nonEmpty); i++ {
+		previous := &(nonEmpty[i-1])
+		current := &(nonEmpty[i])
+		if current.start < previous.end {
+			return fmt.Errorf("The %s (offsets 0x%x-0x%x) overlaps the %s "+
+				"(offsets 0x%x-0x%x)", current.name, current.start,
+				current.end, previous.name, previous.start, previous.end)
+		}
+	}
+	return nil
+}
+
+// Returns the binary form of the given file's ELF header, exactly as it's
+// currently set.
+func encodeCurrentHeader(f ELFFile) ([]byte, error) {
+	var toReturn []byte
+	var e error
+	switch v := f.(type) {
+	case *ELF64File:
+		toReturn, e = encodeBinary(v.Endianness, &(v.Header))
+	case *ELF32File:
+		toReturn, e = encodeBinary(v.Endianness, &(v.Header))
+	default:
+		return nil, fmt.Errorf("Unsupported ELF file type: %T", f)
+	}
+	if e != nil {
+		return nil, e
+	}
+	// Like when parsing, the signature is always treated as little-endian.
+	if len(toReturn) >= 4 {
+		var signature uint32
+		switch v := f.(type) {
+		case *ELF64File:
+			signature = v.Header.Signature
+		case *ELF32File:
+			signature = v.Header.Signature
+		}
+		binary.LittleEndian.PutUint32(toReturn, signature)
+	}
+	return toReturn, nil
+}
+
+// Moving or resizing sections may make the serialized file larger than the
+// original one, but only up to this size. Without a limit, a section moved to
+// a huge offset would require an enormous allocation.
+const maxSerializedFileSize = 1 << 30
+
+// Implements Serialize for either 32- or 64-bit ELF files. Requires the
+// section headers from when the file was parsed, in order to locate the
+// original section content.
+func serializeELF(f ELFFile, parsed []ELF64SectionHeader) ([]byte, error) {
+	raw := fileRaw(f)
+	is64 := is64Bit(f)
+	order := fileEndianness(f)
+	layout := getFileLayout(f)
+	sections := sectionHeaders64(f)
+	segments := programHeaders64(f)
+	var programHeaderSize, sectionHeaderSize int
+	if is64 {
+		programHeaderSize = binary.Size(&ELF64ProgramHeader{})
+		sectionHeaderSize = binary.Size(&ELF64SectionHeader{})
+	} else {
+		programHeaderSize = binary.Size(&ELF32ProgramHeader{})
+		sectionHeaderSize = binary.Size(&ELF32SectionHeader{})
+	}
+	if int(f.GetSegmentCount()) != len(segments) {
+		return nil, fmt.Errorf("The header specifies %d segments, but %d "+
+			"are defined", f.GetSegmentCount(), len(segments))
+	}
+	if int(f.GetSectionCount()) != len(sections) {
+		return nil, fmt.Errorf("The header specifies %d sections, but %d "+
+			"are defined", f.GetSectionCount(), len(sections))
+	}
+	if (len(segments) != 0) &&
+		(int(layout.ProgramHeaderEntrySize) != programHeaderSize) {
+		return nil, fmt.Errorf("Unsupported program header entry size: %d",
+			layout.ProgramHeaderEntrySize)
+	}
+	if (len(sections) != 0) &&
+		(int(layout.SectionHeaderEntrySize) != sectionHeaderSize) {
+		return nil, fmt.Errorf("Unsupported section header entry size: %d",
+			layout.SectionHeaderEntrySize)
+	}
+
+	header, e := encodeCurrentHeader(f)
+	if e != nil {
+		return nil, fmt.Errorf("Failed encoding the ELF header: %w", e)
+	}
+	if int(layout.HeaderSize) < len(header) {
+		return nil, fmt.Errorf("The header size (%d) is too small",
+			layout.HeaderSize)
+	}
+	programHeaders, e := encodeProgramHeaders(is64, order, segments)
+	if e != nil {
+		return nil, fmt.Errorf("Failed encoding program headers: %w", e)
+	}
+	sectionHeaders, e := encodeSectionHeaders(is64, order, sections)
+	if e != nil {
+		return nil, fmt.Errorf("Failed encoding section headers: %w", e)
+	}
+
+	// Make sure nothing will be written on top of anything else.
+	regions := []fileRegion{
+		fileRegion{
+			name:  "ELF header",
+			start: 0,
+			end:   uint64(layout.HeaderSize),
+		},
+	}
+	addRegion := func(name string, start, size uint64) error {
+		end, e := rangeEnd(start, size)
+		if e != nil {
+			return fmt.Errorf("Invalid location for the %s: %w", name, e)
+		}
+		regions = append(regions, fileRegion{
+			name:  name,
+			start: start,
+			end:   end,
+		})
+		return nil
+	}
+	e = addRegion("program header table", layout.ProgramHeaderOffset,
+		uint64(len(programHeaders)))
+	if e != nil {
+		return nil, e
+	}
+	e = addRegion("section header table", layout.SectionHeaderOffset,
+		uint64(len(sectionHeaders)))
+	if e != nil {
+		return nil, e
+	}
+	for i := 1; i < len(sections); i++ {
+		h := &(sections[i])
+		if h.Type == UninitializedSection {
+			continue
+		}
+		// Only sections that were moved or resized may extend past the end
+		// of the original file. Otherwise, a malformed section could make
+		// the output arbitrarily large.
+		if (i < len(parsed)) && (parsed[i].Type != UninitializedSection) {
+			end, e := rangeEnd(parsed[i].FileOffset, parsed[i].Size)
+			if (e != nil) || (end > uint64(len(raw))) {
+				return nil, fmt.Errorf("The original content of section %d "+
+					"is outside of the file", i)
+			}
+		}
+		e = addRegion(fmt.Sprintf("content of section %d", i), h.FileOffset,
+			h.Size)
+		if e != nil {
+			return nil, e
+		}
+	}
+	e = checkOverlaps(regions)
+	if e != nil {
+		return nil, e
+	}
+
+	size := uint64(len(raw))
+	for _, r := range regions {
+		// Empty regions, such as a missing section header table, may have
+		// arbitrary offsets.
+		if (r.end > size) && (r.end != r.start) {
+			size = r.end
+		}
+	}
+	if (size > uint64(len(raw))) && (size > maxSerializedFileSize) {
+		return nil, fmt.Errorf("The serialized file would be 0x%x bytes, "+
+			"which is more than the limit of 0x%x", size, maxSerializedFileSize)
+	}
+	toReturn := make([]byte, size)
+	copy(toReturn, raw)
+	// Move section content first, since the original content may be where
+	// a header table is now.
+	for i := 1; i < len(sections); i++ {
+		h := &(sections[i])
+		if h.Type == UninitializedSection {
+			continue
+		}
+		// Sections added since the file was parsed use whatever is in Raw at
+		// their current location.
+		source := h
+		if i < len(parsed) {
+			source = &(parsed[i])
+		}
+		if source.Type == UninitializedSection {
+			source = h
+		}
+		start := source.FileOffset
+		end, e := rangeEnd(start, source.Size)
+		if (e != nil) || (end > uint64(len(raw))) {
+			end = uint64(len(raw))
+		}
+		if start >= end {
+			continue
+		}
+		content := raw[start:end]
+		if uint64(len(content)) > h.Size {
+			content = content[:h.Size]
+		}
+		destination := toReturn[h.FileOffset : h.FileOffset+h.Size]
+		n := copy(destination, content)
+		// If the section grew, don't leave stale data in the new space.
+		if source != h {
+			for j := n; j < len(destination); j++ {
+				destination[j] = 0
+			}
+		}
+	}
+	copy(toReturn, header)
+	if len(programHeaders) != 0 {
+		copy(toReturn[layout.ProgramHeaderOffset:], programHeaders)
+	}
+	if len(sectionHeaders) != 0 {
+		copy(toReturn[layout.SectionHeaderOffset:], sectionHeaders)
+	}
+	return toReturn, nil
+}
+
+// Returns the content of the file, after encoding the current Header,
+// Segments and Sections at the offsets they specify. The content of each
+// section is copied from the location it had when the file was last parsed,
+// so sections can be moved by changing their FileOffset. Bytes in Raw that
+// aren't part of a header or section are preserved. Returns an error if any
+// headers or sections would overlap. Neither Raw nor the parsed data are
+// modified; callers should set Raw and call ReparseData() if needed.
+func (f *ELF64File) Serialize() ([]byte, error) {
+	return serializeELF(f, f.parsedSections)
+}
+
+// Returns the content of the file, after encoding the current Header,
+// Segments and Sections. Behaves the same as the ELF64File version.
+func (f *ELF32File) Serialize() ([]byte, error) {
+	parsed := make([]ELF64SectionHeader, len(f.parsedSections))
+	for i, h := range f.parsedSections {
+		parsed[i] = ELF64SectionHeader{
+			Type:       h.Type,
+			FileOffset: uint64(h.FileOffset),
+			Size:       uint64(h.Size),
+		}
+	}
+	return serializeELF(f, parsed)
+}
+
+// Writes the serialized file to the given writer. Satisfies the io.WriterTo
+// interface.
+func (f *ELF64File) WriteTo(w io.Writer) (int64, error) {
+	content, e := f.Serialize()
+	if e != nil {
+		return 0, e
+	}
+	return io.Copy(w, bytes.NewReader(content))
+}
+
+// Writes the serialized file to the given writer. Satisfies the io.WriterTo
+// interface.
+func (f *ELF32File) WriteTo(w io.Writer) (int64, error) {
+	content, e := f.Serialize()
+	if e != nil {
+		return 0, e
+	}
+	return io.Copy(w, bytes.NewReader(content))
+}
@@ -0,0 +1,121 @@
+package elf_reader
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// Serializes either an *ELF32File or *ELF64File.
+func serializeTestFile(f ELFFile) ([]byte, error) {
+	switch v := f.(type) {
+	case *ELF64File:
+		return v.Serialize()
+	case *ELF32File:
+		return v.Serialize()
+	}
+	return nil, fmt.Errorf("Unsupported ELF file type: %T", f)
+}
+
+func TestSerializeUnmodified(t *testing.T) {
+	testFile := func(filename string) {
+		contents := fileBytes(filename, t)
+		f, e := ParseELFFile(contents)
+		if e != nil {
+			t.Errorf("Failed parsing %s: %s\n", filename, e)
+			return
+		}
+		serialized, e := serializeTestFile(f)
+		if e != nil {
+			t.Errorf("Failed serializing %s: %s\n", filename, e)
+			return
+		}
+		if !bytes.Equal(serialized, contents) {
+			t.Errorf("Serializing unmodified %s changed its content\n",
+				filename)
+		}
+	}
+	testFile("test_data/bash32_freebsd")
+	testFile("test_data/sleep_amd64")
+	testFile("test_data/sleep_arm32")
+	testFile("test_data/ld-linux_arm32.so")
+	testFile("test_data/hello_debug_amd64.o")
+}
+
+func TestSerializeModified(t *testing.T) {
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	commentIndex, e := FindSectionByName(f, ".comment")
+	if e != nil {
+		t.Fatalf("Couldn't find .comment: %s\n", e)
+	}
+	originalComment, e := f.GetSectionContent(commentIndex)
+	if e != nil {
+		t.Fatalf("Couldn't read .comment: %s\n", e)
+	}
+	originalComment = append([]byte{}, originalComment...)
+	f.Header.EntryPoint = 0x1234
+	// Move the .comment section to the end of the file.
+	f.Sections[commentIndex].FileOffset = uint64(len(f.Raw))
+	var buffer bytes.Buffer
+	_, e = f.WriteTo(&buffer)
+	if e != nil {
+		t.Fatalf("Failed writing modified file: %s\n", e)
+	}
+	modified, e := ParseELF64File(buffer.Bytes())
+	if e != nil {
+		t.Fatalf("Failed parsing modified file: %s\n", e)
+	}
+	if modified.Header.EntryPoint != 0x1234 {
+		t.Errorf("Entry point wasn't changed: 0x%x\n",
+			modified.Header.EntryPoint)
+	}
+	comment, e := modified.GetSectionContent(commentIndex)
+	if e != nil {
+		t.Fatalf("Couldn't read moved .comment: %s\n", e)
+	}
+	if !bytes.Equal(comment, originalComment) {
+		t.Errorf("The moved .comment has the wrong content: %q\n", comment)
+	}
+
+	// Now make the section overlap the section header table.
+	f.Sections[commentIndex].FileOffset = f.Header.SectionHeaderOffset
+	_, e = f.Serialize()
+	if e == nil {
+		t.Fatalf("Didn't get an error for overlapping content\n")
+	}
+	t.Logf("Got expected error for overlapping content: %s\n", e)
+
+	// Moving the section to a huge offset must produce an error rather than
+	// a huge allocation, and offsets that overflow must be rejected too.
+	for _, offset := range []uint64{1 << 40, 0xfffffffffffffff0} {
+		f.Sections[commentIndex].FileOffset = offset
+		_, e = f.Serialize()
+		if e == nil {
+			t.Errorf("Didn't get an error for section offset 0x%x\n",
+				offset)
+			continue
+		}
+		t.Logf("Got expected error for section offset 0x%x: %s\n", offset,
+			e)
+	}
+}
+
+func TestSerialize32(t *testing.T) {
+	f := parseTestELF32("test_data/sleep_arm32", t)
+	f.Header.Flags ^= 1
+	f.Segments[0].Flags |= 2
+	serialized, e := serializeTestFile(f)
+	if e != nil {
+		t.Fatalf("Failed serializing modified 32-bit file: %s\n", e)
+	}
+	modified, e := ParseELF32File(serialized)
+	if e != nil {
+		t.Fatalf("Failed parsing modified 32-bit file: %s\n", e)
+	}
+	if modified.Header != f.Header {
+		t.Errorf("The header wasn't written correctly\n")
+	}
+	if modified.Segments[0] != f.Segments[0] {
+		t.Errorf("The program header wasn't written correctly\n")
+	}
+}
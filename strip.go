@@ -0,0 +1,783 @@
+package elf_reader
+
+// This file contains code for removing sections and symbols from ELF files,
+// similar to the strip and objcopy utilities.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// Specifies which sections Strip removes from an ELF file.
+type StripMode uint8
+
+const (
+	// Removes everything that isn't needed at runtime: debugging sections
+	// and the non-dynamic symbol table. Symbols in relocatable files are kept
+	// if a relocation refers to them. This is the default mode.
+	StripAll StripMode = iota
+	// Removes only the debugging sections and the relocations that apply to
+	// them.
+	StripDebug
+	// Produces a separate debug file by keeping the debugging sections, the
+	// symbol table, and notes, but turning every other section into a NOBITS
+	// section that doesn't occupy space in the file.
+	StripOnlyKeepDebug
+	// Doesn't remove any sections. Useful for only filtering symbols or only
+	// adding a .gnu_debuglink section.
+	StripNone
+)
+
+func (m StripMode) String() string {
+	switch m {
+	case StripAll:
+		return "strip all"
+	case StripDebug:
+		return "strip debug"
+	case StripOnlyKeepDebug:
+		return "only keep debug"
+	case StripNone:
+		return "strip nothing"
+	}
+	return fmt.Sprintf("unknown strip mode %d", uint8(m))
+}
+
+// Holds the settings used by Strip.
+type StripOptions struct {
+	// Controls which sections are removed.
+	Mode StripMode
+	// If this is non-empty, only the symbols with these names are kept in the
+	// .symtab section, along with any symbols needed by relocations.
+	KeepSymbols []string
+	// If this is non-empty, a .gnu_debuglink section referring to a debug
+	// file with this name is added to the output, replacing any existing
+	// .gnu_debuglink section. The name shouldn't include any directories.
+	DebugLinkName string
+	// The content of the debug file named by DebugLinkName. Used to compute
+	// the CRC stored in the .gnu_debuglink section.
+	DebugFileContent []byte
+}
+
+// Returns true if a section with the given name only holds debugging
+// information.
+func IsDebugSectionName(name string) bool {
+	prefixes := []string{".debug", ".zdebug", ".gnu.debuglto_", ".stab",
+		".gnu.linkonce.wi."}
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return (name == ".line") || (name == ".gdb_index")
+}
+
+// Returns the content of a .gnu_debuglink section referring to a debug file
+// with the given name and content.
+func GNUDebugLinkContent(name string, debugFile []byte,
+	endianness binary.ByteOrder) []byte {
+	toReturn := append([]byte(name), 0)
+	for (len(toReturn) % 4) != 0 {
+		toReturn = append(toReturn, 0)
+	}
+	var crc [4]byte
+	endianness.PutUint32(crc[:], crc32.ChecksumIEEE(debugFile))
+	return append(toReturn, crc[:]...)
+}
+
+// Tracks a single section while Strip is deciding what to keep.
+type stripSection struct {
+	header  ELF64SectionHeader
+	name    string
+	content []byte
+	removed bool
+	// Will be true if the content must stay at its current file offset,
+	// because it's part of a segment.
+	pinned bool
+	// The section's size in the original file. Pinned sections can't grow
+	// past this without overwriting whatever follows them.
+	originalSize uint64
+	// The section's index in the output file.
+	newIndex uint16
+	// Will be true if the section wasn't in the original file.
+	added bool
+}
+
+// Holds the state needed while stripping a single file.
+type stripState struct {
+	f        ELFFile
+	options  *StripOptions
+	is64     bool
+	order    binary.ByteOrder
+	layout   fileLayout
+	sections []stripSection
+	segments []ELF64ProgramHeader
+}
+
+// Returns true if the section's type indicates it contains no file data.
+func (s *stripSection) isNoBits() bool {
+	return s.header.Type == UninitializedSection
+}
+
+// Returns true if the section is a relocation table.
+func (s *stripSection) isRelocation() bool {
+	return (s.header.Type == RelSection) || (s.header.Type == RelaSection)
+}
+
+// Fills in the sections and segments in the strip state.
+func (s *stripState) loadSections() error {
+	headers := sectionHeaders64(s.f)
+	s.segments = programHeaders64(s.f)
+	s.sections = make([]stripSection, len(headers))
+	var e error
+	for i := range headers {
+		current := &(s.sections[i])
+		current.header = headers[i]
+		current.originalSize = headers[i].Size
+		if i == 0 {
+			continue
+		}
+		current.name, e = s.f.GetSectionName(uint16(i))
+		if e != nil {
+			return fmt.Errorf("Couldn't get name of section %d: %w", i, e)
+		}
+		if current.isNoBits() {
+			continue
+		}
+		current.content, e = s.f.GetSectionContent(uint16(i))
+		if e != nil {
+			return fmt.Errorf("Couldn't get content of section %d: %w", i, e)
+		}
+	}
+	return nil
+}
+
+// Returns true if the given section is fully contained in the file content
+// of any segment.
+func (s *stripState) inSegment(h *ELF64SectionHeader) bool {
+	for i := range s.segments {
+		p := &(s.segments[i])
+		if p.FileSize == 0 {
+			continue
+		}
+		if (h.FileOffset >= p.FileOffset) &&
+			((h.FileOffset + h.Size) <= (p.FileOffset + p.FileSize)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if any section other than the one at the given index and not
+// marked for removal links to the section at the given index.
+func (s *stripState) isLinkedTo(index int) bool {
+	for i := range s.sections {
+		current := &(s.sections[i])
+		if (i == index) || current.removed {
+			continue
+		}
+		if int(current.header.LinkedIndex) == index {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if a relocation section applies to a section that has been
+// removed.
+func (s *stripState) relocationTargetRemoved(r *stripSection) bool {
+	target := int(r.header.Info)
+	if (target == 0) || (target >= len(s.sections)) {
+		return false
+	}
+	return s.sections[target].removed
+}
+
+// Marks sections for removal, depending on the strip mode.
+func (s *stripState) markRemovedSections() {
+	mode := s.options.Mode
+	for i := 1; i < len(s.sections); i++ {
+		current := &(s.sections[i])
+		if (mode == StripAll) || (mode == StripDebug) {
+			if IsDebugSectionName(current.name) {
+				current.removed = true
+			}
+		}
+		if (s.options.DebugLinkName != "") &&
+			(current.name == ".gnu_debuglink") {
+			current.removed = true
+		}
+	}
+	// Remove relocations for any sections we removed.
+	for i := 1; i < len(s.sections); i++ {
+		current := &(s.sections[i])
+		if current.isRelocation() && s.relocationTargetRemoved(current) {
+			current.removed = true
+		}
+	}
+	if (mode != StripAll) || (s.f.GetFileType() == ELFTypeRelocatable) {
+		return
+	}
+	// Remove the non-dynamic symbol tables in executables and shared
+	// libraries, unless a remaining relocation table needs them, or we were
+	// asked to keep some symbols.
+	if len(s.options.KeepSymbols) != 0 {
+		return
+	}
+	for i := 1; i < len(s.sections); i++ {
+		current := &(s.sections[i])
+		if current.header.Type != SymbolTableSection {
+			continue
+		}
+		if s.isLinkedTo(i) {
+			continue
+		}
+		current.removed = true
+		stringTable := int(current.header.LinkedIndex)
+		if (stringTable == 0) || (stringTable >= len(s.sections)) {
+			continue
+		}
+		if s.isNamesTable(stringTable) || s.isLinkedTo(stringTable) {
+			continue
+		}
+		s.sections[stringTable].removed = true
+	}
+}
+
+// Returns true if the section at the given index is the section names table.
+func (s *stripState) isNamesTable(index int) bool {
+	return int(s.layout.SectionNamesTable) == index
+}
+
+// Assigns output indices to each section that is kept.
+func (s *stripState) assignNewIndices() error {
+	var newIndex uint16
+	for i := range s.sections {
+		current := &(s.sections[i])
+		if current.removed {
+			continue
+		}
+		current.newIndex = newIndex
+		newIndex++
+	}
+	if s.sections[0].removed {
+		return fmt.Errorf("Internal error: removed the null section")
+	}
+	return nil
+}
+
+// Maps an old section index to a new one. Indices outside of the normal range
+// of section indices, e.g. SHN_ABS, are returned unchanged. The second return
+// value will be false if the section was removed.
+func (s *stripState) mapSectionIndex(index uint32) (uint32, bool) {
+	if (index == 0) || (index >= 0xff00) {
+		return index, true
+	}
+	if index >= uint32(len(s.sections)) {
+		return index, true
+	}
+	if s.sections[index].removed {
+		return 0, false
+	}
+	return uint32(s.sections[index].newIndex), true
+}
+
+// Returns the symbol indices referenced by any kept relocation section that
+// uses the symbol table at the given index.
+func (s *stripState) referencedSymbols(symbolTable int) (map[uint32]bool,
+	error) {
+	toReturn := make(map[uint32]bool)
+	for i := range s.sections {
+		current := &(s.sections[i])
+		if current.removed || !current.isRelocation() {
+			continue
+		}
+		if int(current.header.LinkedIndex) != symbolTable {
+			continue
+		}
+		relocations, e := s.f.GetRelocations(uint16(i))
+		if e != nil {
+			return nil, fmt.Errorf("Couldn't read relocations in section "+
+				"%s: %w", current.name, e)
+		}
+		for _, r := range relocations {
+			toReturn[r.SymbolIndex()] = true
+		}
+	}
+	return toReturn, nil
+}
+
+// Rewrites the symbol table at the given index, dropping symbols that refer
+// to removed sections and, if needed, symbols that weren't selected. Also
+// renumbers the relocations that refer to the symbol table.
+func (s *stripState) rewriteSymbolTable(index int) error {
+	table := &(s.sections[index])
+	symbols, names, e := s.f.GetSymbols(uint16(index))
+	if e != nil {
+		return fmt.Errorf("Couldn't read symbols in %s: %w", table.name, e)
+	}
+	referenced, e := s.referencedSymbols(index)
+	if e != nil {
+		return e
+	}
+	filtering := len(s.options.KeepSymbols) != 0
+	if (s.options.Mode == StripAll) &&
+		(s.f.GetFileType() == ELFTypeRelocatable) {
+		filtering = true
+	}
+	keepNames := make(map[string]bool)
+	for _, name := range s.options.KeepSymbols {
+		keepNames[name] = true
+	}
+	// Maps old symbol indices to new ones.
+	symbolMap := make(map[uint32]uint32)
+	newSymbols := make([]ELF64Symbol, 0, len(symbols))
+	newLocalCount := uint32(0)
+	for i := range symbols {
+		symbol := toELF64Symbol(symbols[i])
+		if i != 0 {
+			newSection, ok := s.mapSectionIndex(uint32(symbol.SectionIndex))
+			keep := ok
+			if filtering && !keepNames[names[i]] {
+				keep = false
+			}
+			if referenced[uint32(i)] {
+				if !ok {
+					return fmt.Errorf("Symbol %d in %s is needed by a "+
+						"relocation, but its section was removed", i,
+						table.name)
+				}
+				keep = true
+			}
+			if !keep {
+				continue
+			}
+			symbol.SectionIndex = uint16(newSection)
+		}
+		symbolMap[uint32(i)] = uint32(len(newSymbols))
+		if uint32(i) < table.header.Info {
+			newLocalCount++
+		}
+		newSymbols = append(newSymbols, symbol)
+	}
+
+	// Rebuild the string table if we filtered symbols and the string table
+	// isn't shared with the section names.
+	stringTable := int(table.header.LinkedIndex)
+	if filtering && (stringTable > 0) && (stringTable < len(s.sections)) &&
+		!s.isNamesTable(stringTable) {
+		newStrings := []byte{0}
+		offsets := make(map[string]uint32)
+		for i := range symbols {
+			newIndex, ok := symbolMap[uint32(i)]
+			if !ok || (names[i] == "") {
+				continue
+			}
+			offset, ok := offsets[names[i]]
+			if !ok {
+				offset = uint32(len(newStrings))
+				offsets[names[i]] = offset
+				newStrings = append(newStrings, []byte(names[i])...)
+				newStrings = append(newStrings, 0)
+			}
+			newSymbols[newIndex].Name = offset
+		}
+		s.sections[stringTable].content = newStrings
+		s.sections[stringTable].header.Size = uint64(len(newStrings))
+	}
+
+	table.content, e = encodeSymbols(s.is64, s.order, newSymbols)
+	if e != nil {
+		return fmt.Errorf("Failed encoding symbols for %s: %w", table.name, e)
+	}
+	table.header.Size = uint64(len(table.content))
+	table.header.Info = newLocalCount
+
+	// Finally, renumber the relocations and section groups that use this
+	// symbol table.
+	for i := range s.sections {
+		current := &(s.sections[i])
+		if current.removed || (int(current.header.LinkedIndex) != index) {
+			continue
+		}
+		if current.header.Type == GroupSection {
+			newSymbol, ok := symbolMap[current.header.Info]
+			if !ok {
+				return fmt.Errorf("The signature symbol for group %s was "+
+					"removed", current.name)
+			}
+			current.header.Info = newSymbol
+			continue
+		}
+		if !current.isRelocation() {
+			continue
+		}
+		relocations, e := s.f.GetRelocations(uint16(i))
+		if e != nil {
+			return fmt.Errorf("Couldn't read relocations in %s: %w",
+				current.name, e)
+		}
+		for j, r := range relocations {
+			newSymbol, ok := symbolMap[r.SymbolIndex()]
+			if !ok {
+				return fmt.Errorf("Relocation %d in %s refers to a removed "+
+					"symbol", j, current.name)
+			}
+			info := ELF64RelocationInfo(r.Type()) |
+				(ELF64RelocationInfo(newSymbol) << 32)
+			relocations[j] = &ELF64Rela{
+				Address:        r.Offset(),
+				RelocationInfo: info,
+				AddendValue:    r.Addend(),
+			}
+		}
+		current.content, e = encodeRelocations(s.is64, s.order,
+			current.header.Type == RelaSection, relocations)
+		if e != nil {
+			return fmt.Errorf("Failed encoding relocations for %s: %w",
+				current.name, e)
+		}
+		current.header.Size = uint64(len(current.content))
+	}
+	return nil
+}
+
+// Updates the section indices in the dynamic symbol table without removing
+// any symbols, since the dynamic symbol table's layout must not change.
+func (s *stripState) rewriteDynamicSymbols(index int) error {
+	table := &(s.sections[index])
+	symbols, _, e := s.f.GetSymbols(uint16(index))
+	if e != nil {
+		return fmt.Errorf("Couldn't read symbols in %s: %w", table.name, e)
+	}
+	newSymbols := make([]ELF64Symbol, len(symbols))
+	for i := range symbols {
+		newSymbols[i] = toELF64Symbol(symbols[i])
+		newSection, ok := s.mapSectionIndex(uint32(
+			newSymbols[i].SectionIndex))
+		if !ok {
+			return fmt.Errorf("Dynamic symbol %d refers to a removed section",
+				i)
+		}
+		newSymbols[i].SectionIndex = uint16(newSection)
+	}
+	content, e := encodeSymbols(s.is64, s.order, newSymbols)
+	if e != nil {
+		return fmt.Errorf("Failed encoding dynamic symbols: %w", e)
+	}
+	// Don't change the size of the section, in case the original contained
+	// any padding.
+	newContent := make([]byte, len(table.content))
+	copy(newContent, table.content)
+	copy(newContent, content)
+	table.content = newContent
+	return nil
+}
+
+// Updates the section indices listed in a section group.
+func (s *stripState) rewriteGroup(index int) error {
+	group := &(s.sections[index])
+	if (len(group.content) % 4) != 0 {
+		return fmt.Errorf("Invalid size for section group %s", group.name)
+	}
+	newContent := make([]byte, 0, len(group.content))
+	newContent = append(newContent, group.content[0:4]...)
+	var tmp [4]byte
+	for i := 4; i < len(group.content); i += 4 {
+		member := s.order.Uint32(group.content[i:])
+		newMember, ok := s.mapSectionIndex(member)
+		if !ok {
+			continue
+		}
+		s.order.PutUint32(tmp[:], newMember)
+		newContent = append(newContent, tmp[:]...)
+	}
+	group.content = newContent
+	group.header.Size = uint64(len(newContent))
+	return nil
+}
+
+// Updates the section indices in all of the kept sections' headers, and
+// rewrites any section content containing section or symbol indices.
+func (s *stripState) updateSections() error {
+	var e error
+	// Rewrite symbol tables first, since doing so may also rewrite
+	// relocations and section groups.
+	for i := 1; i < len(s.sections); i++ {
+		current := &(s.sections[i])
+		if current.removed {
+			continue
+		}
+		switch current.header.Type {
+		case SymbolTableSection:
+			e = s.rewriteSymbolTable(i)
+		case DynamicLoaderSymbolSection:
+			e = s.rewriteDynamicSymbols(i)
+		}
+		if e != nil {
+			return e
+		}
+	}
+	for i := 1; i < len(s.sections); i++ {
+		current := &(s.sections[i])
+		if current.removed {
+			continue
+		}
+		if current.header.Type == GroupSection {
+			e = s.rewriteGroup(i)
+			if e != nil {
+				return e
+			}
+		}
+		newLink, ok := s.mapSectionIndex(current.header.LinkedIndex)
+		if !ok {
+			return fmt.Errorf("Section %s is linked to a removed section",
+				current.name)
+		}
+		current.header.LinkedIndex = newLink
+		// The info field only holds a section index for relocations, or if
+		// the SHF_INFO_LINK flag is set.
+		if current.isRelocation() ||
+			((current.header.Flags & SectionFlagInfoLink) != 0) {
+			newInfo, ok := s.mapSectionIndex(current.header.Info)
+			if !ok {
+				return fmt.Errorf("Section %s refers to a removed section",
+					current.name)
+			}
+			current.header.Info = newInfo
+		}
+	}
+	return nil
+}
+
+// Converts every section except for notes, debugging information, and
+// symbol and string tables into NOBITS sections, and zeroes the file size of
+// the segments.
+func (s *stripState) keepOnlyDebug() {
+	for i := 1; i < len(s.sections); i++ {
+		current := &(s.sections[i])
+		if current.removed || current.isNoBits() {
+			continue
+		}
+		if IsDebugSectionName(current.name) {
+			continue
+		}
+		allocated := current.header.Flags.Allocated()
+		switch current.header.Type {
+		case NoteSection, SymbolTableSection:
+			continue
+		case StringTableSection:
+			if !allocated {
+				continue
+			}
+		case RelSection, RelaSection:
+			target := int(current.header.Info)
+			if (target < len(s.sections)) &&
+				IsDebugSectionName(s.sections[target].name) {
+				continue
+			}
+		}
+		current.header.Type = UninitializedSection
+		current.content = nil
+	}
+	for i := range s.segments {
+		s.segments[i].FileSize = 0
+	}
+}
+
+// Returns the offset just past the ELF header and program header table.
+func (s *stripState) headersEnd() uint64 {
+	toReturn := uint64(s.layout.HeaderSize)
+	if len(s.segments) != 0 {
+		tableEnd := s.layout.ProgramHeaderOffset +
+			uint64(s.layout.ProgramHeaderEntrySize)*uint64(len(s.segments))
+		if tableEnd > toReturn {
+			toReturn = tableEnd
+		}
+	}
+	return toReturn
+}
+
+// Adds the name to the section names table if it isn't already there, and
+// returns its offset.
+func (s *stripState) addSectionName(name string) uint32 {
+	names := &(s.sections[s.layout.SectionNamesTable])
+	toFind := append([]byte(name), 0)
+	for i := 0; i+len(toFind) <= len(names.content); i++ {
+		if (i != 0) && (names.content[i-1] != 0) {
+			continue
+		}
+		if string(names.content[i:i+len(toFind)]) == string(toFind) {
+			return uint32(i)
+		}
+	}
+	newContent := make([]byte, len(names.content), len(names.content)+
+		len(toFind))
+	copy(newContent, names.content)
+	names.content = append(newContent, toFind...)
+	names.header.Size = uint64(len(names.content))
+	return uint32(len(newContent))
+}
+
+// Produces the output file's content.
+func (s *stripState) layoutFile() ([]byte, error) {
+	raw := fileRaw(s.f)
+	end := s.headersEnd()
+	onlyDebug := s.options.Mode == StripOnlyKeepDebug
+	programHeaderOffset := s.layout.ProgramHeaderOffset
+	if !onlyDebug {
+		// Keep the content of every segment in place.
+		for i := range s.segments {
+			segmentEnd := s.segments[i].FileOffset + s.segments[i].FileSize
+			if segmentEnd > end {
+				end = segmentEnd
+			}
+		}
+		for i := 1; i < len(s.sections); i++ {
+			current := &(s.sections[i])
+			if current.removed || current.added || current.isNoBits() {
+				continue
+			}
+			// Use the original size, in case the section has grown.
+			original := current.header
+			original.Size = current.originalSize
+			current.pinned = s.inSegment(&original)
+		}
+	}
+	if end > uint64(len(raw)) {
+		return nil, fmt.Errorf("Segments extend past the end of the file")
+	}
+	var toReturn []byte
+	if onlyDebug {
+		// The debug file only contains the ELF header and the program header
+		// table before the sections, so place the program headers directly
+		// after the ELF header.
+		programHeaderOffset = uint64(s.layout.HeaderSize)
+		toReturn = make([]byte, s.layout.HeaderSize)
+		table, e := encodeProgramHeaders(s.is64, s.order, s.segments)
+		if e != nil {
+			return nil, e
+		}
+		toReturn = append(toReturn, table...)
+	} else {
+		toReturn = make([]byte, end)
+		copy(toReturn, raw[:end])
+	}
+
+	headers := make([]ELF64SectionHeader, 0, len(s.sections))
+	for i := range s.sections {
+		current := &(s.sections[i])
+		if current.removed {
+			continue
+		}
+		if i == 0 {
+			headers = append(headers, current.header)
+			continue
+		}
+		if current.isNoBits() {
+			if !current.pinned && (onlyDebug ||
+				(current.header.FileOffset > uint64(len(toReturn)))) {
+				current.header.FileOffset = uint64(len(toReturn))
+			}
+			headers = append(headers, current.header)
+			continue
+		}
+		if current.pinned {
+			if uint64(len(current.content)) > current.originalSize {
+				return nil, fmt.Errorf("Section %s is part of a segment, so "+
+					"it can't grow from %d to %d bytes", current.name,
+					current.originalSize, len(current.content))
+			}
+			copy(toReturn[current.header.FileOffset:], current.content)
+			headers = append(headers, current.header)
+			continue
+		}
+		var offset uint64
+		toReturn, offset = appendAligned(toReturn, current.content,
+			current.header.Align)
+		current.header.FileOffset = offset
+		headers = append(headers, current.header)
+	}
+
+	// Now, the section header table goes at the end of the file.
+	table, e := encodeSectionHeaders(s.is64, s.order, headers)
+	if e != nil {
+		return nil, e
+	}
+	tableAlign := uint64(4)
+	if s.is64 {
+		tableAlign = 8
+	}
+	toReturn, tableOffset := appendAligned(toReturn, table, tableAlign)
+	newNamesIndex, ok := s.mapSectionIndex(uint32(
+		s.layout.SectionNamesTable))
+	if !ok {
+		return nil, fmt.Errorf("The section names table was removed")
+	}
+	header, e := encodeFileHeader(s.f, programHeaderOffset, tableOffset,
+		uint16(len(headers)), uint16(newNamesIndex))
+	if e != nil {
+		return nil, fmt.Errorf("Failed encoding ELF header: %w", e)
+	}
+	copy(toReturn, header)
+	return toReturn, nil
+}
+
+// Adds a new .gnu_debuglink section at the end of the section list.
+func (s *stripState) addDebugLink() {
+	var h ELF64SectionHeader
+	h.Name = s.addSectionName(".gnu_debuglink")
+	h.Type = BitsSection
+	h.Align = 4
+	content := GNUDebugLinkContent(s.options.DebugLinkName,
+		s.options.DebugFileContent, s.order)
+	h.Size = uint64(len(content))
+	s.sections = append(s.sections, stripSection{
+		header:  h,
+		name:    ".gnu_debuglink",
+		content: content,
+		added:   true,
+	})
+}
+
+// Returns the content of a new ELF file, based on the given file but with
+// sections or symbols removed according to the given options. If options is
+// nil, this behaves as if StripAll was requested. Sections that are part of a
+// segment remain at their original offsets, so the program headers remain
+// valid. The input file isn't modified.
+func Strip(f ELFFile, options *StripOptions) ([]byte, error) {
+	if options == nil {
+		options = &StripOptions{}
+	}
+	if f.GetSectionCount() == 0 {
+		return nil, fmt.Errorf("Can't strip a file without section headers")
+	}
+	s := stripState{
+		f:       f,
+		options: options,
+		is64:    is64Bit(f),
+		order:   fileEndianness(f),
+		layout:  getFileLayout(f),
+	}
+	e := s.loadSections()
+	if e != nil {
+		return nil, e
+	}
+	s.markRemovedSections()
+	if options.DebugLinkName != "" {
+		s.addDebugLink()
+	}
+	e = s.assignNewIndices()
+	if e != nil {
+		return nil, e
+	}
+	if options.Mode == StripOnlyKeepDebug {
+		s.keepOnlyDebug()
+	}
+	e = s.updateSections()
+	if e != nil {
+		return nil, e
+	}
+	return s.layoutFile()
+}
@@ -0,0 +1,249 @@
+package elf_reader
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Returns the names of the symbols referred to by each relocation in the
+// given relocation section.
+func relocationSymbolNames(f ELFFile, sectionName string,
+	t *testing.T) []string {
+	index, e := FindSectionByName(f, sectionName)
+	if e != nil {
+		t.Fatalf("Failed finding %s: %s\n", sectionName, e)
+	}
+	header, e := f.GetSectionHeader(index)
+	if e != nil {
+		t.Fatalf("Failed getting %s header: %s\n", sectionName, e)
+	}
+	_, names, e := f.GetSymbols(uint16(header.GetLinkedIndex()))
+	if e != nil {
+		t.Fatalf("Failed reading symbols for %s: %s\n", sectionName, e)
+	}
+	relocations, e := f.GetRelocations(index)
+	if e != nil {
+		t.Fatalf("Failed reading relocations in %s: %s\n", sectionName, e)
+	}
+	toReturn := make([]string, len(relocations))
+	for i, r := range relocations {
+		toReturn[i] = names[r.SymbolIndex()]
+	}
+	return toReturn
+}
+
+func TestStripAll(t *testing.T) {
+	original := parseTestELF64("test_data/sleep_amd64", t)
+	stripped, e := Strip(original, nil)
+	if e != nil {
+		t.Fatalf("Failed stripping file: %s\n", e)
+	}
+	f, e := ParseELF64File(stripped)
+	if e != nil {
+		t.Fatalf("Failed parsing stripped file: %s\n", e)
+	}
+	if len(stripped) >= len(original.Raw) {
+		t.Errorf("Stripped file wasn't smaller than the original\n")
+	}
+	for _, name := range []string{".symtab", ".strtab"} {
+		_, e = FindSectionByName(f, name)
+		if e == nil {
+			t.Errorf("Stripped file still contains %s\n", name)
+		}
+	}
+	if len(f.Segments) != len(original.Segments) {
+		t.Fatalf("Expected %d segments, got %d\n", len(original.Segments),
+			len(f.Segments))
+	}
+	for i := range f.Segments {
+		// Segments containing the ELF header will differ, since the section
+		// header table moved.
+		if f.Segments[i].FileOffset < uint64(f.Header.HeaderSize) {
+			continue
+		}
+		a, e := original.GetSegmentContent(uint16(i))
+		if e != nil {
+			t.Fatalf("Failed reading original segment %d: %s\n", i, e)
+		}
+		b, e := f.GetSegmentContent(uint16(i))
+		if e != nil {
+			t.Fatalf("Failed reading stripped segment %d: %s\n", i, e)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("Content of segment %d changed\n", i)
+		}
+	}
+	index, e := FindSectionByName(f, ".dynsym")
+	if e != nil {
+		t.Fatalf("Stripped file is missing .dynsym: %s\n", e)
+	}
+	symbols, _, e := f.GetSymbols(index)
+	if e != nil {
+		t.Fatalf("Failed reading stripped .dynsym: %s\n", e)
+	}
+	if len(symbols) != 7 {
+		t.Errorf("Expected 7 dynamic symbols, got %d\n", len(symbols))
+	}
+}
+
+func TestStripKeepSymbols(t *testing.T) {
+	original := parseTestELF64("test_data/hello_debug_amd64.o", t)
+	stripped, e := Strip(original, &StripOptions{
+		Mode:        StripDebug,
+		KeepSymbols: []string{"main"},
+	})
+	if e != nil {
+		t.Fatalf("Failed stripping object file: %s\n", e)
+	}
+	f, e := ParseELFFile(stripped)
+	if e != nil {
+		t.Fatalf("Failed parsing stripped object file: %s\n", e)
+	}
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		name, e := f.GetSectionName(i)
+		if e != nil {
+			t.Fatalf("Failed getting section %d name: %s\n", i, e)
+		}
+		if IsDebugSectionName(name) || (name == ".rela.debug_info") {
+			t.Errorf("Section %s wasn't removed\n", name)
+		}
+	}
+	index, e := FindSectionByName(f, ".symtab")
+	if e != nil {
+		t.Fatalf("Stripped object is missing .symtab: %s\n", e)
+	}
+	_, names, e := f.GetSymbols(index)
+	if e != nil {
+		t.Fatalf("Failed reading stripped symbols: %s\n", e)
+	}
+	found := false
+	for _, name := range names {
+		if name == "hello.c" {
+			t.Errorf("The file symbol wasn't removed\n")
+		}
+		if name == "main" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("The main symbol wasn't kept\n")
+	}
+	// The relocations must still refer to the same symbols after they're
+	// renumbered.
+	before := relocationSymbolNames(original, ".rela.text", t)
+	after := relocationSymbolNames(f, ".rela.text", t)
+	if len(before) != len(after) {
+		t.Fatalf("Expected %d relocations, got %d\n", len(before),
+			len(after))
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			t.Errorf("Relocation %d refers to %s, expected %s\n", i, after[i],
+				before[i])
+		}
+	}
+}
+
+func TestStripOnlyKeepDebug(t *testing.T) {
+	original := parseTestELF32("test_data/sleep_arm32", t)
+	debugFile, e := Strip(original, &StripOptions{Mode: StripOnlyKeepDebug})
+	if e != nil {
+		t.Fatalf("Failed creating debug file: %s\n", e)
+	}
+	debugELF, e := ParseELF32File(debugFile)
+	if e != nil {
+		t.Fatalf("Failed parsing debug file: %s\n", e)
+	}
+	index, e := FindSectionByName(debugELF, ".text")
+	if e != nil {
+		t.Fatalf("Debug file is missing .text: %s\n", e)
+	}
+	if debugELF.Sections[index].Type != UninitializedSection {
+		t.Errorf("The .text section in the debug file wasn't NOBITS\n")
+	}
+	index, e = FindSectionByName(debugELF, ".symtab")
+	if e != nil {
+		t.Fatalf("Debug file is missing .symtab: %s\n", e)
+	}
+	_, _, e = debugELF.GetSymbolTable(index)
+	if e != nil {
+		t.Errorf("Failed reading symbols from the debug file: %s\n", e)
+	}
+
+	stripped, e := Strip(original, &StripOptions{
+		Mode:             StripAll,
+		DebugLinkName:    "sleep_arm32.debug",
+		DebugFileContent: debugFile,
+	})
+	if e != nil {
+		t.Fatalf("Failed stripping file: %s\n", e)
+	}
+	f, e := ParseELF32File(stripped)
+	if e != nil {
+		t.Fatalf("Failed parsing stripped file: %s\n", e)
+	}
+	index, e = FindSectionByName(f, ".gnu_debuglink")
+	if e != nil {
+		t.Fatalf("Stripped file is missing .gnu_debuglink: %s\n", e)
+	}
+	content, e := f.GetSectionContent(index)
+	if e != nil {
+		t.Fatalf("Failed reading .gnu_debuglink: %s\n", e)
+	}
+	expected := GNUDebugLinkContent("sleep_arm32.debug", debugFile,
+		f.Endianness)
+	if !bytes.Equal(content, expected) {
+		t.Errorf("Incorrect .gnu_debuglink content: % x\n", content)
+	}
+}
+
+func TestStripOnlyKeepDebugBadRelocationTarget(t *testing.T) {
+	f := parseTestELF64("test_data/hello_debug_amd64.o", t)
+	index, e := FindSectionByName(f, ".rela.debug_info")
+	if e != nil {
+		t.Fatalf("Failed finding .rela.debug_info: %s\n", e)
+	}
+	// A relocation section with an out-of-range target must not cause a
+	// panic. It isn't treated as debugging information.
+	f.Sections[index].Info = 0xffff
+	debugFile, e := Strip(f, &StripOptions{Mode: StripOnlyKeepDebug})
+	if e != nil {
+		t.Fatalf("Failed creating debug file: %s\n", e)
+	}
+	debugELF, e := ParseELF64File(debugFile)
+	if e != nil {
+		t.Fatalf("Failed parsing debug file: %s\n", e)
+	}
+	index, e = FindSectionByName(debugELF, ".rela.debug_info")
+	if e != nil {
+		t.Fatalf("Debug file is missing .rela.debug_info: %s\n", e)
+	}
+	if debugELF.Sections[index].Type != UninitializedSection {
+		t.Errorf("The invalid relocation section wasn't made NOBITS\n")
+	}
+}
+
+func TestStripGrowingPinnedSection(t *testing.T) {
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	// Make the empty GNU stack segment cover the whole file, so every section
+	// is pinned, including .shstrtab, which must grow to hold the name of
+	// the new .gnu_debuglink section.
+	found := false
+	for i := range f.Segments {
+		if f.Segments[i].Type == GNUStackSegment {
+			f.Segments[i].FileSize = uint64(len(f.Raw))
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Didn't find the GNU stack segment\n")
+	}
+	_, e := Strip(f, &StripOptions{
+		Mode:          StripAll,
+		DebugLinkName: "sleep_amd64.debug",
+	})
+	if e == nil {
+		t.Fatalf("Didn't get an error for a pinned section growing\n")
+	}
+	t.Logf("Got expected error for a pinned section growing: %s\n", e)
+}
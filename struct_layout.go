@@ -0,0 +1,479 @@
+package elf_reader
+
+// This file contains code for reporting the memory layout of structs, classes
+// and unions described by a file's DWARF information, in a similar manner to
+// pahole.
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// The cache line size used by default when printing struct layouts.
+const DefaultCacheLineSize = 64
+
+// The DWARF expression opcode used by older compilers to specify a member's
+// offset.
+const dwarfOpPlusUconst = 0x23
+
+// Describes a single member of a struct, class or union.
+type StructMember struct {
+	// The member's name. This is empty for anonymous members, and is the name
+	// of the base class for base classes.
+	Name string
+	// The member's type, as formatted by the debug/dwarf package.
+	TypeName string
+	// True if this member is a base class rather than a data member.
+	BaseClass bool
+	// The offset, in bytes, of the member from the start of the struct.
+	Offset uint64
+	// The size of the member's type, in bytes.
+	Size uint64
+	// The number of bits in a bitfield, and the offset of its first bit in
+	// the byte at Offset. Both are 0 if the member isn't a bitfield.
+	BitSize   uint64
+	BitOffset uint64
+	// The number of unused bytes and bits between the end of this member and
+	// the start of the next one. The unused space after the last member is
+	// given by the StructLayout's Padding field instead.
+	Hole    uint64
+	BitHole uint64
+}
+
+// Returns the offset of the first bit following the member.
+func (m *StructMember) endBit() uint64 {
+	if m.BitSize != 0 {
+		return m.Offset*8 + m.BitOffset + m.BitSize
+	}
+	return (m.Offset + m.Size) * 8
+}
+
+// Describes the layout of a struct, class or union.
+type StructLayout struct {
+	Name string
+	// Either "struct", "class" or "union".
+	Kind string
+	// The total size of the struct, in bytes.
+	Size    uint64
+	Members []StructMember
+	// The number of unused bytes at the end of the struct.
+	Padding uint64
+	// The cache line size used when printing the layout. Defaults to
+	// DefaultCacheLineSize.
+	CacheLineSize uint64
+}
+
+// Returns the number of holes between members, and their total size in
+// bytes. Holes of less than one byte between bitfields aren't counted.
+func (l *StructLayout) Holes() (uint64, uint64) {
+	count := uint64(0)
+	total := uint64(0)
+	for i := range l.Members {
+		if l.Members[i].Hole != 0 {
+			count++
+			total += l.Members[i].Hole
+		}
+	}
+	return count, total
+}
+
+// Returns the number of cache lines the struct occupies, assuming it starts
+// at the beginning of a cache line.
+func (l *StructLayout) CacheLines() uint64 {
+	if l.CacheLineSize == 0 {
+		return 0
+	}
+	return (l.Size + l.CacheLineSize - 1) / l.CacheLineSize
+}
+
+func (l *StructLayout) String() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "%s %s {\n", l.Kind, l.Name)
+	boundary := l.CacheLineSize
+	for i := range l.Members {
+		m := &(l.Members[i])
+		// Mark the start of the cache line containing the first member
+		// starting in it. Cache lines entirely spanned by a single member
+		// aren't marked.
+		if (l.CacheLineSize != 0) && (m.Offset >= boundary) {
+			line := (m.Offset / l.CacheLineSize) * l.CacheLineSize
+			fmt.Fprintf(&s, "\t/* --- cacheline %d boundary (%d bytes) ",
+				line/l.CacheLineSize, line)
+			if m.Offset > line {
+				fmt.Fprintf(&s, "was %d bytes ago ", m.Offset-line)
+			}
+			s.WriteString("--- */\n")
+			boundary = line + l.CacheLineSize
+		}
+		name := m.Name
+		if m.BaseClass {
+			name = "<base class>"
+		}
+		if m.BitSize != 0 {
+			fmt.Fprintf(&s, "\t%-24s %-20s /* %5d:%2d %5d */\n", m.TypeName,
+				fmt.Sprintf("%s:%d;", name, m.BitSize), m.Offset,
+				m.BitOffset, m.Size)
+		} else {
+			fmt.Fprintf(&s, "\t%-24s %-20s /* %5d    %5d */\n", m.TypeName,
+				name+";", m.Offset, m.Size)
+		}
+		if (m.Hole == 0) && (m.BitHole == 0) {
+			continue
+		}
+		s.WriteString("\n")
+		if m.Hole != 0 {
+			fmt.Fprintf(&s, "\t/* XXX %d byte hole, try to pack */\n", m.Hole)
+		}
+		if m.BitHole != 0 {
+			fmt.Fprintf(&s, "\t/* XXX %d bit hole, try to pack */\n",
+				m.BitHole)
+		}
+		s.WriteString("\n")
+	}
+	holes, holeBytes := l.Holes()
+	fmt.Fprintf(&s, "\n\t/* size: %d, cachelines: %d, members: %d */\n",
+		l.Size, l.CacheLines(), len(l.Members))
+	if holes != 0 {
+		fmt.Fprintf(&s, "\t/* holes: %d, sum holes: %d */\n", holes,
+			holeBytes)
+	}
+	if l.Padding != 0 {
+		fmt.Fprintf(&s, "\t/* padding: %d */\n", l.Padding)
+	}
+	s.WriteString("};\n")
+	return s.String()
+}
+
+// Reads an unsigned LEB128 value from the start of the data. Returns false if
+// the data ends before the value does, or the value doesn't fit in 64 bits.
+func readULEB128(data []byte) (uint64, bool) {
+	toReturn := uint64(0)
+	for i, b := range data {
+		if i >= 10 {
+			break
+		}
+		toReturn |= uint64(b&0x7f) << (7 * uint(i))
+		if (b & 0x80) == 0 {
+			return toReturn, true
+		}
+	}
+	return 0, false
+}
+
+// Returns the value of a non-negative integer attribute, or 0 if the entry
+// doesn't have the attribute.
+func unsignedAttribute(entry *dwarf.Entry, attr dwarf.Attr) (uint64, error) {
+	v, ok := entry.Val(attr).(int64)
+	if !ok {
+		return 0, nil
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("Invalid %s: %d", attr, v)
+	}
+	return uint64(v), nil
+}
+
+// Returns the offset of a member, in bytes, from the start of its struct.
+func memberOffset(entry *dwarf.Entry) (uint64, error) {
+	switch v := entry.Val(dwarf.AttrDataMemberLoc).(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		if v < 0 {
+			return 0, fmt.Errorf("Invalid member offset: %d", v)
+		}
+		return uint64(v), nil
+	case []byte:
+		// Older compilers use a location expression instead of a constant.
+		if (len(v) > 1) && (v[0] == dwarfOpPlusUconst) {
+			offset, ok := readULEB128(v[1:])
+			if ok {
+				return offset, nil
+			}
+		}
+		return 0, fmt.Errorf("Unsupported member location expression")
+	}
+	return 0, fmt.Errorf("Unsupported member location")
+}
+
+// Fills in the offset and size of a member based on the entry's attributes.
+// The byte order is needed to interpret the bit offsets of bitfields in DWARF
+// versions before 4.
+func setMemberPosition(m *StructMember, entry *dwarf.Entry,
+	order binary.ByteOrder) error {
+	offset, e := memberOffset(entry)
+	if e != nil {
+		return e
+	}
+	bitSize, e := unsignedAttribute(entry, dwarf.AttrBitSize)
+	if e != nil {
+		return e
+	}
+	m.Offset = offset
+	if bitSize == 0 {
+		return nil
+	}
+	var firstBit uint64
+	if _, ok := entry.Val(dwarf.AttrBitOffset).(int64); ok {
+		// This is the older convention: the bit offset is from the most
+		// significant bit of a storage unit with the given byte size.
+		bitOffset, e := unsignedAttribute(entry, dwarf.AttrBitOffset)
+		if e != nil {
+			return e
+		}
+		unitSize, e := unsignedAttribute(entry, dwarf.AttrByteSize)
+		if e != nil {
+			return e
+		}
+		if unitSize == 0 {
+			unitSize = m.Size
+		}
+		if order == binary.BigEndian {
+			firstBit = offset*8 + bitOffset
+		} else {
+			if (bitOffset + bitSize) > (unitSize * 8) {
+				return fmt.Errorf("Invalid bit offset: %d", bitOffset)
+			}
+			firstBit = offset*8 + unitSize*8 - bitOffset - bitSize
+		}
+	} else {
+		dataBitOffset, e := unsignedAttribute(entry, dwarf.AttrDataBitOffset)
+		if e != nil {
+			return e
+		}
+		firstBit = offset*8 + dataBitOffset
+	}
+	m.Offset = firstBit / 8
+	m.BitOffset = firstBit % 8
+	m.BitSize = bitSize
+	return nil
+}
+
+// Computes the holes between members and the padding at the end of the
+// struct.
+func (l *StructLayout) computeHoles() {
+	end := uint64(0)
+	for i := range l.Members {
+		m := &(l.Members[i])
+		start := m.Offset*8 + m.BitOffset
+		// Every member of a union starts at 0, so there are no holes.
+		if (i > 0) && (start > end) && (l.Kind != "union") {
+			l.Members[i-1].Hole = (start - end) / 8
+			l.Members[i-1].BitHole = (start - end) % 8
+		}
+		if m.endBit() > end {
+			end = m.endBit()
+		}
+	}
+	end = (end + 7) / 8
+	if l.Size > end {
+		l.Padding = l.Size - end
+	}
+}
+
+// Reads the layout of the struct, class or union in the given entry.
+func readStructLayout(d *dwarf.Data, entry *dwarf.Entry,
+	order binary.ByteOrder) (*StructLayout, error) {
+	toReturn := &StructLayout{
+		CacheLineSize: DefaultCacheLineSize,
+	}
+	toReturn.Name, _ = entry.Val(dwarf.AttrName).(string)
+	switch entry.Tag {
+	case dwarf.TagClassType:
+		toReturn.Kind = "class"
+	case dwarf.TagUnionType:
+		toReturn.Kind = "union"
+	default:
+		toReturn.Kind = "struct"
+	}
+	size, e := unsignedAttribute(entry, dwarf.AttrByteSize)
+	if e != nil {
+		return nil, e
+	}
+	toReturn.Size = size
+	if !entry.Children {
+		return toReturn, nil
+	}
+	// Use a separate reader, so callers can continue looking for nested
+	// definitions.
+	reader := d.Reader()
+	reader.Seek(entry.Offset)
+	_, e = reader.Next()
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading %s: %w", toReturn.Name, e)
+	}
+	for {
+		child, e := reader.Next()
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading %s members: %w",
+				toReturn.Name, e)
+		}
+		if (child == nil) || (child.Tag == 0) {
+			break
+		}
+		if child.Children {
+			reader.SkipChildren()
+		}
+		if (child.Tag != dwarf.TagMember) &&
+			(child.Tag != dwarf.TagInheritance) {
+			continue
+		}
+		// Static members are declared as members in older DWARF versions.
+		declaration, _ := child.Val(dwarf.AttrDeclaration).(bool)
+		if declaration {
+			continue
+		}
+		var m StructMember
+		m.Name, _ = child.Val(dwarf.AttrName).(string)
+		m.BaseClass = child.Tag == dwarf.TagInheritance
+		typeOffset, ok := child.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			return nil, fmt.Errorf("Member %s of %s has no type", m.Name,
+				toReturn.Name)
+		}
+		memberType, e := d.Type(typeOffset)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading the type of %s in %s: %w",
+				m.Name, toReturn.Name, e)
+		}
+		m.TypeName = memberType.String()
+		if memberType.Size() > 0 {
+			m.Size = uint64(memberType.Size())
+		}
+		if m.BaseClass && (m.Name == "") {
+			m.Name = m.TypeName
+		}
+		e = setMemberPosition(&m, child, order)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading the position of %s in %s: "+
+				"%w", m.Name, toReturn.Name, e)
+		}
+		if m.Offset > toReturn.Size {
+			return nil, fmt.Errorf("Member %s of %s is at offset %d, past "+
+				"the end of the %d-byte %s", m.Name, toReturn.Name, m.Offset,
+				toReturn.Size, toReturn.Kind)
+		}
+		toReturn.Members = append(toReturn.Members, m)
+	}
+	toReturn.computeHoles()
+	return toReturn, nil
+}
+
+// Returns true if the entry is the definition of a struct, class or union.
+func isStructDefinition(entry *dwarf.Entry) bool {
+	switch entry.Tag {
+	case dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType:
+	default:
+		return false
+	}
+	declaration, _ := entry.Val(dwarf.AttrDeclaration).(bool)
+	return !declaration
+}
+
+// The maximum number of typedefs or qualifiers followed when looking for the
+// struct a typedef refers to.
+const maxTypedefReferences = 16
+
+// Returns the entry defining the struct that the typedef entry refers to, or
+// nil if it doesn't refer to a struct, class or union definition.
+func typedefStructEntry(d *dwarf.Data, entry *dwarf.Entry) *dwarf.Entry {
+	for i := 0; i < maxTypedefReferences; i++ {
+		switch entry.Tag {
+		case dwarf.TagTypedef, dwarf.TagConstType, dwarf.TagVolatileType:
+		default:
+			if isStructDefinition(entry) {
+				return entry
+			}
+			return nil
+		}
+		offset, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			return nil
+		}
+		reader := d.Reader()
+		reader.Seek(offset)
+		entry, _ = reader.Next()
+		if entry == nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Returns the layout of the first definition of the named struct, class or
+// union in the file's DWARF information. The name may also be a typedef
+// referring to a struct, e.g. for an anonymous struct.
+func GetStructLayout(f ELFFile, name string) (*StructLayout, error) {
+	d, e := loadDWARF(f)
+	if e != nil {
+		return nil, e
+	}
+	order := fileEndianness(f)
+	reader := d.Reader()
+	for {
+		entry, e := reader.Next()
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading DWARF entries: %w", e)
+		}
+		if entry == nil {
+			break
+		}
+		entryName, _ := entry.Val(dwarf.AttrName).(string)
+		if entryName != name {
+			continue
+		}
+		if isStructDefinition(entry) {
+			return readStructLayout(d, entry, order)
+		}
+		if entry.Tag != dwarf.TagTypedef {
+			continue
+		}
+		definition := typedefStructEntry(d, entry)
+		if definition == nil {
+			continue
+		}
+		toReturn, e := readStructLayout(d, definition, order)
+		if e != nil {
+			return nil, e
+		}
+		toReturn.Name = name
+		return toReturn, nil
+	}
+	return nil, fmt.Errorf("Couldn't find a definition of %s", name)
+}
+
+// Returns the layouts of all named structs, classes and unions in the file's
+// DWARF information. If several definitions have the same name, only the
+// first is included.
+func GetStructLayouts(f ELFFile) ([]*StructLayout, error) {
+	d, e := loadDWARF(f)
+	if e != nil {
+		return nil, e
+	}
+	order := fileEndianness(f)
+	found := make(map[string]bool)
+	var toReturn []*StructLayout
+	reader := d.Reader()
+	for {
+		entry, e := reader.Next()
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading DWARF entries: %w", e)
+		}
+		if entry == nil {
+			break
+		}
+		name, _ := entry.Val(dwarf.AttrName).(string)
+		if (name == "") || found[name] || !isStructDefinition(entry) {
+			continue
+		}
+		layout, e := readStructLayout(d, entry, order)
+		if e != nil {
+			return nil, e
+		}
+		found[name] = true
+		toReturn = append(toReturn, layout)
+	}
+	return toReturn, nil
+}
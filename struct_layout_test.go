@@ -0,0 +1,152 @@
+package elf_reader
+
+import (
+	"strings"
+	"testing"
+)
+
+// Checks the layout against the expected member names, offsets, sizes and
+// holes, and the expected struct size and padding.
+func checkStructLayout(l *StructLayout, size, padding uint64,
+	expected []StructMember, t *testing.T) {
+	t.Logf("%s\n", l)
+	if (l.Size != size) || (l.Padding != padding) {
+		t.Errorf("Expected %s to have size %d and padding %d, got %d and "+
+			"%d\n", l.Name, size, padding, l.Size, l.Padding)
+	}
+	if len(l.Members) != len(expected) {
+		t.Errorf("Expected %d members in %s, got %d\n", len(expected),
+			l.Name, len(l.Members))
+		return
+	}
+	for i := range expected {
+		m := l.Members[i]
+		// The type names depend on the compiler.
+		m.TypeName = ""
+		if m != expected[i] {
+			t.Errorf("Incorrect member %d of %s: expected %v, got %v\n", i,
+				l.Name, expected[i], m)
+		}
+	}
+}
+
+func TestStructLayout(t *testing.T) {
+	// Both files were built from the same source, which contains a struct
+	// with holes, a struct with bitfields, a derived class and a typedef for
+	// an anonymous struct. The ARM file uses the older DWARF representation
+	// for bitfields.
+	for _, name := range []string{"layout_amd64.o", "layout_arm32.o"} {
+		f, e := ParseELFFile(fileBytes("test_data/"+name, t))
+		if e != nil {
+			t.Fatalf("Failed parsing %s: %s\n", name, e)
+		}
+		pointerSize := uint64(8)
+		if !is64Bit(f) {
+			pointerSize = 4
+		}
+		l, e := GetStructLayout(f, "packet")
+		if e != nil {
+			t.Fatalf("Failed getting packet layout in %s: %s\n", name, e)
+		}
+		checkStructLayout(l, 48, 8-pointerSize, []StructMember{
+			{Name: "tag", Offset: 0, Size: 1, Hole: 3},
+			{Name: "length", Offset: 4, Size: 4},
+			{Name: "flags", Offset: 8, Size: 2, Hole: 6},
+			{Name: "weight", Offset: 16, Size: 8},
+			{Name: "name", Offset: 24, Size: 13, Hole: 3},
+			{Name: "next", Offset: 40, Size: pointerSize},
+		}, t)
+		count, total := l.Holes()
+		if (count != 3) || (total != 12) {
+			t.Errorf("Expected 3 holes totaling 12 bytes, got %d and %d\n",
+				count, total)
+		}
+
+		l, e = GetStructLayout(f, "flags")
+		if e != nil {
+			t.Fatalf("Failed getting flags layout in %s: %s\n", name, e)
+		}
+		checkStructLayout(l, 4, 0, []StructMember{
+			{Name: "ready", Offset: 0, Size: 4, BitSize: 1},
+			{Name: "mode", Offset: 0, Size: 4, BitSize: 3, BitOffset: 1,
+				BitHole: 4},
+			{Name: "count", Offset: 1, Size: 4, BitSize: 12, BitHole: 4},
+			{Name: "id", Offset: 3, Size: 1},
+		}, t)
+
+		l, e = GetStructLayout(f, "derived")
+		if e != nil {
+			t.Fatalf("Failed getting derived layout in %s: %s\n", name, e)
+		}
+		if l.Kind != "class" {
+			t.Errorf("Expected derived to be a class, got %s\n", l.Kind)
+		}
+		checkStructLayout(l, 16, 0, []StructMember{
+			{Name: "class base", BaseClass: true, Offset: 0, Size: 8},
+			{Name: "y", Offset: 8, Size: 8},
+		}, t)
+
+		l, e = GetStructLayout(f, "pair_t")
+		if e != nil {
+			t.Fatalf("Failed getting pair_t layout in %s: %s\n", name, e)
+		}
+		checkStructLayout(l, 8, 3, []StructMember{
+			{Name: "a", Offset: 0, Size: 4},
+			{Name: "b", Offset: 4, Size: 1},
+		}, t)
+
+		layouts, e := GetStructLayouts(f)
+		if e != nil {
+			t.Fatalf("Failed getting all layouts in %s: %s\n", name, e)
+		}
+		// The anonymous struct isn't included.
+		if len(layouts) != 4 {
+			t.Errorf("Expected 4 named structs in %s, got %d\n", name,
+				len(layouts))
+		}
+
+		_, e = GetStructLayout(f, "missing")
+		if e == nil {
+			t.Errorf("Didn't get an error for a missing struct\n")
+		}
+	}
+}
+
+func TestStructLayoutCacheLines(t *testing.T) {
+	f := parseTestELF64("test_data/hello_debug_amd64", t)
+	l, e := GetStructLayout(f, "packet")
+	if e != nil {
+		t.Fatalf("Failed getting packet layout: %s\n", e)
+	}
+	l.CacheLineSize = 16
+	s := l.String()
+	t.Logf("%s\n", s)
+	if l.CacheLines() != 3 {
+		t.Errorf("Expected 3 cache lines, got %d\n", l.CacheLines())
+	}
+	expected := []string{
+		"/* --- cacheline 1 boundary (16 bytes) --- */\n\tdouble",
+		"/* --- cacheline 2 boundary (32 bytes) was 8 bytes ago --- */\n" +
+			"\t*struct packet",
+		"/* size: 48, cachelines: 3, members: 6 */",
+	}
+	for _, text := range expected {
+		if !strings.Contains(s, text) {
+			t.Errorf("The layout doesn't contain %q\n", text)
+		}
+	}
+
+	// With cache lines smaller than some members, only the line each member
+	// starts in is marked.
+	l.CacheLineSize = 4
+	s = l.String()
+	t.Logf("%s\n", s)
+	if strings.Count(s, "cacheline ") != 5 {
+		t.Errorf("Expected 5 cache line markers, got %d\n",
+			strings.Count(s, "cacheline "))
+	}
+	text := "/* --- cacheline 10 boundary (40 bytes) --- */\n\t*struct packet"
+	if !strings.Contains(s, text) {
+		t.Errorf("The layout doesn't contain %q\n", text)
+	}
+}
@@ -0,0 +1,232 @@
+package elf_reader
+
+// This file contains code for looking up symbols by name or address across
+// all of a file's symbol tables, including the symbol table in its
+// MiniDebugInfo.
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The name used as the LookupSymbol.Table for symbols from MiniDebugInfo.
+const MiniDebugInfoTable = ".gnu_debugdata"
+
+// The section index used by absolute symbols.
+const sectionIndexAbsolute = 0xfff1
+
+// Holds a single symbol found by a SymbolLookup.
+type LookupSymbol struct {
+	Name         string
+	Value        uint64
+	Size         uint64
+	Info         ELFSymbolInfo
+	SectionIndex uint16
+	// The name of the symbol table containing the symbol, e.g. ".symtab" or
+	// ".dynsym", or MiniDebugInfoTable for symbols from the MiniDebugInfo.
+	Table string
+}
+
+func (s *LookupSymbol) String() string {
+	return fmt.Sprintf("%s (%s %s, %d bytes at 0x%x, from %s)", s.Name,
+		symbolBindingName(s.Info.Binding()),
+		symbolTypeName(s.Info.SymbolType()), s.Size, s.Value, s.Table)
+}
+
+// Returns true if the symbol contains the given address. Symbols without a
+// size only contain their own address.
+func (s *LookupSymbol) contains(address uint64) bool {
+	if address < s.Value {
+		return false
+	}
+	if s.Size == 0 {
+		return address == s.Value
+	}
+	return (address - s.Value) < s.Size
+}
+
+// Used to look up the symbols in all of a file's symbol tables by name or
+// address.
+type SymbolLookup struct {
+	// The symbols, sorted by address.
+	symbols []LookupSymbol
+	// Holds the largest end address of any symbol up to and including each
+	// index in symbols. Used to stop searching for symbols containing an
+	// address early.
+	maxEnd []uint64
+	// Maps symbol names to indices in symbols.
+	byName map[string][]int
+	// Problems that caused symbols to be skipped.
+	warnings []error
+}
+
+// Identifies a symbol for removing duplicates, e.g. symbols that are in both
+// .symtab and .dynsym.
+type symbolKey struct {
+	name  string
+	value uint64
+	info  ELFSymbolInfo
+}
+
+// Adds the defined symbols with names to the lookup, skipping any that have
+// already been added.
+func (l *SymbolLookup) addSymbols(symbols []ELFSymbol, names []string,
+	table string, seen map[symbolKey]bool) {
+	for i, s := range symbols {
+		t := s.GetInfo().SymbolType()
+		// Skip undefined symbols and section or file symbols.
+		if (names[i] == "") || (s.GetSectionIndex() == 0) || (t == 3) ||
+			(t == 4) {
+			continue
+		}
+		key := symbolKey{names[i], s.GetValue(), s.GetInfo()}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		l.symbols = append(l.symbols, LookupSymbol{
+			Name:         names[i],
+			Value:        s.GetValue(),
+			Size:         s.GetSize(),
+			Info:         s.GetInfo(),
+			SectionIndex: s.GetSectionIndex(),
+			Table:        table,
+		})
+	}
+}
+
+// Adds the symbols from every symbol table in the file. If table isn't
+// empty, it's recorded as the table for every symbol, rather than the name of
+// the symbol table's section.
+func (l *SymbolLookup) addFileSymbols(f ELFFile, table string,
+	seen map[symbolKey]bool) error {
+	for i := uint16(0); i < f.GetSectionCount(); i++ {
+		if !f.IsSymbolTable(i) {
+			continue
+		}
+		name := table
+		if name == "" {
+			var e error
+			name, e = f.GetSectionName(i)
+			if e != nil {
+				return e
+			}
+		}
+		symbols, names, e := f.GetSymbols(i)
+		if e != nil {
+			return fmt.Errorf("Failed reading symbols from %s: %w", name, e)
+		}
+		l.addSymbols(symbols, names, name, seen)
+	}
+	return nil
+}
+
+// Adds the symbols from the file's MiniDebugInfo.
+func (l *SymbolLookup) addMiniDebugInfoSymbols(f ELFFile,
+	seen map[symbolKey]bool) error {
+	mini, e := GetMiniDebugInfo(f)
+	if e != nil {
+		return e
+	}
+	return l.addFileSymbols(mini, MiniDebugInfoTable, seen)
+}
+
+// Returns a SymbolLookup containing the defined symbols from every symbol
+// table in the file, followed by the symbols from its MiniDebugInfo, if it
+// has any. When the same symbol appears in several tables, only the first is
+// kept, so symbols from .symtab take precedence over the MiniDebugInfo.
+// Section and file symbols aren't included. A MiniDebugInfo that can't be
+// read is skipped, and reported by the lookup's Warnings method.
+func NewSymbolLookup(f ELFFile) (*SymbolLookup, error) {
+	toReturn := &SymbolLookup{
+		byName: make(map[string][]int),
+	}
+	seen := make(map[symbolKey]bool)
+	e := toReturn.addFileSymbols(f, "", seen)
+	if e != nil {
+		return nil, e
+	}
+	if HasMiniDebugInfo(f) {
+		// The MiniDebugInfo is only supplementary, so a corrupt or
+		// unsupported one is skipped rather than hiding the file's other
+		// symbols. Its symbols are added only if all of them can be read.
+		mini := &SymbolLookup{}
+		e = mini.addMiniDebugInfoSymbols(f, seen)
+		if e != nil {
+			toReturn.warnings = append(toReturn.warnings, fmt.Errorf(
+				"Skipped the MiniDebugInfo: %w", e))
+		} else {
+			toReturn.symbols = append(toReturn.symbols, mini.symbols...)
+		}
+	}
+	symbols := toReturn.symbols
+	sort.SliceStable(symbols, func(a, b int) bool {
+		return symbols[a].Value < symbols[b].Value
+	})
+	toReturn.maxEnd = make([]uint64, len(symbols))
+	maxEnd := uint64(0)
+	for i := range symbols {
+		end := symbols[i].Value + symbols[i].Size
+		if end < symbols[i].Value {
+			// The size overflowed.
+			end = ^uint64(0)
+		}
+		if end > maxEnd {
+			maxEnd = end
+		}
+		toReturn.maxEnd[i] = maxEnd
+		toReturn.byName[symbols[i].Name] = append(
+			toReturn.byName[symbols[i].Name], i)
+	}
+	return toReturn, nil
+}
+
+// Returns the problems that caused symbols to be skipped, e.g. a corrupt
+// MiniDebugInfo. Returns nil if there were none.
+func (l *SymbolLookup) Warnings() []error {
+	return l.warnings
+}
+
+// Returns all of the symbols, sorted by address.
+func (l *SymbolLookup) Symbols() []LookupSymbol {
+	return l.symbols
+}
+
+// Returns the symbols with the given name. There may be several, e.g. local
+// symbols from different source files.
+func (l *SymbolLookup) Find(name string) []LookupSymbol {
+	indices := l.byName[name]
+	toReturn := make([]LookupSymbol, len(indices))
+	for i, index := range indices {
+		toReturn[i] = l.symbols[index]
+	}
+	return toReturn
+}
+
+// Returns the function or object symbol containing the given address, or nil
+// if there isn't one. If several symbols contain the address, the one
+// starting closest to it is returned, preferring symbols from the tables
+// added first if several start at the same address. The address must be a
+// virtual address in the file, so the load address of a position-independent
+// executable or shared library must be subtracted first.
+func (l *SymbolLookup) ForAddress(address uint64) *LookupSymbol {
+	i := sort.Search(len(l.symbols), func(i int) bool {
+		return l.symbols[i].Value > address
+	})
+	var toReturn *LookupSymbol
+	for i--; (i >= 0) && (l.maxEnd[i] >= address); i-- {
+		s := &(l.symbols[i])
+		if (toReturn != nil) && (s.Value != toReturn.Value) {
+			break
+		}
+		// Absolute symbols, e.g. for symbol versions, aren't addresses.
+		t := s.Info.SymbolType()
+		if ((t != 1) && (t != 2)) || (s.SectionIndex == sectionIndexAbsolute) {
+			continue
+		}
+		if s.contains(address) {
+			toReturn = s
+		}
+	}
+	return toReturn
+}
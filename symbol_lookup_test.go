@@ -0,0 +1,80 @@
+package elf_reader
+
+import (
+	"testing"
+)
+
+func TestSymbolLookup(t *testing.T) {
+	// The stripped file's MiniDebugInfo should provide the same function
+	// symbols as the original file's .symtab.
+	for _, name := range []string{"hello_minidebug_amd64",
+		"hello_debug_amd64"} {
+		f := parseTestELF64("test_data/"+name, t)
+		lookup, e := NewSymbolLookup(f)
+		if e != nil {
+			t.Fatalf("Failed creating symbol lookup for %s: %s\n", name, e)
+		}
+		expectedTable := ".symtab"
+		if HasMiniDebugInfo(f) {
+			expectedTable = MiniDebugInfoTable
+		}
+		tests := []struct {
+			address uint64
+			name    string
+		}{
+			{0x1000, "_init"},
+			{0x1001, ""},
+			{0x1140, "frame_dummy"},
+			{0x1149, "checksum"},
+			{0x115c, "checksum"},
+			{0x117a, "checksum"},
+			{0x11df, "main"},
+			{0x11e0, "_fini"},
+		}
+		for _, test := range tests {
+			s := lookup.ForAddress(test.address)
+			if test.name == "" {
+				if s != nil {
+					t.Errorf("Expected no symbol at 0x%x in %s, got %s\n",
+						test.address, name, s)
+				}
+				continue
+			}
+			if (s == nil) || (s.Name != test.name) ||
+				(s.Table != expectedTable) {
+				t.Errorf("Expected %s at 0x%x in %s, got %v\n", test.name,
+					test.address, name, s)
+			}
+		}
+		symbols := lookup.Find("main")
+		if (len(symbols) != 1) || (symbols[0].Value != 0x117b) ||
+			(symbols[0].Size != 0x65) {
+			t.Errorf("Incorrect symbols for main in %s: %v\n", name,
+				symbols)
+		}
+		all := lookup.Symbols()
+		for i := 1; i < len(all); i++ {
+			if all[i].Value < all[i-1].Value {
+				t.Errorf("The symbols in %s aren't sorted by address\n", name)
+				break
+			}
+		}
+	}
+
+	f := parseTestELF64("test_data/libbind_a_amd64.so", t)
+	lookup, e := NewSymbolLookup(f)
+	if e != nil {
+		t.Fatalf("Failed creating symbol lookup: %s\n", e)
+	}
+	// Both versions of foo should be found, but not the version symbols.
+	if len(lookup.Find("foo")) != 2 {
+		t.Errorf("Expected 2 symbols named foo, got %v\n", lookup.Find("foo"))
+	}
+	s := lookup.ForAddress(0x4009)
+	if (s == nil) || (s.Name != "counter") || (s.Table != ".dynsym") {
+		t.Errorf("Expected counter at 0x4009, got %v\n", s)
+	}
+	if lookup.ForAddress(0) != nil {
+		t.Errorf("Found a symbol at address 0\n")
+	}
+}
@@ -13,18 +13,31 @@ import (
 // offset is invalid or the string isn't terminated. This can be used to
 // extract strings from string table content.
 func ReadStringAtOffset(offset uint32, data []byte) ([]byte, error) {
-	if offset >= uint32(len(data)) {
-		return nil, fmt.Errorf("Invalid string offset: %d", offset)
+	if uint64(offset) >= uint64(len(data)) {
+		return nil, fmt.Errorf("%w: string offset %d is past the end of "+
+			"the table", ErrTruncated, offset)
 	}
-	endIndex := offset
-	for data[endIndex] != 0 {
-		endIndex++
-		if endIndex >= uint32(len(data)) {
-			return nil, fmt.Errorf("Unterminated string starting at offset %d",
-				offset)
-		}
+	length := bytes.IndexByte(data[offset:], 0)
+	if length < 0 {
+		return nil, fmt.Errorf("%w: unterminated string starting at offset "+
+			"%d", ErrTruncated, offset)
+	}
+	return data[offset : uint64(offset)+uint64(length)], nil
+}
+
+// Returns an error if a table of count entries, each entrySize bytes, doesn't
+// fit in dataSize bytes when starting at the given offset. Used to check
+// tables' bounds before allocating space for their entries.
+func checkTableBounds(offset, count, entrySize, dataSize uint64) error {
+	if offset > dataSize {
+		return fmt.Errorf("%w: table offset 0x%x is past the end of the "+
+			"data", ErrTruncated, offset)
+	}
+	if (entrySize != 0) && (count > ((dataSize - offset) / entrySize)) {
+		return fmt.Errorf("%w: %d %d-byte entries at offset 0x%x don't fit "+
+			"in %d bytes", ErrTruncated, count, entrySize, offset, dataSize)
 	}
-	return data[offset:endIndex], nil
+	return nil
 }
 
 // Calculates the hash value of a given string.
@@ -0,0 +1,868 @@
+package elf_reader
+
+// This file contains code for checking ELF files for malformed or
+// inconsistent structures, which ReparseData doesn't detect because it only
+// parses what's needed to read the file.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Indicates how serious a ValidationDiagnostic is.
+type ValidationSeverity uint8
+
+const (
+	// The file is unusual, but may still work correctly.
+	ValidationWarning ValidationSeverity = iota
+	// The file is malformed, and tools or loaders may reject or misread it.
+	ValidationError
+)
+
+func (s ValidationSeverity) String() string {
+	switch s {
+	case ValidationWarning:
+		return "warning"
+	case ValidationError:
+		return "error"
+	}
+	return fmt.Sprintf("unknown severity %d", uint8(s))
+}
+
+// Encodes the severity as its name in JSON output.
+func (s ValidationSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Describes a single problem found by Validate.
+type ValidationDiagnostic struct {
+	Severity ValidationSeverity
+	// The part of the file containing the problem, e.g. "ELF header" or
+	// "section 5 (.dynsym)".
+	Location string
+	Message  string
+}
+
+func (d *ValidationDiagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Severity, d.Location, d.Message)
+}
+
+// The list of problems found by Validate.
+type ValidationDiagnostics []ValidationDiagnostic
+
+// Returns true if any of the diagnostics are errors.
+func (d ValidationDiagnostics) HasErrors() bool {
+	for i := range d {
+		if d[i].Severity == ValidationError {
+			return true
+		}
+	}
+	return false
+}
+
+func (d ValidationDiagnostics) String() string {
+	if len(d) == 0 {
+		return "No problems found.\n"
+	}
+	var b strings.Builder
+	for i := range d {
+		fmt.Fprintf(&b, "%s\n", &(d[i]))
+	}
+	return b.String()
+}
+
+// Returns the expected sizes of the ELF header, a program header and a
+// section header for the file's class.
+func expectedHeaderSizes(f ELFFile) (uint16, uint16, uint16) {
+	if is64Bit(f) {
+		return 64, 56, 64
+	}
+	return 52, 32, 40
+}
+
+// Returns the version field from the ELF header (not the one in e_ident).
+func headerVersion(f ELFFile) uint32 {
+	switch v := f.(type) {
+	case *ELF64File:
+		return v.Header.Version2
+	case *ELF32File:
+		return v.Header.Version2
+	}
+	return 0
+}
+
+// Returns the entry point from the ELF header.
+func entryPoint(f ELFFile) uint64 {
+	switch v := f.(type) {
+	case *ELF64File:
+		return v.Header.EntryPoint
+	case *ELF32File:
+		return uint64(v.Header.EntryPoint)
+	}
+	return 0
+}
+
+// Returns true if the value is zero or a power of two.
+func isPowerOfTwo(v uint64) bool {
+	return (v & (v - 1)) == 0
+}
+
+// Holds the state used by the individual validation checks.
+type validator struct {
+	f           ELFFile
+	raw         []byte
+	layout      fileLayout
+	sections    []ELF64SectionHeader
+	segments    []ELF64ProgramHeader
+	diagnostics ValidationDiagnostics
+}
+
+func (v *validator) add(severity ValidationSeverity, location string,
+	format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, ValidationDiagnostic{
+		Severity: severity,
+		Location: location,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Returns a description of the section at the given index, for use as a
+// diagnostic's location.
+func (v *validator) sectionLocation(index int) string {
+	name, e := v.f.GetSectionName(uint16(index))
+	if (e != nil) || (name == "") {
+		return fmt.Sprintf("section %d", index)
+	}
+	return fmt.Sprintf("section %d (%s)", index, name)
+}
+
+func segmentLocation(index int) string {
+	return fmt.Sprintf("segment %d", index)
+}
+
+// Returns true if the given range lies within the file.
+func (v *validator) inFile(offset, size uint64) bool {
+	end, e := rangeEnd(offset, size)
+	return (e == nil) && (end <= uint64(len(v.raw)))
+}
+
+// Returns true if the section occupies space in the file.
+func (v *validator) hasContent(index int) bool {
+	h := &(v.sections[index])
+	return (h.Type != NullSection) && (h.Type != UninitializedSection) &&
+		(h.Size != 0)
+}
+
+func (v *validator) checkHeader() {
+	const location = "ELF header"
+	if v.raw[6] != 1 {
+		v.add(ValidationError, location, "Invalid e_ident version: %d",
+			v.raw[6])
+	}
+	if headerVersion(v.f) != 1 {
+		v.add(ValidationError, location, "Invalid e_version: %d",
+			headerVersion(v.f))
+	}
+	fileType := v.f.GetFileType()
+	if fileType == 0 {
+		v.add(ValidationWarning, location, "The file type is ET_NONE")
+	} else if (fileType > 4) && (fileType < 0xfe00) {
+		v.add(ValidationError, location, "Invalid file type: %d",
+			uint16(fileType))
+	}
+	headerSize, programHeaderSize, sectionHeaderSize := expectedHeaderSizes(
+		v.f)
+	if v.layout.HeaderSize != headerSize {
+		v.add(ValidationError, location, "e_ehsize is %d, expected %d",
+			v.layout.HeaderSize, headerSize)
+	}
+	if (len(v.segments) != 0) &&
+		(v.layout.ProgramHeaderEntrySize != programHeaderSize) {
+		v.add(ValidationError, location, "e_phentsize is %d, expected %d",
+			v.layout.ProgramHeaderEntrySize, programHeaderSize)
+	}
+	if !v.inFile(v.layout.ProgramHeaderOffset, uint64(len(v.segments))*
+		uint64(v.layout.ProgramHeaderEntrySize)) {
+		v.add(ValidationError, location, "The program header table extends "+
+			"past the end of the file")
+	}
+	if len(v.sections) == 0 {
+		return
+	}
+	if v.layout.SectionHeaderEntrySize != sectionHeaderSize {
+		v.add(ValidationError, location, "e_shentsize is %d, expected %d",
+			v.layout.SectionHeaderEntrySize, sectionHeaderSize)
+	}
+	if !v.inFile(v.layout.SectionHeaderOffset, uint64(len(v.sections))*
+		uint64(v.layout.SectionHeaderEntrySize)) {
+		v.add(ValidationError, location, "The section header table extends "+
+			"past the end of the file")
+	}
+	namesTable := int(v.layout.SectionNamesTable)
+	if namesTable == 0 {
+		v.add(ValidationWarning, location, "There is no section name table")
+	} else if namesTable >= len(v.sections) {
+		v.add(ValidationError, location, "e_shstrndx %d is out of range",
+			namesTable)
+	} else if v.sections[namesTable].Type != StringTableSection {
+		v.add(ValidationError, location, "e_shstrndx %d isn't a string "+
+			"table", namesTable)
+	}
+	if v.sections[0].Type != NullSection {
+		v.add(ValidationWarning, location, "Section 0 isn't a null section")
+	}
+}
+
+// Checks that the entry point is in an executable loadable segment.
+func (v *validator) checkEntryPoint() {
+	entry := entryPoint(v.f)
+	fileType := v.f.GetFileType()
+	if (entry == 0) || ((fileType != ELFTypeExecutable) &&
+		(fileType != ELFTypeShared)) {
+		return
+	}
+	hasLoadable := false
+	for i := range v.segments {
+		s := &(v.segments[i])
+		if s.Type != LoadableSegment {
+			continue
+		}
+		hasLoadable = true
+		if (s.Flags&1) == 0 || (entry < s.VirtualAddress) ||
+			((entry - s.VirtualAddress) >= s.MemorySize) {
+			continue
+		}
+		return
+	}
+	if hasLoadable {
+		v.add(ValidationWarning, "ELF header", "The entry point 0x%x isn't "+
+			"in an executable loadable segment", entry)
+	}
+}
+
+// Returns the expected entry size for sections of the given type, or 0 if
+// it isn't fixed.
+func (v *validator) expectedEntrySize(t SectionHeaderType) uint64 {
+	is64 := is64Bit(v.f)
+	sizes := map[SectionHeaderType][2]uint64{
+		SymbolTableSection:         {16, 24},
+		DynamicLoaderSymbolSection: {16, 24},
+		RelSection:                 {8, 16},
+		RelaSection:                {12, 24},
+		DynamicLinkingTableSection: {8, 16},
+	}
+	s, ok := sizes[t]
+	if !ok {
+		return 0
+	}
+	if is64 {
+		return s[1]
+	}
+	return s[0]
+}
+
+// Checks the sh_link and sh_info fields of a section.
+func (v *validator) checkSectionLinks(index int) {
+	h := &(v.sections[index])
+	location := v.sectionLocation(index)
+	count := uint32(len(v.sections))
+	if h.LinkedIndex >= count {
+		v.add(ValidationError, location, "sh_link %d is out of range",
+			h.LinkedIndex)
+	} else {
+		var expected []SectionHeaderType
+		switch h.Type {
+		case SymbolTableSection, DynamicLoaderSymbolSection,
+			DynamicLinkingTableSection:
+			expected = []SectionHeaderType{StringTableSection}
+		case HashSection, GNUHashSection, GNUVersionSymbolSection:
+			expected = []SectionHeaderType{DynamicLoaderSymbolSection}
+		case RelSection, RelaSection:
+			// Dynamic relocations without symbols may have no link.
+			if h.LinkedIndex != 0 {
+				expected = []SectionHeaderType{SymbolTableSection,
+					DynamicLoaderSymbolSection}
+			}
+		}
+		if len(expected) != 0 {
+			linkedType := v.sections[h.LinkedIndex].Type
+			ok := false
+			for _, t := range expected {
+				ok = ok || (linkedType == t)
+			}
+			if !ok {
+				v.add(ValidationError, location, "sh_link refers to section "+
+					"%d, which is a %s", h.LinkedIndex, linkedType)
+			}
+		}
+	}
+	switch {
+	case (h.Type == SymbolTableSection) ||
+		(h.Type == DynamicLoaderSymbolSection):
+		entrySize := v.expectedEntrySize(h.Type)
+		if uint64(h.Info) > (h.Size / entrySize) {
+			v.add(ValidationError, location, "sh_info %d is greater than "+
+				"the number of symbols", h.Info)
+		}
+	case (h.Flags & SectionFlagInfoLink) != 0:
+		if h.Info >= count {
+			v.add(ValidationError, location, "sh_info %d is out of range",
+				h.Info)
+		}
+	}
+}
+
+func (v *validator) checkSections() {
+	for i := 1; i < len(v.sections); i++ {
+		h := &(v.sections[i])
+		location := v.sectionLocation(i)
+		if v.hasContent(i) && !v.inFile(h.FileOffset, h.Size) {
+			v.add(ValidationError, location, "The contents (offset 0x%x, "+
+				"size 0x%x) extend past the end of the file", h.FileOffset,
+				h.Size)
+		}
+		if !isPowerOfTwo(h.Align) {
+			v.add(ValidationError, location, "The alignment %d isn't a "+
+				"power of two", h.Align)
+		} else if (h.Align > 1) && ((h.VirtualAddress % h.Align) != 0) {
+			v.add(ValidationWarning, location, "The address 0x%x isn't "+
+				"aligned to %d bytes", h.VirtualAddress, h.Align)
+		}
+		v.checkSectionLinks(i)
+		entrySize := v.expectedEntrySize(h.Type)
+		if entrySize != 0 {
+			if h.EntrySize != entrySize {
+				v.add(ValidationError, location, "sh_entsize is %d, "+
+					"expected %d", h.EntrySize, entrySize)
+			}
+			if (h.Size % entrySize) != 0 {
+				v.add(ValidationError, location, "The size %d isn't a "+
+					"multiple of the entry size", h.Size)
+			}
+		}
+		if (h.Type == StringTableSection) && (h.Size != 0) {
+			content, e := v.f.GetSectionContent(uint16(i))
+			if e != nil {
+				continue
+			}
+			if content[len(content)-1] != 0 {
+				v.add(ValidationError, location, "The string table isn't "+
+					"null-terminated")
+			}
+			if content[0] != 0 {
+				v.add(ValidationWarning, location, "The string table "+
+					"doesn't start with a null byte")
+			}
+		}
+	}
+	v.checkOverlaps()
+}
+
+// Checks for sections overlapping each other or the header tables.
+func (v *validator) checkOverlaps() {
+	type fileRange struct {
+		start, end uint64
+		name       string
+	}
+	var ranges []fileRange
+	ranges = append(ranges, fileRange{0, uint64(v.layout.HeaderSize),
+		"the ELF header"})
+	if len(v.segments) != 0 {
+		start := v.layout.ProgramHeaderOffset
+		ranges = append(ranges, fileRange{start, start +
+			uint64(len(v.segments))*uint64(v.layout.ProgramHeaderEntrySize),
+			"the program header table"})
+	}
+	start := v.layout.SectionHeaderOffset
+	ranges = append(ranges, fileRange{start, start +
+		uint64(len(v.sections))*uint64(v.layout.SectionHeaderEntrySize),
+		"the section header table"})
+	for i := 1; i < len(v.sections); i++ {
+		h := &(v.sections[i])
+		if !v.hasContent(i) || !v.inFile(h.FileOffset, h.Size) {
+			continue
+		}
+		ranges = append(ranges, fileRange{h.FileOffset,
+			h.FileOffset + h.Size, v.sectionLocation(i)})
+	}
+	sort.SliceStable(ranges, func(a, b int) bool {
+		return ranges[a].start < ranges[b].start
+	})
+	// Compare each range to the one extending furthest before it.
+	furthest := 0
+	for i := 1; i < len(ranges); i++ {
+		current := &(ranges[i])
+		previous := &(ranges[furthest])
+		if (current.start < current.end) && (current.start < previous.end) {
+			v.add(ValidationError, current.name, "Overlaps %s",
+				previous.name)
+		}
+		if current.end > previous.end {
+			furthest = i
+		}
+	}
+}
+
+// Returns true if the virtual address range is within a loadable segment.
+func (v *validator) inLoadableSegment(address, size uint64) bool {
+	for i := range v.segments {
+		s := &(v.segments[i])
+		if (s.Type != LoadableSegment) || (address < s.VirtualAddress) {
+			continue
+		}
+		if (address - s.VirtualAddress + size) <= s.MemorySize {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) checkSegments() {
+	seenLoadable := false
+	var lastLoadAddress uint64
+	counts := make(map[ProgramHeaderType]int)
+	for i := range v.segments {
+		s := &(v.segments[i])
+		location := segmentLocation(i)
+		counts[s.Type]++
+		if !v.inFile(s.FileOffset, s.FileSize) {
+			v.add(ValidationError, location, "The contents (offset 0x%x, "+
+				"size 0x%x) extend past the end of the file", s.FileOffset,
+				s.FileSize)
+		}
+		if !isPowerOfTwo(s.Align) {
+			v.add(ValidationError, location, "The alignment %d isn't a "+
+				"power of two", s.Align)
+		}
+		switch s.Type {
+		case LoadableSegment:
+			if (s.Align > 1) && isPowerOfTwo(s.Align) &&
+				((s.FileOffset % s.Align) != (s.VirtualAddress % s.Align)) {
+				v.add(ValidationError, location, "The offset 0x%x and "+
+					"address 0x%x aren't congruent modulo the alignment "+
+					"0x%x", s.FileOffset, s.VirtualAddress, s.Align)
+			}
+			if s.FileSize > s.MemorySize {
+				v.add(ValidationError, location, "The file size 0x%x is "+
+					"larger than the memory size 0x%x", s.FileSize,
+					s.MemorySize)
+			}
+			if seenLoadable && (s.VirtualAddress < lastLoadAddress) {
+				v.add(ValidationWarning, location, "Loadable segments "+
+					"aren't sorted by address")
+			}
+			seenLoadable = true
+			lastLoadAddress = s.VirtualAddress
+		case ProgramHeaderSegment:
+			v.checkPHDRSegment(i, seenLoadable)
+		case InterpreterSegment:
+			v.checkInterpreterSegment(i, seenLoadable)
+		}
+	}
+	unique := []ProgramHeaderType{ProgramHeaderSegment, InterpreterSegment,
+		DynamicLinkingSegment, GNUStackSegment, GNURelroSegment}
+	for _, t := range unique {
+		if counts[t] > 1 {
+			v.add(ValidationError, "program header table", "There are %d "+
+				"%s headers, but at most one is allowed", counts[t], t)
+		}
+	}
+}
+
+// Checks that a PT_PHDR segment describes the program header table.
+func (v *validator) checkPHDRSegment(index int, afterLoadable bool) {
+	s := &(v.segments[index])
+	location := segmentLocation(index)
+	if afterLoadable {
+		v.add(ValidationError, location, "PT_PHDR follows a loadable segment")
+	}
+	tableSize := uint64(len(v.segments)) *
+		uint64(v.layout.ProgramHeaderEntrySize)
+	if (s.FileOffset != v.layout.ProgramHeaderOffset) ||
+		(s.FileSize != tableSize) {
+		v.add(ValidationError, location, "PT_PHDR (offset 0x%x, size 0x%x) "+
+			"doesn't match the program header table (offset 0x%x, size "+
+			"0x%x)", s.FileOffset, s.FileSize, v.layout.ProgramHeaderOffset,
+			tableSize)
+	}
+	if !v.inLoadableSegment(s.VirtualAddress, s.MemorySize) {
+		v.add(ValidationError, location, "PT_PHDR isn't covered by a "+
+			"loadable segment")
+	}
+}
+
+// Checks that a PT_INTERP segment holds a path, and matches any .interp
+// section.
+func (v *validator) checkInterpreterSegment(index int, afterLoadable bool) {
+	s := &(v.segments[index])
+	location := segmentLocation(index)
+	if afterLoadable {
+		v.add(ValidationError, location, "PT_INTERP follows a loadable "+
+			"segment")
+	}
+	content, e := v.f.GetSegmentContent(uint16(index))
+	if e == nil {
+		if (len(content) == 0) || (content[len(content)-1] != 0) {
+			v.add(ValidationError, location, "The interpreter path isn't "+
+				"null-terminated")
+		}
+	}
+	for i := 1; i < len(v.sections); i++ {
+		name, e := v.f.GetSectionName(uint16(i))
+		if (e != nil) || (name != ".interp") {
+			continue
+		}
+		h := &(v.sections[i])
+		if (h.FileOffset != s.FileOffset) || (h.Size != s.FileSize) {
+			v.add(ValidationWarning, location, "PT_INTERP (offset 0x%x, "+
+				"size 0x%x) doesn't match the .interp section (offset 0x%x, "+
+				"size 0x%x)", s.FileOffset, s.FileSize, h.FileOffset, h.Size)
+		}
+	}
+}
+
+// Checks that symbols refer to valid sections, lie within them, and are
+// ordered with local symbols first.
+func (v *validator) checkSymbols(index int) {
+	location := v.sectionLocation(index)
+	symbols, names, e := v.f.GetSymbols(uint16(index))
+	if e != nil {
+		v.add(ValidationError, location, "Failed reading symbols: %s", e)
+		return
+	}
+	firstGlobal := int(v.sections[index].Info)
+	relocatable := v.f.GetFileType() == ELFTypeRelocatable
+	for i := 1; i < len(symbols); i++ {
+		s := symbols[i]
+		name := names[i]
+		if name == "" {
+			name = fmt.Sprintf("symbol %d", i)
+		}
+		isLocal := s.GetInfo().Binding() == 0
+		if isLocal && (i >= firstGlobal) {
+			v.add(ValidationError, location, "Local symbol %s follows the "+
+				"first global symbol, %d", name, firstGlobal)
+		} else if !isLocal && (i < firstGlobal) {
+			v.add(ValidationError, location, "Non-local symbol %s precedes "+
+				"the first global symbol, %d", name, firstGlobal)
+		}
+		sectionIndex := int(s.GetSectionIndex())
+		if (sectionIndex == 0) || (sectionIndex >= 0xff00) {
+			continue
+		}
+		if sectionIndex >= len(v.sections) {
+			v.add(ValidationError, location, "%s refers to section %d, "+
+				"which doesn't exist", name, sectionIndex)
+			continue
+		}
+		// The values of TLS symbols are offsets into the TLS segment.
+		symbolType := s.GetInfo().SymbolType()
+		if (symbolType == 6) || (symbolType == 3) {
+			continue
+		}
+		section := &(v.sections[sectionIndex])
+		start := section.VirtualAddress
+		if relocatable {
+			start = 0
+		}
+		value := s.GetValue()
+		if (value < start) || ((value - start) > section.Size) {
+			// Linkers assign symbols such as _end, marking the ends of
+			// regions, to nearby sections rather than the section they're
+			// in, so these are only reported if they're outside of memory.
+			if !relocatable && v.inLoadableSegment(value, 0) {
+				continue
+			}
+			v.add(ValidationError, location, "%s (value 0x%x) is outside "+
+				"of %s", name, value, v.sectionLocation(sectionIndex))
+		} else if (value - start + s.GetSize()) > section.Size {
+			v.add(ValidationWarning, location, "%s (value 0x%x, size %d) "+
+				"extends past the end of %s", name, value, s.GetSize(),
+				v.sectionLocation(sectionIndex))
+		}
+	}
+}
+
+// Reads the words in the data, returning nil if it's too short.
+func (v *validator) readWords(data []byte, count uint64) []uint32 {
+	if count > (uint64(len(data)) / 4) {
+		return nil
+	}
+	order := fileEndianness(v.f)
+	toReturn := make([]uint32, count)
+	for i := range toReturn {
+		toReturn[i] = order.Uint32(data[i*4:])
+	}
+	return toReturn
+}
+
+// Returns true if a dynamic symbol should be findable using the hash tables.
+func isHashedSymbol(s ELFSymbol, name string) bool {
+	return (name != "") && (s.GetSectionIndex() != 0) &&
+		(s.GetInfo().Binding() != 0)
+}
+
+// Checks that a SHT_HASH table agrees with the symbol table it refers to.
+func (v *validator) checkSysVHash(index int, symbols []ELFSymbol,
+	names []string) {
+	location := v.sectionLocation(index)
+	content, e := v.f.GetSectionContent(uint16(index))
+	if e != nil {
+		v.add(ValidationError, location, "Failed reading hash table: %s", e)
+		return
+	}
+	header := v.readWords(content, 2)
+	if header == nil {
+		v.add(ValidationError, location, "The hash table is too small")
+		return
+	}
+	bucketCount, chainCount := uint64(header[0]), uint64(header[1])
+	words := v.readWords(content[8:], bucketCount+chainCount)
+	if words == nil {
+		v.add(ValidationError, location, "The hash table is too small for "+
+			"%d buckets and %d chains", bucketCount, chainCount)
+		return
+	}
+	if chainCount != uint64(len(symbols)) {
+		v.add(ValidationError, location, "The hash table has %d chains, "+
+			"but there are %d symbols", chainCount, len(symbols))
+	}
+	if bucketCount == 0 {
+		v.add(ValidationError, location, "The hash table has no buckets")
+		return
+	}
+	buckets, chains := words[:bucketCount], words[bucketCount:]
+	for i, s := range symbols {
+		if !isHashedSymbol(s, names[i]) {
+			continue
+		}
+		hash := ELF32Hash([]byte(names[i]))
+		found := false
+		// Limit the number of steps, in case the chain contains a loop.
+		current := buckets[uint64(hash)%bucketCount]
+		for steps := uint64(0); (current != 0) && (steps < chainCount); steps++ {
+			if uint64(current) >= chainCount {
+				break
+			}
+			if (int(current) < len(names)) && (names[current] == names[i]) {
+				found = true
+				break
+			}
+			current = chains[current]
+		}
+		if !found {
+			v.add(ValidationError, location, "Symbol %s isn't found using "+
+				"the hash table", names[i])
+		}
+	}
+}
+
+// Returns the GNU hash of the given name.
+func gnuHash(name string) uint32 {
+	hash := uint32(5381)
+	for i := 0; i < len(name); i++ {
+		hash = (hash * 33) + uint32(name[i])
+	}
+	return hash
+}
+
+// Checks that a SHT_GNU_HASH table agrees with the symbol table it refers
+// to.
+func (v *validator) checkGNUHash(index int, symbols []ELFSymbol,
+	names []string) {
+	location := v.sectionLocation(index)
+	content, e := v.f.GetSectionContent(uint16(index))
+	if e != nil {
+		v.add(ValidationError, location, "Failed reading hash table: %s", e)
+		return
+	}
+	header := v.readWords(content, 4)
+	if header == nil {
+		v.add(ValidationError, location, "The hash table is too small")
+		return
+	}
+	bucketCount := uint64(header[0])
+	symbolOffset := uint64(header[1])
+	bloomCount := uint64(header[2])
+	bloomShift := header[3]
+	bloomWordBits := uint64(32)
+	if is64Bit(v.f) {
+		bloomWordBits = 64
+	}
+	symbolCount := uint64(len(symbols))
+	if symbolOffset > symbolCount {
+		v.add(ValidationError, location, "The first hashed symbol, %d, is "+
+			"past the end of the symbol table", symbolOffset)
+		return
+	}
+	if (bucketCount == 0) || (bloomCount == 0) {
+		v.add(ValidationError, location, "The hash table has %d buckets and "+
+			"%d bloom filter words", bucketCount, bloomCount)
+		return
+	}
+	// The bloom filter words are read as pairs of 32-bit words in 64-bit
+	// files. The chains don't need to cover symbols that aren't in any
+	// bucket, so they take up the rest of the table.
+	bloomWords := bloomCount * (bloomWordBits / 32)
+	words := v.readWords(content[16:], uint64(len(content)-16)/4)
+	if uint64(len(words)) < (bloomWords + bucketCount) {
+		v.add(ValidationError, location, "The hash table is too small for "+
+			"%d bloom filter words and %d buckets", bloomCount, bucketCount)
+		return
+	}
+	bloom := words[:bloomWords]
+	buckets := words[bloomWords : bloomWords+bucketCount]
+	chains := words[bloomWords+bucketCount:]
+	order := fileEndianness(v.f)
+	bloomBit := func(bit uint64, wordIndex uint64) bool {
+		if bloomWordBits == 32 {
+			return (bloom[wordIndex] & (1 << bit)) != 0
+		}
+		// Reassemble the 64-bit word in the file's byte order.
+		var pair [8]byte
+		order.PutUint32(pair[:], bloom[wordIndex*2])
+		order.PutUint32(pair[4:], bloom[wordIndex*2+1])
+		return (order.Uint64(pair[:]) & (1 << bit)) != 0
+	}
+	for i, s := range symbols {
+		if !isHashedSymbol(s, names[i]) {
+			continue
+		}
+		if uint64(i) < symbolOffset {
+			v.add(ValidationWarning, location, "Symbol %s precedes the "+
+				"first hashed symbol, so it can't be found", names[i])
+			continue
+		}
+		hash := gnuHash(names[i])
+		wordIndex := (uint64(hash) / bloomWordBits) % bloomCount
+		if !bloomBit(uint64(hash)%bloomWordBits, wordIndex) ||
+			!bloomBit(uint64(hash>>bloomShift)%bloomWordBits, wordIndex) {
+			v.add(ValidationError, location, "The bloom filter rejects "+
+				"symbol %s", names[i])
+			continue
+		}
+		found := false
+		current := uint64(buckets[uint64(hash)%uint64(bucketCount)])
+		for (current >= symbolOffset) && (current < symbolCount) &&
+			((current - symbolOffset) < uint64(len(chains))) {
+			chainHash := chains[current-symbolOffset]
+			if ((chainHash | 1) == (hash | 1)) &&
+				(names[current] == names[i]) {
+				found = true
+				break
+			}
+			if (chainHash & 1) != 0 {
+				break
+			}
+			current++
+		}
+		if !found {
+			v.add(ValidationError, location, "Symbol %s isn't found using "+
+				"the hash table", names[i])
+		}
+	}
+}
+
+// Checks the hash tables against the symbol tables they refer to.
+func (v *validator) checkHashTables() {
+	for i := 1; i < len(v.sections); i++ {
+		h := &(v.sections[i])
+		if (h.Type != HashSection) && (h.Type != GNUHashSection) {
+			continue
+		}
+		link := int(h.LinkedIndex)
+		if (link >= len(v.sections)) ||
+			(v.sections[link].Type != DynamicLoaderSymbolSection) {
+			// This is already reported by checkSectionLinks.
+			continue
+		}
+		symbols, names, e := v.f.GetSymbols(uint16(link))
+		if e != nil {
+			// This is already reported by checkSymbols.
+			continue
+		}
+		if h.Type == HashSection {
+			v.checkSysVHash(i, symbols, names)
+		} else {
+			v.checkGNUHash(i, symbols, names)
+		}
+	}
+}
+
+// Implements Validate for either 32- or 64-bit ELF files.
+func validateELF(f ELFFile) ValidationDiagnostics {
+	v := &validator{
+		f:        f,
+		raw:      fileRaw(f),
+		layout:   getFileLayout(f),
+		sections: sectionHeaders64(f),
+		segments: programHeaders64(f),
+	}
+	v.checkHeader()
+	v.checkEntryPoint()
+	v.checkSections()
+	v.checkSegments()
+	for i := 1; i < len(v.sections); i++ {
+		t := v.sections[i].Type
+		if (t == SymbolTableSection) || (t == DynamicLoaderSymbolSection) {
+			v.checkSymbols(i)
+		}
+	}
+	v.checkHashTables()
+	return v.diagnostics
+}
+
+// Checks the file for malformed or inconsistent headers, sections, segments,
+// symbols and hash tables, returning a diagnostic for each problem found.
+// Returns an empty list if no problems were found.
+func (f *ELF64File) Validate() ValidationDiagnostics {
+	return validateELF(f)
+}
+
+// Checks the file for problems. Behaves the same as the ELF64File version.
+func (f *ELF32File) Validate() ValidationDiagnostics {
+	return validateELF(f)
+}
+
+// Checks the given *ELF32File or *ELF64File for problems, in the same way as
+// its Validate method. Other implementations of ELFFile aren't supported, and
+// produce a single error diagnostic.
+func ValidateELFFile(f ELFFile) ValidationDiagnostics {
+	switch f.(type) {
+	case *ELF64File, *ELF32File:
+		return validateELF(f)
+	}
+	return ValidationDiagnostics{
+		ValidationDiagnostic{
+			Severity: ValidationError,
+			Location: "file",
+			Message:  fmt.Sprintf("Unsupported ELF file type: %T", f),
+		},
+	}
+}
+
+// Parses the given data as an ELF file, in the same way as ParseELFFile, but
+// returns an error if Validate reports any errors. Warnings are ignored.
+func ParseELFFileStrict(raw []byte) (ELFFile, error) {
+	f, e := ParseELFFile(raw)
+	if e != nil {
+		return nil, e
+	}
+	diagnostics := ValidateELFFile(f)
+	var errors []string
+	for i := range diagnostics {
+		d := &(diagnostics[i])
+		if d.Severity == ValidationError {
+			errors = append(errors, d.Location+": "+d.Message)
+		}
+	}
+	if len(errors) == 0 {
+		return f, nil
+	}
+	if len(errors) == 1 {
+		return nil, fmt.Errorf("Invalid ELF file: %s", errors[0])
+	}
+	return nil, fmt.Errorf("Invalid ELF file: %s (and %d more errors)",
+		errors[0], len(errors)-1)
+}
@@ -0,0 +1,142 @@
+package elf_reader
+
+import (
+	"strings"
+	"testing"
+)
+
+// Parses a copy of the given file, applies the modification, and checks that
+// Validate reports an error containing the expected message.
+func checkValidationError(filename, expected string,
+	modify func(f ELFFile, raw []byte), t *testing.T) {
+	raw := append([]byte{}, fileBytes(filename, t)...)
+	f, e := ParseELFFile(raw)
+	if e != nil {
+		t.Fatalf("Failed parsing %s: %s\n", filename, e)
+	}
+	modify(f, raw)
+	diagnostics := ValidateELFFile(f)
+	for i := range diagnostics {
+		d := &(diagnostics[i])
+		if (d.Severity == ValidationError) &&
+			strings.Contains(d.Message, expected) {
+			t.Logf("Got expected diagnostic: %s\n", d)
+			return
+		}
+	}
+	t.Errorf("Didn't get an error containing \"%s\". Got:\n%s", expected,
+		diagnostics)
+}
+
+// Returns the index of the named section, or fails the test.
+func testSectionIndex(f ELFFile, name string, t *testing.T) uint16 {
+	index, e := FindSectionByName(f, name)
+	if e != nil {
+		t.Fatalf("%s\n", e)
+	}
+	return index
+}
+
+func TestValidate(t *testing.T) {
+	testFiles := []string{"sleep_amd64", "sleep_arm32", "bash32_freebsd",
+		"hello_debug_amd64.o", "ld-linux_arm32.so"}
+	for _, name := range testFiles {
+		f, e := ParseELFFile(fileBytes("test_data/"+name, t))
+		if e != nil {
+			t.Fatalf("Failed parsing %s: %s\n", name, e)
+		}
+		diagnostics := ValidateELFFile(f)
+		if len(diagnostics) != 0 {
+			t.Errorf("Got unexpected diagnostics for %s:\n%s", name,
+				diagnostics)
+		}
+	}
+
+	checkValidationError("test_data/sleep_amd64", "e_version",
+		func(f ELFFile, raw []byte) {
+			f.(*ELF64File).Header.Version2 = 2
+		}, t)
+	checkValidationError("test_data/sleep_arm32", "e_ehsize",
+		func(f ELFFile, raw []byte) {
+			f.(*ELF32File).Header.HeaderSize = 60
+		}, t)
+	checkValidationError("test_data/sleep_amd64", "sh_link 200",
+		func(f ELFFile, raw []byte) {
+			index := testSectionIndex(f, ".dynsym", t)
+			f.(*ELF64File).Sections[index].LinkedIndex = 200
+		}, t)
+	checkValidationError("test_data/sleep_amd64", "Overlaps",
+		func(f ELFFile, raw []byte) {
+			index := testSectionIndex(f, ".fini", t)
+			sections := f.(*ELF64File).Sections
+			sections[index].FileOffset = sections[index-1].FileOffset
+		}, t)
+	checkValidationError("test_data/sleep_amd64", "aren't congruent",
+		func(f ELFFile, raw []byte) {
+			f.(*ELF64File).Segments[3].VirtualAddress += 0x10
+		}, t)
+	checkValidationError("test_data/sleep_amd64", "PT_PHDR",
+		func(f ELFFile, raw []byte) {
+			f.(*ELF64File).Segments[0].FileOffset += 8
+		}, t)
+	checkValidationError("test_data/sleep_amd64", "PT_INTERP follows",
+		func(f ELFFile, raw []byte) {
+			segments := f.(*ELF64File).Segments
+			segments[1], segments[2] = segments[2], segments[1]
+		}, t)
+	checkValidationError("test_data/sleep_amd64", "null-terminated",
+		func(f ELFFile, raw []byte) {
+			index := testSectionIndex(f, ".shstrtab", t)
+			h := &(f.(*ELF64File).Sections[index])
+			raw[h.FileOffset+h.Size-1] = 'x'
+		}, t)
+	checkValidationError("test_data/hello_debug_amd64.o", "is outside of",
+		func(f ELFFile, raw []byte) {
+			index := testSectionIndex(f, ".text", t)
+			f.(*ELF64File).Sections[index].Size = 0
+		}, t)
+	checkValidationError("test_data/bash32_freebsd", "isn't found using",
+		func(f ELFFile, raw []byte) {
+			// Clear the SysV hash table's buckets.
+			index := testSectionIndex(f, ".hash", t)
+			h := &(f.(*ELF32File).Sections[index])
+			for i := h.FileOffset + 8; i < (h.FileOffset + h.Size); i++ {
+				raw[i] = 0
+			}
+		}, t)
+	checkValidationError("test_data/bash32_freebsd", "bloom filter rejects",
+		func(f ELFFile, raw []byte) {
+			// Clear the GNU hash table's bloom filter.
+			index := testSectionIndex(f, ".gnu.hash", t)
+			offset := f.(*ELF32File).Sections[index].FileOffset
+			words := f.(*ELF32File).Endianness.Uint32(raw[offset+8:])
+			for i := uint32(0); i < (words * 4); i++ {
+				raw[offset+16+i] = 0
+			}
+		}, t)
+
+	// ParseELFFileStrict should reject files with errors, but accept valid
+	// ones.
+	raw := append([]byte{}, fileBytes("test_data/sleep_amd64", t)...)
+	_, e := ParseELFFileStrict(raw)
+	if e != nil {
+		t.Errorf("Strict parsing failed for a valid file: %s\n", e)
+	}
+	// Set the section alignment of .text to 3.
+	f, _ := ParseELF64File(raw)
+	index := testSectionIndex(f, ".text", t)
+	offset := f.Header.SectionHeaderOffset + uint64(index)*64 + 48
+	raw[offset] = 3
+	_, e = ParseELFFileStrict(raw)
+	if e == nil {
+		t.Errorf("Strict parsing didn't fail for an invalid file\n")
+	} else {
+		t.Logf("Got expected strict parsing error: %s\n", e)
+	}
+	// The 64-bit parser should check the signature, like the 32-bit one.
+	raw[0] = 0
+	_, e = ParseELF64File(raw)
+	if e == nil {
+		t.Errorf("Didn't get an error for an invalid signature\n")
+	}
+}
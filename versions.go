@@ -0,0 +1,457 @@
+package elf_reader
+
+// This file contains 32- or 64-bit agnostic functions for reading GNU symbol
+// versioning information. The version definition and requirement structures
+// have the same layout in both 32- and 64-bit ELF files, so the ELF32
+// structure definitions are used for both.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Special values in the .gnu.version section.
+const (
+	// The symbol is local and not available outside the object.
+	VersionIndexLocal = 0
+	// The symbol is global, but has no specific version.
+	VersionIndexGlobal = 1
+	// If set in a version index, the symbol isn't the default version, and
+	// is only used when explicitly requested by version.
+	VersionIndexHidden = 0x8000
+)
+
+// The value of the Flags field in a version definition for the definition
+// naming the object itself.
+const VersionFlagBase = 1
+
+// Holds a single version defined by an ELF file, from a .gnu.version_d
+// section.
+type ELFVersionDefinition struct {
+	// The index used to refer to this version in the .gnu.version section.
+	Index uint16
+	Flags uint16
+	Hash  uint32
+	// The name of the version, e.g. "GLIBC_2.4".
+	Name string
+	// The names of the versions this version inherits from, if any.
+	Parents []string
+}
+
+func (d *ELFVersionDefinition) String() string {
+	if len(d.Parents) == 0 {
+		return fmt.Sprintf("Version %d: %s", d.Index, d.Name)
+	}
+	return fmt.Sprintf("Version %d: %s (parents: %v)", d.Index, d.Name,
+		d.Parents)
+}
+
+// Holds a single version of a library required by an ELF file.
+type ELFVersionNeeded struct {
+	// The index used to refer to this version in the .gnu.version section.
+	Index uint16
+	Flags uint16
+	Hash  uint32
+	Name  string
+}
+
+// Holds the list of versions required from a single library, from a
+// .gnu.version_r section.
+type ELFVersionRequirement struct {
+	// The name of the library, e.g. "libc.so.6".
+	File     string
+	Versions []ELFVersionNeeded
+}
+
+func (r *ELFVersionRequirement) String() string {
+	names := make([]string, len(r.Versions))
+	for i, v := range r.Versions {
+		names[i] = v.Name
+	}
+	return fmt.Sprintf("%s: %v", r.File, names)
+}
+
+// Returns the index of the first section with the given type, or 0 if no
+// such section exists.
+func findSectionByType(f ELFFile, t SectionHeaderType) uint16 {
+	for i := uint16(1); i < f.GetSectionCount(); i++ {
+		header, e := f.GetSectionHeader(i)
+		if e != nil {
+			continue
+		}
+		if header.GetType() == t {
+			return i
+		}
+	}
+	return 0
+}
+
+// Decodes the structure at the given offset in the content into v. Returns
+// an error if the structure doesn't fit in the content.
+func readStructAt(content []byte, offset uint64, order binary.ByteOrder,
+	v interface{}) error {
+	size := uint64(binary.Size(v))
+	if (offset > uint64(len(content))) ||
+		(size > (uint64(len(content)) - offset)) {
+		return fmt.Errorf("%w: offset 0x%x is outside of the section",
+			ErrTruncated, offset)
+	}
+	return binary.Read(bytes.NewReader(content[offset:offset+size]), order, v)
+}
+
+// Parses and returns a chain of ELF32VersionNeedAux structures, with the first
+// structure starting at the given offset in a section's content. Requires the
+// number of version aux structures to expect.
+func parseVersionNeedAux(content []byte, firstOffset int64, count uint16,
+	order binary.ByteOrder) ([]ELF32VersionNeedAux, error) {
+	data := bytes.NewReader(content)
+	_, e := data.Seek(firstOffset, io.SeekStart)
+	if e != nil {
+		return nil, fmt.Errorf("Failed seeking first version aux: %w", e)
+	}
+	e = checkTableBounds(uint64(firstOffset), uint64(count),
+		uint64(binary.Size(&ELF32VersionNeedAux{})), uint64(len(content)))
+	if e != nil {
+		return nil, fmt.Errorf("Invalid aux structure count: %w", e)
+	}
+	toReturn := make([]ELF32VersionNeedAux, 0, count)
+	// Like the version requirements, we need to get these 1 at a time.
+	var current ELF32VersionNeedAux
+	var startOffset int64
+	for count > 0 {
+		startOffset, e = data.Seek(0, io.SeekCurrent)
+		if e != nil {
+			return nil, fmt.Errorf("Failed getting current offset: %w", e)
+		}
+		e = binary.Read(data, order, &current)
+		if e != nil {
+			return nil, fmt.Errorf("Failed parsing req. aux struct: %w",
+				readError(e))
+		}
+		toReturn = append(toReturn, current)
+		count--
+		// A zero Next offset ends the chain, even if fewer structures were
+		// read than expected. Continuing would re-read the same structure.
+		if current.Next == 0 {
+			break
+		}
+		_, e = data.Seek(startOffset+int64(current.Next), io.SeekStart)
+		if e != nil {
+			return nil, fmt.Errorf("Failed seeking to next aux struct: %w", e)
+		}
+	}
+	return toReturn, nil
+}
+
+// Parses the .gnu.version_r section with the given index, which is expected
+// to contain the given number of entries. Used by both
+// ELF32File.ParseVersionRequirementSection and GetVersionRequirements, which
+// get the number of entries from different places.
+func parseVersionRequirementSection(f ELFFile, sectionIndex uint16,
+	entryCount uint32) ([]ELF32VersionNeed, [][]ELF32VersionNeedAux, error) {
+	content, e := f.GetSectionContent(sectionIndex)
+	if e != nil {
+		return nil, nil, fmt.Errorf(
+			"Failed reading version requirement section: %w", e)
+	}
+	if entryCount == 0 {
+		return nil, nil, nil
+	}
+	// Each entry needs space in the section, so a larger count can't be
+	// valid.
+	e = checkTableBounds(0, uint64(entryCount),
+		uint64(binary.Size(&ELF32VersionNeed{})), uint64(len(content)))
+	if e != nil {
+		return nil, nil, sectionError(f, sectionIndex,
+			"version requirement table", 0, fmt.Errorf("Invalid number of "+
+				"version requirements: %w", e))
+	}
+	data := bytes.NewReader(content)
+	order := fileEndianness(f)
+	toReturn := make([]ELF32VersionNeed, 0, entryCount)
+	auxData := make([][]ELF32VersionNeedAux, 0, entryCount)
+	// Unlike other ELF structures, we need to read these version entries one
+	// at a time--they may not be directly adjacent.
+	var current ELF32VersionNeed
+	var currentAux []ELF32VersionNeedAux
+	var startOffset int64
+	var totalRead uint32
+	for {
+		startOffset, e = data.Seek(0, io.SeekCurrent)
+		if e != nil {
+			return nil, nil, fmt.Errorf("Failed getting current offset: %w", e)
+		}
+		e = binary.Read(data, order, &current)
+		if e != nil {
+			return nil, nil, sectionError(f, sectionIndex,
+				"version requirement", uint64(startOffset), readError(e))
+		}
+		toReturn = append(toReturn, current)
+		currentAux, e = parseVersionNeedAux(content, startOffset+
+			int64(current.AuxOffset), current.Count, order)
+		if e != nil {
+			return nil, nil, sectionError(f, sectionIndex,
+				"version requirement aux data", uint64(startOffset)+
+					uint64(current.AuxOffset), e)
+		}
+		auxData = append(auxData, currentAux)
+		totalRead++
+		if (totalRead >= entryCount) || (current.Next == 0) {
+			break
+		}
+		// The Next field contains an offset relative to the start of the
+		// version need structure.
+		_, e = data.Seek(startOffset+int64(current.Next), io.SeekStart)
+		if e != nil {
+			return nil, nil, fmt.Errorf(
+				"Failed seeking to next requirement: %w", e)
+		}
+	}
+	return toReturn, auxData, nil
+}
+
+// Parses and returns a chain of ELF32VersionDefAux structures, with the first
+// structure starting at the given offset in a section's content. Requires the
+// number of definition aux structures to expect.
+func parseVersionDefAux(content []byte, firstOffset int64, count uint16,
+	order binary.ByteOrder) ([]ELF32VersionDefAux, error) {
+	data := bytes.NewReader(content)
+	_, e := data.Seek(firstOffset, io.SeekStart)
+	if e != nil {
+		return nil, fmt.Errorf("Failed seeking first version aux: %w", e)
+	}
+	e = checkTableBounds(uint64(firstOffset), uint64(count),
+		uint64(binary.Size(&ELF32VersionDefAux{})), uint64(len(content)))
+	if e != nil {
+		return nil, fmt.Errorf("Invalid aux structure count: %w", e)
+	}
+	toReturn := make([]ELF32VersionDefAux, 0, count)
+	// Like the version definitions, we need to get these 1 at a time.
+	var current ELF32VersionDefAux
+	var startOffset int64
+	for count > 0 {
+		startOffset, e = data.Seek(0, io.SeekCurrent)
+		if e != nil {
+			return nil, fmt.Errorf("Failed getting current offset: %w", e)
+		}
+		e = binary.Read(data, order, &current)
+		if e != nil {
+			return nil, fmt.Errorf("Failed parsing defn. aux struct: %w",
+				readError(e))
+		}
+		toReturn = append(toReturn, current)
+		count--
+		// A zero Next offset ends the chain, even if fewer structures were
+		// read than expected. Continuing would re-read the same structure.
+		if current.Next == 0 {
+			break
+		}
+		_, e = data.Seek(startOffset+int64(current.Next), io.SeekStart)
+		if e != nil {
+			return nil, fmt.Errorf("Failed seeking to next aux struct: %w", e)
+		}
+	}
+	return toReturn, nil
+}
+
+// Parses the .gnu.version_d section with the given index, which is expected
+// to contain the given number of entries. Behaves like
+// parseVersionRequirementSection.
+func parseVersionDefinitionSection(f ELFFile, sectionIndex uint16,
+	entryCount uint32) ([]ELF32VersionDef, [][]ELF32VersionDefAux, error) {
+	content, e := f.GetSectionContent(sectionIndex)
+	if e != nil {
+		return nil, nil, fmt.Errorf(
+			"Failed reading version definition section: %w", e)
+	}
+	if entryCount == 0 {
+		return nil, nil, nil
+	}
+	// Each entry needs space in the section, so a larger count can't be
+	// valid.
+	e = checkTableBounds(0, uint64(entryCount),
+		uint64(binary.Size(&ELF32VersionDef{})), uint64(len(content)))
+	if e != nil {
+		return nil, nil, sectionError(f, sectionIndex,
+			"version definition table", 0, fmt.Errorf("Invalid number of "+
+				"version definitions: %w", e))
+	}
+	data := bytes.NewReader(content)
+	order := fileEndianness(f)
+	toReturn := make([]ELF32VersionDef, 0, entryCount)
+	auxData := make([][]ELF32VersionDefAux, 0, entryCount)
+	// Like with version requirements, we need to read these entires one at a
+	// time.
+	var current ELF32VersionDef
+	var currentAux []ELF32VersionDefAux
+	var startOffset int64
+	var totalRead uint32
+	for {
+		startOffset, e = data.Seek(0, io.SeekCurrent)
+		if e != nil {
+			return nil, nil, fmt.Errorf("Failed getting current offset: %w", e)
+		}
+		e = binary.Read(data, order, &current)
+		if e != nil {
+			return nil, nil, sectionError(f, sectionIndex, "version definition",
+				uint64(startOffset), readError(e))
+		}
+		toReturn = append(toReturn, current)
+		currentAux, e = parseVersionDefAux(content, startOffset+
+			int64(current.AuxOffset), current.Count, order)
+		if e != nil {
+			return nil, nil, sectionError(f, sectionIndex,
+				"version definition aux data", uint64(startOffset)+
+					uint64(current.AuxOffset), e)
+		}
+		auxData = append(auxData, currentAux)
+		totalRead++
+		if (totalRead >= entryCount) || (current.Next == 0) {
+			break
+		}
+		// The Next field contains an offset relative to the start of the
+		// version definition structure.
+		_, e = data.Seek(startOffset+int64(current.Next), io.SeekStart)
+		if e != nil {
+			return nil, nil, fmt.Errorf(
+				"Failed seeking to next definition: %w", e)
+		}
+	}
+	return toReturn, auxData, nil
+}
+
+// Returns the string table linked to the given version section, and the
+// number of entries in the section, from its Info field.
+func versionSectionStrings(f ELFFile, index uint16) ([]byte, uint32, error) {
+	header, e := f.GetSectionHeader(index)
+	if e != nil {
+		return nil, 0, e
+	}
+	stringTable, e := f.GetSectionContent(uint16(header.GetLinkedIndex()))
+	if e != nil {
+		return nil, 0, fmt.Errorf("Failed reading version section "+
+			"strings: %w", e)
+	}
+	return stringTable, header.GetInfo(), nil
+}
+
+// Returns the versions defined in the file's .gnu.version_d section. Returns
+// nil and no error if the file doesn't define any versions.
+func GetVersionDefinitions(f ELFFile) ([]ELFVersionDefinition, error) {
+	index := findSectionByType(f, GNUVersionDefinitionSection)
+	if index == 0 {
+		return nil, nil
+	}
+	stringTable, count, e := versionSectionStrings(f, index)
+	if e != nil {
+		return nil, e
+	}
+	definitions, auxData, e := parseVersionDefinitionSection(f, index, count)
+	if e != nil {
+		return nil, e
+	}
+	toReturn := make([]ELFVersionDefinition, len(definitions))
+	for i, d := range definitions {
+		current := &(toReturn[i])
+		current.Index = d.Index
+		current.Flags = d.Flags
+		current.Hash = d.Hash
+		for j, aux := range auxData[i] {
+			name, e := ReadStringAtOffset(aux.Name, stringTable)
+			if e != nil {
+				return nil, fmt.Errorf("Failed reading version name: %w", e)
+			}
+			if j == 0 {
+				current.Name = string(name)
+			} else {
+				current.Parents = append(current.Parents, string(name))
+			}
+		}
+	}
+	return toReturn, nil
+}
+
+// Returns the library versions required by the file, from its .gnu.version_r
+// section. Returns nil and no error if the file doesn't require any
+// versions.
+func GetVersionRequirements(f ELFFile) ([]ELFVersionRequirement, error) {
+	index := findSectionByType(f, GNUVersionRequirementSection)
+	if index == 0 {
+		return nil, nil
+	}
+	stringTable, count, e := versionSectionStrings(f, index)
+	if e != nil {
+		return nil, e
+	}
+	needs, auxData, e := parseVersionRequirementSection(f, index, count)
+	if e != nil {
+		return nil, e
+	}
+	toReturn := make([]ELFVersionRequirement, len(needs))
+	for i, need := range needs {
+		file, e := ReadStringAtOffset(need.File, stringTable)
+		if e != nil {
+			return nil, fmt.Errorf("Failed reading required file name: %w", e)
+		}
+		current := &(toReturn[i])
+		current.File = string(file)
+		for _, aux := range auxData[i] {
+			name, e := ReadStringAtOffset(aux.Name, stringTable)
+			if e != nil {
+				return nil, fmt.Errorf("Failed reading version name: %w", e)
+			}
+			current.Versions = append(current.Versions, ELFVersionNeeded{
+				Index: aux.Other,
+				Flags: aux.Flags,
+				Hash:  aux.Hash,
+				Name:  string(name),
+			})
+		}
+	}
+	return toReturn, nil
+}
+
+// Returns the version index of each symbol in the dynamic symbol table, from
+// the file's .gnu.version section. Returns nil and no error if the file
+// doesn't have a .gnu.version section.
+func GetSymbolVersionIndices(f ELFFile) ([]uint16, error) {
+	index := findSectionByType(f, GNUVersionSymbolSection)
+	if index == 0 {
+		return nil, nil
+	}
+	content, e := f.GetSectionContent(index)
+	if e != nil {
+		return nil, fmt.Errorf("Failed reading symbol versions: %w", e)
+	}
+	toReturn := make([]uint16, len(content)/2)
+	order := fileEndianness(f)
+	for i := range toReturn {
+		toReturn[i] = order.Uint16(content[i*2:])
+	}
+	return toReturn, nil
+}
+
+// Returns a map of version indices to the names of versions, for all
+// versions either defined or required by the file.
+func GetVersionNames(f ELFFile) (map[uint16]string, error) {
+	definitions, e := GetVersionDefinitions(f)
+	if e != nil {
+		return nil, e
+	}
+	requirements, e := GetVersionRequirements(f)
+	if e != nil {
+		return nil, e
+	}
+	toReturn := make(map[uint16]string)
+	for _, d := range definitions {
+		toReturn[d.Index] = d.Name
+	}
+	for _, r := range requirements {
+		for _, v := range r.Versions {
+			toReturn[v.Index] = v.Name
+		}
+	}
+	return toReturn, nil
+}
@@ -0,0 +1,59 @@
+package elf_reader
+
+import (
+	"testing"
+)
+
+func TestGetVersionDefinitions(t *testing.T) {
+	f := parseTestELF32("test_data/ld-linux_arm32.so", t)
+	definitions, e := GetVersionDefinitions(f)
+	if e != nil {
+		t.Fatalf("Failed getting version definitions: %s\n", e)
+	}
+	names := make(map[string]bool)
+	for i := range definitions {
+		t.Logf("%s\n", &(definitions[i]))
+		names[definitions[i].Name] = true
+	}
+	if !names["ld-linux-armhf.so.3"] || !names["GLIBC_2.4"] ||
+		!names["GLIBC_PRIVATE"] {
+		t.Errorf("Missing expected version definitions\n")
+	}
+	if (definitions[0].Flags & VersionFlagBase) == 0 {
+		t.Errorf("The first definition wasn't the base version\n")
+	}
+}
+
+func TestGetVersionRequirements(t *testing.T) {
+	f := parseTestELF64("test_data/sleep_amd64", t)
+	requirements, e := GetVersionRequirements(f)
+	if e != nil {
+		t.Fatalf("Failed getting version requirements: %s\n", e)
+	}
+	if len(requirements) != 1 {
+		t.Fatalf("Expected 1 required library, got %d\n", len(requirements))
+	}
+	r := &(requirements[0])
+	t.Logf("%s\n", r)
+	if (r.File != "libc.so.6") || (len(r.Versions) != 1) ||
+		(r.Versions[0].Name != "GLIBC_2.2.5") {
+		t.Errorf("Incorrect version requirements: %s\n", r)
+	}
+	indices, e := GetSymbolVersionIndices(f)
+	if e != nil {
+		t.Fatalf("Failed getting symbol version indices: %s\n", e)
+	}
+	names, e := GetVersionNames(f)
+	if e != nil {
+		t.Fatalf("Failed getting version names: %s\n", e)
+	}
+	found := false
+	for _, index := range indices {
+		if names[index&0x7fff] == "GLIBC_2.2.5" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("No symbols referred to GLIBC_2.2.5\n")
+	}
+}
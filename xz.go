@@ -0,0 +1,943 @@
+package elf_reader
+
+// This file contains a decoder for the xz compression format, which is used
+// by .deb and .rpm packages and .gnu_debugdata sections, but isn't supported
+// by Go's standard library. Only the LZMA2 filter is supported, which is the
+// only filter used by default.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+// The magic bytes at the start of an xz stream.
+const XZMagic = "\xfd7zXZ\x00"
+
+// The ID of the LZMA2 filter in an xz block header.
+const xzFilterLZMA2 = 0x21
+
+// Values of the check type in an xz stream's flags.
+const (
+	xzCheckNone   = 0
+	xzCheckCRC32  = 1
+	xzCheckCRC64  = 4
+	xzCheckSHA256 = 10
+)
+
+var xzCRC64Table = crc64.MakeTable(crc64.ECMA)
+
+// Returns the size of the check for the given check type.
+func xzCheckSize(checkType byte) int {
+	switch checkType {
+	case xzCheckNone:
+		return 0
+	case xzCheckCRC32:
+		return 4
+	case xzCheckCRC64:
+		return 8
+	case xzCheckSHA256:
+		return 32
+	}
+	// Unsupported check types have sizes defined by the spec, so they can
+	// be skipped.
+	return 4 << ((checkType - 1) / 3)
+}
+
+// Returns a new hash for the given check type, or nil if it isn't
+// supported.
+func newXZCheck(checkType byte) hash.Hash {
+	switch checkType {
+	case xzCheckCRC32:
+		return crc32.NewIEEE()
+	case xzCheckCRC64:
+		return crc64.New(xzCRC64Table)
+	case xzCheckSHA256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// The number of states in the LZMA state machine.
+const lzmaStateCount = 12
+
+// Decodes the range-coded bits in an LZMA chunk.
+type lzmaRangeDecoder struct {
+	data   []byte
+	offset int
+	rangeV uint32
+	code   uint32
+}
+
+func (r *lzmaRangeDecoder) init(data []byte) error {
+	if (len(data) < 5) || (data[0] != 0) {
+		return fmt.Errorf("Invalid LZMA range coder data")
+	}
+	r.data = data
+	r.offset = 5
+	r.rangeV = 0xffffffff
+	r.code = binary.BigEndian.Uint32(data[1:])
+	return nil
+}
+
+// Reading past the end of the data returns zeros, which will cause corrupt
+// data to be detected by the chunk's size checks rather than panicking.
+func (r *lzmaRangeDecoder) nextByte() uint32 {
+	if r.offset >= len(r.data) {
+		r.offset++
+		return 0
+	}
+	toReturn := r.data[r.offset]
+	r.offset++
+	return uint32(toReturn)
+}
+
+func (r *lzmaRangeDecoder) normalize() {
+	if r.rangeV < (1 << 24) {
+		r.rangeV <<= 8
+		r.code = (r.code << 8) | r.nextByte()
+	}
+}
+
+func (r *lzmaRangeDecoder) decodeBit(probability *uint16) uint32 {
+	bound := (r.rangeV >> 11) * uint32(*probability)
+	var toReturn uint32
+	if r.code < bound {
+		r.rangeV = bound
+		*probability += (2048 - *probability) >> 5
+	} else {
+		r.rangeV -= bound
+		r.code -= bound
+		*probability -= *probability >> 5
+		toReturn = 1
+	}
+	r.normalize()
+	return toReturn
+}
+
+func (r *lzmaRangeDecoder) decodeDirectBits(count uint32) uint32 {
+	var toReturn uint32
+	for ; count > 0; count-- {
+		r.rangeV >>= 1
+		r.code -= r.rangeV
+		t := 0 - (r.code >> 31)
+		r.code += r.rangeV & t
+		r.normalize()
+		toReturn = (toReturn << 1) + (t + 1)
+	}
+	return toReturn
+}
+
+// Decodes a symbol with the given number of bits, most significant bit
+// first, using the probabilities at indices 1 through (1 << bits) - 1.
+func (r *lzmaRangeDecoder) decodeBitTree(probabilities []uint16,
+	bits uint32) uint32 {
+	m := uint32(1)
+	for i := uint32(0); i < bits; i++ {
+		m = (m << 1) + r.decodeBit(&probabilities[m])
+	}
+	return m - (1 << bits)
+}
+
+// Like decodeBitTree, but least significant bit first.
+func (r *lzmaRangeDecoder) decodeReverseBitTree(probabilities []uint16,
+	bits uint32) uint32 {
+	m := uint32(1)
+	var toReturn uint32
+	for i := uint32(0); i < bits; i++ {
+		bit := r.decodeBit(&probabilities[m])
+		m = (m << 1) + bit
+		toReturn |= bit << i
+	}
+	return toReturn
+}
+
+func resetProbabilities(probabilities []uint16) {
+	for i := range probabilities {
+		probabilities[i] = 1024
+	}
+}
+
+// Decodes match lengths in LZMA data.
+type lzmaLengthDecoder struct {
+	choice  uint16
+	choice2 uint16
+	low     [16][8]uint16
+	mid     [16][8]uint16
+	high    [256]uint16
+}
+
+func (d *lzmaLengthDecoder) reset() {
+	d.choice = 1024
+	d.choice2 = 1024
+	for i := range d.low {
+		resetProbabilities(d.low[i][:])
+		resetProbabilities(d.mid[i][:])
+	}
+	resetProbabilities(d.high[:])
+}
+
+// Returns the match length minus the minimum length of 2.
+func (d *lzmaLengthDecoder) decode(r *lzmaRangeDecoder,
+	posState uint32) uint32 {
+	if r.decodeBit(&d.choice) == 0 {
+		return r.decodeBitTree(d.low[posState][:], 3)
+	}
+	if r.decodeBit(&d.choice2) == 0 {
+		return 8 + r.decodeBitTree(d.mid[posState][:], 3)
+	}
+	return 16 + r.decodeBitTree(d.high[:], 8)
+}
+
+// Holds the most recently decoded data, which matches refer back to. This
+// grows as needed up to the dictionary size, and is then used as a circular
+// buffer.
+type lzmaWindow struct {
+	buffer []byte
+	size   int
+	// The position the next byte will be written to.
+	position int
+	// The number of bytes written since the dictionary was last reset.
+	total uint64
+}
+
+func (w *lzmaWindow) reset() {
+	w.buffer = w.buffer[:0]
+	w.position = 0
+	w.total = 0
+}
+
+func (w *lzmaWindow) put(b byte) {
+	if len(w.buffer) < w.size {
+		w.buffer = append(w.buffer, b)
+		w.position = len(w.buffer)
+	} else {
+		w.buffer[w.position] = b
+		w.position++
+	}
+	if w.position == w.size {
+		w.position = 0
+	}
+	w.total++
+}
+
+// Returns the byte the given distance back, where 1 is the most recently
+// written byte. The distance must already have been checked.
+func (w *lzmaWindow) get(distance uint32) byte {
+	i := w.position - int(distance)
+	if i < 0 {
+		i += len(w.buffer)
+	}
+	return w.buffer[i]
+}
+
+// Returns true if the given distance refers to a byte in the window.
+func (w *lzmaWindow) validDistance(distance uint32) bool {
+	return (distance > 0) && (uint64(distance) <= w.total) &&
+		(int(distance) <= len(w.buffer))
+}
+
+// Holds the state of an LZMA decoder, which persists between LZMA2 chunks
+// unless they reset it.
+type lzmaDecoder struct {
+	lc, lp, pb uint32
+	state      uint32
+	reps       [4]uint32
+	literals   []uint16
+	isMatch    [lzmaStateCount << 4]uint16
+	isRep      [lzmaStateCount]uint16
+	isRepG0    [lzmaStateCount]uint16
+	isRepG1    [lzmaStateCount]uint16
+	isRepG2    [lzmaStateCount]uint16
+	isRep0Long [lzmaStateCount << 4]uint16
+	posSlot    [4][64]uint16
+	posSpecial [115]uint16
+	align      [16]uint16
+	length     lzmaLengthDecoder
+	repLength  lzmaLengthDecoder
+	window     lzmaWindow
+}
+
+// Sets the literal context bits, literal position bits and position bits
+// from an LZMA properties byte.
+func (d *lzmaDecoder) setProperties(properties byte) error {
+	if properties >= (9 * 5 * 5) {
+		return fmt.Errorf("Invalid LZMA properties: 0x%02x", properties)
+	}
+	d.lc = uint32(properties % 9)
+	properties /= 9
+	d.lp = uint32(properties % 5)
+	d.pb = uint32(properties / 5)
+	// LZMA2 requires lc + lp to be at most 4.
+	if (d.lc + d.lp) > 4 {
+		return fmt.Errorf("Invalid LZMA2 properties: lc + lp > 4")
+	}
+	d.literals = make([]uint16, 0x300<<(d.lc+d.lp))
+	return nil
+}
+
+func (d *lzmaDecoder) resetState() {
+	d.state = 0
+	d.reps = [4]uint32{}
+	resetProbabilities(d.literals)
+	resetProbabilities(d.isMatch[:])
+	resetProbabilities(d.isRep[:])
+	resetProbabilities(d.isRepG0[:])
+	resetProbabilities(d.isRepG1[:])
+	resetProbabilities(d.isRepG2[:])
+	resetProbabilities(d.isRep0Long[:])
+	for i := range d.posSlot {
+		resetProbabilities(d.posSlot[i][:])
+	}
+	resetProbabilities(d.posSpecial[:])
+	resetProbabilities(d.align[:])
+	d.length.reset()
+	d.repLength.reset()
+}
+
+func (d *lzmaDecoder) decodeLiteral(r *lzmaRangeDecoder) byte {
+	var previous uint32
+	if d.window.total > 0 {
+		previous = uint32(d.window.get(1))
+	}
+	litState := ((uint32(d.window.total) & ((1 << d.lp) - 1)) << d.lc) +
+		(previous >> (8 - d.lc))
+	probabilities := d.literals[0x300*litState:]
+	symbol := uint32(1)
+	if d.state >= 7 {
+		// The caller checks that the distance is valid in this state.
+		matchByte := uint32(d.window.get(d.reps[0] + 1))
+		for symbol < 0x100 {
+			matchBit := (matchByte >> 7) & 1
+			matchByte <<= 1
+			bit := r.decodeBit(&probabilities[((1+matchBit)<<8)+symbol])
+			symbol = (symbol << 1) | bit
+			if matchBit != bit {
+				break
+			}
+		}
+	}
+	for symbol < 0x100 {
+		symbol = (symbol << 1) | r.decodeBit(&probabilities[symbol])
+	}
+	return byte(symbol)
+}
+
+// Returns the distance of a match, minus 1.
+func (d *lzmaDecoder) decodeDistance(r *lzmaRangeDecoder,
+	length uint32) uint32 {
+	lengthState := length
+	if lengthState > 3 {
+		lengthState = 3
+	}
+	slot := r.decodeBitTree(d.posSlot[lengthState][:], 6)
+	if slot < 4 {
+		return slot
+	}
+	directBits := (slot >> 1) - 1
+	distance := (2 | (slot & 1)) << directBits
+	if slot < 14 {
+		return distance + r.decodeReverseBitTree(
+			d.posSpecial[distance-slot:], directBits)
+	}
+	distance += r.decodeDirectBits(directBits-4) << 4
+	return distance + r.decodeReverseBitTree(d.align[:], 4)
+}
+
+// Decodes an LZMA chunk containing the given number of uncompressed bytes,
+// appending them to the output.
+func (d *lzmaDecoder) decodeChunk(compressed []byte, size int,
+	output []byte) ([]byte, error) {
+	var r lzmaRangeDecoder
+	e := r.init(compressed)
+	if e != nil {
+		return nil, e
+	}
+	w := &(d.window)
+	posMask := uint32(1<<d.pb) - 1
+	end := len(output) + size
+	for len(output) < end {
+		posState := uint32(w.total) & posMask
+		if r.decodeBit(&d.isMatch[(d.state<<4)+posState]) == 0 {
+			if (d.state >= 7) && !w.validDistance(d.reps[0]+1) {
+				return nil, fmt.Errorf("Invalid LZMA match distance")
+			}
+			b := d.decodeLiteral(&r)
+			w.put(b)
+			output = append(output, b)
+			if d.state < 4 {
+				d.state = 0
+			} else if d.state < 10 {
+				d.state -= 3
+			} else {
+				d.state -= 6
+			}
+			continue
+		}
+		var length uint32
+		if r.decodeBit(&d.isRep[d.state]) == 0 {
+			// A match with a new distance.
+			d.reps[3], d.reps[2], d.reps[1] = d.reps[2], d.reps[1], d.reps[0]
+			length = d.length.decode(&r, posState)
+			if d.state < 7 {
+				d.state = 7
+			} else {
+				d.state = 10
+			}
+			d.reps[0] = d.decodeDistance(&r, length)
+			if d.reps[0] == 0xffffffff {
+				return nil, fmt.Errorf("Unexpected LZMA end marker")
+			}
+		} else {
+			// A match reusing a recent distance.
+			if r.decodeBit(&d.isRepG0[d.state]) == 0 {
+				if r.decodeBit(&d.isRep0Long[(d.state<<4)+posState]) == 0 {
+					// A single byte at the most recent distance.
+					if !w.validDistance(d.reps[0] + 1) {
+						return nil, fmt.Errorf("Invalid LZMA match distance")
+					}
+					if d.state < 7 {
+						d.state = 9
+					} else {
+						d.state = 11
+					}
+					b := w.get(d.reps[0] + 1)
+					w.put(b)
+					output = append(output, b)
+					continue
+				}
+			} else {
+				var distance uint32
+				if r.decodeBit(&d.isRepG1[d.state]) == 0 {
+					distance = d.reps[1]
+				} else {
+					if r.decodeBit(&d.isRepG2[d.state]) == 0 {
+						distance = d.reps[2]
+					} else {
+						distance = d.reps[3]
+						d.reps[3] = d.reps[2]
+					}
+					d.reps[2] = d.reps[1]
+				}
+				d.reps[1] = d.reps[0]
+				d.reps[0] = distance
+			}
+			length = d.repLength.decode(&r, posState)
+			if d.state < 7 {
+				d.state = 8
+			} else {
+				d.state = 11
+			}
+		}
+		distance := d.reps[0] + 1
+		if !w.validDistance(distance) {
+			return nil, fmt.Errorf("Invalid LZMA match distance: %d", distance)
+		}
+		length += 2
+		if (len(output) + int(length)) > end {
+			return nil, fmt.Errorf("LZMA match extends past the end of the " +
+				"chunk")
+		}
+		for ; length > 0; length-- {
+			b := w.get(distance)
+			w.put(b)
+			output = append(output, b)
+		}
+	}
+	if r.offset != len(compressed) {
+		return nil, fmt.Errorf("LZMA chunk size mismatch: used %d of %d "+
+			"bytes", r.offset, len(compressed))
+	}
+	return output, nil
+}
+
+// Reads the decompressed data from a raw LZMA2 stream.
+type lzma2Reader struct {
+	input   io.Reader
+	decoder lzmaDecoder
+	// Decompressed data that hasn't been read yet.
+	pending []byte
+	// Buffers reused between chunks.
+	output     []byte
+	compressed []byte
+	// Set once a chunk with new properties has been seen.
+	haveProperties bool
+	// Set once the dictionary has been reset at least once.
+	dictionaryReset bool
+	done            bool
+}
+
+// The largest LZMA2 dictionary size supported. The window grows as data is
+// decompressed, up to the dictionary size, so this limits the memory used by
+// hostile streams. It's larger than the dictionary used by any xz preset.
+const maxLZMA2DictionarySize = 1 << 30
+
+// Returns the dictionary size encoded in an LZMA2 filter properties byte.
+// Returns an error if it's invalid or larger than maxLZMA2DictionarySize.
+func lzma2DictionarySize(properties byte) (int, error) {
+	if properties > 40 {
+		return 0, fmt.Errorf("Invalid LZMA2 dictionary size: %d", properties)
+	}
+	size := uint64(0xffffffff)
+	if properties < 40 {
+		size = uint64(2|(properties&1)) << (properties/2 + 11)
+	}
+	if size > maxLZMA2DictionarySize {
+		return 0, fmt.Errorf("Unsupported LZMA2 dictionary size: %d bytes",
+			size)
+	}
+	return int(size), nil
+}
+
+// Returns a reader for decompressing a raw LZMA2 stream, as stored in an xz
+// block, using the given dictionary size.
+func newLZMA2Reader(input io.Reader, dictionarySize int) *lzma2Reader {
+	toReturn := &lzma2Reader{input: input}
+	toReturn.decoder.window.size = dictionarySize
+	return toReturn
+}
+
+// Decodes the next chunk into r.pending. Sets r.done at the end of the
+// stream.
+func (r *lzma2Reader) nextChunk() error {
+	var control [1]byte
+	_, e := io.ReadFull(r.input, control[:])
+	if e != nil {
+		return fmt.Errorf("Failed reading LZMA2 chunk: %w", e)
+	}
+	c := control[0]
+	if c == 0 {
+		r.done = true
+		return nil
+	}
+	if (c == 1) || (c == 2) {
+		// An uncompressed chunk, with a dictionary reset if c is 1.
+		var sizeBytes [2]byte
+		_, e = io.ReadFull(r.input, sizeBytes[:])
+		if e != nil {
+			return fmt.Errorf("Failed reading LZMA2 chunk size: %w", e)
+		}
+		if c == 1 {
+			r.decoder.window.reset()
+			r.dictionaryReset = true
+		} else if !r.dictionaryReset {
+			return fmt.Errorf("The first LZMA2 chunk doesn't reset the " +
+				"dictionary")
+		}
+		size := int(binary.BigEndian.Uint16(sizeBytes[:])) + 1
+		r.output = append(r.output[:0], make([]byte, size)...)
+		_, e = io.ReadFull(r.input, r.output)
+		if e != nil {
+			return fmt.Errorf("Failed reading uncompressed LZMA2 chunk: %w", e)
+		}
+		for _, b := range r.output {
+			r.decoder.window.put(b)
+		}
+		r.pending = r.output
+		return nil
+	}
+	if c < 0x80 {
+		return fmt.Errorf("Invalid LZMA2 control byte: 0x%02x", c)
+	}
+	var header [4]byte
+	_, e = io.ReadFull(r.input, header[:])
+	if e != nil {
+		return fmt.Errorf("Failed reading LZMA2 chunk header: %w", e)
+	}
+	size := ((int(c&0x1f) << 16) | int(binary.BigEndian.Uint16(
+		header[:]))) + 1
+	compressedSize := int(binary.BigEndian.Uint16(header[2:])) + 1
+	reset := (c >> 5) & 3
+	if reset == 3 {
+		r.decoder.window.reset()
+		r.dictionaryReset = true
+	} else if !r.dictionaryReset {
+		return fmt.Errorf("The first LZMA2 chunk doesn't reset the " +
+			"dictionary")
+	}
+	if reset >= 2 {
+		var properties [1]byte
+		_, e = io.ReadFull(r.input, properties[:])
+		if e != nil {
+			return fmt.Errorf("Failed reading LZMA2 properties: %w", e)
+		}
+		e = r.decoder.setProperties(properties[0])
+		if e != nil {
+			return e
+		}
+		r.haveProperties = true
+	} else if !r.haveProperties {
+		return fmt.Errorf("LZMA2 chunk without properties")
+	}
+	if reset >= 1 {
+		r.decoder.resetState()
+	}
+	r.compressed = append(r.compressed[:0], make([]byte,
+		compressedSize)...)
+	_, e = io.ReadFull(r.input, r.compressed)
+	if e != nil {
+		return fmt.Errorf("Failed reading LZMA2 chunk data: %w", e)
+	}
+	r.output, e = r.decoder.decodeChunk(r.compressed, size, r.output[:0])
+	if e != nil {
+		return e
+	}
+	r.pending = r.output
+	return nil
+}
+
+func (r *lzma2Reader) Read(data []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		e := r.nextChunk()
+		if e != nil {
+			return 0, e
+		}
+	}
+	n := copy(data, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Reads a variable-length integer from an xz header or index.
+func readXZVarint(r io.ByteReader) (uint64, error) {
+	var toReturn uint64
+	for i := 0; i < 9; i++ {
+		b, e := r.ReadByte()
+		if e != nil {
+			return 0, e
+		}
+		toReturn |= uint64(b&0x7f) << (7 * i)
+		if (b & 0x80) == 0 {
+			if (i > 0) && (b == 0) {
+				return 0, fmt.Errorf("Invalid xz integer encoding")
+			}
+			return toReturn, nil
+		}
+	}
+	return 0, fmt.Errorf("xz integer is too long")
+}
+
+// Counts the bytes read from a reader.
+type countingReader struct {
+	r     *bufio.Reader
+	count uint64
+}
+
+func (c *countingReader) Read(data []byte) (int, error) {
+	n, e := c.r.Read(data)
+	c.count += uint64(n)
+	return n, e
+}
+
+// Decompresses an xz stream, which may consist of several concatenated
+// streams.
+type xzReader struct {
+	input     *bufio.Reader
+	checkType byte
+	check     hash.Hash
+	// The current block's decompressed data, or nil between blocks.
+	block io.Reader
+	// Counts the compressed bytes in the current block.
+	blockInput *countingReader
+	// The sizes recorded in the block header, or -1 if they weren't.
+	compressedSize   int64
+	uncompressedSize int64
+	uncompressedRead int64
+	// The number of blocks decoded in the current stream, for checking the
+	// index.
+	blockCount uint64
+	done       bool
+}
+
+// Reads and checks a stream header, setting the check type.
+func (r *xzReader) readStreamHeader() error {
+	var header [12]byte
+	_, e := io.ReadFull(r.input, header[:])
+	if e != nil {
+		return fmt.Errorf("Failed reading xz stream header: %w", e)
+	}
+	if string(header[:6]) != XZMagic {
+		return fmt.Errorf("Invalid xz stream header")
+	}
+	if binary.LittleEndian.Uint32(header[8:]) != crc32.ChecksumIEEE(
+		header[6:8]) {
+		return fmt.Errorf("Incorrect xz stream header CRC32")
+	}
+	if (header[6] != 0) || (header[7] > 0xf) {
+		return fmt.Errorf("Unsupported xz stream flags")
+	}
+	r.checkType = header[7]
+	r.blockCount = 0
+	return nil
+}
+
+// Reads the block header starting with the given size byte, and sets up
+// r.block to decompress the block.
+func (r *xzReader) startBlock(sizeByte byte) error {
+	headerSize := (int(sizeByte) + 1) * 4
+	header := make([]byte, headerSize)
+	header[0] = sizeByte
+	_, e := io.ReadFull(r.input, header[1:])
+	if e != nil {
+		return fmt.Errorf("Failed reading xz block header: %w", e)
+	}
+	crcOffset := headerSize - 4
+	if binary.LittleEndian.Uint32(header[crcOffset:]) !=
+		crc32.ChecksumIEEE(header[:crcOffset]) {
+		return fmt.Errorf("Incorrect xz block header CRC32")
+	}
+	flags := header[1]
+	if (flags & 0x3c) != 0 {
+		return fmt.Errorf("Unsupported xz block flags: 0x%02x", flags)
+	}
+	fields := bytes.NewReader(header[2:crcOffset])
+	r.compressedSize = -1
+	r.uncompressedSize = -1
+	if (flags & 0x40) != 0 {
+		size, e := readXZVarint(fields)
+		if e != nil {
+			return fmt.Errorf("Invalid xz compressed size: %w", e)
+		}
+		r.compressedSize = int64(size)
+	}
+	if (flags & 0x80) != 0 {
+		size, e := readXZVarint(fields)
+		if e != nil {
+			return fmt.Errorf("Invalid xz uncompressed size: %w", e)
+		}
+		r.uncompressedSize = int64(size)
+	}
+	filterCount := int(flags&3) + 1
+	var dictionarySize int
+	for i := 0; i < filterCount; i++ {
+		id, e := readXZVarint(fields)
+		if e != nil {
+			return fmt.Errorf("Invalid xz filter ID: %w", e)
+		}
+		propertiesSize, e := readXZVarint(fields)
+		if e != nil {
+			return fmt.Errorf("Invalid xz filter properties size: %w", e)
+		}
+		if propertiesSize > uint64(fields.Len()) {
+			return fmt.Errorf("Invalid xz filter properties size: %d",
+				propertiesSize)
+		}
+		properties := make([]byte, propertiesSize)
+		fields.Read(properties)
+		if (id != xzFilterLZMA2) || (filterCount != 1) {
+			return fmt.Errorf("Unsupported xz filter: 0x%x", id)
+		}
+		if len(properties) != 1 {
+			return fmt.Errorf("Invalid LZMA2 filter properties")
+		}
+		dictionarySize, e = lzma2DictionarySize(properties[0])
+		if e != nil {
+			return e
+		}
+	}
+	// The rest of the header must be padding.
+	for fields.Len() > 0 {
+		b, _ := fields.ReadByte()
+		if b != 0 {
+			return fmt.Errorf("Invalid xz block header padding")
+		}
+	}
+	r.blockInput = &countingReader{r: r.input}
+	r.block = newLZMA2Reader(r.blockInput, dictionarySize)
+	r.uncompressedRead = 0
+	r.check = newXZCheck(r.checkType)
+	r.blockCount++
+	return nil
+}
+
+// Checks the sizes, padding and check at the end of the current block.
+func (r *xzReader) finishBlock() error {
+	if (r.compressedSize >= 0) &&
+		(uint64(r.compressedSize) != r.blockInput.count) {
+		return fmt.Errorf("xz block compressed size mismatch")
+	}
+	if (r.uncompressedSize >= 0) &&
+		(r.uncompressedSize != r.uncompressedRead) {
+		return fmt.Errorf("xz block uncompressed size mismatch")
+	}
+	padding := (4 - (r.blockInput.count % 4)) % 4
+	for i := uint64(0); i < padding; i++ {
+		b, e := r.input.ReadByte()
+		if e != nil {
+			return fmt.Errorf("Failed reading xz block padding: %w", e)
+		}
+		if b != 0 {
+			return fmt.Errorf("Invalid xz block padding")
+		}
+	}
+	expected := make([]byte, xzCheckSize(r.checkType))
+	_, e := io.ReadFull(r.input, expected)
+	if e != nil {
+		return fmt.Errorf("Failed reading xz block check: %w", e)
+	}
+	if r.check != nil {
+		sum := r.check.Sum(nil)
+		// CRCs are stored in little-endian order.
+		if r.checkType != xzCheckSHA256 {
+			for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+				sum[i], sum[j] = sum[j], sum[i]
+			}
+		}
+		if !bytes.Equal(sum, expected) {
+			return fmt.Errorf("xz block check failed")
+		}
+	}
+	r.block = nil
+	return nil
+}
+
+// Reads the index and stream footer after the last block in a stream. The
+// index indicator byte must already have been read. The index is only checked
+// for its record count and CRC32, since the blocks have already been checked
+// individually.
+func (r *xzReader) finishStream() error {
+	crc := crc32.NewIEEE()
+	crc.Write([]byte{0})
+	// Includes the index indicator byte.
+	indexSize := uint64(1)
+	readByte := func() (byte, error) {
+		b, e := r.input.ReadByte()
+		if e != nil {
+			return 0, fmt.Errorf("Failed reading xz index: %w", e)
+		}
+		crc.Write([]byte{b})
+		indexSize++
+		return b, nil
+	}
+	readVarint := func() (uint64, error) {
+		var toReturn uint64
+		for i := 0; i < 9; i++ {
+			b, e := readByte()
+			if e != nil {
+				return 0, e
+			}
+			toReturn |= uint64(b&0x7f) << (7 * i)
+			if (b & 0x80) == 0 {
+				return toReturn, nil
+			}
+		}
+		return 0, fmt.Errorf("xz integer is too long")
+	}
+	count, e := readVarint()
+	if e != nil {
+		return e
+	}
+	if count != r.blockCount {
+		return fmt.Errorf("xz index has %d records, but the stream had %d "+
+			"blocks", count, r.blockCount)
+	}
+	for i := uint64(0); i < (count * 2); i++ {
+		_, e = readVarint()
+		if e != nil {
+			return e
+		}
+	}
+	for (indexSize % 4) != 0 {
+		b, e := readByte()
+		if e != nil {
+			return e
+		}
+		if b != 0 {
+			return fmt.Errorf("Invalid xz index padding")
+		}
+	}
+	// The index's CRC32 is followed by the 12-byte stream footer.
+	var footer [16]byte
+	_, e = io.ReadFull(r.input, footer[:])
+	if e != nil {
+		return fmt.Errorf("Failed reading xz stream footer: %w", e)
+	}
+	if binary.LittleEndian.Uint32(footer[:]) != crc.Sum32() {
+		return fmt.Errorf("Incorrect xz index CRC32")
+	}
+	if binary.LittleEndian.Uint32(footer[4:]) != crc32.ChecksumIEEE(
+		footer[8:14]) {
+		return fmt.Errorf("Incorrect xz stream footer CRC32")
+	}
+	if string(footer[14:]) != "YZ" {
+		return fmt.Errorf("Invalid xz stream footer")
+	}
+	if footer[13] != r.checkType {
+		return fmt.Errorf("xz stream footer flags don't match the header")
+	}
+	// Skip stream padding, and start the next stream if there is one.
+	for {
+		b, _ := r.input.Peek(4)
+		if len(b) == 0 {
+			r.done = true
+			return nil
+		}
+		if !bytes.Equal(b, []byte{0, 0, 0, 0}) {
+			break
+		}
+		r.input.Discard(4)
+	}
+	return r.readStreamHeader()
+}
+
+func (r *xzReader) Read(data []byte) (int, error) {
+	for {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.block == nil {
+			b, e := r.input.ReadByte()
+			if e != nil {
+				return 0, fmt.Errorf("Failed reading xz block: %w", e)
+			}
+			if b == 0 {
+				e = r.finishStream()
+			} else {
+				e = r.startBlock(b)
+			}
+			if e != nil {
+				return 0, e
+			}
+			continue
+		}
+		n, e := r.block.Read(data)
+		r.uncompressedRead += int64(n)
+		if r.check != nil {
+			r.check.Write(data[:n])
+		}
+		if e == io.EOF {
+			e = r.finishBlock()
+			if e != nil {
+				return n, e
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, e
+	}
+}
+
+// Returns a reader that decompresses the xz data from the given reader.
+// Only the LZMA2 filter is supported, without any other filters such as the
+// BCJ filters for executable code. CRC32, CRC64 and SHA-256 checks are
+// verified, and concatenated streams are decompressed in sequence. Returns
+// an error if the data doesn't start with a valid xz stream header.
+func NewXZReader(input io.Reader) (io.Reader, error) {
+	toReturn := &xzReader{input: bufio.NewReader(input)}
+	e := toReturn.readStreamHeader()
+	if e != nil {
+		return nil, e
+	}
+	return toReturn, nil
+}
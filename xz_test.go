@@ -0,0 +1,93 @@
+package elf_reader
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestXZReader(t *testing.T) {
+	// The sleep file uses CRC32 checks. The ld-linux file uses SHA-256
+	// checks, multiple blocks, a small dictionary and non-default lc, lp and
+	// pb properties.
+	testFiles := []string{"sleep_amd64", "ld-linux_arm32.so"}
+	for _, name := range testFiles {
+		original := fileBytes("test_data/"+name, t)
+		compressed := fileBytes("test_data/"+name+".xz", t)
+		r, e := NewXZReader(bytes.NewReader(compressed))
+		if e != nil {
+			t.Errorf("Failed opening %s.xz: %s\n", name, e)
+			continue
+		}
+		decompressed, e := io.ReadAll(r)
+		if e != nil {
+			t.Errorf("Failed decompressing %s.xz: %s\n", name, e)
+			continue
+		}
+		if !bytes.Equal(decompressed, original) {
+			t.Errorf("Decompressed %s.xz doesn't match the original\n", name)
+		}
+	}
+
+	// Concatenated streams should be decompressed one after the other.
+	compressed := fileBytes("test_data/sleep_amd64.xz", t)
+	concatenated := append(append([]byte{}, compressed...), compressed...)
+	r, e := NewXZReader(bytes.NewReader(concatenated))
+	if e != nil {
+		t.Fatalf("Failed opening concatenated streams: %s\n", e)
+	}
+	decompressed, e := io.ReadAll(r)
+	if e != nil {
+		t.Fatalf("Failed decompressing concatenated streams: %s\n", e)
+	}
+	original := fileBytes("test_data/sleep_amd64", t)
+	if !bytes.Equal(decompressed, append(original, original...)) {
+		t.Errorf("Concatenated streams weren't decompressed correctly\n")
+	}
+
+	// A corrupted byte should be detected by the checks.
+	corrupted := append([]byte{}, compressed...)
+	corrupted[len(corrupted)/2] ^= 0x40
+	r, e = NewXZReader(bytes.NewReader(corrupted))
+	if e == nil {
+		_, e = io.ReadAll(r)
+	}
+	if e == nil {
+		t.Errorf("Didn't get an error for corrupted xz data\n")
+	} else {
+		t.Logf("Got expected error for corrupted xz data: %s\n", e)
+	}
+}
+
+func TestLZMA2DictionarySize(t *testing.T) {
+	expected := map[byte]int{
+		0:  4096,
+		1:  6144,
+		18: 2 << 20,
+		36: 1 << 30,
+	}
+	for properties, size := range expected {
+		n, e := lzma2DictionarySize(properties)
+		if e != nil {
+			t.Errorf("Failed getting dictionary size for %d: %s\n",
+				properties, e)
+			continue
+		}
+		if n != size {
+			t.Errorf("Expected dictionary size %d for %d, got %d\n", size,
+				properties, n)
+		}
+	}
+	// Sizes over 1 GiB, including those that don't fit in a 32-bit int,
+	// must be rejected.
+	for _, properties := range []byte{37, 38, 39, 40, 41} {
+		_, e := lzma2DictionarySize(properties)
+		if e == nil {
+			t.Errorf("Didn't get an error for dictionary size %d\n",
+				properties)
+			continue
+		}
+		t.Logf("Got expected error for dictionary size %d: %s\n", properties,
+			e)
+	}
+}